@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/spf13/cobra"
+)
+
+// defaultBenchPrompt は、bench で既定として送信する短いプロンプトです。
+const defaultBenchPrompt = "Go言語の特徴を一文で説明してください。"
+
+// 'bench' サブコマンド固有のフラグ変数を定義
+var (
+	benchIterations  int
+	benchConcurrency int
+	benchPrompt      string
+)
+
+// benchResult は、bench の計測結果です。
+type benchResult struct {
+	latencies   []time.Duration // 成功したリクエストのレイテンシ
+	failures    int
+	totalTokens int64
+	elapsed     time.Duration
+	firstErr    error
+}
+
+// NewBenchCmd は 'bench' コマンドを構築します。
+func NewBenchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "固定のプロンプトを繰り返し送信し、レイテンシや成功率を計測します。",
+		Long: `このコマンドは、--prompt を --iterations 回、最大 --concurrency 並列で送信し、
+レイテンシのパーセンタイル (p50/p95/p99)、成功率、合計トークン数を表示します。
+リトライやタイムアウトの設定 (--retries, --timeout など) と --rpm によるレート制限はそのまま適用されるため、
+クォータに合わせた設定の調整に利用できます。Ctrl-C で中断した場合は、それまでの結果を表示します。
+
+利用例:
+  ai-client bench --iterations 20 --concurrency 4
+  ai-client bench --iterations 60 --concurrency 10 --rpm 30 --retries 1`,
+
+		RunE: executeBenchCommand,
+	}
+
+	cmd.Flags().IntVarP(&benchIterations, "iterations", "n", 10, "送信するリクエストの回数")
+	cmd.Flags().IntVarP(&benchConcurrency, "concurrency", "c", 1, "同時に送信するリクエストの最大数")
+	cmd.Flags().StringVar(&benchPrompt, "prompt", defaultBenchPrompt, "送信するプロンプト")
+
+	return cmd
+}
+
+// executeBenchCommand は 'bench' サブコマンドの実際の実行ロジックを保持します。
+func executeBenchCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	if benchIterations < 1 || benchConcurrency < 1 {
+		return &invalidInputError{err: fmt.Errorf("--iterations と --concurrency は1以上である必要があります (iterations: %d, concurrency: %d)", benchIterations, benchConcurrency)}
+	}
+	if strings.TrimSpace(benchPrompt) == "" {
+		return &invalidInputError{err: fmt.Errorf("--prompt が空です")}
+	}
+
+	client, err := newClient(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "%d 回のリクエストを最大 %d 並列で送信します...\n", benchIterations, benchConcurrency)
+	result := runBench(ctx, client, benchPrompt, modelName, benchIterations, benchConcurrency, time.Duration(timeout)*time.Second)
+	printBenchSummary(cmd.OutOrStdout(), result, client)
+
+	// 中断された場合は、結果を表示したうえでキャンセルとして終了します
+	return ctx.Err()
+}
+
+// runBench は、プロンプトを iterations 回、最大 concurrency 並列で送信し、結果を集計します。
+// ctx がキャンセルされた場合は新しいリクエストの送信をやめ、それまでの結果を返します。
+func runBench(ctx context.Context, client ai.Generator, prompt, model string, iterations, concurrency int, perRequestTimeout time.Duration) benchResult {
+	var (
+		mu     sync.Mutex
+		result benchResult
+		wg     sync.WaitGroup
+	)
+
+	jobs := make(chan struct{})
+	start := time.Now()
+	for range min(concurrency, iterations) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				reqCtx, cancel := context.WithTimeout(ctx, perRequestTimeout)
+				reqStart := time.Now()
+				resp, err := client.GenerateContent(reqCtx, prompt, model)
+				latency := time.Since(reqStart)
+				cancel()
+
+				mu.Lock()
+				if err != nil {
+					result.failures++
+					if result.firstErr == nil {
+						result.firstErr = err
+					}
+				} else {
+					result.latencies = append(result.latencies, latency)
+					if resp.Usage != nil {
+						result.totalTokens += int64(resp.Usage.TotalTokens)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for range iterations {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- struct{}{}:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	result.elapsed = time.Since(start)
+	slices.Sort(result.latencies)
+	return result
+}
+
+// printBenchSummary は、bench の計測結果を整形して出力します。
+func printBenchSummary(w io.Writer, result benchResult, client ai.Generator) {
+	completed := len(result.latencies) + result.failures
+
+	var sb strings.Builder
+	sb.WriteString("\n" + separatorHeavy)
+	sb.WriteString("\n📈 ベンチマーク結果:")
+	sb.WriteString("\n" + separatorHeavy)
+	sb.WriteString(fmt.Sprintf("\nModel: %s", modelName))
+	sb.WriteString(fmt.Sprintf("\n完了したリクエスト: %d / %d", completed, benchIterations))
+	if completed > 0 {
+		sb.WriteString(fmt.Sprintf("\n成功率: %.1f%% (成功 %d / 失敗 %d)", float64(len(result.latencies))*100/float64(completed), len(result.latencies), result.failures))
+	}
+	if len(result.latencies) > 0 {
+		sb.WriteString(fmt.Sprintf("\nレイテンシ: p50 %s / p95 %s / p99 %s (最小 %s / 最大 %s)",
+			latencyPercentile(result.latencies, 50), latencyPercentile(result.latencies, 95), latencyPercentile(result.latencies, 99),
+			roundLatency(result.latencies[0]), roundLatency(result.latencies[len(result.latencies)-1])))
+	}
+	sb.WriteString(fmt.Sprintf("\n合計トークン: %d", result.totalTokens))
+	sb.WriteString(fmt.Sprintf("\n所要時間: %s", roundLatency(result.elapsed)))
+	if sp, ok := client.(statsProvider); ok {
+		sb.WriteString(fmt.Sprintf("\nリトライ回数: %d", sp.Stats().TotalRetries))
+	}
+	if result.firstErr != nil {
+		sb.WriteString(fmt.Sprintf("\n最初のエラー: %v", result.firstErr))
+	}
+	sb.WriteString("\n" + separatorLight + "\n")
+
+	fmt.Fprint(w, sb.String())
+}
+
+// latencyPercentile は、昇順に並んだレイテンシから p パーセンタイルの値を返します (nearest-rank 法)。
+func latencyPercentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	rank = min(max(rank, 1), len(sorted))
+	return roundLatency(sorted[rank-1])
+}
+
+// roundLatency は、表示用にレイテンシをミリ秒単位に丸めます。
+func roundLatency(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
+	"github.com/spf13/cobra"
+	"google.golang.org/genai"
+)
+
+// chatPrompt は、chat でユーザーの入力を促す記号です。
+const chatPrompt = "> "
+
+// chatExitCommands は、chat を終了する入力です。
+var chatExitCommands = map[string]bool{"exit": true, "quit": true, "/exit": true, "/quit": true}
+
+// defaultHistoryRatio は、chat の履歴に使うコンテキストウィンドウの割合の既定値です。
+// 残りは新しいメッセージと応答のために空けておきます。
+const defaultHistoryRatio = 0.8
+
+// 'chat' サブコマンド固有のフラグ変数を定義
+var (
+	chatSessionName   string
+	chatHistoryRatio  float64
+	chatCompaction    string
+	chatSummaryPrompt string
+)
+
+// NewChatCmd は 'chat' コマンドを構築します。
+func NewChatCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "対話形式でモデルと会話します。",
+		Long: `このコマンドは、標準入力から 1 行ずつメッセージを読み込み、それまでの会話の履歴と一緒にモデルへ送ります。
+exit または quit を入力するか、EOF (Ctrl-D) で終了します。
+--session を指定すると、会話の履歴をファイルに保存し、次回同じ名前を指定したときに続きから再開します。
+保存したセッションは sessions list / sessions delete で管理できます。
+履歴がモデルのコンテキストウィンドウの --history-ratio を超えると、古いターンから削除します (システム指示は残ります)。
+--compaction summarize を指定すると、削除する代わりに古いターンをモデルに要約させ、要約に置き換えます。
+--timeout は、会話全体ではなくメッセージごとの応答に適用します (--provider gemini のみ)。
+
+利用例:
+  ai-client chat
+  ai-client chat --session work --system "あなたは Go の専門家です"`,
+		Args: cobra.NoArgs,
+		RunE: executeChatCommand,
+	}
+
+	cmd.Flags().StringVarP(&chatSessionName, "session", "s", "", "会話の履歴を保存・再開するセッション名")
+	cmd.Flags().StringVar(&chatCompaction, "compaction", string(gemini.DropOldest), "履歴が上限を超えたときの縮め方 (drop-oldest: 古いターンを削除, summarize: 古いターンを要約に置き換え)")
+	cmd.Flags().StringVar(&chatSummaryPrompt, "summary-prompt", "", "--compaction summarize で古いターンを要約させる指示 (未指定の場合は既定の指示)")
+	cmd.Flags().Float64Var(&chatHistoryRatio, "history-ratio", defaultHistoryRatio, "履歴の見積もりトークン数がモデルのコンテキストウィンドウのこの割合を超えたら、古いターンから削除する (0 で削除しない。コンテキストウィンドウが不明なモデルでは削除しない)")
+
+	return cmd
+}
+
+// executeChatCommand は 'chat' サブコマンドの実際の実行ロジックを保持します。
+func executeChatCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if provider != providerGemini {
+		return &invalidInputError{err: fmt.Errorf("chat は --provider %s でのみ使用できます", providerGemini)}
+	}
+	if chatHistoryRatio < 0 || chatHistoryRatio > 1 {
+		return &invalidInputError{err: fmt.Errorf("--history-ratio は0以上1以下である必要があります。入力値: %v", chatHistoryRatio)}
+	}
+	compaction := gemini.CompactionStrategy(chatCompaction)
+	if compaction != gemini.DropOldest && compaction != gemini.Summarize {
+		return &invalidInputError{err: fmt.Errorf("--compaction は %s または %s である必要があります。入力値: %s", gemini.DropOldest, gemini.Summarize, chatCompaction)}
+	}
+
+	var history []*genai.Content
+	if chatSessionName != "" {
+		var err error
+		if history, err = loadChatSession(chatSessionName); err != nil {
+			return err
+		}
+	}
+
+	client, err := newGeminiClient(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+	session := client.NewChatSession(modelName, history)
+	session.MaxHistoryTokens = maxHistoryTokens(modelName, chatHistoryRatio)
+	session.Compaction = compaction
+	session.SummaryPrompt = chatSummaryPrompt
+	if len(history) > 0 {
+		fmt.Fprintf(cmd.ErrOrStderr(), "セッション '%s' を再開します (%d ターン)。\n", chatSessionName, len(history))
+	}
+
+	// 標準入力は別の goroutine で読み、入力を待っている間に中断 (Ctrl-C) されたらすぐに終了します
+	scanner := bufio.NewScanner(cmd.InOrStdin())
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		fmt.Fprint(cmd.ErrOrStderr(), chatPrompt)
+		var line string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok = <-lines:
+		}
+		if !ok {
+			break
+		}
+		message := strings.TrimSpace(line)
+		if message == "" {
+			continue
+		}
+		if chatExitCommands[message] {
+			return nil
+		}
+
+		msgCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		resp, err := withSpinner(msgCtx, cmd, func(ctx context.Context) (*gemini.Response, error) {
+			return session.Send(ctx, message)
+		})
+		cancel()
+		if err != nil {
+			// 中断 (Ctrl-C) された場合は終了し、それ以外のエラーは表示して会話を続けます
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return ctx.Err()
+			}
+			slog.ErrorContext(ctx, "応答の生成に失敗しました", "error", err)
+			continue
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), truncateForDisplay(resp.Text))
+
+		if chatSessionName != "" {
+			if err := saveChatSession(chatSessionName, modelName, session.History()); err != nil {
+				slog.WarnContext(ctx, "セッションの保存に失敗しました", "session", chatSessionName, "error", err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("標準入力からの読み込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// maxHistoryTokens は、モデルのコンテキストウィンドウと --history-ratio から、履歴のトークン数の上限を求めます。
+// ratio が 0 の場合と、コンテキストウィンドウが不明なモデルの場合は 0 (削除しない) を返します。
+func maxHistoryTokens(model string, ratio float64) int {
+	if ratio == 0 {
+		return 0
+	}
+	window, ok := runner.ContextWindowFor(model)
+	if !ok {
+		slog.Debug("コンテキストウィンドウが不明なモデルのため、履歴を削除しません", "model", model)
+		return 0
+	}
+	return int(float64(window) * ratio)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/atotto/clipboard"
+)
+
+// errClipboardUnsupported は、このプラットフォームでクリップボードを利用できないことを示します。
+// Linux では xclip、xsel、wl-clipboard (Wayland) のいずれかが必要です。
+var errClipboardUnsupported = errors.New("このプラットフォームではクリップボードに対応していません (Linux では xclip、xsel、wl-clipboard のいずれかが必要です)")
+
+// --clipboard、--copy、--copy-only フラグの値です。
+var (
+	useClipboard bool
+	copyResponse bool
+	copyOnly     bool
+)
+
+// readClipboard は、システムのクリップボードのテキストを入力として読み込みます。
+// クリップボードを利用できない場合は errClipboardUnsupported を、空の場合は emptyInputError を返します。
+func readClipboard() ([]byte, error) {
+	if clipboard.Unsupported {
+		return nil, &invalidInputError{err: errClipboardUnsupported}
+	}
+	text, err := clipboard.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("クリップボードからの読み込みに失敗しました: %w", err)
+	}
+	if len(bytes.TrimSpace([]byte(text))) == 0 {
+		return nil, &emptyInputError{msg: "入力エラー: クリップボードに処理するテキストがありません"}
+	}
+	return []byte(text), nil
+}
+
+// copyToClipboard は、応答のテキストをシステムのクリップボードにコピーし、コピーできたかどうかを返します。
+// クリップボードを利用できない場合もコマンドは失敗させず、警告を出力して false を返します。
+func copyToClipboard(ctx context.Context, text string) bool {
+	if clipboard.Unsupported {
+		slog.WarnContext(ctx, "応答をクリップボードにコピーできませんでした", "error", errClipboardUnsupported)
+		return false
+	}
+	if err := clipboard.WriteAll(text); err != nil {
+		slog.WarnContext(ctx, "応答をクリップボードにコピーできませんでした", "error", err)
+		return false
+	}
+	slog.InfoContext(ctx, "応答をクリップボードにコピーしました", "bytes", len(text))
+	return true
+}
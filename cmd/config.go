@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	clibase "github.com/shouni/go-cli-base"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// configDirName は、既定の設定ファイルを置くディレクトリ名です (os.UserConfigDir の下)。
+const configDirName = "go-ai-client"
+
+// configFileName は、既定の設定ファイル名です。
+const configFileName = "config.yaml"
+
+// fileConfig は、--config (未指定時は既定の場所) の YAML 設定ファイルの内容です。
+//
+//	aliases:
+//	  fast: gemini-2.5-flash
+//	  smart: gemini-2.5-pro
+//	profiles:
+//	  gemini-2.5-pro:
+//	    timeout: 180
+//	    temperature: 0.3
+type fileConfig struct {
+	// Aliases は、--model に指定できる短い名前と実際のモデル名の対応です。
+	Aliases map[string]string `yaml:"aliases"`
+	// Profiles は、モデル名 (エイリアスを解決した後の名前) ごとの既定値です。
+	Profiles map[string]modelProfile `yaml:"profiles"`
+}
+
+// modelProfile は、設定ファイルの profiles に書く、1 つのモデルの既定値です。
+// 指定した項目だけを、対応するフラグが明示されていない場合に適用します。
+type modelProfile struct {
+	Temperature    *float32 `yaml:"temperature"`
+	Timeout        *int     `yaml:"timeout"`
+	MaxTokens      *int32   `yaml:"max_tokens"`
+	ThinkingBudget *int32   `yaml:"thinking_budget"`
+	Retries        *uint64  `yaml:"retries"`
+}
+
+// appConfig は、読み込んだ設定ファイルの内容です。設定ファイルがない場合はゼロ値のままです。
+var appConfig fileConfig
+
+// defaultConfigPath は、既定の設定ファイルのパス ($XDG_CONFIG_HOME/go-ai-client/config.yaml など) を返します。
+// ユーザーの設定ディレクトリを特定できない場合は空文字列を返します。
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, configDirName, configFileName)
+}
+
+// loadConfigFile は、--config で指定された設定ファイル、または既定の場所の設定ファイルを読み込み、appConfig に設定します。
+// 既定の場所にファイルがない場合は何もしません。--config で指定したファイルが読み込めない場合はエラーを返します。
+func loadConfigFile() error {
+	path, explicit := clibase.Flags.ConfigFile, true
+	if path == "" {
+		path, explicit = defaultConfigPath(), false
+		if path == "" {
+			return nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return &invalidInputError{err: fmt.Errorf("設定ファイル '%s' の読み込みに失敗しました: %w", path, err)}
+	}
+
+	var cfg fileConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return &invalidInputError{err: fmt.Errorf("設定ファイル '%s' の解析に失敗しました: %w", path, err)}
+	}
+	appConfig = cfg
+	slog.Debug("設定ファイルを読み込みました", "path", path, "aliases", len(cfg.Aliases), "profiles", len(cfg.Profiles))
+	return nil
+}
+
+// resolveModelAlias は、name が設定ファイルで定義されたエイリアスであれば実際のモデル名を返します。
+// 一致するエイリアスがない場合は name をそのまま返します。
+func resolveModelAlias(name string) string {
+	if real, ok := appConfig.Aliases[name]; ok && real != "" {
+		return real
+	}
+	return name
+}
+
+// applyModelProfile は、--model (エイリアスを解決した後の名前) のプロファイルが設定ファイルにあれば、
+// その値を明示されていないフラグに設定します。明示されたフラグは上書きしません。
+// フラグとして設定するため、以降はそのフラグが指定された場合と同じように扱われます。
+func applyModelProfile(cmd *cobra.Command) error {
+	profile, ok := appConfig.Profiles[modelName]
+	if !ok {
+		return nil
+	}
+
+	values := map[string]string{}
+	// --creativity は温度を含むプリセットなので、指定された場合はプロファイルの温度より優先します
+	if profile.Temperature != nil && creativity == "" {
+		values["temperature"] = strconv.FormatFloat(float64(*profile.Temperature), 'f', -1, 32)
+	}
+	if profile.Timeout != nil {
+		values["timeout"] = strconv.Itoa(*profile.Timeout)
+	}
+	if profile.MaxTokens != nil {
+		values["max-tokens"] = strconv.FormatInt(int64(*profile.MaxTokens), 10)
+	}
+	if profile.ThinkingBudget != nil {
+		values["thinking-budget"] = strconv.FormatInt(int64(*profile.ThinkingBudget), 10)
+	}
+	if profile.Retries != nil {
+		values["retries"] = strconv.FormatUint(*profile.Retries, 10)
+	}
+
+	flags := cmd.Flags()
+	var applied []string
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if flags.Lookup(name) == nil || flags.Changed(name) {
+			continue
+		}
+		if err := flags.Set(name, values[name]); err != nil {
+			return &invalidInputError{err: fmt.Errorf("モデル '%s' のプロファイルの %s を設定できません: %w", modelName, name, err)}
+		}
+		applied = append(applied, name)
+	}
+	slog.Debug("モデルのプロファイルを適用しました", "model", modelName, "flags", applied)
+	return nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// creativityPreset は、--creativity で選べる温度と TopP の組み合わせです。
+type creativityPreset struct {
+	temperature float32
+	topP        float32
+}
+
+// creativityPresets は、--creativity の名前と設定値の対応です。
+var creativityPresets = map[string]creativityPreset{
+	"deterministic": {temperature: 0.0, topP: 0.1},
+	"balanced":      {temperature: 0.7, topP: 0.95},
+	"creative":      {temperature: 1.0, topP: 1.0},
+}
+
+// creativity は --creativity フラグの値です。
+var creativity string
+
+// resolveSampling は、--creativity と --temperature から、クライアントに渡す温度と TopP を決定します。
+// どちらも指定されていない場合は nil を返し、クライアントの既定値に任せます。
+// 両方が指定された場合は --creativity を優先し、警告を出力します。
+func resolveSampling(cmd *cobra.Command) (temp *float32, topP *float32, err error) {
+	flags := cmd.Flags()
+	if creativity == "" {
+		if flags.Changed("temperature") {
+			return &temperature, nil, nil
+		}
+		return nil, nil, nil
+	}
+
+	preset, ok := creativityPresets[creativity]
+	if !ok {
+		return nil, nil, &invalidInputError{err: fmt.Errorf("不明な --creativity です: '%s' (利用可能な値: %s)", creativity, creativityNames())}
+	}
+	if flags.Changed("temperature") {
+		slog.Warn("--creativity と --temperature が両方指定されたため、--creativity の設定を使用します",
+			"creativity", creativity, "temperature", preset.temperature, "ignored_temperature", temperature)
+	}
+	return &preset.temperature, &preset.topP, nil
+}
+
+// creativityNames は、利用可能なプリセット名をカンマ区切りで返します。
+func creativityNames() string {
+	names := make([]string, 0, len(creativityPresets))
+	for name := range creativityPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
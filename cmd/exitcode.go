@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/shouni/go-ai-client/v2/pkg/ai/openai"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
+	"google.golang.org/genai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 終了コード。ラッパースクリプトがエラーの種類を判別できるように、分類ごとに値を分けます。
+const (
+	exitCodeError        = 1 // 分類できないエラー
+	exitCodeAuth         = 2 // APIキーの未設定・認証エラー
+	exitCodeInvalidInput = 3 // 入力やフラグの誤り
+	exitCodeRetryable    = 4 // レート制限・クォータの超過・サービス停止・タイムアウトなど、時間をおけば解消しうるエラー
+	exitCodeBlocked      = 5 // 安全フィルターなどによる生成のブロック
+
+	exitCodeCanceled = 130 // Ctrl-C などによるキャンセル (シェルの慣例に合わせ 128 + SIGINT)
+)
+
+// invalidInputError は、入力の誤りによるエラーであることを示します (終了コード 3)。
+type invalidInputError struct{ err error }
+
+func (e *invalidInputError) Error() string { return e.err.Error() }
+func (e *invalidInputError) Unwrap() error { return e.err }
+
+// authError は、APIキーの未設定など認証に関するエラーであることを示します (終了コード 2)。
+type authError struct{ err error }
+
+func (e *authError) Error() string { return e.err.Error() }
+func (e *authError) Unwrap() error { return e.err }
+
+// exitCodeFor は、エラーの種類に応じた終了コードを返します。
+func exitCodeFor(err error) int {
+	var inputErr *invalidInputError
+	var authErr *authError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, context.Canceled):
+		return exitCodeCanceled
+	case errors.As(err, &authErr):
+		return exitCodeAuth
+	case errors.As(err, &inputErr), errors.Is(err, runner.ErrEmptyInput), errors.Is(err, runner.ErrInputTooLarge),
+		errors.Is(err, gemini.ErrInvalidRawConfig):
+		return exitCodeInvalidInput
+	case gemini.IsBlocked(err), openai.IsBlocked(err), errors.Is(err, runner.ErrModerationRejected):
+		return exitCodeBlocked
+	// 1 日あたりのクォータの超過はクライアントではリトライしないけれど、リセットされれば解消するため同じ分類にします
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, gemini.ErrUnreachable), errors.Is(err, gemini.ErrQuotaExceeded):
+		return exitCodeRetryable
+	}
+
+	// API が返したステータスで分類します
+	if code, ok := httpStatusOf(err); ok {
+		switch {
+		case code == http.StatusUnauthorized || code == http.StatusForbidden:
+			return exitCodeAuth
+		case code == http.StatusBadRequest:
+			return exitCodeInvalidInput
+		case code == http.StatusTooManyRequests:
+			return exitCodeRetryable
+		}
+	}
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return exitCodeAuth
+	case codes.InvalidArgument:
+		return exitCodeInvalidInput
+	case codes.ResourceExhausted:
+		return exitCodeRetryable
+	}
+
+	// 一時的な障害かどうかは、クライアントのリトライ判定と同じ基準で判定します
+	if gemini.IsRetryable(err) || openai.IsRetryable(err) {
+		return exitCodeRetryable
+	}
+
+	return exitCodeError
+}
+
+// httpStatusOf は、Gemini (REST) または OpenAI 互換 API のエラーから HTTP ステータスコードを取り出します。
+func httpStatusOf(err error) (int, bool) {
+	var geminiErr genai.APIError
+	if errors.As(err, &geminiErr) {
+		return geminiErr.Code, true
+	}
+	var openaiErr *openai.HTTPError
+	if errors.As(err, &openaiErr) {
+		return openaiErr.StatusCode, true
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/shouni/go-ai-client/v2/pkg/ai/openai"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
+	"google.golang.org/genai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// blockedGeminiError は、安全フィルターでブロックされた応答を返すサーバーに Gemini のクライアントで問い合わせ、
+// そのエラーを返します。ブロックを示すエラーの型はパッケージの外から組み立てられないためです。
+func blockedGeminiError(t *testing.T) error {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"candidates":[{"finishReason":"SAFETY"}]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := gemini.NewClient(context.Background(), gemini.Config{APIKey: "dummy-key", BaseURL: server.URL, DisableRetries: true})
+	if err != nil {
+		t.Fatalf("クライアントの初期化に失敗しました: %v", err)
+	}
+	_, err = client.GenerateContent(context.Background(), "hello", "test-model")
+	if !gemini.IsBlocked(err) {
+		t.Fatalf("ブロックを示すエラーが返されるべきです: %v", err)
+	}
+	return err
+}
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"成功", nil, 0},
+
+		// 認証
+		{"API キーの未設定", &authError{err: errors.New("GEMINI_API_KEY が設定されていません")}, exitCodeAuth},
+		{"REST 401", genai.APIError{Code: 401, Status: "UNAUTHENTICATED"}, exitCodeAuth},
+		{"REST 403", genai.APIError{Code: 403, Status: "PERMISSION_DENIED"}, exitCodeAuth},
+		{"gRPC Unauthenticated", status.Error(codes.Unauthenticated, "invalid key"), exitCodeAuth},
+		{"OpenAI 401", &openai.HTTPError{StatusCode: 401}, exitCodeAuth},
+
+		// 入力の誤り
+		{"フラグの誤り", &invalidInputError{err: errors.New("--temperature は 0.0〜1.0")}, exitCodeInvalidInput},
+		{"空の入力", fmt.Errorf("実行に失敗しました: %w", runner.ErrEmptyInput), exitCodeInvalidInput},
+		{"REST 400", genai.APIError{Code: 400, Status: "INVALID_ARGUMENT"}, exitCodeInvalidInput},
+		{"gRPC InvalidArgument", status.Error(codes.InvalidArgument, "invalid prompt"), exitCodeInvalidInput},
+		{"OpenAI 400", &openai.HTTPError{StatusCode: 400}, exitCodeInvalidInput},
+
+		// ブロック
+		{"Gemini の安全フィルター", blockedGeminiError(t), exitCodeBlocked},
+		{"事前チェックによる拒否", runner.ErrModerationRejected, exitCodeBlocked},
+
+		// 時間をおけば解消しうるエラー
+		{"REST 429", genai.APIError{Code: 429, Status: "RESOURCE_EXHAUSTED"}, exitCodeRetryable},
+		{"REST 503", genai.APIError{Code: 503, Status: "UNAVAILABLE"}, exitCodeRetryable},
+		{"gRPC Unavailable", status.Error(codes.Unavailable, "service unavailable"), exitCodeRetryable},
+		{"OpenAI 429", &openai.HTTPError{StatusCode: 429}, exitCodeRetryable},
+		{"OpenAI 500", &openai.HTTPError{StatusCode: 500}, exitCodeRetryable},
+		{"タイムアウト", fmt.Errorf("生成に失敗しました: %w", context.DeadlineExceeded), exitCodeRetryable},
+		{"1 日あたりのクォータの超過", fmt.Errorf("%w: %w", gemini.ErrQuotaExceeded, genai.APIError{Code: 429}), exitCodeRetryable},
+
+		// キャンセル
+		{"キャンセル", fmt.Errorf("生成に失敗しました: %w", context.Canceled), exitCodeCanceled},
+
+		// 分類できないエラー
+		{"分類できないエラー", errors.New("something went wrong"), exitCodeError},
+		{"REST 404", genai.APIError{Code: 404, Status: "NOT_FOUND"}, exitCodeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeFor(tt.err); got != tt.want {
+				t.Errorf("exitCodeFor(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,33 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"time"
 
-	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
 	"github.com/spf13/cobra"
 )
 
+// streamingInputThreshold を超えるサイズの入力ファイルは、File API 経由でストリーミング送信します。
+const streamingInputThreshold = 512 * 1024
+
+// readerGenerator は、入力をメモリに読み込まずにストリーミング送信できるクライアントです (現在は Gemini のみ)。
+type readerGenerator interface {
+	GenerateContentFromReader(ctx context.Context, r io.Reader, modelName string) (*ai.Response, error)
+}
+
+// promptFileMode は、--prompt-file で読み込んだテンプレートを登録するモード名です。
+const promptFileMode = "prompt-file"
+
+// genericPromptFile は 'generic' サブコマンド固有のフラグ変数を定義
+var genericPromptFile string
+
 // NewGenericCmd は 'generic' コマンドを構築します。
 func NewGenericCmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -17,13 +36,31 @@ func NewGenericCmd() *cobra.Command {
 		Long: `このコマンドは、モデルに特別な役割を与えず、通常のチャットや要約を目的とします。
 'mode' フラグは無視されます。
 
+入力ファイルが大きい場合 (512KiB 超) は、内容をメモリに読み込まずに File API 経由で
+ストリーミング送信します (--provider gemini のみ)。メモリ使用量は抑えられますが、アップロードと処理待ちの分だけ
+応答までの時間は長くなります。
+
+-i は複数指定でき、その場合は各ファイルを '=== ファイル名 ===' の見出し付きで連結して渡します。
+引数を併用した場合は、それも見出し付きで末尾に追加します。標準入力も合わせて渡す場合は -i - を指定します
+(-i を指定した場合、標準入力は -i - がない限り読み込みません)。
+
 利用例:
   # ファイルから読み込み、標準出力に出力
-  ai-client generic -i input.txt`,
+  ai-client generic -i input.txt
+
+  # 複数のファイルをまとめて渡す
+  ai-client generic -i main.go -i main_test.go
+
+  # モードを登録せずに、ファイルのテンプレートを一度だけ使う
+  cat diff.txt | ai-client generic --prompt-file review.md`,
 
 		// 実行ロジックを外部関数に委譲
-		RunE: executeGenericCommand,
+		RunE: withCommandTimeout(allowEmptyInput(executeGenericCommand)),
 	}
+
+	addInputFileFlag(cmd)
+	cmd.Flags().StringVar(&genericPromptFile, "prompt-file", "", "一度だけ使うプロンプトテンプレートのファイル (入力は {{.Content}} として埋め込まれます)")
+
 	return cmd
 }
 
@@ -31,32 +68,115 @@ func NewGenericCmd() *cobra.Command {
 func executeGenericCommand(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 
-	// 1. 入力内容の決定
-	// readInputは []byte, error を返す
-	inputText, err := readInput(cmd, args)
+	// 1. クライアント初期化
+	// 環境変数とフラグからクライアントを生成
+	client, err := newClient(cmd)
 	if err != nil {
-		return err // readInput内で十分なエラーメッセージが出ていると想定
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+
+	// 2. 入力内容の決定とコンテンツ生成
+	var generateContent *ai.Response
+	// 単一ファイルのみが入力の場合は、サイズに応じてストリーミング送信できる経路を使う
+	// (--prompt-file 指定時はテンプレートに埋め込む必要があり、--json-schema 指定時は JSON で生成する必要があり、
+	// --input-format 指定時は送信前に変換する必要があるため対象外)
+	if genericPromptFile == "" && jsonSchemaFile == "" && inputFormat == string(runner.InputFormatRaw) && len(inputFiles) == 1 && inputFiles[0] != stdinInputPath && len(args) == 0 {
+		start := time.Now()
+		generateContent, err = withSpinner(ctx, cmd, func(ctx context.Context) (*ai.Response, error) {
+			return generateFromInputFile(ctx, client, inputFiles[0])
+		})
+		if err != nil {
+			return fmt.Errorf("AIコンテンツ生成中にエラーが発生しました: %w", err)
+		}
+		generateContent.Elapsed = time.Since(start)
+		// Runner を経由しないため、後処理をここで適用
+		if trimResponse {
+			generateContent.Text = runner.TrimFiller(generateContent.Text, fillerPhrases())
+			for i, candidate := range generateContent.Candidates {
+				generateContent.Candidates[i] = runner.TrimFiller(candidate, fillerPhrases())
+			}
+		}
+		if stripFences {
+			generateContent.Text = runner.StripCodeFences(generateContent.Text)
+			for i, candidate := range generateContent.Candidates {
+				generateContent.Candidates[i] = runner.StripCodeFences(candidate)
+			}
+		}
+	} else {
+		// readInputは []byte, error を返す
+		inputText, err := readInput(cmd, args)
+		if err != nil {
+			return err // readInput内で十分なエラーメッセージが出ていると想定
+		}
+		// --prompt-file がなければテンプレートを使わないため、モードは空で Runner に渡す
+		builder, mode, err := loadPromptFile(genericPromptFile)
+		if err != nil {
+			return err
+		}
+		r, err := newRunner(client, builder)
+		if err != nil {
+			return err
+		}
+		generateContent, err = withSpinner(ctx, cmd, func(ctx context.Context) (*ai.Response, error) {
+			return r.Run(ctx, string(inputText), inputSourceName(cmd, args), mode, modelName)
+		})
+		if err != nil {
+			return err
+		}
+		outputTemplateName = r.ResolveTemplateName(mode)
+		outputMode = mode
+	}
+
+	// 3. 結果の出力
+	return GenerateAndOutput(ctx, generateContent)
+}
+
+// loadPromptFile は、--prompt-file のテンプレートを一時的なモードとして登録したビルダーとそのモード名を返します。
+// path が空の場合は、ビルダーとモードの両方を空で返します。
+func loadPromptFile(path string) (prompts.Builder, string, error) {
+	if path == "" {
+		return nil, "", nil
 	}
 
-	// 2. クライアント初期化
-	// 環境変数からクライアントを生成
-	client, err := gemini.NewClientFromEnv(ctx)
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+		return nil, "", &invalidInputError{err: fmt.Errorf("プロンプトファイル '%s' の読み込みに失敗しました: %w", path, err)}
 	}
+	builder, err := prompts.NewPromptBuilderFromTemplates(map[string]string{promptFileMode: string(content)})
+	if err != nil {
+		return nil, "", &invalidInputError{err: fmt.Errorf("プロンプトファイル '%s' の解析に失敗しました: %w", path, err)}
+	}
+	builder.SetTemplateName(promptFileMode, path)
+	return builder, promptFileMode, nil
+}
 
-	// 3. タイムアウト設定とコンテンツ生成
-	// commandCtx を使用し、処理全体にタイムアウトを適用
-	commandCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
-	defer cancel()
+// generateFromInputFile は入力ファイルのサイズに応じて、インライン送信と File API 経由のストリーミング送信を切り替えます。
+func generateFromInputFile(ctx context.Context, client ai.Generator, path string) (*ai.Response, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("入力ファイルのオープンに失敗しました: %w", err)
+	}
+	defer f.Close()
 
-	// Gemini APIを呼び出し
-	// inputTextは []byte なので、string() にキャストして渡す
-	generateContent, err := client.GenerateContent(commandCtx, string(inputText), modelName)
+	info, err := f.Stat()
 	if err != nil {
-		return fmt.Errorf("AIコンテンツ生成中にエラーが発生しました: %w", err)
+		return nil, fmt.Errorf("入力ファイルの情報取得に失敗しました: %w", err)
+	}
+	// Runner を経由しないため、入力サイズの上限をここで確認
+	if maxInputBytes > 0 && info.Size() > int64(maxInputBytes) {
+		return nil, fmt.Errorf("%w (%d バイト、上限 %d バイト)。summarize の --chunk-size で分割して処理することを検討してください", runner.ErrInputTooLarge, info.Size(), maxInputBytes)
+	}
+
+	if rg, ok := client.(readerGenerator); ok && info.Size() > streamingInputThreshold {
+		return rg.GenerateContentFromReader(ctx, f, modelName)
 	}
 
-	// 4. 結果の出力
-	return GenerateAndOutput(ctx, generateContent.Text)
+	inputText, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("入力ファイルの読み込みに失敗しました: %w", err)
+	}
+	if len(bytes.TrimSpace(inputText)) == 0 {
+		return nil, &emptyInputError{msg: "入力エラー: 指定されたファイルに処理するテキストが含まれていません"}
+	}
+	return client.GenerateContent(ctx, string(inputText), modelName)
 }
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/spf13/cobra"
+	"google.golang.org/genai"
+)
+
+// defaultImageModel は、generate-image で --model が未指定の場合に使用する画像生成に対応したモデル名です。
+const defaultImageModel = "gemini-2.5-flash-image"
+
+// imageAspectRatios は、--aspect-ratio に指定できる縦横比です (Gemini API の対応値)。
+var imageAspectRatios = []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"}
+
+// imageExtensions は、画像の MIME タイプと、それに対応するファイルの拡張子です。
+var imageExtensions = map[string][]string{
+	"image/png":  {".png"},
+	"image/jpeg": {".jpg", ".jpeg"},
+	"image/webp": {".webp"},
+}
+
+// 'generate-image' サブコマンド固有のフラグ変数を定義
+var (
+	imageOutputFile  string
+	imageAspectRatio string
+)
+
+// NewGenerateImageCmd は 'generate-image' コマンドを構築します。
+func NewGenerateImageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate-image [TEXT or pipe] --output <file>",
+		Short: "テキストの指示から画像を生成し、ファイルに保存します。",
+		Long: `このコマンドは、入力テキストを画像生成の指示としてモデルに渡し、返された画像を --output のファイルに保存して、
+保存したパスを表示します。入力は generic と同様に、引数・標準入力・-i (複数指定可) から読み込みます。
+--output に - を指定すると、画像をファイルに保存せずに標準出力に書き出します。--encode base64 を指定すると、
+画像を base64 でエンコードしたテキストとして保存・出力します (パイプや JSON に渡す場合に使います)。
+標準出力が端末の場合は、表示が壊れないよう --encode base64 が必要です。
+--model を指定しない場合は ` + defaultImageModel + ` を使います。--seed を指定すると、同じ指示から同じ画像を得やすくなります。
+モデルが画像を返さなかった場合 (画像生成に対応していないモデルや、テキストだけで答えた場合) はエラーになります。
+--provider gemini のみ対応しています。
+
+利用例:
+  ai-client generate-image "夕焼けの海辺を歩く猫" -o cat.png
+  ai-client generate-image "ロゴ: 青い鳥" --aspect-ratio 16:9 --seed 42 -o logo.png
+  ai-client generate-image "アイコン: 歯車" -o - --encode base64 | pbcopy`,
+
+		RunE: withCommandTimeout(executeGenerateImageCommand),
+	}
+
+	addInputFileFlag(cmd)
+	cmd.Flags().StringVarP(&imageOutputFile, "output", "o", "", "生成した画像を保存するファイルのパス (必須。- で標準出力)")
+	cmd.Flags().StringVar(&imageAspectRatio, "aspect-ratio", "", "画像の縦横比 ("+strings.Join(imageAspectRatios, ", ")+")。未指定時はモデルの既定値")
+	_ = cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+// executeGenerateImageCommand は 'generate-image' サブコマンドの実際の実行ロジックを保持します。
+func executeGenerateImageCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	if provider != providerGemini {
+		return &invalidInputError{err: fmt.Errorf("generate-image は --provider %s でのみ使用できます", providerGemini)}
+	}
+	if imageAspectRatio != "" && !slices.Contains(imageAspectRatios, imageAspectRatio) {
+		return &invalidInputError{err: fmt.Errorf("不明な縦横比です: '%s' (利用可能な値: %s)", imageAspectRatio, strings.Join(imageAspectRatios, ", "))}
+	}
+	toStdout := imageOutputFile == "-"
+	if toStdout && outputEncoding == outputEncodingNone && isTerminal(cmd.OutOrStdout()) {
+		return &invalidInputError{err: fmt.Errorf("画像のバイナリを端末に出力すると表示が壊れるため、--output - では --encode %s を指定するか、パイプやリダイレクトで渡してください", outputEncodingBase64)}
+	}
+
+	// 1. 入力内容 (画像の指示) の決定
+	inputText, err := readInput(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	// 2. クライアント初期化
+	client, err := newGeminiClient(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+	model := modelName
+	if !cmd.Flags().Changed("model") {
+		model = defaultImageModel
+	}
+
+	// 3. 画像の生成
+	opts := gemini.ImageOptions{AspectRatio: imageAspectRatio}
+	if cmd.Flags().Changed("seed") {
+		opts.Seed = &seed
+	}
+	start := time.Now()
+	resp, err := withSpinner(ctx, cmd, func(ctx context.Context) (*gemini.Response, error) {
+		return client.GenerateWithParts(ctx, model, []*genai.Part{genai.NewPartFromText(string(inputText))}, opts)
+	})
+	if err != nil {
+		return fmt.Errorf("画像の生成中にエラーが発生しました: %w", err)
+	}
+	data, mimeType, err := gemini.ExtractImage(resp)
+	if err != nil {
+		return fmt.Errorf("モデル '%s' から画像を取得できませんでした: %w", model, err)
+	}
+	slog.InfoContext(ctx, "画像を生成しました", "model", resp.ModelName, "mime_type", mimeType, "bytes", len(data), "elapsed", time.Since(start).Round(time.Millisecond))
+
+	if outputEncoding == outputEncodingBase64 {
+		data = []byte(base64.StdEncoding.EncodeToString(data) + "\n")
+		slog.InfoContext(ctx, "画像を base64 でエンコードしました", "mime_type", mimeType)
+	}
+
+	// 4. 保存とパスの表示 (--output - の場合は標準出力への書き出し)
+	if toStdout {
+		if _, err := cmd.OutOrStdout().Write(data); err != nil {
+			return fmt.Errorf("画像の出力に失敗しました: %w", err)
+		}
+		return nil
+	}
+	if exts, ok := imageExtensions[mimeType]; ok && outputEncoding == outputEncodingNone && !slices.Contains(exts, strings.ToLower(filepath.Ext(imageOutputFile))) {
+		slog.WarnContext(ctx, "保存先の拡張子が画像の形式と一致しません", "path", imageOutputFile, "mime_type", mimeType)
+	}
+	if err := os.WriteFile(imageOutputFile, data, 0o644); err != nil {
+		return fmt.Errorf("画像の保存に失敗しました: %w", err)
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), imageOutputFile)
+	return nil
+}
@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
+	clibase "github.com/shouni/go-cli-base"
+	"gopkg.in/yaml.v3"
+)
+
+// --output-format で選べる出力形式です。
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+	outputFormatYAML = "yaml"
+)
+
+// outputFormat は --output-format フラグの値です。
+var outputFormat string
+
+// --encode で選べる、応答に含まれるバイナリ (画像など) の出力のエンコードです。
+const (
+	outputEncodingNone   = "none"
+	outputEncodingBase64 = "base64"
+)
+
+// outputEncoding は --encode フラグの値です。
+var outputEncoding string
+
+// --max-output-chars と --max-output-lines フラグの値です。0 の場合は切り詰めません。
+var (
+	maxOutputChars int
+	maxOutputLines int
+)
+
+// defaultOutputTemplate は、--output-template が未指定の場合に text 形式の出力に使うテンプレートです。
+// 見出しとセパレータで応答を囲み、モデル名などのメタ情報を付けます。
+const defaultOutputTemplate = "\n{{separatorHeavy}}\n🤖 AIモデルからの応答:\n{{separatorHeavy}}\n" +
+	"{{.Text}}{{.Citations}}{{.Images}}\n\n" +
+	"{{separatorLight}}\nModel: {{.Model}}{{if .Template}}\nテンプレート: {{.Template}}{{end}}\n" +
+	"出力処理時刻: {{.Timestamp.Format \"2006-01-02 15:04:05\"}}{{.Report}}\n{{separatorLight}}\n"
+
+// outputTemplateText は --output-template フラグの値です。空の場合は defaultOutputTemplate を使います。
+var outputTemplateText string
+
+// outputTemplate は、validateOutputTemplate で解析した text 形式の出力のテンプレートです。
+var outputTemplate *template.Template
+
+// outputMode は、出力のテンプレートに渡すモードです。テンプレートでプロンプトを構築したコマンドが設定します。
+var outputMode string
+
+// outputTemplateFuncs は、出力のテンプレートで使える関数です。
+var outputTemplateFuncs = template.FuncMap{
+	"separatorHeavy": func() string { return separatorHeavy },
+	"separatorLight": func() string { return separatorLight },
+}
+
+// outputTemplateData は、text 形式の出力のテンプレートに渡す値です。
+type outputTemplateData struct {
+	// Model は --model で指定したモデル名、ResponseModel は実際に応答したモデル名です。
+	Model         string
+	ResponseModel string
+	// Mode と Template は、プロンプトの構築に使ったモードとテンプレート名です (使っていない場合は空)。
+	Mode     string
+	Template string
+	// Text は応答の本文です。複数の候補がある場合は、番号付きの区切りで候補を連結したものです。
+	Text string
+	// Usage はトークン使用量です (返されなかった場合は nil)。
+	Usage *ai.Usage
+	// Citations は --show-citations、Report は --verbose を指定した場合の整形済みの出典と実行レポートです (未指定の場合は空)。
+	Citations string
+	Report    string
+	// Images は --encode base64 を指定した場合の、base64 でエンコードした画像と注記です (未指定の場合や画像がない場合は空)。
+	Images string
+	// Timestamp は出力した時刻です。
+	Timestamp time.Time
+}
+
+// structuredOutput は、--output-format json / yaml で出力する応答とメタ情報です。
+// JSON と YAML で同じ構造体を使い、キー名も揃えます。
+type structuredOutput struct {
+	Text          string             `json:"text" yaml:"text"`
+	Candidates    []string           `json:"candidates,omitempty" yaml:"candidates,omitempty"`
+	Truncated     bool               `json:"truncated,omitempty" yaml:"truncated,omitempty"`
+	Model         string             `json:"model" yaml:"model"`
+	ResponseModel string             `json:"response_model,omitempty" yaml:"response_model,omitempty"`
+	Template      string             `json:"template,omitempty" yaml:"template,omitempty"`
+	Usage         *structuredUsage   `json:"usage,omitempty" yaml:"usage,omitempty"`
+	Citations     []structuredSource `json:"citations,omitempty" yaml:"citations,omitempty"`
+	Images        []structuredImage  `json:"images,omitempty" yaml:"images,omitempty"`
+	ElapsedMS     int64              `json:"elapsed_ms,omitempty" yaml:"elapsed_ms,omitempty"`
+	RequestID     string             `json:"request_id,omitempty" yaml:"request_id,omitempty"`
+	Timestamp     string             `json:"timestamp" yaml:"timestamp"`
+}
+
+// structuredUsage は、structuredOutput のトークン使用量です。
+type structuredUsage struct {
+	PromptTokens     int32 `json:"prompt_tokens" yaml:"prompt_tokens"`
+	CompletionTokens int32 `json:"completion_tokens" yaml:"completion_tokens"`
+	TotalTokens      int32 `json:"total_tokens" yaml:"total_tokens"`
+}
+
+// structuredSource は、structuredOutput の出典です。
+type structuredSource struct {
+	URI   string `json:"uri,omitempty" yaml:"uri,omitempty"`
+	Title string `json:"title,omitempty" yaml:"title,omitempty"`
+}
+
+// structuredImage は、structuredOutput の画像です。--encode base64 を指定した場合だけ出力します。
+type structuredImage struct {
+	MIMEType string `json:"mime_type" yaml:"mime_type"`
+	Bytes    int    `json:"bytes" yaml:"bytes"`
+	Encoding string `json:"encoding" yaml:"encoding"`
+	Data     string `json:"data" yaml:"data"`
+}
+
+// validateOutputFormat は、--output-format の値が対応している形式か確認します。
+func validateOutputFormat() error {
+	switch outputFormat {
+	case outputFormatText, outputFormatJSON, outputFormatYAML:
+		return nil
+	default:
+		return &invalidInputError{err: fmt.Errorf("不明な出力形式です: '%s' (利用可能な値: %s, %s, %s)", outputFormat, outputFormatText, outputFormatJSON, outputFormatYAML)}
+	}
+}
+
+// validateOutputEncoding は、--encode の値が対応しているエンコードか確認します。
+func validateOutputEncoding() error {
+	switch outputEncoding {
+	case outputEncodingNone, outputEncodingBase64:
+		return nil
+	default:
+		return &invalidInputError{err: fmt.Errorf("不明なエンコードです: '%s' (利用可能な値: %s, %s)", outputEncoding, outputEncodingNone, outputEncodingBase64)}
+	}
+}
+
+// validateOutputLimits は、--max-output-chars と --max-output-lines の値が負でないか確認します。
+func validateOutputLimits() error {
+	if maxOutputChars < 0 {
+		return &invalidInputError{err: fmt.Errorf("--max-output-chars には 0 以上の値を指定してください: %d", maxOutputChars)}
+	}
+	if maxOutputLines < 0 {
+		return &invalidInputError{err: fmt.Errorf("--max-output-lines には 0 以上の値を指定してください: %d", maxOutputLines)}
+	}
+	return nil
+}
+
+// validateOutputTemplate は、--output-template を解析し、見本の値で実行して誤りがないか確認します。
+// 存在しないフィールドの参照や、nil になりうる .Usage を {{with}} で囲まずに参照している誤りを、API を呼び出す前に検出するためです。
+func validateOutputTemplate() error {
+	text := outputTemplateText
+	if text == "" {
+		text = defaultOutputTemplate
+	} else if outputFormat != outputFormatText {
+		return &invalidInputError{err: fmt.Errorf("--output-template は --output-format %s でのみ使用できます", outputFormatText)}
+	}
+
+	tmpl, err := template.New("output").Funcs(outputTemplateFuncs).Parse(text)
+	if err != nil {
+		return &invalidInputError{err: fmt.Errorf("--output-template の解析に失敗しました: %w", err)}
+	}
+	// トークン使用量は返されない場合があるため、ある場合とない場合の両方で実行します
+	for _, usage := range []*ai.Usage{{}, nil} {
+		sample := outputTemplateData{Usage: usage, Timestamp: time.Now()}
+		if err := tmpl.Execute(io.Discard, sample); err != nil {
+			return &invalidInputError{err: fmt.Errorf("--output-template を実行できません: %w", err)}
+		}
+	}
+	outputTemplate = tmpl
+	return nil
+}
+
+// formatTemplateOutput は、応答とメタ情報を text 形式の出力のテンプレートで整形します。
+// 実行時にテンプレートが失敗した場合は、応答を捨てないよう警告を出して本文だけを返します。
+func formatTemplateOutput(resp *ai.Response) string {
+	data := outputTemplateData{
+		Model:         modelName,
+		ResponseModel: resp.ModelName,
+		Mode:          outputMode,
+		Template:      outputTemplateName,
+		Text:          resp.Text,
+		Usage:         resp.Usage,
+		Timestamp:     time.Now(),
+	}
+	if len(resp.Candidates) > 1 {
+		data.Text = formatCandidates(resp.Candidates)
+	}
+	data.Text = truncateForDisplay(data.Text)
+	if showCitations {
+		data.Citations = formatCitations(resp.Citations)
+	}
+	if clibase.Flags.Verbose {
+		data.Report = formatVerboseReport(resp)
+	}
+	if outputEncoding == outputEncodingBase64 {
+		data.Images = formatEncodedImages(resp.Images)
+	}
+
+	tmpl := outputTemplate
+	if tmpl == nil {
+		// 起動時の検証を経ずに呼ばれた場合 (テストなど) は、既定のテンプレートを使います
+		tmpl = template.Must(template.New("output").Funcs(outputTemplateFuncs).Parse(defaultOutputTemplate))
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		slog.Warn("出力のテンプレートの実行に失敗したため、応答の本文だけを出力します", "error", err)
+		return data.Text + "\n"
+	}
+	return sb.String()
+}
+
+// truncateForDisplay は、--max-output-chars / --max-output-lines に従って表示する応答を切り詰め、
+// 切り詰めた場合は省略記号と、応答の全体の長さを示す注記を付けます。
+func truncateForDisplay(text string) string {
+	truncated, ok := runner.TruncateText(text, maxOutputChars, maxOutputLines)
+	if !ok {
+		return text
+	}
+	lines := strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+	return fmt.Sprintf("%s…\n(表示を切り詰めました。応答の全体は %d 文字、%d 行です)", truncated, utf8.RuneCountInString(text), lines)
+}
+
+// formatEncodedImages は、画像を base64 でエンコードし、どの画像をエンコードしたかの注記を付けて整形します。
+// 端末に表示したりパイプで渡したりしてもデータが壊れないよう、バイナリのまま出力はしません。
+func formatEncodedImages(images []ai.Image) string {
+	var sb strings.Builder
+	for i, img := range images {
+		sb.WriteString(fmt.Sprintf("\n\n🖼️ 画像 %d/%d (%s, %d バイト) を base64 でエンコードしました:\n", i+1, len(images), img.MIMEType, len(img.Data)))
+		sb.WriteString(base64.StdEncoding.EncodeToString(img.Data))
+	}
+	return sb.String()
+}
+
+// newStructuredOutput は、応答と実行時の情報から structuredOutput を組み立てます。
+func newStructuredOutput(resp *ai.Response) structuredOutput {
+	out := structuredOutput{
+		Text:          resp.Text,
+		Candidates:    resp.Candidates,
+		Model:         modelName,
+		ResponseModel: resp.ModelName,
+		Template:      outputTemplateName,
+		ElapsedMS:     resp.Elapsed.Milliseconds(),
+		RequestID:     resp.RequestID,
+		Timestamp:     time.Now().Format(time.RFC3339),
+	}
+	if resp.Usage != nil {
+		out.Usage = &structuredUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		}
+	}
+	// 構造化した出力では注記を付けず、truncated で切り詰めたことを示します
+	var truncated bool
+	out.Text, truncated = runner.TruncateText(resp.Text, maxOutputChars, maxOutputLines)
+	out.Truncated = truncated
+	if len(resp.Candidates) > 0 {
+		out.Candidates = make([]string, len(resp.Candidates))
+		for i, c := range resp.Candidates {
+			out.Candidates[i], truncated = runner.TruncateText(c, maxOutputChars, maxOutputLines)
+			out.Truncated = out.Truncated || truncated
+		}
+	}
+	for _, c := range resp.Citations {
+		out.Citations = append(out.Citations, structuredSource{URI: c.URI, Title: c.Title})
+	}
+	if outputEncoding == outputEncodingBase64 {
+		for _, img := range resp.Images {
+			out.Images = append(out.Images, structuredImage{
+				MIMEType: img.MIMEType,
+				Bytes:    len(img.Data),
+				Encoding: outputEncodingBase64,
+				Data:     base64.StdEncoding.EncodeToString(img.Data),
+			})
+		}
+	}
+	return out
+}
+
+// formatStructuredOutput は、応答とメタ情報を format (json または yaml) の文字列に変換します。
+func formatStructuredOutput(resp *ai.Response, format string) (string, error) {
+	out := newStructuredOutput(resp)
+	if format == outputFormatJSON {
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("応答の JSON への変換に失敗しました: %w", err)
+		}
+		return string(data) + "\n", nil
+	}
+
+	var node yaml.Node
+	if err := node.Encode(out); err != nil {
+		return "", fmt.Errorf("応答の YAML への変換に失敗しました: %w", err)
+	}
+	useLiteralStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return "", fmt.Errorf("応答の YAML への変換に失敗しました: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("応答の YAML への変換に失敗しました: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// useLiteralStyle は、複数行の文字列をブロックスカラー (|) で出力するよう、ノードのスタイルを設定します。
+// 応答のテキストをエスケープされた 1 行ではなく、そのままの改行で読めるようにするためです。
+func useLiteralStyle(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && strings.Contains(node.Value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	for _, child := range node.Content {
+		useLiteralStyle(child)
+	}
+}
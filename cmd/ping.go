@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/spf13/cobra"
+)
+
+// NewPingCmd は 'ping' コマンドを構築します。
+func NewPingCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ping",
+		Short: "API キーと Gemini API への接続を確認します。",
+		Long: `このコマンドは、生成より安価なトークン数の計算を 1 回だけ呼び出し、API キーと接続が有効かどうかを確認します。
+成功した場合は OK と応答までの時間を表示します。バッチ処理の前の事前チェックに使えます。
+API キーが無効な場合は終了コード 2、接続できない場合は終了コード 4 で、原因を表示して終了します。
+--model で指定したモデルを使って確認します (存在しないモデルの場合もエラーになります)。リトライはしません。
+--provider gemini のみ対応しています。
+
+利用例:
+  ai-client ping
+  ai-client ping && ai-client summarize -i report.md`,
+		Args: cobra.NoArgs,
+		RunE: withCommandTimeout(executePingCommand),
+	}
+}
+
+// executePingCommand は 'ping' サブコマンドの実際の実行ロジックを保持します。
+func executePingCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if provider != providerGemini {
+		return &invalidInputError{err: fmt.Errorf("ping は --provider %s でのみ使用できます", providerGemini)}
+	}
+
+	client, err := newGeminiClient(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+
+	start := time.Now()
+	if err := client.PingModel(ctx, modelName); err != nil {
+		// 認証の失敗は API が 400 で返す場合もあるため、終了コードが認証エラーになるよう包みます
+		if errors.Is(err, gemini.ErrUnauthorized) {
+			return &authError{err: err}
+		}
+		return err
+	}
+	elapsed := time.Since(start).Round(time.Millisecond)
+	slog.DebugContext(ctx, "疎通を確認しました", "model", modelName, "elapsed", elapsed)
+	fmt.Fprintf(cmd.OutOrStdout(), "OK (model: %s, %s)\n", modelName, elapsed)
+	return nil
+}
@@ -3,15 +3,18 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"time"
+	"strings"
 
-	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
 	"github.com/shouni/go-ai-client/v2/pkg/prompts"
 	"github.com/spf13/cobra"
 )
 
-// promptMode は 'prompt' サブコマンド固有のフラグ変数を定義
-var promptMode string
+// 'prompt' サブコマンド固有のフラグ変数を定義
+var (
+	promptMode      string
+	promptListModes bool
+)
 
 // NewPromptCmd は 'prompt' コマンドを構築します。
 func NewPromptCmd() *cobra.Command {
@@ -24,12 +27,22 @@ func NewPromptCmd() *cobra.Command {
 利用例:
   ai-client prompt "Go言語の並行処理について" -d solo
   ai-client prompt "猫と魚の会話" -d dialogue
+  ai-client prompt --list-modes
 `,
+		// --list-modes ではモデルを呼び出さないため、APIキーのチェックを省略
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if promptListModes {
+				return initOfflinePreRunE(cmd, args)
+			}
+			return initAppPreRunE(cmd, args)
+		},
 		// コマンドの実行ロジックを外部関数に委譲
-		RunE: executePromptCommand,
+		RunE: withCommandTimeout(allowEmptyInput(executePromptCommand)),
 	}
 
-	cmd.Flags().StringVarP(&promptMode, "mode", "d", "solo", "生成するスクリプトのモード (solo, dialogue)")
+	addInputFileFlag(cmd)
+	cmd.Flags().StringVarP(&promptMode, "mode", "d", "solo", "生成するスクリプトのモード (一覧は --list-modes で確認できます)")
+	cmd.Flags().BoolVar(&promptListModes, "list-modes", false, "利用可能なモードを1行に1つずつ表示して終了する")
 
 	return cmd
 }
@@ -38,35 +51,47 @@ func NewPromptCmd() *cobra.Command {
 func executePromptCommand(cmd *cobra.Command, args []string) error {
 	commandCtx := cmd.Context()
 
+	builder, err := prompts.NewPromptBuilder()
+	if err != nil {
+		return fmt.Errorf("プロンプトの構築に失敗しました: %w", err)
+	}
+
+	// --list-modes の場合は、入力を読まずにモードの一覧だけを表示する
+	if promptListModes {
+		fmt.Fprintln(cmd.OutOrStdout(), strings.Join(builder.ListModes(), "\n"))
+		return nil
+	}
+
 	// 1. 入力内容の決定
 	inputText, err := readInput(cmd, args)
 	if err != nil {
 		return err // readInput内で十分なエラーメッセージが出ていると想定
 	}
 
-	// 2. プロンプトの構築
-	builder, err := prompts.NewPromptBuilder()
-	if err != nil {
-		return fmt.Errorf("プロンプトの構築に失敗しました: %w", err)
+	// 2. モードの確認 (不明なモードの場合は利用可能なモードを示す)
+	if !builder.HasMode(promptMode) {
+		return &invalidInputError{err: fmt.Errorf("不明なモードです: '%s' (利用可能なモード: %s)", promptMode, strings.Join(builder.ListModes(), ", "))}
 	}
-	templateData := prompts.TemplateData{Content: string(inputText)}
-	finalPrompt, err := builder.Build(templateData, promptMode)
 
-	// 3. クライアント初期化と実行 (タイムアウト適用)
-	client, err := gemini.NewClientFromEnv(commandCtx)
+	// 3. クライアント初期化と実行 (Runner がタイムアウトを適用)
+	client, err := newClient(cmd)
 	if err != nil {
 		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
 	}
 
-	// タイムアウトコンテキストの適用 (Timeout グローバル変数を使用)
-	clientCtx, cancel := context.WithTimeout(commandCtx, time.Duration(timeout)*time.Second)
-	defer cancel()
-
-	generateContent, err := client.GenerateContent(clientCtx, finalPrompt, modelName)
+	r, err := newRunner(client, builder)
+	if err != nil {
+		return err
+	}
+	generateContent, err := withSpinner(commandCtx, cmd, func(ctx context.Context) (*ai.Response, error) {
+		return r.Run(ctx, string(inputText), inputSourceName(cmd, args), promptMode, modelName)
+	})
 	if err != nil {
-		return fmt.Errorf("AIコンテンツ生成中にエラーが発生しました: %w", err)
+		return err
 	}
+	outputTemplateName = r.ResolveTemplateName(promptMode)
+	outputMode = promptMode
 
 	// 4. 結果の出力
-	return GenerateAndOutput(commandCtx, generateContent.Text)
+	return GenerateAndOutput(commandCtx, generateContent)
 }
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+// 'render' サブコマンド固有のフラグ変数を定義
+var (
+	renderMode string
+	renderVars map[string]string
+)
+
+// NewRenderCmd は 'render' コマンドを構築します。
+func NewRenderCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render [TEXT or pipe]",
+		Short: "モデルを呼び出さずに、テンプレートを適用した最終的なプロンプトを表示します。",
+		Long: `このコマンドは、入力テキストに指定したモードのテンプレートを適用し、モデルに送られるはずの
+プロンプトをそのまま標準出力に表示します。API は呼び出さず、APIキーも不要なため、
+キーのない環境でのテンプレートのデバッグに利用できます。
+入力は generic と同様に、引数・標準入力・-i (複数指定可) から読み込みます。
+テンプレートが {{.Vars.名前}} を参照している場合や --var を指定した場合は、標準エラー出力に変数ごとの値を表示し、
+参照されているのに設定されていない変数と、指定したのに参照されていない変数を警告します。
+
+利用例:
+  ai-client render -d solo "Go言語の並行処理について"
+  ai-client render -d translate --var to=English --var from=日本語 -i README.md`,
+
+		// APIキーのチェックを行わないよう、ルートの PersistentPreRunE を上書き
+		PersistentPreRunE: initOfflinePreRunE,
+		RunE:              allowEmptyInput(executeRenderCommand),
+	}
+
+	addInputFileFlag(cmd)
+	cmd.Flags().StringVarP(&renderMode, "mode", "d", "solo", "適用するテンプレートのモード")
+	cmd.Flags().StringToStringVar(&renderVars, "var", nil, "テンプレートに {{.Vars.名前}} として渡す変数 (名前=値、複数指定可)")
+
+	return cmd
+}
+
+// executeRenderCommand は 'render' サブコマンドの実際の実行ロジックを保持します。
+func executeRenderCommand(cmd *cobra.Command, args []string) error {
+	// 1. 入力内容の決定
+	inputText, err := readInput(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	// 2. ビルダーの初期化とモードの確認
+	builder, err := prompts.NewPromptBuilder()
+	if err != nil {
+		return fmt.Errorf("プロンプトの構築に失敗しました: %w", err)
+	}
+	if !builder.HasMode(renderMode) {
+		return &invalidInputError{err: fmt.Errorf("不明なモードです: '%s' (利用可能なモード: %s)", renderMode, strings.Join(builder.ListModes(), ", "))}
+	}
+
+	// 3. プロンプトの構築 (モデルは呼び出さないため、ジェネレーターは不要)
+	r := runner.NewRunner(nil, builder)
+	r.Vars = renderVars
+	finalPrompt, err := r.BuildFullPrompt(string(inputText), inputSourceName(cmd, args), renderMode)
+	if err != nil {
+		return &invalidInputError{err: err}
+	}
+
+	// 4. 結果の出力 (パイプで扱いやすいよう、装飾は付けない)
+	fmt.Fprintln(cmd.OutOrStdout(), finalPrompt)
+
+	// 5. 変数の展開結果を標準エラー出力に表示 (プロンプトの出力には混ぜない)
+	usages, err := builder.ResolveVars(renderMode, renderVars)
+	if err != nil {
+		return err
+	}
+	if len(usages) > 0 {
+		fmt.Fprint(cmd.ErrOrStderr(), formatVarUsages(usages))
+	}
+	return nil
+}
+
+// formatVarUsages は、テンプレートの変数ごとの値と、未設定・未使用の警告を整形します。
+func formatVarUsages(usages []prompts.VarUsage) string {
+	var sb strings.Builder
+	sb.WriteString("\n" + separatorLight)
+	sb.WriteString("\n変数:")
+	for _, u := range usages {
+		switch {
+		case !u.Set:
+			sb.WriteString(fmt.Sprintf("\n  ⚠️ %s: (未設定。空文字列として展開されます)", u.Name))
+		case !u.Referenced:
+			sb.WriteString(fmt.Sprintf("\n  ⚠️ %s = %q (テンプレートで参照されていません)", u.Name, u.Value))
+		default:
+			sb.WriteString(fmt.Sprintf("\n  %s = %q", u.Name, u.Value))
+		}
+	}
+	sb.WriteString("\n" + separatorLight + "\n")
+	return sb.String()
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+	"github.com/spf13/cobra"
+)
+
+// reviewMode は、コードレビューに使用する組み込みテンプレートのモード名です。
+const reviewMode = "review"
+
+// 'review' サブコマンド固有のフラグ変数を定義
+var (
+	reviewGit    bool
+	reviewStaged bool
+	reviewFocus  string
+)
+
+// NewReviewCmd は 'review' コマンドを構築します。
+func NewReviewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "review [DIFF or pipe]",
+		Short: "組み込みのレビューテンプレートを使用して、差分をコードレビューします。",
+		Long: `このコマンドは、unified diff 形式の差分をモデルに渡し、概要・重大な問題・改善の提案・軽微な指摘・総評の見出しで
+構成されたレビューを出力します。差分は generic と同様に、引数・標準入力・-i (複数指定可) から読み込みます。
+--git を指定すると、カレントディレクトリのリポジトリで git diff を実行し、作業ツリーの未ステージの変更をレビューします
+(--staged ではステージした変更)。--focus で重点的に確認する観点を指定できます。
+
+利用例:
+  ai-client review --git
+  ai-client review --staged --focus "エラー処理, 並行処理"
+  git diff main...feature | ai-client review
+  ai-client review -i change.patch --output-format json`,
+
+		RunE: withCommandTimeout(allowEmptyInput(executeReviewCommand)),
+	}
+
+	addInputFileFlag(cmd)
+	cmd.Flags().BoolVar(&reviewGit, "git", false, "カレントディレクトリのリポジトリで git diff を実行し、その差分をレビューする")
+	cmd.Flags().BoolVar(&reviewStaged, "staged", false, "git diff --staged でステージした変更をレビューする (--git を含みます)")
+	cmd.Flags().StringVar(&reviewFocus, "focus", "", "重点的に確認する観点 (例: セキュリティ, 性能)")
+
+	return cmd
+}
+
+// executeReviewCommand は 'review' サブコマンドの実際の実行ロジックを保持します。
+func executeReviewCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	// 1. 差分の決定 (--git / --staged の場合は git diff の出力)
+	var diff []byte
+	var sourceName string
+	var err error
+	if reviewGit || reviewStaged {
+		if len(args) > 0 || len(inputFiles) > 0 {
+			return &invalidInputError{err: errors.New("--git と --staged は、引数や -i の入力とは同時に指定できません")}
+		}
+		diff, sourceName, err = readGitDiff(ctx, reviewStaged)
+	} else {
+		diff, err = readInput(cmd, args)
+		sourceName = inputSourceName(cmd, args)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 2. クライアントとビルダーの初期化
+	client, err := newClient(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+	builder, err := prompts.NewPromptBuilder()
+	if err != nil {
+		return fmt.Errorf("プロンプトの構築に失敗しました: %w", err)
+	}
+
+	// 3. 重点的に確認する観点をテンプレート変数として渡して実行
+	r, err := newRunner(client, builder)
+	if err != nil {
+		return err
+	}
+	r.Vars = map[string]string{"focus": reviewFocus}
+	generateContent, err := withSpinner(ctx, cmd, func(ctx context.Context) (*ai.Response, error) {
+		return r.Run(ctx, string(diff), sourceName, reviewMode, modelName)
+	})
+	if err != nil {
+		return err
+	}
+	outputTemplateName = r.ResolveTemplateName(reviewMode)
+	outputMode = reviewMode
+
+	// 4. 結果の出力
+	return GenerateAndOutput(ctx, generateContent)
+}
+
+// readGitDiff は、カレントディレクトリのリポジトリで git diff を実行し、差分と入力元の名前を返します。
+// staged が true の場合は、ステージした変更 (git diff --staged) を返します。
+func readGitDiff(ctx context.Context, staged bool) ([]byte, string, error) {
+	sourceName := "git diff"
+	args := []string{"diff", "--no-color", "--no-ext-diff"}
+	if staged {
+		sourceName += " --staged"
+		args = append(args, "--staged")
+	}
+
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, "", &invalidInputError{err: fmt.Errorf("%s の実行に失敗しました: %s", sourceName, strings.TrimSpace(string(exitErr.Stderr)))}
+		}
+		return nil, "", &invalidInputError{err: fmt.Errorf("%s の実行に失敗しました: %w", sourceName, err)}
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		hint := "ステージした変更は --staged でレビューできます"
+		if staged {
+			hint = "未ステージの変更は --git でレビューできます"
+		}
+		return nil, "", &emptyInputError{msg: fmt.Sprintf("入力エラー: %s に差分がありません (%s)", sourceName, hint)}
+	}
+	return out, sourceName, nil
+}
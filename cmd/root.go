@@ -1,44 +1,195 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
 	clibase "github.com/shouni/go-cli-base"
 	"github.com/spf13/cobra"
 )
 
 // グローバルなフラグ変数（PersistentFlagsで設定される）
 var (
-	modelName string
-	timeout   int
+	modelName      string
+	timeout        int
+	showCitations  bool
+	enableSearch   bool
+	stopSequences  []string
+	seed           int32
+	temperature    float32
+	candidates     int32
+	rpm            int
+	rawConfig      string
+	provider       string
+	stripFences    bool
+	trimResponse   bool
+	trimPhrases    []string
+	debugRequest   bool
+	thinkingBudget int32
+	modalities     []string
+	baseURL        string
+	maxInputBytes  int
+	inputFormat    string
+	jsonSchemaFile string
+	templateName   string
+	autoContinue   int
+	maxTokens      int32
+	keyRotation    string
+
+	retries           uint64
+	noRetry           bool
+	retryInitialDelay time.Duration
+	retryMaxDelay     time.Duration
+)
+
+// 利用可能な AI プロバイダ
+const (
+	providerGemini = "gemini"
+	providerOpenAI = "openai"
+
+	// defaultOpenAIModel は --provider openai で --model が未指定の場合に使用するモデル名です。
+	defaultOpenAIModel = "gpt-4o-mini"
 )
 
 var genericCmd *cobra.Command
 var promptCmd *cobra.Command
+var validateTemplatesCmd *cobra.Command
+var serveCmd *cobra.Command
+var translateCmd *cobra.Command
+var summarizeCmd *cobra.Command
+var renderCmd *cobra.Command
+var transcribeCmd *cobra.Command
+var benchCmd *cobra.Command
+var chatCmd *cobra.Command
+var sessionsCmd *cobra.Command
+var generateImageCmd *cobra.Command
+var pingCmd *cobra.Command
+var reviewCmd *cobra.Command
 
 // init 関数でサブコマンドを初期化し、rootCmdに追加する準備をします。
 func init() {
 	// 依存関係を初期化
 	genericCmd = NewGenericCmd()
 	promptCmd = NewPromptCmd()
+	validateTemplatesCmd = NewValidateTemplatesCmd()
+	serveCmd = NewServeCmd()
+	translateCmd = NewTranslateCmd()
+	summarizeCmd = NewSummarizeCmd()
+	renderCmd = NewRenderCmd()
+	transcribeCmd = NewTranscribeCmd()
+	benchCmd = NewBenchCmd()
+	chatCmd = NewChatCmd()
+	sessionsCmd = NewSessionsCmd()
+	generateImageCmd = NewGenerateImageCmd()
+	pingCmd = NewPingCmd()
+	reviewCmd = NewReviewCmd()
 }
 
 // addAppPersistentFlags は、アプリケーション全体で利用可能な永続フラグを追加します。
 // clibase.Execute に渡されます。
 func addAppPersistentFlags(rootCmd *cobra.Command) {
-	rootCmd.PersistentFlags().IntVarP(&timeout, "timeout", "t", 60, "APIリクエストのタイムアウト時間 (秒)")
-	rootCmd.PersistentFlags().StringVarP(&modelName, "model", "m", "gemini-2.5-flash", "使用するGeminiモデル名")
+	rootCmd.PersistentFlags().IntVarP(&timeout, "timeout", "t", 60, "コマンド全体のタイムアウト時間 (秒)。プロンプト構築、API 呼び出し、すべてのリトライを含み、期限を過ぎるとリトライを打ち切ります (serve と bench ではリクエストごと、chat ではメッセージごと、transcribe では生成の呼び出しに適用)")
+	rootCmd.PersistentFlags().StringVarP(&modelName, "model", "m", "gemini-2.5-flash", "使用するモデル名")
+	rootCmd.PersistentFlags().BoolVar(&showCitations, "show-citations", false, "応答の末尾に出典情報を表示する")
+	rootCmd.PersistentFlags().BoolVar(&enableSearch, "search", false, "Google 検索によるグラウンディングを有効にする (対応モデルのみ)")
+	rootCmd.PersistentFlags().StringArrayVar(&stopSequences, "stop", nil, "生成を打ち切る停止シーケンス (複数指定可、最大5個)")
+	rootCmd.PersistentFlags().Int32Var(&seed, "seed", 0, "乱数シード (--temperature 0 と併用すると再現性のある出力になります)")
+	rootCmd.PersistentFlags().Uint64Var(&retries, "retries", gemini.DefaultMaxRetries, "一時的なエラー時の最大リトライ回数 (0 でリトライしない。--no-retry と同じ)")
+	rootCmd.PersistentFlags().BoolVar(&noRetry, "no-retry", false, "一時的なエラーでもリトライせず、待たずにすぐ失敗する (--retries 0 と同じで、--retries より優先。開発中の確認向け)")
+	rootCmd.PersistentFlags().DurationVar(&retryInitialDelay, "retry-initial-delay", gemini.DefaultInitialDelay, "リトライ開始時の待機時間 (以降は指数的に増加)")
+	rootCmd.PersistentFlags().DurationVar(&retryMaxDelay, "retry-max-delay", gemini.DefaultMaxDelay, "リトライ間隔の上限")
+	rootCmd.PersistentFlags().IntVar(&rpm, "rpm", 0, "1分あたりのリクエスト数の上限。超えないように送信前に待機します (0 で無制限。--provider gemini のみ)")
+	rootCmd.PersistentFlags().IntVar(&maxInputBytes, "max-input", 0, "受け付ける入力の最大バイト数 (0 で無制限)")
+	rootCmd.PersistentFlags().BoolVar(&allowEmpty, "allow-empty", false, "入力が空の場合もエラーにせず、何も出力せずに正常終了する (パイプライン向け)")
+	rootCmd.PersistentFlags().BoolVar(&useClipboard, "clipboard", false, "引数もパイプ入力もない場合に、システムのクリップボードのテキストを入力として使う")
+	rootCmd.PersistentFlags().BoolVar(&copyResponse, "copy", false, "応答のテキストをシステムのクリップボードにもコピーする (コピーできない場合は警告のみ)")
+	rootCmd.PersistentFlags().BoolVar(&copyOnly, "copy-only", false, "応答のテキストをクリップボードにコピーし、標準出力には出力しない (コピーできない場合は標準出力に出力)")
+	rootCmd.PersistentFlags().StringVar(&inputFormat, "input-format", string(runner.InputFormatRaw), "入力の形式 (raw, html, markdown)。html はタグを、markdown は記法を取り除いてからプロンプトを構築します")
+	rootCmd.PersistentFlags().StringVar(&jsonSchemaFile, "json-schema", "", "応答を JSON に限定し、指定した JSON Schema ファイルで検証する (--provider gemini のみ)")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output-format", outputFormatText, "応答の出力形式 (text, json, yaml)。json と yaml では応答のテキストとモデル名、トークン使用量などのメタ情報を構造化して出力します")
+	rootCmd.PersistentFlags().StringVar(&outputTemplateText, "output-template", "", "text 形式の出力を整形する Go テンプレート (.Model, .ResponseModel, .Mode, .Template, .Text, .Usage, .Citations, .Images, .Report, .Timestamp が使えます。未指定の場合は見出しとセパレータ付きの既定の形式)")
+	rootCmd.PersistentFlags().StringVar(&outputEncoding, "encode", outputEncodingNone, "応答に含まれる画像などのバイナリの出力のエンコード (none, base64)。none ではテキストの応答だけを出力し、base64 では画像を base64 で出力します (generate-image では保存・出力する画像に適用)")
+	rootCmd.PersistentFlags().IntVar(&maxOutputChars, "max-output-chars", 0, "表示する応答を先頭からこの文字数に切り詰め、省略記号と注記を付ける (0 で無制限。API のリクエストやクリップボードへのコピーには影響しません)")
+	rootCmd.PersistentFlags().IntVar(&maxOutputLines, "max-output-lines", 0, "表示する応答を先頭からこの行数に切り詰め、省略記号と注記を付ける (0 で無制限。API のリクエストやクリップボードへのコピーには影響しません)")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "応答を待っている間のスピナーなど、進行状況を表示しない")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "色付きの表示とスピナーを無効にする (環境変数 NO_COLOR でも無効になります)")
+	rootCmd.PersistentFlags().BoolVar(&stripFences, "strip-fences", false, "応答全体を囲む Markdown のコードブロック (```json など) を取り除く")
+	rootCmd.PersistentFlags().BoolVar(&trimResponse, "trim", false, "応答の前後の空白と、冒頭の前置き (\"Sure, here is...:\" など) を取り除く")
+	rootCmd.PersistentFlags().StringArrayVar(&trimPhrases, "trim-phrase", nil, "--trim で取り除く前置きの言葉 (複数指定可。指定すると既定の一覧の代わりに使います)")
+	rootCmd.PersistentFlags().StringVar(&templateName, "prompt-template-name", "", "ログと出力のメタ情報に表示するテンプレート名 (未指定の場合は実際に使ったテンプレートのファイル名や builtin:<モード>)")
+	rootCmd.PersistentFlags().StringVar(&rawConfig, "raw-config", "", `生成設定を JSON で直接指定する (例: '{"topK":20}')。他のフラグと重なった場合はフラグが優先 (--provider gemini のみ)`)
+	rootCmd.PersistentFlags().StringVar(&keyRotation, "key-rotation", string(gemini.RoundRobin), "環境変数 GEMINI_API_KEYS (カンマ区切り) で複数の API キーを指定した場合の使い分け方 (round-robin, least-recently-rate-limited。--provider gemini のみ)")
+	rootCmd.PersistentFlags().Int32Var(&maxTokens, "max-tokens", 0, "応答の出力トークン数の上限 (0 でモデルの既定値。--provider gemini のみ)")
+	rootCmd.PersistentFlags().IntVar(&autoContinue, "auto-continue", 0, "応答が出力トークンの上限で打ち切られた場合に、続きを頼んで連結する最大回数 (0 で無効。--provider gemini のみ)")
+	rootCmd.PersistentFlags().BoolVar(&debugRequest, "debug-request", false, "API に送信するコンテンツと生成設定を JSON でデバッグログに出力する (ログレベルをデバッグにします。--provider gemini のみ)")
+	rootCmd.PersistentFlags().StringVar(&baseURL, "base-url", "", "API の接続先を差し替える (モックサーバーやリージョンのエンドポイント用。--provider gemini のみ。openai では OPENAI_BASE_URL を使用)")
+	rootCmd.PersistentFlags().StringVar(&provider, "provider", providerGemini, "使用する AI プロバイダ (gemini, openai)")
+	rootCmd.PersistentFlags().Float32Var(&temperature, "temperature", gemini.DefaultTemperature, "応答の創造性 (0.0〜1.0)")
+	rootCmd.PersistentFlags().Int32Var(&thinkingBudget, "thinking-budget", 0, "思考に使うトークン数の上限。大きいほど品質が上がりやすく応答は遅くなります (0 で思考なし、-1 でモデルに任せる。未指定時はモデルの既定値。--provider gemini のみ)")
+	rootCmd.PersistentFlags().StringSliceVar(&modalities, "modalities", nil, "応答に含める種類をカンマ区切りで指定する (TEXT, IMAGE, AUDIO。例: TEXT,IMAGE でテキストと画像を 1 つの応答で受け取る。画像は --encode base64 で出力。未指定時はモデルの既定値。--provider gemini のみ)")
+	rootCmd.PersistentFlags().Int32Var(&candidates, "candidates", 1, "生成する候補の数 (1 以上。2 以上の場合は候補ごとに番号付きで表示します。--provider gemini のみ)")
+	rootCmd.PersistentFlags().StringVar(&systemPrompt, "system", "", "すべてのリクエストに付けるシステム指示 (--system-file とは同時に指定できません)")
+	rootCmd.PersistentFlags().StringVar(&systemFile, "system-file", "", "システム指示を読み込むファイル。末尾の空白と改行は取り除きます (--system とは同時に指定できません)")
+	rootCmd.PersistentFlags().StringVar(&creativity, "creativity", "", "応答の創造性のプリセット (deterministic, balanced, creative)。--temperature より優先されます")
 }
 
 // --- メイン実行関数 ---
 
 // Execute は、CLIアプリケーションのエントリポイントです。
 // アプリケーション固有のサブコマンドとカスタマイズ関数をルートコマンドに追加し、実行します。
+// エラー時は、エラーの種類に応じた終了コード (exitcode.go を参照) で終了します。
 func Execute() {
-	// clibase.Execute を使用して、アプリケーションの実行に必要なすべてを設定し、実行します。
-	clibase.Execute(
+	// clibase.Execute は常に終了コード 1 で終了するため、ルートコマンドの構築のみを clibase に任せます。
+	rootCmd := clibase.NewRootCmd(
 		"go-ai-client", // アプリケーション名
 		addAppPersistentFlags,
 		initAppPreRunE,
+	)
+	rootCmd.AddCommand(
 		genericCmd,
 		promptCmd,
+		validateTemplatesCmd,
+		serveCmd,
+		translateCmd,
+		summarizeCmd,
+		renderCmd,
+		transcribeCmd,
+		benchCmd,
+		chatCmd,
+		sessionsCmd,
+		generateImageCmd,
+		pingCmd,
+		reviewCmd,
 	)
+	// フラグの誤りは入力エラーとして扱います
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &invalidInputError{err: err}
+	})
+
+	// Ctrl-C (SIGINT) / SIGTERM でルートコンテキストをキャンセルし、処理中の API 呼び出しを中断します。
+	// 2 回目のシグナルは stop 後のデフォルト動作 (即時終了) に任せます。
+	// コマンドの終了を待たずに済むよう、最初のシグナルを受け取った時点で stop します。
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if err == nil {
+		return
+	}
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "\n⏹️  キャンセルされました")
+	}
+	stop()
+	os.Exit(exitCodeFor(err))
 }
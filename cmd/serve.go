@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+// serveShutdownTimeout は、シャットダウン時に処理中のリクエストの完了を待つ最大時間です。
+const serveShutdownTimeout = 30 * time.Second
+
+// serveMaxRequestBytes は、POST /generate で受け付けるリクエストボディの最大バイト数です。
+// --max-input による入力の上限とは別に、JSON の解析の前にメモリの使用量を抑えるための上限です。
+const serveMaxRequestBytes = 10 * 1024 * 1024
+
+// servePort は 'serve' サブコマンド固有のフラグ変数を定義
+var servePort int
+
+// generateRequest は POST /generate のリクエストボディです。
+type generateRequest struct {
+	Prompt string `json:"prompt"`
+	Mode   string `json:"mode"`
+	Model  string `json:"model"`
+}
+
+// generateResponse は POST /generate のレスポンスボディです。
+type generateResponse struct {
+	Text     string `json:"text,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Template string `json:"template,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewServeCmd は 'serve' コマンドを構築します。
+func NewServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "HTTP サーバーとして起動し、POST /generate でコンテンツ生成を受け付けます。",
+		Long: `このコマンドは HTTP サーバーを起動し、以下のエンドポイントを公開します。
+
+  POST /generate  {"prompt": "...", "mode": "solo", "model": "..."} を受け取り、生成結果を JSON で返します。
+                  mode を省略するとテンプレートを使わず、model を省略すると --model の値を使用します。
+  GET  /healthz   ヘルスチェック用に 200 を返します。
+
+各リクエストには --timeout が適用されます。SIGTERM / SIGINT を受け取ると、処理中のリクエストの完了を待ってから終了します。
+
+利用例:
+  ai-client serve --port 8080`,
+
+		RunE:         executeServeCommand,
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().IntVar(&servePort, "port", 8080, "待ち受けるポート番号")
+
+	return cmd
+}
+
+// executeServeCommand は 'serve' サブコマンドの実際の実行ロジックを保持します。
+func executeServeCommand(cmd *cobra.Command, args []string) error {
+	client, err := newClient(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+	builder, err := prompts.NewPromptBuilder()
+	if err != nil {
+		return fmt.Errorf("プロンプトの構築に失敗しました: %w", err)
+	}
+
+	r, err := newRunner(client, builder)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /generate", newGenerateHandler(r, builder))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", servePort),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("HTTP サーバーを起動しました", "addr", srv.Addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("HTTP サーバーが異常終了しました: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("シャットダウンしています...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("HTTP サーバーのシャットダウンに失敗しました: %w", err)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("HTTP サーバーが異常終了しました: %w", err)
+	}
+	return nil
+}
+
+// newGenerateHandler は、Runner を使ってリクエストを処理する POST /generate のハンドラを返します。
+// リクエストのコンテキストを Runner に渡すため、クライアントが切断すると生成も中断されます。
+// 不明なモード、大きすぎる入力などのクライアント側の誤りは 4xx で返します。
+func newGenerateHandler(r *runner.Runner, builder *prompts.PromptBuilder) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var body generateRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, serveMaxRequestBytes)).Decode(&body); err != nil {
+			status := http.StatusBadRequest
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeJSON(w, status, generateResponse{Error: fmt.Sprintf("リクエストボディの解析に失敗しました: %v", err)})
+			return
+		}
+		if body.Mode != "" && !builder.HasMode(body.Mode) {
+			writeJSON(w, http.StatusBadRequest, generateResponse{Error: fmt.Sprintf("不明なモードです: '%s' (利用可能なモード: %s)", body.Mode, strings.Join(builder.ListModes(), ", "))})
+			return
+		}
+
+		model := resolveModelAlias(body.Model)
+		if model == "" {
+			model = modelName
+		}
+
+		result, err := r.RunWithResult(req.Context(), body.Prompt, "http", body.Mode, model)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "コンテンツ生成に失敗しました", "error", err)
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, runner.ErrEmptyInput):
+				status = http.StatusBadRequest
+			case errors.Is(err, runner.ErrInputTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			case errors.Is(err, context.DeadlineExceeded):
+				status = http.StatusGatewayTimeout
+			}
+			writeJSON(w, status, generateResponse{Error: err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, generateResponse{Text: result.Text, Model: result.Response.ModelName, Template: result.TemplateName})
+	}
+}
+
+// writeJSON は、値を JSON としてレスポンスに書き込みます。
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("レスポンスの書き込みに失敗しました", "error", err)
+	}
+}
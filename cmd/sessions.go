@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/genai"
+)
+
+// sessionsDirName は、チャットの履歴を保存するディレクトリ名です (設定ディレクトリの下)。
+const sessionsDirName = "sessions"
+
+// sessionNamePattern は、セッション名として使える文字列です。ファイル名にそのまま使うため、パスの区切りなどは使えません。
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// chatSessionFile は、セッションの履歴ファイル (JSON) の内容です。
+type chatSessionFile struct {
+	Model     string           `json:"model"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	History   []*genai.Content `json:"history"`
+}
+
+// sessionsDir は、セッションの履歴ファイルを保存するディレクトリ ($XDG_CONFIG_HOME/go-ai-client/sessions など) を返します。
+func sessionsDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("セッションを保存するディレクトリを特定できません: %w", err)
+	}
+	return filepath.Join(dir, configDirName, sessionsDirName), nil
+}
+
+// sessionPath は、セッション名を検証し、その履歴ファイルのパスを返します。
+func sessionPath(name string) (string, error) {
+	if !sessionNamePattern.MatchString(name) {
+		return "", &invalidInputError{err: fmt.Errorf("セッション名 '%s' は使用できません (英数字、'-'、'_'、'.' のみ)", name)}
+	}
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// loadChatSession は、セッションの履歴を読み込みます。ファイルがない場合は空の履歴を返します。
+// ファイルが壊れている場合 (書き込み途中で中断された場合など) は、警告を出力して空の履歴から始めます。
+func loadChatSession(name string) ([]*genai.Content, error) {
+	path, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("セッション '%s' の読み込みに失敗しました: %w", name, err)
+	}
+
+	var file chatSessionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		slog.Warn("セッションの履歴ファイルが壊れているため、新しい会話として始めます", "session", name, "path", path, "error", err)
+		return nil, nil
+	}
+	return file.History, nil
+}
+
+// saveChatSession は、セッションの履歴を保存します。
+// 書き込み途中で中断されても既存の履歴が壊れないよう、一時ファイルに書き込んでから置き換えます。
+func saveChatSession(name, model string, history []*genai.Content) error {
+	path, err := sessionPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(chatSessionFile{Model: model, UpdatedAt: time.Now(), History: history}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("セッション '%s' の変換に失敗しました: %w", name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("セッションを保存するディレクトリの作成に失敗しました: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("セッション '%s' の保存に失敗しました: %w", name, err)
+	}
+	defer os.Remove(tmp.Name()) // 置き換えに成功した場合は存在しないため、エラーは無視します
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("セッション '%s' の保存に失敗しました: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("セッション '%s' の保存に失敗しました: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("セッション '%s' の保存に失敗しました: %w", name, err)
+	}
+	return nil
+}
+
+// NewSessionsCmd は 'sessions' コマンドと、その 'list'、'delete' サブコマンドを構築します。
+func NewSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "chat --session で保存した会話の履歴を管理します。",
+		// APIキーのチェックを行わないよう、ルートの PersistentPreRunE を上書き
+		PersistentPreRunE: initOfflinePreRunE,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "保存されているセッションの一覧を表示します。",
+		Args:  cobra.NoArgs,
+		RunE:  executeSessionsListCommand,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete <name>...",
+		Short: "保存されているセッションを削除します。",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  executeSessionsDeleteCommand,
+	})
+
+	return cmd
+}
+
+// executeSessionsListCommand は、セッション名、モデル名、ターン数、最終更新日時を一覧で表示します。
+func executeSessionsListCommand(cmd *cobra.Command, args []string) error {
+	dir, err := sessionsDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("セッションの一覧の取得に失敗しました: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(cmd.ErrOrStderr(), "保存されているセッションはありません。")
+		return nil
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tMODEL\tTURNS\tUPDATED")
+	for _, name := range names {
+		var file chatSessionFile
+		data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+		if err == nil {
+			err = json.Unmarshal(data, &file)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t(読み込めません)\n", name)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", name, file.Model, len(file.History), file.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
+
+// executeSessionsDeleteCommand は、指定されたセッションの履歴ファイルを削除します。
+func executeSessionsDeleteCommand(cmd *cobra.Command, args []string) error {
+	for _, name := range args {
+		path, err := sessionPath(name)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return &invalidInputError{err: fmt.Errorf("セッション '%s' は存在しません", name)}
+			}
+			return fmt.Errorf("セッション '%s' の削除に失敗しました: %w", name, err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "セッション '%s' を削除しました。\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/spf13/cobra"
+)
+
+// spinnerFrames は、スピナーで順番に表示する記号です。
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinnerInterval は、スピナーの記号を切り替える間隔です。
+const spinnerInterval = 100 * time.Millisecond
+
+// スピナーの表示に使う ANSI エスケープシーケンスです。
+const (
+	ansiCyan      = "\033[36m"
+	ansiYellow    = "\033[33m"
+	ansiReset     = "\033[0m"
+	ansiClearLine = "\r\033[K"
+)
+
+// 'quiet' と 'no-color' フラグの値です。
+var (
+	quiet   bool
+	noColor bool
+)
+
+// spinnerMu は、スピナーの状態と標準エラー出力への書き込みを保護します。
+// スピナーの行とログの行が混ざらないよう、ログの書き込み (spinnerLogWriter) もこのロックの下で行います。
+var spinnerMu sync.Mutex
+
+// activeSpinner は、表示中のスピナーです (表示していない場合は nil)。spinnerMu で保護します。
+var activeSpinner *spinner
+
+// spinner は、API の呼び出しを待っている間、標準エラー出力の 1 行に待ち時間とリトライの状況を表示します。
+type spinner struct {
+	w     io.Writer
+	start time.Time
+
+	// frame、message、retry は spinnerMu で保護します。
+	frame   string
+	message string
+	retry   bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// withSpinner は、対話的な端末の場合にスピナーを表示しながら fn を呼び、fn が返ったらスピナーの行を消します。
+// fn には、リトライをスピナーの表示に反映するコンテキストを渡します。
+// 標準出力と標準エラー出力のどちらかが端末でない場合と、--quiet、--no-color または環境変数 NO_COLOR が指定された場合は何も表示しません。
+func withSpinner[T any](ctx context.Context, cmd *cobra.Command, fn func(ctx context.Context) (T, error)) (T, error) {
+	spinnerCtx, stop := startSpinner(ctx, cmd)
+	defer stop()
+	return fn(spinnerCtx)
+}
+
+// startSpinner は、スピナーの表示を始め、リトライを表示に反映するコンテキストと、表示を止める関数を返します。
+// 返された関数は複数回呼んでも構いません。
+func startSpinner(ctx context.Context, cmd *cobra.Command) (context.Context, func()) {
+	if !spinnerEnabled(cmd) {
+		return ctx, func() {}
+	}
+
+	s := &spinner{
+		w:       cmd.ErrOrStderr(),
+		start:   time.Now(),
+		frame:   spinnerFrames[0],
+		message: "応答を待っています...",
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	spinnerMu.Lock()
+	activeSpinner = s
+	spinnerMu.Unlock()
+	go s.run()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(s.stop)
+			<-s.done
+		})
+	}
+	return ai.WithOnRetry(ctx, s.retrying), stop
+}
+
+// spinnerEnabled は、スピナーを表示するかどうかを判定します。
+func spinnerEnabled(cmd *cobra.Command) bool {
+	if quiet || noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(cmd.OutOrStdout()) && isTerminal(cmd.ErrOrStderr())
+}
+
+// run は、止められるまで spinnerInterval ごとにスピナーの行を描き直し、止められたら行を消します。
+func (s *spinner) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		spinnerMu.Lock()
+		s.frame = spinnerFrames[frame%len(spinnerFrames)]
+		s.draw()
+		spinnerMu.Unlock()
+
+		select {
+		case <-s.stop:
+			spinnerMu.Lock()
+			fmt.Fprint(s.w, ansiClearLine)
+			if activeSpinner == s {
+				activeSpinner = nil
+			}
+			spinnerMu.Unlock()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw は、記号とメッセージ、経過時間でスピナーの行を描き直します。リトライ中は記号を黄色で表示します。
+// spinnerMu を取得した状態で呼びます。
+func (s *spinner) draw() {
+	color := ansiCyan
+	if s.retry {
+		color = ansiYellow
+	}
+	elapsed := time.Since(s.start).Truncate(time.Second)
+	fmt.Fprintf(s.w, "%s%s%s%s %s (%s)", ansiClearLine, color, s.frame, ansiReset, s.message, elapsed)
+}
+
+// retrying は、リトライの試行を始めるときに呼ばれ、スピナーのメッセージを切り替えます (ai.RetryFunc)。
+func (s *spinner) retrying(attempt int, err error) {
+	spinnerMu.Lock()
+	defer spinnerMu.Unlock()
+	s.message = fmt.Sprintf("リトライしています (%d 回目の試行)...", attempt)
+	s.retry = true
+}
+
+// spinnerLogWriter は、ログ (slog) の出力先です。スピナーの表示中は、ログの行を書く前にスピナーの行を消し、
+// 書いた後にスピナーの行を描き直します。リトライの警告などのログが、スピナーの行につながって表示されるのを防ぐためです。
+type spinnerLogWriter struct {
+	w io.Writer
+}
+
+func (l spinnerLogWriter) Write(p []byte) (int, error) {
+	spinnerMu.Lock()
+	defer spinnerMu.Unlock()
+	if activeSpinner == nil {
+		return l.w.Write(p)
+	}
+	fmt.Fprint(activeSpinner.w, ansiClearLine)
+	n, err := l.w.Write(p)
+	activeSpinner.draw()
+	return n, err
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+// summarizeMode は、要約に使用する組み込みテンプレートのモード名です。
+const summarizeMode = "summarize"
+
+// defaultChunkSize は、要約時に入力を分割する既定の文字数 (rune 数) です。
+const defaultChunkSize = 20000
+
+// 'summarize' サブコマンド固有のフラグ変数を定義
+var (
+	summarizeLength    string
+	summarizeSentences int
+	summarizeChunkSize int
+)
+
+// NewSummarizeCmd は 'summarize' コマンドを構築します。
+func NewSummarizeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "summarize [TEXT or pipe]",
+		Short: "組み込みの要約テンプレートを使用して、入力テキストを要約します。",
+		Long: `このコマンドは、入力テキストを --length (short, medium, long) または --sentences で指定した長さに要約します。
+入力が --chunk-size を超える場合は、段落単位で分割して各チャンクを要約し、それらの要約をさらに要約して1つにまとめます。
+入力は generic と同様に、引数・標準入力・-i (複数指定可) から読み込みます。
+
+利用例:
+  cat article.md | ai-client summarize --length short
+  ai-client summarize -i report.txt --sentences 5`,
+
+		RunE: withCommandTimeout(allowEmptyInput(executeSummarizeCommand)),
+	}
+
+	addInputFileFlag(cmd)
+	cmd.Flags().StringVar(&summarizeLength, "length", "medium", "要約の長さ (short, medium, long)")
+	cmd.Flags().IntVar(&summarizeSentences, "sentences", 0, "要約の文数 (指定時は --length より優先)")
+	cmd.Flags().IntVar(&summarizeChunkSize, "chunk-size", defaultChunkSize, "入力を分割して要約する文字数の上限 (0 で分割しない)")
+
+	return cmd
+}
+
+// executeSummarizeCommand は 'summarize' サブコマンドの実際の実行ロジックを保持します。
+func executeSummarizeCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	switch summarizeLength {
+	case "short", "medium", "long":
+	default:
+		return &invalidInputError{err: fmt.Errorf("不明な要約の長さです: '%s' (利用可能な値: short, medium, long)", summarizeLength)}
+	}
+	if summarizeSentences < 0 {
+		return &invalidInputError{err: fmt.Errorf("--sentences は 0 以上である必要があります: %d", summarizeSentences)}
+	}
+
+	// 1. 入力内容の決定
+	inputText, err := readInput(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	// 2. クライアントとビルダーの初期化
+	client, err := newClient(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+	builder, err := prompts.NewPromptBuilder()
+	if err != nil {
+		return fmt.Errorf("プロンプトの構築に失敗しました: %w", err)
+	}
+
+	r, err := newRunner(client, builder)
+	if err != nil {
+		return err
+	}
+	r.Vars = map[string]string{"length": summarizeLength}
+	if summarizeSentences > 0 {
+		r.Vars["sentences"] = strconv.Itoa(summarizeSentences)
+	}
+
+	// 3. 要約の実行 (必要に応じてチャンク分割)
+	generateContent, err := summarizeInChunks(cmd, r, string(inputText), inputSourceName(cmd, args))
+	if err != nil {
+		return err
+	}
+	outputTemplateName = r.ResolveTemplateName(summarizeMode)
+	outputMode = summarizeMode
+
+	// 4. 結果の出力
+	return GenerateAndOutput(ctx, generateContent)
+}
+
+// summarizeInChunks は、入力を --chunk-size ごとに分割して要約し、複数のチャンクがあれば各要約をまとめて再度要約します。
+func summarizeInChunks(cmd *cobra.Command, r *runner.Runner, input, sourceName string) (*ai.Response, error) {
+	ctx := cmd.Context()
+
+	chunks := prompts.SplitIntoChunks(input, summarizeChunkSize)
+	if len(chunks) == 1 {
+		return withSpinner(ctx, cmd, func(ctx context.Context) (*ai.Response, error) {
+			return r.Run(ctx, input, sourceName, summarizeMode, modelName)
+		})
+	}
+
+	start := time.Now()
+	slog.Info("入力が大きいため、チャンクに分割して要約します", "chunks", len(chunks), "runes", utf8.RuneCountInString(input))
+
+	summaries := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		fmt.Fprintf(cmd.ErrOrStderr(), "チャンク %d/%d を要約中...\n", i+1, len(chunks))
+		resp, err := withSpinner(ctx, cmd, func(ctx context.Context) (*ai.Response, error) {
+			return r.Run(ctx, chunk, fmt.Sprintf("%s (%d/%d)", sourceName, i+1, len(chunks)), summarizeMode, modelName)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("チャンク %d/%d の要約に失敗しました: %w", i+1, len(chunks), err)
+		}
+		summaries = append(summaries, resp.Text)
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "%d 件の要約を統合中...\n", len(summaries))
+	resp, err := withSpinner(ctx, cmd, func(ctx context.Context) (*ai.Response, error) {
+		return r.Run(ctx, strings.Join(summaries, "\n\n"), sourceName+" (chunk summaries)", summarizeMode, modelName)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("要約の統合に失敗しました: %w", err)
+	}
+	resp.Elapsed = time.Since(start)
+	return resp, nil
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// --system と --system-file フラグの値です。
+var (
+	systemPrompt string
+	systemFile   string
+)
+
+// resolveSystemInstruction は、--system または --system-file から、クライアントに渡すシステム指示を決定します。
+// --system-file の場合はファイルの内容を読み込み、末尾の空白と改行を取り除きます。
+// 両方が指定された場合と、ファイルを読み込めない場合はエラーを返します。どちらも指定されていない場合は空文字列を返します。
+func resolveSystemInstruction() (string, error) {
+	if systemPrompt != "" && systemFile != "" {
+		return "", &invalidInputError{err: fmt.Errorf("--system と --system-file は同時に指定できません")}
+	}
+	if systemFile == "" {
+		return systemPrompt, nil
+	}
+
+	data, err := os.ReadFile(systemFile)
+	if err != nil {
+		return "", &invalidInputError{err: fmt.Errorf("システム指示のファイル '%s' の読み込みに失敗しました: %w", systemFile, err)}
+	}
+	return strings.TrimRight(string(data), " \t\r\n"), nil
+}
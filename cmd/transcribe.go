@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/spf13/cobra"
+	"google.golang.org/genai"
+)
+
+// audioMIMETypes は、文字起こしで受け付ける音声ファイルの拡張子と MIME タイプの対応です (Gemini API の対応形式)。
+var audioMIMETypes = map[string]string{
+	".wav":  "audio/wav",
+	".mp3":  "audio/mp3",
+	".aiff": "audio/aiff",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".flac": "audio/flac",
+}
+
+const (
+	// transcribeInstruction は、音声とともにモデルへ渡す文字起こしの指示です。
+	transcribeInstruction = "この音声を文字起こししてください。話された内容だけを、話された言語のまま、要約や説明を加えずに出力してください。"
+
+	// largeAudioThreshold を超える音声ファイルは、サーバー側の処理に時間がかかるため、File API の処理待ちを延長します。
+	largeAudioThreshold = 20 * 1024 * 1024
+	// largeAudioPollingTimeout は、大きな音声ファイルの処理完了を待つ最大時間です。
+	largeAudioPollingTimeout = 10 * time.Minute
+)
+
+// transcribeAudioFile は 'transcribe' サブコマンド固有のフラグ変数を定義
+var transcribeAudioFile string
+
+// NewTranscribeCmd は 'transcribe' コマンドを構築します。
+func NewTranscribeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "transcribe --audio <file>",
+		Short: "音声ファイルを File API 経由でアップロードし、文字起こしした結果を表示します。",
+		Long: `このコマンドは、--audio で指定した音声ファイルを File API にアップロードし、文字起こしの指示とともにモデルへ渡します。
+対応形式: ` + audioExtensions() + `
+20MiB を超えるファイルは、File API の処理完了を最大 10 分まで待ちます。--provider gemini のみ対応しています。
+
+利用例:
+  ai-client transcribe --audio meeting.mp3`,
+
+		RunE: executeTranscribeCommand,
+	}
+
+	cmd.Flags().StringVar(&transcribeAudioFile, "audio", "", "文字起こしする音声ファイルのパス (必須)")
+	_ = cmd.MarkFlagRequired("audio")
+
+	return cmd
+}
+
+// executeTranscribeCommand は 'transcribe' サブコマンドの実際の実行ロジックを保持します。
+func executeTranscribeCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	if provider != providerGemini {
+		return &invalidInputError{err: fmt.Errorf("transcribe は --provider %s でのみ使用できます", providerGemini)}
+	}
+
+	// 1. 音声ファイルの検証 (大きなファイルもメモリに載せないよう、内容はアップロード時に少しずつ読み出します)
+	mimeType, err := audioMIMEType(transcribeAudioFile)
+	if err != nil {
+		return &invalidInputError{err: err}
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "ファイル '%s' から読み込み中...\n", transcribeAudioFile)
+	audio, err := os.Open(transcribeAudioFile)
+	if err != nil {
+		return &invalidInputError{err: fmt.Errorf("音声ファイルの読み込みに失敗しました: %w", err)}
+	}
+	defer audio.Close()
+	info, err := audio.Stat()
+	if err != nil {
+		return &invalidInputError{err: fmt.Errorf("音声ファイルの読み込みに失敗しました: %w", err)}
+	}
+
+	// 2. クライアント初期化 (大きなファイルは File API の処理待ちを延長)
+	cfg, err := geminiConfigFromFlags(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+	if info.Size() > largeAudioThreshold {
+		cfg.FilePollingTimeout = largeAudioPollingTimeout
+	}
+	client, err := gemini.NewClientFromEnvWithConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+
+	// 3. アップロード (処理待ちの上限は FilePollingTimeout で制御するため、--timeout は適用しない)
+	file, err := client.UploadFileFrom(ctx, audio, info.Size(), mimeType)
+	if err != nil {
+		return fmt.Errorf("音声ファイルのアップロードに失敗しました: %w", err)
+	}
+	defer func() {
+		if err := file.Delete(context.WithoutCancel(ctx)); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "⚠️  アップロードした音声ファイルの削除に失敗しました: %v\n", err)
+		}
+	}()
+
+	// 4. 文字起こし (--timeout はモデルの呼び出しに適用)
+	commandCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	parts := []*genai.Part{file.Part(), genai.NewPartFromText(transcribeInstruction)}
+	start := time.Now()
+	resp, err := withSpinner(commandCtx, cmd, func(ctx context.Context) (*gemini.Response, error) {
+		return client.GenerateWithParts(ctx, modelName, parts, gemini.ImageOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("文字起こし中にエラーが発生しました: %w", err)
+	}
+	resp.Elapsed = time.Since(start)
+
+	// 5. 結果の出力
+	return GenerateAndOutput(ctx, resp)
+}
+
+// audioMIMEType は、ファイルの拡張子から音声の MIME タイプを判定します。対応していない形式の場合はエラーを返します。
+func audioMIMEType(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	mimeType, ok := audioMIMETypes[ext]
+	if !ok {
+		return "", fmt.Errorf("対応していない音声形式です: '%s' (対応形式: %s)", path, audioExtensions())
+	}
+	return mimeType, nil
+}
+
+// audioExtensions は、対応している音声ファイルの拡張子をカンマ区切りで返します。
+func audioExtensions() string {
+	exts := make([]string, 0, len(audioMIMETypes))
+	for ext := range audioMIMETypes {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return strings.Join(exts, ", ")
+}
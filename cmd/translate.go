@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+	"github.com/spf13/cobra"
+)
+
+// translateMode は、翻訳に使用する組み込みテンプレートのモード名です。
+const translateMode = "translate"
+
+// 'translate' サブコマンド固有のフラグ変数を定義
+var (
+	translateTo   string
+	translateFrom string
+)
+
+// NewTranslateCmd は 'translate' コマンドを構築します。
+func NewTranslateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "translate [TEXT or pipe]",
+		Short: "組み込みの翻訳テンプレートを使用して、入力テキストを指定した言語に翻訳します。",
+		Long: `このコマンドは、入力テキストを --to で指定した言語に翻訳します。
+--from を省略した場合、原文の言語はモデルが入力から判断します。
+入力は generic と同様に、引数・標準入力・-i (複数指定可) から読み込みます。
+
+利用例:
+  ai-client translate --to 英語 "こんにちは、世界"
+  cat README.md | ai-client translate --from 日本語 --to English`,
+
+		RunE: withCommandTimeout(allowEmptyInput(executeTranslateCommand)),
+	}
+
+	addInputFileFlag(cmd)
+	cmd.Flags().StringVar(&translateTo, "to", "", "翻訳先の言語 (必須。例: 英語, English)")
+	cmd.Flags().StringVar(&translateFrom, "from", "", "翻訳元の言語 (省略時は自動判定)")
+	_ = cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+// executeTranslateCommand は 'translate' サブコマンドの実際の実行ロジックを保持します。
+func executeTranslateCommand(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	// 1. 入力内容の決定
+	inputText, err := readInput(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	// 2. クライアントとビルダーの初期化
+	client, err := newClient(cmd)
+	if err != nil {
+		return fmt.Errorf("AIクライアントの初期化に失敗しました: %w", err)
+	}
+	builder, err := prompts.NewPromptBuilder()
+	if err != nil {
+		return fmt.Errorf("プロンプトの構築に失敗しました: %w", err)
+	}
+
+	// 3. 翻訳先・翻訳元の言語をテンプレート変数として渡して実行
+	r, err := newRunner(client, builder)
+	if err != nil {
+		return err
+	}
+	r.Vars = map[string]string{"to": translateTo, "from": translateFrom}
+	generateContent, err := withSpinner(ctx, cmd, func(ctx context.Context) (*ai.Response, error) {
+		return r.Run(ctx, string(inputText), inputSourceName(cmd, args), translateMode, modelName)
+	})
+	if err != nil {
+		return err
+	}
+	outputTemplateName = r.ResolveTemplateName(translateMode)
+	outputMode = translateMode
+
+	// 4. 結果の出力
+	return GenerateAndOutput(ctx, generateContent)
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,6 +11,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/shouni/go-ai-client/v2/pkg/ai/openai"
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+	"github.com/shouni/go-ai-client/v2/pkg/runner"
 	clibase "github.com/shouni/go-cli-base"
 	"github.com/shouni/go-utils/iohandler"
 	"github.com/spf13/cobra"
@@ -21,8 +27,77 @@ const (
 	separatorLight = "----------------------------------------------"
 )
 
-// readInput は、コマンドライン引数、ファイルフラグ、標準入力の順序で
+// inputFiles は -i/--input-file フラグで指定された入力ファイルのパス (複数指定可)
+var inputFiles []string
+
+// addInputFileFlag は、入力ファイルを指定する -i/--input-file フラグをコマンドに追加します。
+func addInputFileFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&inputFiles, "input-file", "i", nil, "入力ファイルのパス (複数指定可。各ファイルは '=== ファイル名 ===' の見出し付きで連結されます。- で標準入力)")
+}
+
+// withCommandTimeout は、--timeout をコマンド全体 (入力の読み込み後のプロンプト構築、API 呼び出し、すべてのリトライ) の
+// 絶対的な期限として run に適用します。期限はコマンドの先頭で 1 つだけ設定し、cmd.Context() を通じてすべての処理で共有します。
+// 期限を過ぎると、実行中の API 呼び出しとリトライの待機は打ち切られ、それ以降のリトライも行いません。
+func withCommandTimeout(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(cmd.Context(), time.Duration(timeout)*time.Second)
+		defer cancel()
+		cmd.SetContext(ctx)
+		return run(cmd, args)
+	}
+}
+
+// allowEmpty は --allow-empty フラグの値です。
+var allowEmpty bool
+
+// emptyInputError は、処理するテキストが空であることを示します (終了コード 3)。
+// --allow-empty の判定のため、errors.Is で runner.ErrEmptyInput と一致します。
+type emptyInputError struct{ msg string }
+
+func (e *emptyInputError) Error() string        { return e.msg }
+func (e *emptyInputError) Is(target error) bool { return target == runner.ErrEmptyInput }
+
+// allowEmptyInput は、--allow-empty が指定されている場合に、空の入力によるエラーを成功 (何も出力しない) として扱うよう run を包みます。
+// 入力を読み込むコマンドの RunE に使用します。
+func allowEmptyInput(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		err := run(cmd, args)
+		if allowEmpty && errors.Is(err, runner.ErrEmptyInput) {
+			slog.Info("入力が空のため、何も出力せずに終了します (--allow-empty)")
+			return nil
+		}
+		return err
+	}
+}
+
+// readInput は、readRawInput で読み込んだ入力を --input-format に応じてプレーンテキストへ変換して返します。
 func readInput(cmd *cobra.Command, args []string) ([]byte, error) {
+	format, err := runner.ParseInputFormat(inputFormat)
+	if err != nil {
+		return nil, &invalidInputError{err: err}
+	}
+	input, err := readRawInput(cmd, args)
+	if err != nil || format == runner.InputFormatRaw {
+		return input, err
+	}
+
+	converted, err := runner.ConvertInput(string(input), format)
+	if err != nil {
+		return nil, &invalidInputError{err: err}
+	}
+	if strings.TrimSpace(converted) == "" {
+		return nil, &emptyInputError{msg: fmt.Sprintf("入力エラー: --input-format %s で変換した結果、処理するテキストが残りませんでした", format)}
+	}
+	return []byte(converted), nil
+}
+
+// readRawInput は、ファイルフラグ、コマンドライン引数、クリップボード (--clipboard)、標準入力の順序で
+func readRawInput(cmd *cobra.Command, args []string) ([]byte, error) {
+	// 0. 入力ファイルが指定されている場合は、引数 (と -i - の標準入力) と合わせて見出し付きで連結
+	if len(inputFiles) > 0 {
+		return readInputFiles(cmd, args)
+	}
+
 	// 1. コマンドライン引数からの読み込みを優先 (パイプ処理との混同を避けるため)
 	if len(args) > 0 {
 		// 読み込み元を標準エラー出力で通知
@@ -31,7 +106,13 @@ func readInput(cmd *cobra.Command, args []string) ([]byte, error) {
 		return []byte(strings.Join(args, " ")), nil
 	}
 
-	// 2. 標準入力からの読み込み
+	// 2. --clipboard が指定され、標準入力がパイプでない場合はクリップボードから読み込み
+	if useClipboard && !isPipedInput(cmd.InOrStdin()) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "クリップボードから読み込み中...\n")
+		return readClipboard()
+	}
+
+	// 3. 標準入力からの読み込み
 	// cmd.InOrStdin() を使用して標準入力から読み込み
 	fmt.Fprintf(cmd.ErrOrStderr(), "標準入力 (stdin) から読み込み中...\n")
 
@@ -41,71 +122,451 @@ func readInput(cmd *cobra.Command, args []string) ([]byte, error) {
 		return nil, fmt.Errorf("標準入力からの読み込みに失敗しました: %w", err)
 	}
 
-	// 3. 空入力のチェック
+	// 4. 空入力のチェック
 	if len(bytes.TrimSpace(input)) == 0 {
 		// バイトスライスをトリムして、空白や改行のみでないか確認
 		// 致命的エラーではなく、適切な使い方を促すメッセージにする
-		return nil, fmt.Errorf("入力エラー: 処理するテキストが提供されていません。\n\n使用法:\n1. コマンド引数として直接指定: `yourcommand \"テキスト内容\"`\n2. 標準入力としてパイプで渡す: `cat input.txt | yourcommand`")
+		return nil, &emptyInputError{msg: "入力エラー: 処理するテキストが提供されていません。\n\n使用法:\n1. コマンド引数として直接指定: `yourcommand \"テキスト内容\"`\n2. 標準入力としてパイプで渡す: `cat input.txt | yourcommand`"}
 	}
 
 	return input, nil
 }
 
-// GenerateAndOutput は、RunnerのRunメソッドを呼び出し、結果として得られた
-// AIの応答内容を標準出力に出力し、メタ情報を付加します。
-func GenerateAndOutput(ctx context.Context, outputContent string) error {
-	// 全ての出力を一つの文字列に組み立てる
-	var sb strings.Builder
+// stdinInputPath は、-i で標準入力を表すパスです。
+const stdinInputPath = "-"
+
+// readInputFiles は、入力ファイルを順に読み込み、ファイルごとに見出しを付けて連結します。
+// コマンドライン引数があれば、それも見出し付きで末尾に追加します。
+// 標準入力は -i - で明示された場合だけ読み込みます。パイプが開いたままの CI や cron などで、読み込みが終わらずに止まるのを防ぐためです。
+func readInputFiles(cmd *cobra.Command, args []string) ([]byte, error) {
+	var buf bytes.Buffer
+	readStdin := false
+	for _, path := range inputFiles {
+		if path == stdinInputPath {
+			if readStdin {
+				return nil, &invalidInputError{err: errors.New("-i - (標準入力) は 1 回だけ指定できます")}
+			}
+			readStdin = true
+			fmt.Fprintf(cmd.ErrOrStderr(), "標準入力 (stdin) から読み込み中...\n")
+			stdin, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return nil, fmt.Errorf("標準入力からの読み込みに失敗しました: %w", err)
+			}
+			if len(bytes.TrimSpace(stdin)) > 0 {
+				writeInputSection(&buf, "stdin", stdin)
+			}
+			continue
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "ファイル '%s' から読み込み中...\n", path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, &invalidInputError{err: fmt.Errorf("入力ファイル '%s' の読み込みに失敗しました: %w", path, err)}
+		}
+		writeInputSection(&buf, path, data)
+	}
+
+	if len(args) > 0 {
+		writeInputSection(&buf, "args", []byte(strings.Join(args, " ")))
+	}
+
+	if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+		return nil, &emptyInputError{msg: "入力エラー: 指定されたファイルに処理するテキストが含まれていません"}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeInputSection は、'=== 名前 ===' の見出しに続けて内容を書き込みます。
+func writeInputSection(buf *bytes.Buffer, name string, data []byte) {
+	if buf.Len() > 0 {
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(buf, "=== %s ===\n", name)
+	buf.Write(bytes.TrimRight(data, "\r\n"))
+	buf.WriteString("\n")
+}
+
+// isPipedInput は、入力がパイプやリダイレクトで渡されているかを判定します。
+// 端末 (キャラクタデバイス) の場合は、ユーザーの入力待ちで止まらないよう false を返します。
+func isPipedInput(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return true
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// isTerminal は、出力先が端末 (キャラクタデバイス) かどうかを判定します。
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// inputSourceName は、readInput が入力を読み込んだ入力元の名前を返します。
+func inputSourceName(cmd *cobra.Command, args []string) string {
+	if len(inputFiles) > 0 {
+		names := make([]string, len(inputFiles))
+		for i, path := range inputFiles {
+			names[i] = path
+			if path == stdinInputPath {
+				names[i] = "stdin"
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	if len(args) > 0 {
+		return "args"
+	}
+	if useClipboard && !isPipedInput(cmd.InOrStdin()) {
+		return "clipboard"
+	}
+	return "stdin"
+}
+
+// newClient は、--provider フラグに応じて、環境変数のAPIキーとフラグの設定から AI クライアントを生成します。
+func newClient(cmd *cobra.Command) (ai.Generator, error) {
+	flags := cmd.Flags()
+	if retryInitialDelay > retryMaxDelay {
+		return nil, &invalidInputError{err: fmt.Errorf("--retry-initial-delay (%v) は --retry-max-delay (%v) 以下である必要があります", retryInitialDelay, retryMaxDelay)}
+	}
+	if rpm < 0 {
+		return nil, &invalidInputError{err: fmt.Errorf("--rpm は0以上である必要があります。入力値: %d", rpm)}
+	}
+	if candidates < 1 {
+		return nil, &invalidInputError{err: fmt.Errorf("--candidates は1以上である必要があります。入力値: %d", candidates)}
+	}
+
+	switch provider {
+	case providerGemini:
+		return newGeminiClient(cmd)
+	case providerOpenAI:
+		// --model が未指定の場合は、Gemini 用の既定モデル名を OpenAI 用に差し替えます
+		if !flags.Changed("model") {
+			modelName = defaultOpenAIModel
+		}
+		if candidates > 1 {
+			return nil, &invalidInputError{err: fmt.Errorf("--candidates は --provider %s でのみ使用できます", providerGemini)}
+		}
+		if rpm > 0 {
+			return nil, &invalidInputError{err: fmt.Errorf("--rpm は --provider %s でのみ使用できます", providerGemini)}
+		}
+		if rawConfig != "" {
+			return nil, &invalidInputError{err: fmt.Errorf("--raw-config は --provider %s でのみ使用できます", providerGemini)}
+		}
+		if debugRequest {
+			return nil, &invalidInputError{err: fmt.Errorf("--debug-request は --provider %s でのみ使用できます", providerGemini)}
+		}
+		if baseURL != "" {
+			return nil, &invalidInputError{err: fmt.Errorf("--base-url は --provider %s でのみ使用できます (OpenAI 互換 API の接続先は環境変数 OPENAI_BASE_URL で指定してください)", providerGemini)}
+		}
+		if flags.Changed("thinking-budget") {
+			return nil, &invalidInputError{err: fmt.Errorf("--thinking-budget は --provider %s でのみ使用できます", providerGemini)}
+		}
+		if len(modalities) > 0 {
+			return nil, &invalidInputError{err: fmt.Errorf("--modalities は --provider %s でのみ使用できます", providerGemini)}
+		}
+		temp, topP, err := resolveSampling(cmd)
+		if err != nil {
+			return nil, err
+		}
+		system, err := resolveSystemInstruction()
+		if err != nil {
+			return nil, err
+		}
+		cfg := openai.Config{
+			SystemInstruction: system,
+			Temperature:       temp,
+			TopP:              topP,
+			MaxRetries:        retries,
+			DisableRetries:    disableRetries(),
+			InitialDelay:      retryInitialDelay,
+			MaxDelay:          retryMaxDelay,
+		}
+		return openai.NewClientFromEnvWithConfig(cfg)
+	default:
+		return nil, &invalidInputError{err: fmt.Errorf("不明なプロバイダです: '%s' (利用可能なプロバイダ: %s, %s)", provider, providerGemini, providerOpenAI)}
+	}
+}
+
+// disableRetries は、リトライを無効にするかどうかを返します。
+// Config.MaxRetries の 0 は既定の回数を意味するため、--retries 0 は --no-retry と同じくリトライしない指定として扱います。
+func disableRetries() bool {
+	return noRetry || retries == 0
+}
+
+// newGeminiClient は、環境変数のAPIキーとフラグの設定から Gemini クライアントを生成します。
+func newGeminiClient(cmd *cobra.Command) (*gemini.Client, error) {
+	cfg, err := geminiConfigFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return gemini.NewClientFromEnvWithConfig(cmd.Context(), cfg)
+}
 
-	// 応答の開始セパレータとヘッダー (定数を使用)
-	sb.WriteString("\n" + separatorHeavy)
-	sb.WriteString("\n🤖 AIモデルからの応答:")
-	sb.WriteString("\n" + separatorHeavy + "\n")
+// geminiConfigFromFlags は、フラグの設定を反映した Gemini クライアントの設定を組み立てます。
+// コマンドごとに設定を追加で調整したい場合は、これを変更してから gemini.NewClientFromEnvWithConfig に渡します。
+func geminiConfigFromFlags(cmd *cobra.Command) (gemini.Config, error) {
+	temp, topP, err := resolveSampling(cmd)
+	if err != nil {
+		return gemini.Config{}, err
+	}
+	system, err := resolveSystemInstruction()
+	if err != nil {
+		return gemini.Config{}, err
+	}
+	cfg := gemini.Config{
+		SystemInstruction:     system,
+		Temperature:           temp,
+		TopP:                  topP,
+		MaxRetries:            retries,
+		DisableRetries:        disableRetries(),
+		InitialDelay:          retryInitialDelay,
+		MaxDelay:              retryMaxDelay,
+		EnableSearchGrounding: enableSearch,
+		StopSequences:         stopSequences,
+		RequestsPerMinute:     rpm,
+		RawConfigJSON:         rawConfig,
+		DebugRequests:         debugRequest,
+		BaseURL:               baseURL,
+		KeyRotation:           gemini.KeyRotation(keyRotation),
+	}
+
+	// 明示的に指定されたフラグのみを設定に反映します
+	flags := cmd.Flags()
+	if flags.Changed("seed") {
+		cfg.Seed = &seed
+	}
+	if flags.Changed("thinking-budget") {
+		if thinkingBudget < -1 {
+			return gemini.Config{}, &invalidInputError{err: fmt.Errorf("--thinking-budget は-1以上である必要があります。入力値: %d", thinkingBudget)}
+		}
+		cfg.ThinkingBudget = &thinkingBudget
+	}
+	cfg.ResponseModalities = modalities
+	if candidates > 1 {
+		cfg.CandidateCount = candidates
+	}
+	if cfg.KeyRotation != gemini.RoundRobin && cfg.KeyRotation != gemini.LeastRecentlyRateLimited {
+		return gemini.Config{}, &invalidInputError{err: fmt.Errorf("--key-rotation は %s または %s である必要があります。入力値: %s", gemini.RoundRobin, gemini.LeastRecentlyRateLimited, keyRotation)}
+	}
+	if maxTokens < 0 {
+		return gemini.Config{}, &invalidInputError{err: fmt.Errorf("--max-tokens は0以上である必要があります。入力値: %d", maxTokens)}
+	}
+	cfg.MaxOutputTokens = maxTokens
+	if autoContinue < 0 {
+		return gemini.Config{}, &invalidInputError{err: fmt.Errorf("--auto-continue は0以上である必要があります。入力値: %d", autoContinue)}
+	}
+	if autoContinue > 0 {
+		cfg.AutoContinue = true
+		cfg.MaxContinuations = autoContinue
+	}
+
+	return cfg, nil
+}
 
-	// AIの応答本文
-	sb.WriteString(outputContent)
+// fillerPhrases は、--trim で取り除く前置きの言葉を返します。--trim-phrase が未指定の場合は既定の一覧を使います。
+func fillerPhrases() []string {
+	if len(trimPhrases) > 0 {
+		return trimPhrases
+	}
+	return runner.DefaultFillerPhrases
+}
+
+// newRunner は、クライアントとプロンプトビルダーから、--timeout などのフラグを適用した Runner を生成します。
+func newRunner(client ai.Generator, builder prompts.Builder) (*runner.Runner, error) {
+	r := runner.NewRunner(client, builder)
+	r.Timeout = time.Duration(timeout) * time.Second
+	r.StripFences = stripFences
+	r.TrimResponse = trimResponse
+	r.FillerPhrases = fillerPhrases()
+	r.MaxInputBytes = maxInputBytes
+	r.TemplateName = templateName
+
+	if jsonSchemaFile != "" {
+		schema, err := runner.LoadJSONSchema(jsonSchemaFile)
+		if err != nil {
+			return nil, &invalidInputError{err: err}
+		}
+		r.JSONSchema = schema
+	}
+	return r, nil
+}
+
+// statsProvider は、リトライ回数などの累計統計を提供するクライアントです (現在は Gemini のみ)。
+type statsProvider interface {
+	Stats() gemini.ClientStats
+}
+
+// outputTemplateName は、GenerateAndOutput がメタ情報に表示するテンプレート名です。
+// テンプレートでプロンプトを構築したコマンドが、Runner.ResolveTemplateName で解決した名前を設定します。
+var outputTemplateName string
+
+// GenerateAndOutput は、AIの応答内容を標準出力に出力し、メタ情報を付加します。
+// 見出しやセパレータを含む text 形式の出力は、--output-template のテンプレートで整形します。
+// --verbose 指定時は、処理時間やトークン使用量などの実行レポートも付加します。
+// --output-format json / yaml 指定時は、応答とメタ情報をその形式で出力します。
+// --encode base64 指定時は、応答に含まれる画像も base64 でエンコードして出力します (none では画像を出力しません)。
+// --copy 指定時は応答のテキストをクリップボードにもコピーし、--copy-only 指定時はコピーできれば出力を省略します。
+func GenerateAndOutput(ctx context.Context, resp *ai.Response) error {
+	// --encode none では画像を出力しないので、画像が返されたことだけを知らせます
+	if n := len(resp.Images); n > 0 && outputEncoding == outputEncodingNone {
+		slog.WarnContext(ctx, "応答に含まれる画像は出力していません (--encode base64 で出力できます)", "images", n)
+	}
+	if copyResponse || copyOnly {
+		// コピーできなかった場合は、応答を失わないよう標準出力への出力に戻します
+		if copied := copyToClipboard(ctx, resp.Text); copied && copyOnly {
+			return nil
+		}
+	}
+
+	// --output-format json / yaml では、見出しやセパレータを付けずに応答とメタ情報を構造化して出力します
+	if outputFormat != outputFormatText {
+		out, err := formatStructuredOutput(resp, outputFormat)
+		if err != nil {
+			return err
+		}
+		return iohandler.WriteOutputString("", out)
+	}
+
+	// 見出しやセパレータ、メタ情報の配置は出力のテンプレート (--output-template) に従います
+	return iohandler.WriteOutputString("", formatTemplateOutput(resp)) // 第一引数の空文字列は標準出力を意味する
+}
 
-	// 応答の終了セパレータとメタ情報 (定数を使用)
-	sb.WriteString("\n\n" + separatorLight)
+// formatCandidates は、複数の候補を番号付きの区切りで連結します。
+func formatCandidates(candidates []string) string {
+	var sb strings.Builder
+	for i, text := range candidates {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("--- 候補 %d/%d ---\n", i+1, len(candidates)))
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
 
-	// メタ情報
-	sb.WriteString(fmt.Sprintf("\nModel: %s", modelName))
-	//	sb.WriteString(fmt.Sprintf("\n実行モード: %s", displayMode))
-	sb.WriteString(fmt.Sprintf("\n出力処理時刻: %s", time.Now().Format("2006-01-02 15:04:05")))
+// formatVerboseReport は、処理時間、リトライ回数、トークン使用量、応答したモデルとリクエスト ID を実行レポートとして整形します。
+func formatVerboseReport(resp *ai.Response) string {
+	var sb strings.Builder
+	sb.WriteString("\n\n📊 実行レポート:")
+	sb.WriteString(fmt.Sprintf("\n応答モデル: %s", resp.ModelName))
+	if resp.RequestID != "" {
+		sb.WriteString(fmt.Sprintf("\nリクエスト ID: %s", resp.RequestID))
+	}
+	if resp.Elapsed > 0 {
+		sb.WriteString(fmt.Sprintf("\n処理時間: %s", resp.Elapsed.Round(time.Millisecond)))
+	}
+	// リトライ回数は、クライアントの累計ではなくこの応答を得るまでの回数を表示します
+	if resp.Attempts > 0 {
+		sb.WriteString(fmt.Sprintf("\nリトライ回数: %d", resp.Attempts-1))
+	}
+	if resp.Usage != nil {
+		sb.WriteString(fmt.Sprintf("\nトークン: 入力 %d / 出力 %d / 合計 %d", resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens))
+	} else {
+		sb.WriteString("\nトークン: 不明")
+	}
+	return sb.String()
+}
 
-	// 終了セパレータ
-	sb.WriteString("\n" + separatorLight + "\n")
+// formatCitations は、出典情報をフッターとして整形します。
+func formatCitations(citations []ai.Citation) string {
+	if len(citations) == 0 {
+		return ""
+	}
 
-	return iohandler.WriteOutputString("", sb.String()) // 第一引数の空文字列は標準出力を意味する
+	var sb strings.Builder
+	sb.WriteString("\n\n📚 出典:")
+	for i, c := range citations {
+		title := c.Title
+		if title == "" {
+			title = c.URI
+		}
+		sb.WriteString(fmt.Sprintf("\n[%d] %s", i+1, title))
+		if c.URI != "" && c.URI != title {
+			sb.WriteString(fmt.Sprintf(" (%s)", c.URI))
+		}
+	}
+	return sb.String()
 }
 
 // checkAPIKey、initAppPreRunE 関数は変更なし
 
-// checkAPIKey は、APIキー環境変数が設定されているかを確認します。
+// checkAPIKey は、選択されたプロバイダのAPIキー環境変数が設定されているかを確認します。
 func checkAPIKey() error {
-	if os.Getenv("GEMINI_API_KEY") == "" && os.Getenv("GOOGLE_API_KEY") == "" {
-		return fmt.Errorf("致命的エラー: GEMINI_API_KEY または GOOGLE_API_KEY 環境変数が設定されていません。")
+	if provider == providerOpenAI {
+		// ローカルの OpenAI 互換サーバーはAPIキーが不要なため、ベース URL の指定でも可とします
+		if os.Getenv("OPENAI_API_KEY") == "" && os.Getenv("OPENAI_BASE_URL") == "" {
+			return fmt.Errorf("致命的エラー: OPENAI_API_KEY または OPENAI_BASE_URL 環境変数が設定されていません。")
+		}
+		return nil
+	}
+	if os.Getenv("GEMINI_API_KEY") == "" && os.Getenv("GOOGLE_API_KEY") == "" && os.Getenv("GEMINI_API_KEYS") == "" {
+		return fmt.Errorf("致命的エラー: GEMINI_API_KEY、GOOGLE_API_KEY、GEMINI_API_KEYS のいずれかの環境変数が設定されていません。")
 	}
 	return nil
 }
 
-// initAppPreRunE は、ログレベル設定とAPIキーチェックを実行します。
-func initAppPreRunE(cmd *cobra.Command, args []string) error {
-	// ログレベル設定
+// setupLogger は、--verbose フラグに応じてログレベルを設定します。
+// --debug-request の出力はデバッグレベルのため、指定された場合もデバッグレベルにします。
+func setupLogger() {
 	logLevel := slog.LevelInfo
-	if clibase.Flags.Verbose {
+	if clibase.Flags.Verbose || debugRequest {
 		logLevel = slog.LevelDebug
 	}
-	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+	// スピナーの表示中にログの行がスピナーの行とつながらないよう、spinnerLogWriter を通して書き込みます
+	handler := slog.NewTextHandler(spinnerLogWriter{w: os.Stderr}, &slog.HandlerOptions{
 		Level: logLevel,
 	})
 	slog.SetDefault(slog.New(handler))
+}
+
+// initOfflinePreRunE は、APIキーを必要としないコマンド用の PersistentPreRunE です。
+// ルートの initAppPreRunE を上書きし、ログ設定のみを行います。
+func initOfflinePreRunE(cmd *cobra.Command, args []string) error {
+	setupLogger()
+	return nil
+}
+
+// initAppPreRunE は、ログレベル設定、設定ファイルの読み込み、APIキーチェックを実行します。
+func initAppPreRunE(cmd *cobra.Command, args []string) error {
+	// ログレベル設定
+	setupLogger()
+
+	// 設定ファイルの読み込みと、--model のエイリアスの解決、モデルのプロファイルの適用
+	if err := loadConfigFile(); err != nil {
+		return err
+	}
+	if resolved := resolveModelAlias(modelName); resolved != modelName {
+		slog.Debug("モデル名のエイリアスを解決しました", "alias", modelName, "model", resolved)
+		modelName = resolved
+	}
+	if err := applyModelProfile(cmd); err != nil {
+		return err
+	}
+
+	// API を呼び出す前に、出力形式の誤りを検出します
+	if err := validateOutputFormat(); err != nil {
+		return err
+	}
+	if err := validateOutputEncoding(); err != nil {
+		return err
+	}
+	if err := validateOutputLimits(); err != nil {
+		return err
+	}
+	if err := validateOutputTemplate(); err != nil {
+		return err
+	}
 
 	// APIキーチェック
 	err := checkAPIKey()
 	if err != nil {
 		slog.Error("🚨 APIKeyの取得に失敗しました", "error", err)
-		return fmt.Errorf("APIKeyの取得に失敗しました: %w", err)
+		return &authError{err: fmt.Errorf("APIKeyの取得に失敗しました: %w", err)}
 	}
 
 	slog.Info("アプリケーション設定初期化完了")
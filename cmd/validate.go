@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+	"github.com/spf13/cobra"
+)
+
+// validateTemplatesDir は 'validate-templates' サブコマンド固有のフラグ変数を定義
+var validateTemplatesDir string
+
+// NewValidateTemplatesCmd は 'validate-templates' コマンドを構築します。
+func NewValidateTemplatesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate-templates",
+		Short: "プロンプトテンプレートの構文を検証します。",
+		Long: `このコマンドは、組み込みテンプレートと --templates-dir で指定したディレクトリ内の *.md を解析し、
+構文エラーをモード名と行番号付きで報告します。エラーが1件でもあれば非ゼロで終了するため、CIでの検証に利用できます。
+TemplateData に存在しないフィールドを参照している場合は警告を表示します。
+APIキーは不要です。
+
+利用例:
+  ai-client validate-templates --templates-dir ./templates`,
+
+		// APIキーのチェックを行わないよう、ルートの PersistentPreRunE を上書き
+		PersistentPreRunE: initOfflinePreRunE,
+		RunE:              executeValidateTemplatesCommand,
+		// 検証エラーは使い方の誤りではないため、Usage は表示しない
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&validateTemplatesDir, "templates-dir", "", "追加で検証するテンプレートディレクトリ")
+
+	return cmd
+}
+
+// executeValidateTemplatesCommand は 'validate-templates' サブコマンドの実際の実行ロジックを保持します。
+func executeValidateTemplatesCommand(cmd *cobra.Command, args []string) error {
+	templates := prompts.EmbeddedTemplates()
+	if validateTemplatesDir != "" {
+		dirTemplates, err := prompts.LoadTemplatesFromDir(validateTemplatesDir)
+		if err != nil {
+			return err
+		}
+		// 同名のモードはディレクトリ側で上書き
+		for mode, content := range dirTemplates {
+			templates[mode] = content
+		}
+	}
+
+	out := cmd.ErrOrStderr()
+	errorCount := 0
+	for _, issue := range prompts.ValidateTemplates(templates) {
+		label := "❌ エラー"
+		if issue.IsWarning {
+			label = "⚠️  警告"
+		} else {
+			errorCount++
+		}
+
+		location := issue.Mode
+		if issue.Line > 0 {
+			location = fmt.Sprintf("%s:%d", issue.Mode, issue.Line)
+		}
+		fmt.Fprintf(out, "%s [%s] %s\n", label, location, issue.Message)
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("%d 件のテンプレートエラーが見つかりました", errorCount)
+	}
+
+	fmt.Fprintf(out, "✅ %d 件のテンプレートを検証しました\n", len(templates))
+	return nil
+}
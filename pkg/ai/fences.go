@@ -0,0 +1,35 @@
+package ai
+
+import "strings"
+
+// codeFence は Markdown のコードブロックの区切り記号なのだ。
+const codeFence = "```"
+
+// StripCodeFences は、テキスト全体が 1 つのコードブロック (```json ... ``` など) で囲まれている場合に、
+// 区切り記号と言語タグを取り除いた中身を返すのだ。
+// コードブロックで囲まれていないテキストや、囲みが不完全なテキスト、複数のブロックを含むテキストはそのまま返すのだ。
+func StripCodeFences(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, codeFence) || !strings.HasSuffix(trimmed, codeFence) {
+		return s
+	}
+
+	// 開始行 (```言語タグ) を取り除くのだ。改行がなければ 1 行だけの不完全な囲みとみなすのだ
+	newline := strings.IndexByte(trimmed, '\n')
+	if newline < 0 {
+		return s
+	}
+	if strings.Contains(trimmed[len(codeFence):newline], codeFence) {
+		return s
+	}
+	inner := trimmed[newline+1 : len(trimmed)-len(codeFence)]
+
+	// 中身に別の区切り行がある場合は複数ブロックの可能性があるため、手を加えないのだ
+	for _, line := range strings.Split(inner, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), codeFence) {
+			return s
+		}
+	}
+
+	return strings.TrimRight(inner, "\r\n")
+}
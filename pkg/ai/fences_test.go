@@ -0,0 +1,29 @@
+package ai
+
+import "testing"
+
+func TestStripCodeFences(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"言語タグ付きのブロック", "```json\n{\"a\": 1}\n```", "{\"a\": 1}"},
+		{"言語タグなしのブロック", "```\nline1\nline2\n```", "line1\nline2"},
+		{"前後の空白を含むブロック", "\n  ```go\nfmt.Println()\n```  \n", "fmt.Println()"},
+		{"囲まれていないテキスト", "{\"a\": 1}", "{\"a\": 1}"},
+		{"開始の区切りのみ", "```json\n{\"a\": 1}", "```json\n{\"a\": 1}"},
+		{"終了の区切りのみ", "{\"a\": 1}\n```", "{\"a\": 1}\n```"},
+		{"前置きの文章があるブロック", "結果です:\n```json\n{}\n```", "結果です:\n```json\n{}\n```"},
+		{"複数のブロック", "```\na\n```\n説明\n```\nb\n```", "```\na\n```\n説明\n```\nb\n```"},
+		{"1 行だけの囲み", "```code```", "```code```"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripCodeFences(tt.input); got != tt.want {
+				t.Errorf("FAIL: StripCodeFences(%q)\n  got: %q\n  want: %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"google.golang.org/genai"
+)
+
+// CompactionStrategy は、ChatSession の履歴が MaxHistoryTokens を超えたときに、履歴を縮める方法なのだ。
+type CompactionStrategy string
+
+const (
+	// DropOldest は、上限に収まるまで古いターンから順に削除するのだ。
+	DropOldest CompactionStrategy = "drop-oldest"
+	// Summarize は、古いターンをモデルに要約させて、要約を伝える user と了解を返す model の 1 往復に置き換えるのだ。
+	// 要約のために API を 1 回余分に呼び出すのだ。要約に失敗した場合は DropOldest と同じく削除するのだ。
+	Summarize CompactionStrategy = "summarize"
+)
+
+// DefaultSummaryPrompt は、Summarize で古いターンを要約させる既定の指示なのだ。この後ろに会話の記録が続くのだ。
+const DefaultSummaryPrompt = "次の会話の記録を、会話を続けるために必要な事実、決定事項、未解決の質問を落とさずに、簡潔に要約してください。要約だけを出力してください。"
+
+// summaryTurnPrefix は、要約のターンの先頭に付けて、それがこれまでの会話の要約であることをモデルに伝えるのだ。
+const summaryTurnPrefix = "（これまでの会話の要約）\n"
+
+// summaryAcknowledgement は、要約のターンの後ろに置く model のターンなのだ。
+// 要約を user のターンとして入れるので、残りの履歴の先頭の user のターンと続かないよう、ロールを交互に保つためなのだ。
+const summaryAcknowledgement = "承知しました。"
+
+// ChatSession は複数ターンの会話の履歴を保持し、Send のたびに履歴ごとモデルへ送るのだ。
+// システム指示は履歴ではなく Config.SystemInstruction から毎回付けるのだ。
+// 複数の goroutine から同時に使っても安全だけれど、Send は順番に処理されるのだ。
+type ChatSession struct {
+	// MaxHistoryTokens を指定すると、Send の前に履歴と新しいメッセージのトークン数を見積もり、
+	// これを超える場合は収まるまで古いターンから順に削除するのだ。0 なら削除しないのだ。
+	// 見積もりは API を呼ばずに ai.EstimateTokens で行うのだ（あくまで目安で、日本語では多めの見積もりになるのだ）。
+	// システム指示は履歴ではなく Config.SystemInstruction から毎回付けるので、削除されないのだ。
+	// MaxHistoryTokens、Compaction、SummarizeTurns、SummaryPrompt は最初の Send の前に設定するのだ。
+	MaxHistoryTokens int
+	// Compaction は MaxHistoryTokens を超えたときの履歴の縮め方なのだ。空の場合は DropOldest なのだ。
+	Compaction CompactionStrategy
+	// SummarizeTurns は Summarize で一度に要約する古いターンの最小数なのだ。0 なら上限に収まるのに必要な分だけ要約するのだ。
+	SummarizeTurns int
+	// SummaryPrompt は Summarize で古いターンを要約させる指示なのだ。空の場合は DefaultSummaryPrompt を使うのだ。
+	SummaryPrompt string
+
+	client    *Client
+	modelName string
+
+	mu      sync.Mutex
+	history []*genai.Content
+}
+
+// NewChatSession は modelName と会話するセッションを生成するのだ。
+// history を渡すと、保存しておいた会話の続きから始められるのだ（nil なら新しい会話なのだ）。
+func (c *Client) NewChatSession(modelName string, history []*genai.Content) *ChatSession {
+	return &ChatSession{
+		client:    c,
+		modelName: modelName,
+		history:   slices.Clone(history),
+	}
+}
+
+// Send はメッセージを履歴の末尾に付けてモデルへ送り、応答を返すのだ。
+// 成功した場合だけ、メッセージと応答を履歴に追加するのだ。失敗した場合は（MaxHistoryTokens による圧縮を除いて）履歴を変更しないので、
+// そのまま送り直せるのだ。
+func (s *ChatSession) Send(ctx context.Context, message string) (*Response, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, errors.New("メッセージが空です。入力を確認してください")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compactHistory(ctx, ai.EstimateTokens(message))
+
+	userContent := &genai.Content{Role: RoleUser, Parts: []*genai.Part{{Text: message}}}
+	contents := append(slices.Clone(s.history), userContent)
+
+	config := s.client.newGenerateContentConfig()
+	resp, err := s.client.callGenerateContent(ctx, "Gemini chat", s.modelName, contents, config)
+	if err != nil {
+		return nil, err
+	}
+
+	modelContent := &genai.Content{Role: RoleModel, Parts: []*genai.Part{{Text: resp.Text}}}
+	s.history = append(contents, modelContent)
+	return resp, nil
+}
+
+// History はこれまでの会話の履歴の複製を返すのだ。保存して NewChatSession に渡せば、会話を再開できるのだ。
+func (s *ChatSession) History() []*genai.Content {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.history)
+}
+
+// compactHistory は、履歴と reserved トークン分の新しいメッセージが MaxHistoryTokens に収まるよう、Compaction に従って履歴を縮めるのだ。
+// Summarize で要約に失敗した場合や、要約しても収まらない場合は、DropOldest と同じく古いターンを削除するのだ。
+func (s *ChatSession) compactHistory(ctx context.Context, reserved int) {
+	if s.MaxHistoryTokens <= 0 || reserved+historyTokens(s.history) <= s.MaxHistoryTokens {
+		return
+	}
+
+	if s.Compaction == Summarize {
+		if err := s.summarizeHistory(ctx, reserved); err != nil {
+			slog.WarnContext(ctx, "履歴の要約に失敗したため、古いターンを削除するのだ", "error", err)
+		}
+	}
+	s.dropOldest(ctx, reserved)
+}
+
+// dropOldest は、履歴と reserved トークン分の新しいメッセージが MaxHistoryTokens に収まるまで、古いターンを削除するのだ。
+// 会話が user のターンから始まるよう、削除した後に先頭に残った model のターンも削除するのだ。
+func (s *ChatSession) dropOldest(ctx context.Context, reserved int) {
+	total := reserved + historyTokens(s.history)
+	dropped := 0
+	for len(s.history) > 0 && (total > s.MaxHistoryTokens || s.history[0].Role != RoleUser) {
+		total -= estimateContentTokens(s.history[0])
+		s.history = s.history[1:]
+		dropped++
+	}
+	if dropped > 0 {
+		slog.InfoContext(ctx, "履歴がトークン数の上限を超えたため、古いターンを削除したのだ",
+			"dropped", dropped, "remaining", len(s.history), "estimated_tokens", total, "max_history_tokens", s.MaxHistoryTokens)
+	}
+}
+
+// summarizeHistory は、古いターンをモデルに要約させ、要約の 1 往復に置き換えるのだ。
+// 要約するのは、収まるために削除が必要なターンと SummarizeTurns のうち多い方なのだ。
+// 残りの会話が user のターンから始まるよう、その直前までをまとめて要約するのだ。
+func (s *ChatSession) summarizeHistory(ctx context.Context, reserved int) error {
+	n := 0
+	// 要約の後ろに置く model のターンの分も、あらかじめ空けておくのだ
+	total := reserved + ai.EstimateTokens(summaryAcknowledgement) + historyTokens(s.history)
+	for n < len(s.history) && (total > s.MaxHistoryTokens || n < s.SummarizeTurns || s.history[n].Role != RoleUser) {
+		total -= estimateContentTokens(s.history[n])
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	summaryPrompt := s.SummaryPrompt
+	if summaryPrompt == "" {
+		summaryPrompt = DefaultSummaryPrompt
+	}
+	var transcript strings.Builder
+	transcript.WriteString(summaryPrompt)
+	transcript.WriteString("\n\n")
+	for _, content := range s.history[:n] {
+		transcript.WriteString(content.Role + ": ")
+		for _, part := range content.Parts {
+			if part != nil {
+				transcript.WriteString(part.Text)
+			}
+		}
+		transcript.WriteString("\n")
+	}
+
+	// 要約は会話の一部ではないので、システム指示を付けずに頼むのだ
+	config := s.client.newGenerateContentConfig()
+	config.SystemInstruction = nil
+	resp, err := s.client.callGenerateContent(ctx, "Gemini chat summary", s.modelName, promptToContents(transcript.String()), config)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(resp.Text) == "" {
+		return errors.New("要約が空でした")
+	}
+
+	summary := []*genai.Content{
+		{Role: RoleUser, Parts: []*genai.Part{{Text: summaryTurnPrefix + resp.Text}}},
+		{Role: RoleModel, Parts: []*genai.Part{{Text: summaryAcknowledgement}}},
+	}
+	s.history = append(summary, s.history[n:]...)
+	slog.InfoContext(ctx, "履歴がトークン数の上限を超えたため、古いターンを要約したのだ",
+		"summarized", n, "remaining", len(s.history), "max_history_tokens", s.MaxHistoryTokens)
+	return nil
+}
+
+// historyTokens は、履歴全体のトークン数を見積もるのだ。
+func historyTokens(history []*genai.Content) int {
+	n := 0
+	for _, content := range history {
+		n += estimateContentTokens(content)
+	}
+	return n
+}
+
+// estimateContentTokens は、Content のテキストのトークン数を見積もるのだ。
+func estimateContentTokens(content *genai.Content) int {
+	if content == nil {
+		return 0
+	}
+	n := 0
+	for _, part := range content.Parts {
+		if part != nil {
+			n += ai.EstimateTokens(part.Text)
+		}
+	}
+	return n
+}
@@ -1,35 +1,84 @@
 package gemini
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/ai/internal/ptr"
 	"github.com/shouni/go-utils/retry"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 	"google.golang.org/genai"
 )
 
+// Client は GenerativeModel と ai.Generator の両方を満たすのだ。
+var (
+	_ GenerativeModel = (*Client)(nil)
+	_ ai.Generator    = (*Client)(nil)
+)
+
 // NewClient は設定を基に新しい Gemini クライアントを生成するのだ。
 func NewClient(ctx context.Context, cfg Config) (*Client, error) {
-	if cfg.APIKey == "" {
+	apiKeys := collectAPIKeys(cfg)
+	if len(apiKeys) == 0 {
 		return nil, fmt.Errorf("APIキーは必須です。設定を確認してください")
 	}
+	switch cfg.KeyRotation {
+	case "", RoundRobin, LeastRecentlyRateLimited:
+	default:
+		return nil, fmt.Errorf("KeyRotation は %s または %s である必要があります。入力値: %s", RoundRobin, LeastRecentlyRateLimited, cfg.KeyRotation)
+	}
+	if cfg.BaseURL != "" {
+		if err := validateBaseURL(cfg.BaseURL); err != nil {
+			return nil, err
+		}
+	}
+
+	// API キーごとに genai のクライアントを作り、複数ある場合は keyPool でまとめるのだ
+	var client *genai.Client
+	keyModels := make([]modelsService, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		clientConfig := &genai.ClientConfig{
+			APIKey:  apiKey,
+			Backend: genai.BackendGeminiAPI,
+		}
+		clientConfig.HTTPOptions.BaseURL = cfg.BaseURL
 
-	clientConfig := &genai.ClientConfig{
-		APIKey:  cfg.APIKey,
-		Backend: genai.BackendGeminiAPI,
+		keyClient, err := genai.NewClient(ctx, clientConfig)
+		if err != nil {
+			return nil, fmt.Errorf("Geminiクライアントの作成に失敗しました: %w", err)
+		}
+		if client == nil {
+			client = keyClient
+		}
+		keyModels = append(keyModels, keyClient.Models)
+	}
+	var models modelsService = client.Models
+	if len(keyModels) > 1 {
+		models = newKeyPool(keyModels, cfg.KeyRotation)
 	}
 
-	client, err := genai.NewClient(ctx, clientConfig)
+	rawConfig, err := parseRawConfig(cfg.RawConfigJSON)
 	if err != nil {
-		return nil, fmt.Errorf("Geminiクライアントの作成に失敗しました: %w", err)
+		return nil, err
 	}
 
 	temp := DefaultTemperature
+	if cfg.Temperature == nil && rawConfig != nil && rawConfig.Temperature != nil {
+		// 構造化フィールドで指定がない場合に限り、RawConfigJSON の温度を使うのだ
+		cfg.Temperature = rawConfig.Temperature
+	}
 	if cfg.Temperature != nil {
 		if *cfg.Temperature < 0.0 || *cfg.Temperature > 1.0 {
 			return nil, fmt.Errorf("温度設定は0.0から1.0の間である必要があります。入力値: %f", *cfg.Temperature)
@@ -37,10 +86,24 @@ func NewClient(ctx context.Context, cfg Config) (*Client, error) {
 		temp = *cfg.Temperature
 	}
 
+	if cfg.TopP != nil && (*cfg.TopP < 0.0 || *cfg.TopP > 1.0) {
+		return nil, fmt.Errorf("TopP は0.0から1.0の間である必要があります。入力値: %f", *cfg.TopP)
+	}
+
+	if cfg.MaxOutputTokens < 0 {
+		return nil, fmt.Errorf("MaxOutputTokens は0以上である必要があります。入力値: %d", cfg.MaxOutputTokens)
+	}
+	if cfg.CandidateCount < 0 {
+		return nil, fmt.Errorf("CandidateCount は0以上である必要があります。入力値: %d", cfg.CandidateCount)
+	}
+
 	retryCfg := retry.DefaultConfig()
-	if cfg.MaxRetries > 0 {
+	switch {
+	case cfg.DisableRetries:
+		retryCfg.MaxRetries = 0
+	case cfg.MaxRetries > 0:
 		retryCfg.MaxRetries = cfg.MaxRetries
-	} else {
+	default:
 		retryCfg.MaxRetries = DefaultMaxRetries
 	}
 
@@ -53,66 +116,355 @@ func NewClient(ctx context.Context, cfg Config) (*Client, error) {
 	if cfg.MaxDelay > 0 {
 		retryCfg.MaxInterval = cfg.MaxDelay
 	}
+	if retryCfg.InitialInterval > retryCfg.MaxInterval {
+		return nil, fmt.Errorf("リトライの初期待機時間 (%v) は最大待機時間 (%v) 以下である必要があります", retryCfg.InitialInterval, retryCfg.MaxInterval)
+	}
+
+	pollingInterval := DefaultFilePollingInterval
+	if cfg.FilePollingInterval > 0 {
+		pollingInterval = cfg.FilePollingInterval
+	}
+	pollingTimeout := DefaultFilePollingTimeout
+	if cfg.FilePollingTimeout > 0 {
+		pollingTimeout = cfg.FilePollingTimeout
+	}
+	if pollingInterval >= pollingTimeout {
+		return nil, fmt.Errorf("ファイルポーリング間隔 (%v) はタイムアウト (%v) より短い必要があります", pollingInterval, pollingTimeout)
+	}
 
-	return &Client{
-		client:      client,
-		temperature: temp,
-		retryConfig: retryCfg,
-	}, nil
+	if len(cfg.StopSequences) > maxStopSequences {
+		return nil, fmt.Errorf("停止シーケンスは最大%d個まで指定できます。入力数: %d", maxStopSequences, len(cfg.StopSequences))
+	}
+
+	if err := validatePenalty("PresencePenalty", cfg.PresencePenalty); err != nil {
+		return nil, err
+	}
+	if err := validatePenalty("FrequencyPenalty", cfg.FrequencyPenalty); err != nil {
+		return nil, err
+	}
+
+	if cfg.RequestsPerMinute < 0 {
+		return nil, fmt.Errorf("RequestsPerMinute は0以上である必要があります。入力値: %d", cfg.RequestsPerMinute)
+	}
+	if cfg.ThinkingBudget != nil && *cfg.ThinkingBudget < -1 {
+		return nil, fmt.Errorf("ThinkingBudget は-1以上である必要があります。入力値: %d", *cfg.ThinkingBudget)
+	}
+	responseModalities, err := normalizeResponseModalities(cfg.ResponseModalities)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxContinuations < 0 {
+		return nil, fmt.Errorf("MaxContinuations は0以上である必要があります。入力値: %d", cfg.MaxContinuations)
+	}
+	if cfg.StreamStallTimeout < 0 {
+		return nil, fmt.Errorf("StreamStallTimeout は0以上である必要があります。入力値: %v", cfg.StreamStallTimeout)
+	}
+
+	maxContinuations := DefaultMaxContinuations
+	if cfg.MaxContinuations > 0 {
+		maxContinuations = cfg.MaxContinuations
+	}
+
+	resumableThreshold := DefaultResumableUploadThreshold
+	if cfg.ResumableUploadThreshold > 0 {
+		resumableThreshold = cfg.ResumableUploadThreshold
+	}
+
+	c := &Client{
+		client:                   client,
+		models:                   models,
+		files:                    client.Files,
+		uploader:                 newResumableUploader(client.ClientConfig(), cfg.OnUploadProgress),
+		temperature:              temp,
+		retryConfig:              retryCfg,
+		maxElapsedTime:           cfg.MaxElapsedTime,
+		filePollingInterval:      pollingInterval,
+		filePollingTimeout:       pollingTimeout,
+		resumableUploadThreshold: resumableThreshold,
+		onUploadProgress:         cfg.OnUploadProgress,
+		enableSearchGrounding:    cfg.EnableSearchGrounding,
+		// 呼び出し元が Config を書き換えても影響を受けないよう、スライスとポインタは複製して保持するのだ
+		stopSequences:     slices.Clone(cfg.StopSequences),
+		topP:              ptr.Clone(cfg.TopP),
+		seed:              ptr.Clone(cfg.Seed),
+		candidateCount:    cfg.CandidateCount,
+		maxOutputTokens:   cfg.MaxOutputTokens,
+		candidateSelector: cfg.CandidateSelector,
+		rawConfig:         rawConfig,
+		systemInstruction: cfg.SystemInstruction,
+		presencePenalty:   ptr.Clone(cfg.PresencePenalty),
+		frequencyPenalty:  ptr.Clone(cfg.FrequencyPenalty),
+		fallbackModels:    slices.Clone(cfg.FallbackModels),
+
+		retryEmptyResponses:  cfg.RetryEmptyResponses,
+		returnPartialOnBlock: cfg.ReturnPartialOnBlock,
+		autoContinue:         cfg.AutoContinue,
+		maxContinuations:     maxContinuations,
+		limiter:              newRateLimiter(cfg.RequestsPerMinute),
+		streamStallTimeout:   cfg.StreamStallTimeout,
+		thinkingBudget:       ptr.Clone(cfg.ThinkingBudget),
+		responseModalities:   responseModalities,
+		debugRequests:        cfg.DebugRequests,
+		apiKeys:              apiKeys,
+	}
+	if cfg.PublishMetrics {
+		c.publishMetrics()
+	}
+	if cfg.MetricsRegisterer != nil {
+		metrics, err := newMetricsCollector(cfg.MetricsRegisterer)
+		if err != nil {
+			return nil, err
+		}
+		c.metrics = metrics
+	}
+
+	return c, nil
+}
+
+// validatePenalty はペナルティ値が API の受け付ける範囲 [-2.0, 2.0) にあるかを検証するのだ。
+func validatePenalty(name string, v *float32) error {
+	if v == nil {
+		return nil
+	}
+	if *v < -2.0 || *v >= 2.0 {
+		return fmt.Errorf("%s は-2.0以上2.0未満である必要があります。入力値: %f", name, *v)
+	}
+	return nil
 }
 
 // NewClientFromEnv は環境変数（GEMINI_API_KEY等）から設定を読み取って初期化するのだ。
 func NewClientFromEnv(ctx context.Context) (*Client, error) {
+	return NewClientFromEnvWithConfig(ctx, Config{})
+}
+
+// NewClientFromEnvWithConfig は APIキーだけを環境変数から読み取り、残りの設定は cfg を使って初期化するのだ。
+func NewClientFromEnvWithConfig(ctx context.Context, cfg Config) (*Client, error) {
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		apiKey = os.Getenv("GOOGLE_API_KEY")
 	}
-	if apiKey == "" {
-		return nil, fmt.Errorf("環境変数 GEMINI_API_KEY または GOOGLE_API_KEY が設定されていません")
+	if len(cfg.APIKeys) == 0 {
+		cfg.APIKeys = splitAPIKeys(os.Getenv("GEMINI_API_KEYS"))
+	}
+	if apiKey == "" && len(cfg.APIKeys) == 0 {
+		return nil, fmt.Errorf("環境変数 GEMINI_API_KEY または GOOGLE_API_KEY が設定されていません (複数のキーを使う場合は GEMINI_API_KEYS)")
 	}
 
-	return NewClient(ctx, Config{APIKey: apiKey})
+	cfg.APIKey = apiKey
+	return NewClient(ctx, cfg)
 }
 
 // executeWithRetry は指定された操作をリトライ設定に従って実行する内部関数なのだ。
+// GenerateContentWithRetryConfig で呼び出し単位の設定が指定されていれば、そちらを使うのだ。
 func (c *Client) executeWithRetry(ctx context.Context, operationName string, op func() error, shouldRetryFn func(error) bool) error {
-	return retry.Do(ctx, c.retryConfig, operationName, op, shouldRetryFn)
+	retryCfg := c.retryConfig
+	if override, ok := ctx.Value(retryConfigKey{}).(retry.Config); ok {
+		retryCfg = override
+	}
+	if c.maxElapsedTime <= 0 {
+		return retry.Do(ctx, retryCfg, operationName, op, shouldRetryFn)
+	}
+
+	// 予算時間を過ぎたらバックオフ待機を打ち切るのだ。実行中のリクエスト自体は呼び出し元の ctx に従うのだ
+	budgetCtx, cancel := context.WithTimeout(ctx, c.maxElapsedTime)
+	defer cancel()
+
+	var lastErr error
+	trackedOp := func() error {
+		lastErr = op()
+		return lastErr
+	}
+
+	err := retry.Do(budgetCtx, retryCfg, operationName, trackedOp, shouldRetryFn)
+	// 最後のエラーがリトライ対象外なら、予算時間に関係なくそのエラーで失敗したので、予算切れとは報告しないのだ
+	if err != nil && lastErr != nil && shouldRetryFn(lastErr) && ctx.Err() == nil && errors.Is(budgetCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%sに失敗しました: %w: %w", operationName, ErrRetryBudgetExceeded, lastErr)
+	}
+	return err
 }
 
 // GenerateContent は純粋なテキストプロンプトからコンテンツを生成するのだ。
+// Use で追加したミドルウェアを順番に通ってから API を呼び出すのだ。
 func (c *Client) GenerateContent(ctx context.Context, finalPrompt string, modelName string) (*Response, error) {
+	return c.generateChain(c.generateContent)(ctx, finalPrompt, modelName)
+}
+
+// generateContent はミドルウェアの内側で実行される GenerateContent の本体なのだ。
+func (c *Client) generateContent(ctx context.Context, finalPrompt string, modelName string) (*Response, error) {
 	if finalPrompt == "" {
 		return nil, errors.New("プロンプトが空です。入力を確認してください")
 	}
 
-	var finalResp *Response
 	contents := promptToContents(finalPrompt)
-	config := &genai.GenerateContentConfig{
-		Temperature: genai.Ptr(c.temperature),
+	config := c.newGenerateContentConfig()
+
+	resp, err := c.callGenerateContent(ctx, "Gemini API call", modelName, contents, config)
+	if !c.retryEmptyResponses || ai.GenerateOptionsFromContext(ctx).NonIdempotent {
+		return resp, err
 	}
 
-	op := func() error {
-		resp, err := c.client.Models.GenerateContent(ctx, modelName, contents, config)
+	// 空の応答は言い直しで解消することがあるので、回答を促す一文を付け加えて再試行するのだ
+	nudgedContents := promptToContents(finalPrompt + emptyResponseNudge)
+	for i := 0; i < maxEmptyResponseRetries && isEmptyResponse(resp, err) && ctx.Err() == nil; i++ {
+		slog.WarnContext(ctx, "空の応答を受け取ったため、プロンプトを補足して再試行するのだ", "model", modelName, "attempt", i+1)
+		resp, err = c.callGenerateContent(ctx, "Gemini API call", modelName, nudgedContents, config)
+	}
+	return resp, err
+}
+
+// retryConfigKey は呼び出し単位のリトライ設定をコンテキストに格納するためのキーなのだ。
+type retryConfigKey struct{}
+
+// GenerateContentWithRetryConfig は、この呼び出しだけリトライ設定を差し替えて GenerateContent を実行するのだ。
+// override が nil の場合はクライアントの設定をそのまま使うのだ。
+// MaxRetries はそのまま使う（0 ならリトライしない）けれど、InitialInterval と MaxInterval が 0 の場合はクライアントの設定を引き継ぐのだ。
+// ミドルウェアやフォールバックモデルへの呼び出しにも同じ設定が適用されるのだ。
+func (c *Client) GenerateContentWithRetryConfig(ctx context.Context, prompt string, modelName string, override *retry.Config) (*Response, error) {
+	if override != nil {
+		merged := *override
+		if merged.InitialInterval <= 0 {
+			merged.InitialInterval = c.retryConfig.InitialInterval
+		}
+		if merged.MaxInterval <= 0 {
+			merged.MaxInterval = c.retryConfig.MaxInterval
+		}
+		if merged.InitialInterval > merged.MaxInterval {
+			return nil, fmt.Errorf("リトライの初期待機時間 (%v) は最大待機時間 (%v) 以下である必要があります", merged.InitialInterval, merged.MaxInterval)
+		}
+		ctx = context.WithValue(ctx, retryConfigKey{}, merged)
+	}
+	return c.GenerateContent(ctx, prompt, modelName)
+}
+
+// GenerateJSON は応答を JSON に限定してコンテンツを生成するのだ。
+// schema に JSON Schema (map[string]any など JSON に変換できる値) を渡すと、モデルの出力をそのスキーマに沿わせるのだ。
+// schema が nil の場合は JSON 形式であることだけを指定するのだ。
+// 応答全体がコードブロック (```json ... ```) で囲まれている場合は、区切り記号を取り除いたものを Response.Text にするのだ。
+// 応答が JSON として解釈できない場合は ErrInvalidJSON を返すのだ。スキーマへの適合までは検証しないのだ。
+func (c *Client) GenerateJSON(ctx context.Context, prompt string, modelName string, schema any) (*Response, error) {
+	if prompt == "" {
+		return nil, errors.New("プロンプトが空です。入力を確認してください")
+	}
+
+	config := c.newGenerateContentConfig()
+	config.ResponseMIMEType = jsonMIMEType
+	if schema != nil {
+		config.ResponseJsonSchema = schema
+	}
+
+	resp, err := c.callGenerateContent(ctx, "Gemini JSON API call", modelName, promptToContents(prompt), config)
+	if err != nil {
+		return nil, err
+	}
+	// JSON を指定してもコードブロックで囲んで返すモデルがあるので、検証の前に取り除くのだ
+	resp.Text = ai.StripCodeFences(resp.Text)
+	for i, candidate := range resp.Candidates {
+		resp.Candidates[i] = ai.StripCodeFences(candidate)
+	}
+	if !json.Valid([]byte(resp.Text)) {
+		return resp, fmt.Errorf("%w: %.200q", ErrInvalidJSON, resp.Text)
+	}
+	return resp, nil
+}
+
+// GenerateValidated は GenerateContent で生成した応答を validate で検証し、検証を通らなければ再生成するのだ。
+// 再生成するときは、検証エラーの内容をプロンプトの末尾に付け加えて、モデルに自己修正を促すのだ。
+// 最大で maxAttempts 回生成し、最後まで検証を通らなかった場合は、最後の応答と ErrValidationFailed をラップしたエラーを返すのだ。
+// API の呼び出し自体が失敗した場合は、再生成せずにそのエラーを返すのだ (一時的なエラーのリトライは通常どおり行われるのだ)。
+func (c *Client) GenerateValidated(ctx context.Context, prompt string, modelName string, validate func(string) error, maxAttempts int) (*Response, error) {
+	if validate == nil {
+		return nil, errors.New("検証関数が指定されていません")
+	}
+	if maxAttempts < 1 {
+		return nil, fmt.Errorf("maxAttempts は1以上である必要があります (指定値: %d)", maxAttempts)
+	}
+
+	currentPrompt := prompt
+	for attempt := 1; ; attempt++ {
+		resp, err := c.GenerateContent(ctx, currentPrompt, modelName)
 		if err != nil {
-			return err
+			return resp, err
 		}
-		text, extractErr := extractTextFromResponse(resp)
-		if extractErr != nil {
-			return extractErr
+		validationErr := validate(resp.Text)
+		if validationErr == nil {
+			return resp, nil
 		}
-		finalResp = &Response{Text: text, RawResponse: resp}
-		return nil
+		if attempt == maxAttempts || ctx.Err() != nil {
+			return resp, fmt.Errorf("%w (%d 回生成): %w", ErrValidationFailed, attempt, validationErr)
+		}
+
+		slog.WarnContext(ctx, "応答が検証を通らなかったため、指摘を付け加えて再生成するのだ", "model", modelName, "attempt", attempt, "error", validationErr)
+		currentPrompt = prompt + fmt.Sprintf(validationNudgeFormat, validationErr)
+	}
+}
+
+// GenerateTurns は呼び出し側が組み立てた複数ロールの会話からコンテンツを生成するのだ。
+// system ロールのターンはシステム指示としてまとめて送り、それ以外は順番どおりに会話の履歴として送るのだ。
+// チャットセッションを使わずに、自前で履歴を管理したい場合に使うのだ。
+func (c *Client) GenerateTurns(ctx context.Context, turns []Turn, modelName string) (*Response, error) {
+	contents, systemInstruction, err := turnsToContents(turns)
+	if err != nil {
+		return nil, err
+	}
+
+	config := c.newGenerateContentConfig()
+	// system ロールのターンがない場合は、Config.SystemInstruction をそのまま使うのだ
+	if systemInstruction != nil {
+		config.SystemInstruction = systemInstruction
+	}
+
+	return c.callGenerateContent(ctx, "Gemini API call", modelName, contents, config)
+}
+
+// GenerateFewShot は入力と出力の例を user と model のターンが交互に並ぶ会話にして、その後ろに input を付けて生成するのだ。
+// 例を 1 つのプロンプト文字列に詰め込むより、モデルが例の出力形式をそのまま真似しやすいのだ。
+// システム指示は Config.SystemInstruction をそのまま使うのだ。
+func (c *Client) GenerateFewShot(ctx context.Context, examples []FewShotExample, input, modelName string) (*Response, error) {
+	turns := make([]Turn, 0, len(examples)*2+1)
+	for _, example := range examples {
+		turns = append(turns, Turn{Role: RoleUser, Text: example.Input}, Turn{Role: RoleModel, Text: example.Output})
+	}
+	turns = append(turns, Turn{Role: RoleUser, Text: input})
+
+	contents, _, err := turnsToContents(turns)
+	if err != nil {
+		return nil, fmt.Errorf("few-shot の例または入力が不正です: %w", err)
 	}
+	return c.callGenerateContent(ctx, "Gemini few-shot", modelName, contents, c.newGenerateContentConfig())
+}
 
-	err := c.executeWithRetry(ctx, fmt.Sprintf("Gemini API call to %s", modelName), op, shouldRetry)
+// GenerateContentFromReader はリーダーの内容を File API へストリーミング転送し、それを入力としてコンテンツを生成するのだ。
+// GenerateContent と違って入力全体をメモリに載せずに済むけれど、
+// アップロードと処理完了待ちのポーリングが挟まる分だけ応答までの時間は長くなるのだ。
+// 小さな入力なら GenerateContent（インライン送信）の方が速いのだ。
+func (c *Client) GenerateContentFromReader(ctx context.Context, r io.Reader, modelName string) (*Response, error) {
+	file, err := c.uploadReader(ctx, r, readerInputMIMEType)
 	if err != nil {
 		return nil, err
 	}
 
-	return finalResp, nil
+	fileURI, fileName, err := c.waitForFileActive(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	// 呼び出し元がキャンセルした場合も削除できるよう、キャンセルは引き継がないのだ
+	defer func() {
+		if _, err := c.files.Delete(context.WithoutCancel(ctx), fileName, &genai.DeleteFileConfig{}); err != nil {
+			slog.WarnContext(ctx, "File API クリーンアップ失敗", "name", fileName, "error", err)
+		}
+	}()
+
+	contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{
+		{FileData: &genai.FileData{FileURI: fileURI, MIMEType: readerInputMIMEType}},
+	}}}
+	config := c.newGenerateContentConfig()
+
+	return c.callGenerateContent(ctx, "Gemini API call", modelName, contents, config)
 }
 
 // GenerateWithParts はマルチモーダルパーツを処理し、巨大なデータは自動的に File API へ退避するのだ。
+// アップロードは冪等ではない (再送するとサーバー側にファイルが重複する) ので、リトライの外で一度だけ行い、
+// リトライするのは生成の呼び出しだけなのだ。アップロードしたファイルは、生成の試行回数や成否にかかわらず最後に削除するのだ。
 func (c *Client) GenerateWithParts(ctx context.Context, modelName string, parts []*genai.Part, opts ImageOptions) (*Response, error) {
 	processedParts := make([]*genai.Part, len(parts))
 	copy(processedParts, parts)
@@ -128,7 +480,7 @@ func (c *Client) GenerateWithParts(ctx context.Context, modelName string, parts
 			i, p := i, p
 			eg.Go(func() error {
 				slog.InfoContext(gCtx, "巨大データを検知。File APIへ自動転送するのだ", "size", len(p.InlineData.Data))
-				fileURI, fileName, err := c.uploadToFileAPI(gCtx, p.InlineData.Data, p.InlineData.MIMEType)
+				fileURI, fileName, err := c.uploadToFileAPI(gCtx, bytes.NewReader(p.InlineData.Data), int64(len(p.InlineData.Data)), p.InlineData.MIMEType)
 				if err != nil {
 					return err
 				}
@@ -145,30 +497,34 @@ func (c *Client) GenerateWithParts(ctx context.Context, modelName string, parts
 		}
 	}
 
-	// 並列アップロードの完了を待機するのだ
-	if err := eg.Wait(); err != nil {
-		slog.ErrorContext(ctx, "File APIへの並列アップロード中にエラーが発生しました", "error", err)
-		return nil, fmt.Errorf("file upload failed: %w", err)
-	}
-
-	// 生成処理の完了後（または失敗時）、一時ファイルを一括削除するのだ
+	// 後片付けは待機の結果より先に登録するのだ。一部のアップロードだけが成功した場合も、
+	// 成功した分のファイルを残さず削除するためなのだ。呼び出し元がキャンセルした場合も削除できるよう、キャンセルは引き継がないのだ
 	defer func() {
+		cleanupCtx := context.WithoutCancel(ctx)
 		for _, name := range uploadedFiles {
-			if _, err := c.client.Files.Delete(ctx, name, &genai.DeleteFileConfig{}); err != nil {
+			if _, err := c.files.Delete(cleanupCtx, name, &genai.DeleteFileConfig{}); err != nil {
 				slog.WarnContext(ctx, "File API クリーンアップ失敗", "name", name, "error", err)
 			}
 		}
 	}()
 
+	// 並列アップロードの完了を待機するのだ
+	if err := eg.Wait(); err != nil {
+		slog.ErrorContext(ctx, "File APIへの並列アップロード中にエラーが発生しました", "error", err)
+		return nil, fmt.Errorf("file upload failed: %w", err)
+	}
+
 	// --- AIへのリクエスト組み立て ---
 	contents := []*genai.Content{{Role: "user", Parts: processedParts}}
-	genConfig := &genai.GenerateContentConfig{
-		Temperature:    genai.Ptr(c.temperature),
-		TopP:           genai.Ptr(DefaultTopP),
-		CandidateCount: DefaultCandidateCount,
-		Seed:           opts.Seed,
-		SafetySettings: opts.SafetySettings,
+	genConfig := c.newGenerateContentConfig()
+	if genConfig.TopP == nil {
+		genConfig.TopP = genai.Ptr(DefaultTopP)
 	}
+	genConfig.CandidateCount = DefaultCandidateCount
+	if opts.Seed != nil {
+		genConfig.Seed = opts.Seed
+	}
+	genConfig.SafetySettings = opts.SafetySettings
 
 	if opts.SystemPrompt != "" {
 		genConfig.SystemInstruction = &genai.Content{
@@ -180,25 +536,368 @@ func (c *Client) GenerateWithParts(ctx context.Context, modelName string, parts
 		genConfig.ImageConfig = &genai.ImageConfig{AspectRatio: opts.AspectRatio}
 	}
 
+	return c.callGenerateContent(ctx, "Gemini Image API call", modelName, contents, genConfig)
+}
+
+// CountTokens はテキストをモデルに送った場合のトークン数を数えるのだ。
+func (c *Client) CountTokens(ctx context.Context, text string, modelName string) (int32, error) {
+	resp, err := c.models.CountTokens(ctx, modelName, promptToContents(text), nil)
+	if err != nil {
+		return 0, fmt.Errorf("トークン数の取得に失敗しました: %w", err)
+	}
+	return resp.TotalTokens, nil
+}
+
+// Ping は DefaultPingModel を使って PingModel を呼び出すのだ。
+func (c *Client) Ping(ctx context.Context) error {
+	return c.PingModel(ctx, DefaultPingModel)
+}
+
+// PingModel は、生成より安価なトークン数の計算を 1 回だけ呼び出して、API キーと Gemini API への接続を確認するのだ。
+// バッチ処理の前の事前チェック向けなので、リトライはしないのだ。
+// API キーが無効な場合や権限がない場合は ErrUnauthorized、接続できない場合は ErrUnreachable をラップしたエラーを返すのだ。
+// それ以外の失敗 (存在しないモデルなど) は、API のエラーをそのまま包んで返すのだ。
+func (c *Client) PingModel(ctx context.Context, modelName string) error {
+	_, err := c.models.CountTokens(ctx, modelName, promptToContents(pingText), nil)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.Canceled):
+		return ctx.Err()
+	case isAuthError(err):
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	case isNetworkError(err):
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	default:
+		return fmt.Errorf("疎通確認に失敗しました: %w", err)
+	}
+}
+
+// callGenerateContent は組み立て済みのリクエストを指数バックオフ付きのリトライで送信し、応答を抽出するのだ。
+// ai.WithTemperature で温度が指定されていれば、この呼び出しだけ config の温度を差し替えるのだ。
+// リトライしても一時的なエラーが解消しない場合は、FallbackModels のモデルを順番に試すのだ。
+// AutoContinue が有効なら、MaxTokens で打ち切られた応答の続きを頼んで連結するのだ。
+func (c *Client) callGenerateContent(ctx context.Context, operationLabel, modelName string, contents []*genai.Content, config *genai.GenerateContentConfig) (*Response, error) {
+	if err := applyTemperatureOverride(ctx, config); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.callWithFallback(ctx, operationLabel, modelName, contents, config)
+	if c.autoContinue && isMaxTokens(err) && resp != nil {
+		return c.continueTruncated(ctx, operationLabel, contents, config, resp, err)
+	}
+	return resp, err
+}
+
+// callWithFallback は modelName にリトライ付きで送信し、一時的なエラーが解消しない場合は FallbackModels のモデルを順番に試すのだ。
+func (c *Client) callWithFallback(ctx context.Context, operationLabel, modelName string, contents []*genai.Content, config *genai.GenerateContentConfig) (*Response, error) {
+	resp, err := c.callModel(ctx, operationLabel, modelName, contents, config)
+	// 冪等でない呼び出しは、別のモデルに送り直すと副作用が重複するおそれがあるので、フォールバックしないのだ
+	if err == nil || len(c.fallbackModels) == 0 || !IsRetryable(err) || ai.GenerateOptionsFromContext(ctx).NonIdempotent {
+		return resp, err
+	}
+
+	errs := []error{err}
+	for _, fallback := range c.fallbackModels {
+		if ctx.Err() != nil {
+			break
+		}
+		slog.WarnContext(ctx, "一時的なエラーが解消しないため、フォールバックモデルを試すのだ", "from", modelName, "to", fallback, "error", err)
+
+		resp, err = c.callModel(ctx, operationLabel, fallback, contents, config)
+		if err == nil {
+			slog.InfoContext(ctx, "フォールバックモデルが応答したのだ", "model", fallback, "primary", modelName)
+			return resp, nil
+		}
+		errs = append(errs, err)
+		if !IsRetryable(err) {
+			break
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// continueTruncated は、MaxTokens で打ち切られた応答 resp を会話の履歴にして続きを頼み、自然に終わるまで応答を連結するのだ。
+// 続きを頼むのは maxContinuations 回までで、続きが空だった場合も堂々巡りを避けるために打ち切るのだ。
+// 終わらなかった場合や途中で失敗した場合は、連結したテキストを含む Response と ErrTruncated をラップしたエラーを返すのだ。
+func (c *Client) continueTruncated(ctx context.Context, operationLabel string, contents []*genai.Content, config *genai.GenerateContentConfig, resp *Response, err error) (*Response, error) {
+	result := *resp
+	// 続きは選んだ候補だけを連結するので、他の候補は途中までのテキストのまま残さないのだ
+	result.Candidates = nil
+	if result.Usage != nil {
+		usage := *result.Usage
+		result.Usage = &usage
+	}
+
+	var text strings.Builder
+	text.WriteString(resp.Text)
+	for i := 0; i < c.maxContinuations && isMaxTokens(err); i++ {
+		if ctx.Err() != nil {
+			return &result, fmt.Errorf("%w: %w", ErrTruncated, ctx.Err())
+		}
+		slog.InfoContext(ctx, "出力トークンの上限で打ち切られたため、続きを頼むのだ", "model", result.ModelName, "continuation", i+1, "max_continuations", c.maxContinuations)
+
+		history := append(slices.Clone(contents),
+			&genai.Content{Role: RoleModel, Parts: []*genai.Part{{Text: text.String()}}},
+			&genai.Content{Role: RoleUser, Parts: []*genai.Part{{Text: continuationPrompt}}},
+		)
+		next, nextErr := c.callWithFallback(ctx, operationLabel, result.ModelName, history, config)
+		if next == nil {
+			return &result, fmt.Errorf("%w: 続きの生成に失敗しました: %w", ErrTruncated, nextErr)
+		}
+
+		text.WriteString(next.Text)
+		result.Text = text.String()
+		result.RawResponse = next.RawResponse
+		result.RequestID = next.RequestID
+		result.Attempts += next.Attempts
+		result.Citations = append(result.Citations, next.Citations...)
+		result.Images = append(result.Images, next.Images...)
+		result.Usage = addUsage(result.Usage, next.Usage)
+		err = nextErr
+
+		if strings.TrimSpace(next.Text) == "" && isMaxTokens(err) {
+			slog.WarnContext(ctx, "続きが空だったため、続きを頼むのをやめるのだ", "model", result.ModelName)
+			break
+		}
+	}
+
+	if err != nil && !errors.Is(err, ErrTruncated) {
+		err = fmt.Errorf("%w: %w", ErrTruncated, err)
+	}
+	return &result, err
+}
+
+// isMaxTokens は、エラーが出力トークンの上限 (FinishReason が MAX_TOKENS) による打ち切りを示すかどうかを判定するのだ。
+func isMaxTokens(err error) bool {
+	var apiErr *APIResponseError
+	return errors.As(err, &apiErr) && apiErr.finishReason == genai.FinishReasonMaxTokens
+}
+
+// addUsage は 2 つのトークン使用量を合計するのだ。片方が nil の場合はもう片方を返すのだ。
+func addUsage(a, b *ai.Usage) *ai.Usage {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &ai.Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// callModel は単一のモデルに対してリトライ付きでリクエストを送信するのだ。
+func (c *Client) callModel(ctx context.Context, operationLabel, modelName string, contents []*genai.Content, config *genai.GenerateContentConfig) (resp *Response, err error) {
+	operationName := fmt.Sprintf("%s to %s", operationLabel, modelName)
+	c.counters.requests.Add(1)
+
+	var attempts int
+	start := time.Now()
+	c.logRequest(ctx, modelName, contents, config)
+	ctx, span := startSpan(ctx, modelName, contents)
+	defer func() {
+		endSpan(span, attempts, resp, err)
+		c.metrics.observeResult(modelName, start, err)
+	}()
+
 	var finalResp *Response
-	op := func() error {
-		resp, err := c.client.Models.GenerateContent(ctx, modelName, contents, genConfig)
-		if err != nil {
+	var partialErr error
+	var attemptErrs []error
+	op := func() (opErr error) {
+		// キャンセル済みならリクエストを送らずに終了するのだ（Canceled はリトライ対象外なので即座に抜けるのだ）
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		text, extractErr := extractTextFromResponse(resp)
+		attempts++
+		defer func() {
+			if opErr != nil {
+				attemptErrs = append(attemptErrs, opErr)
+			}
+		}()
+		if attempts > 1 {
+			c.counters.retries.Add(1)
+			c.metrics.observeRetry(modelName)
+			if onRetry := ai.OnRetryFromContext(ctx); onRetry != nil {
+				onRetry(attempts, attemptErrs[len(attemptErrs)-1])
+			}
+		}
+		// リトライも 1 回の API 呼び出しとして数え、レート制限の枠が空くまで待つのだ
+		if err := c.waitForRateLimit(ctx); err != nil {
+			return err
+		}
+
+		apiResp, apiErr := c.models.GenerateContent(ctx, modelName, contents, config)
+		logRequestID(ctx, modelName, attempts, apiResp, apiErr)
+		if apiErr != nil {
+			return apiErr
+		}
+		apiResp = c.selectCandidate(ctx, apiResp)
+		text, extractErr := extractTextFromResponse(apiResp)
 		if extractErr != nil {
-			return extractErr
+			if IsBlocked(extractErr) {
+				c.counters.blocked.Add(1)
+			}
+			// 途中までのテキストがあれば、破棄せずに ErrTruncated と一緒に返すのだ。
+			// AutoContinue では MaxTokens で打ち切られたテキストに続きを連結するので、常に残すのだ
+			keepPartial := c.returnPartialOnBlock || (c.autoContinue && isMaxTokens(extractErr))
+			if !keepPartial || !IsBlocked(extractErr) || text == "" {
+				return extractErr
+			}
+			partialErr = fmt.Errorf("%w: %w", ErrTruncated, extractErr)
+		}
+		finalResp = &Response{
+			Text:        text,
+			RawResponse: apiResp,
+			Citations:   extractCitations(apiResp),
+			ModelName:   modelName,
+			Usage:       extractUsage(apiResp),
+			Attempts:    attempts,
+			Candidates:  extractCandidateTexts(apiResp),
+			Images:      extractImages(apiResp),
+			RequestID:   extractRequestID(apiResp),
 		}
-		finalResp = &Response{Text: text, RawResponse: resp}
 		return nil
 	}
 
-	// 指数バックオフ付きのリトライ実行なのだ
-	err := c.executeWithRetry(ctx, fmt.Sprintf("Gemini Image API call to %s", modelName), op, shouldRetry)
-	if err != nil {
+	shouldRetry := shouldRetryWithContext(ctx)
+	if ai.GenerateOptionsFromContext(ctx).NonIdempotent {
+		shouldRetry = func(error) bool { return false }
+	}
+	if err := c.executeWithRetry(ctx, operationName, op, shouldRetry); err != nil {
+		c.counters.failures.Add(1)
+		if len(c.responseModalities) > 0 && isInvalidArgument(err) && mentionsModalities(err) {
+			return nil, fmt.Errorf("%w: %w", ErrResponseModalitiesUnsupported, err)
+		}
+		if c.thinkingBudget != nil && isInvalidArgument(err) && mentionsThinking(err) {
+			return nil, fmt.Errorf("%w: %w", ErrThinkingBudgetUnsupported, err)
+		}
+		if c.enableSearchGrounding && isInvalidArgument(err) {
+			return nil, fmt.Errorf("%w: %w", ErrSearchGroundingUnsupported, err)
+		}
+		if isQuotaExceeded(err) {
+			return nil, fmt.Errorf("%w: %w", ErrQuotaExceeded, err)
+		}
+		// 最後の試行もリトライ可能なエラーだった場合は、リトライの予算を使い切ったので試行の履歴を添えるのだ
+		if n := len(attemptErrs); n > 0 && shouldRetry(attemptErrs[n-1]) {
+			return nil, &RetriesExhaustedError{Attempts: attempts, Errors: attemptErrs, Err: err, RequestID: RequestIDFromError(attemptErrs[n-1])}
+		}
 		return nil, err
 	}
 
-	return finalResp, nil
+	return finalResp, partialErr
+}
+
+// selectCandidate は、応答に複数の候補がある場合に CandidateSelector で候補を選び、それが先頭になるよう並べ替えた応答を返すのだ。
+// 以降の抽出処理は先頭の候補を読むので、選んだ候補がテキスト、出典、画像、ブロックの判定に使われるのだ。
+// API から受け取った応答自体は書き換えず、候補の並びを変えた複製を返すのだ。
+func (c *Client) selectCandidate(ctx context.Context, resp *genai.GenerateContentResponse) *genai.GenerateContentResponse {
+	if resp == nil || len(resp.Candidates) < 2 {
+		return resp
+	}
+	selector := c.candidateSelector
+	if selector == nil {
+		selector = FirstNonBlocked
+	}
+	index := selector(resp.Candidates)
+	if index < 0 || index >= len(resp.Candidates) {
+		slog.WarnContext(ctx, "CandidateSelector が範囲外の番号を返したため、先頭の候補を使うのだ", "index", index, "candidates", len(resp.Candidates))
+		return resp
+	}
+	if index == 0 {
+		return resp
+	}
+
+	selected := *resp
+	selected.Candidates = make([]*genai.Candidate, 0, len(resp.Candidates))
+	selected.Candidates = append(selected.Candidates, resp.Candidates[index])
+	selected.Candidates = append(selected.Candidates, resp.Candidates[:index]...)
+	selected.Candidates = append(selected.Candidates, resp.Candidates[index+1:]...)
+	return &selected
+}
+
+// newGenerateContentConfig はクライアントの設定を反映したリクエスト設定を生成するのだ。
+// 呼び出しごとに新しい値を返すため、呼び出し側で書き換えてもクライアントや他の呼び出しには影響しないのだ。
+// RawConfigJSON が指定されている場合はそれを土台にして、構造化フィールドで指定された値で上書きするのだ。
+func (c *Client) newGenerateContentConfig() *genai.GenerateContentConfig {
+	// NewClient で解析済みの設定を複製して、呼び出しの間で値を共有しないようにするのだ
+	config := cloneRawConfig(c.rawConfig)
+
+	config.Temperature = genai.Ptr(c.temperature)
+	if c.topP != nil {
+		config.TopP = ptr.Clone(c.topP)
+	}
+	if len(c.stopSequences) > 0 {
+		config.StopSequences = slices.Clone(c.stopSequences)
+	}
+	if c.seed != nil {
+		config.Seed = ptr.Clone(c.seed)
+	}
+	if c.presencePenalty != nil {
+		config.PresencePenalty = ptr.Clone(c.presencePenalty)
+	}
+	if c.frequencyPenalty != nil {
+		config.FrequencyPenalty = ptr.Clone(c.frequencyPenalty)
+	}
+	if c.candidateCount > 0 {
+		config.CandidateCount = c.candidateCount
+	}
+	if c.maxOutputTokens > 0 {
+		config.MaxOutputTokens = c.maxOutputTokens
+	}
+	if c.thinkingBudget != nil {
+		// RawConfigJSON で includeThoughts などが指定されていれば、それを残して予算だけを上書きするのだ
+		if config.ThinkingConfig == nil {
+			config.ThinkingConfig = &genai.ThinkingConfig{}
+		}
+		config.ThinkingConfig.ThinkingBudget = ptr.Clone(c.thinkingBudget)
+	}
+	if len(c.responseModalities) > 0 {
+		config.ResponseModalities = slices.Clone(c.responseModalities)
+	}
+	if c.systemInstruction != "" {
+		config.SystemInstruction = &genai.Content{Parts: []*genai.Part{{Text: c.systemInstruction}}}
+	}
+
+	if c.enableSearchGrounding {
+		config.Tools = append(config.Tools, &genai.Tool{GoogleSearch: &genai.GoogleSearch{}})
+	}
+
+	return config
+}
+
+// applyTemperatureOverride は、ai.WithTemperature で温度が指定されていれば config の温度を差し替えるのだ。
+func applyTemperatureOverride(ctx context.Context, config *genai.GenerateContentConfig) error {
+	t, ok := ai.TemperatureFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if t < 0.0 || t > 1.0 {
+		return fmt.Errorf("温度設定は0.0から1.0の間である必要があります。入力値: %f", t)
+	}
+	config.Temperature = genai.Ptr(t)
+	return nil
+}
+
+// newRateLimiter は 1 分あたりのリクエスト数から、呼び出し間隔を均等に空けるトークンバケットを生成するのだ。
+// requestsPerMinute が 0 の場合は制限しないので nil を返すのだ。
+func newRateLimiter(requestsPerMinute int) *rate.Limiter {
+	if requestsPerMinute <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Every(time.Minute/time.Duration(requestsPerMinute)), 1)
+}
+
+// waitForRateLimit はレート制限の枠が空くまで待つのだ。待っている間に ctx が終了した場合はエラーを返すのだ。
+func (c *Client) waitForRateLimit(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("レート制限の待機中に中断しました: %w", err)
+	}
+	return nil
 }
@@ -1,11 +1,32 @@
 package gemini
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-utils/retry"
+	"google.golang.org/genai"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -29,6 +50,27 @@ func TestNewClient_InvalidAPIKey(t *testing.T) {
 	})
 }
 
+func TestNewClient_InvalidFilePolling(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{
+		APIKey:              "dummy-key",
+		FilePollingInterval: 10 * time.Second,
+		FilePollingTimeout:  5 * time.Second,
+	}
+
+	t.Run("ポーリング間隔がタイムアウト以上の場合にエラーを返すこと", func(t *testing.T) {
+		_, err := NewClient(ctx, cfg)
+		if err == nil {
+			t.Fatal("FAIL: ポーリング間隔がタイムアウト以上の場合、エラーが返されるべきです")
+		}
+
+		expectedError := "ファイルポーリング間隔"
+		if !strings.Contains(err.Error(), expectedError) {
+			t.Errorf("FAIL: 予期しないエラーメッセージ\n  got: %q\n  want (contains): %q", err.Error(), expectedError)
+		}
+	})
+}
+
 func TestNewClientFromEnv_MissingKey(t *testing.T) {
 	ctx := context.Background()
 
@@ -73,29 +115,2740 @@ func TestClient_GenerateWithParts_Mock(t *testing.T) {
 	// 4. 異常系 (ブロック): FinishReasonSafety によりブロックされ、APIResponseError が返ることを検証
 }
 
-// shouldRetry の単体テストを追加し、リトライロジックの妥当性を検証します
-func TestShouldRetry(t *testing.T) {
+// IsRetryable の単体テストで、リトライポリシーの妥当性を検証します
+func TestIsRetryable(t *testing.T) {
 	tests := []struct {
 		name string
 		err  error
 		want bool
 	}{
+		// gRPC のステータスコード
 		{"一時的エラー (Unavailable)", status.Error(codes.Unavailable, "service unavailable"), true},
 		{"リソース不足 (ResourceExhausted)", status.Error(codes.ResourceExhausted, "quota exceeded"), true},
 		{"内部エラー (Internal)", status.Error(codes.Internal, "internal server error"), true},
+		{"gRPC DeadlineExceeded", status.Error(codes.DeadlineExceeded, "deadline"), true},
 		{"永続的エラー (InvalidArgument)", status.Error(codes.InvalidArgument, "invalid prompt"), false},
 		{"認証エラー (Unauthenticated)", status.Error(codes.Unauthenticated, "invalid key"), false},
+		{"gRPC PermissionDenied", status.Error(codes.PermissionDenied, "denied"), false},
+		{"gRPC NotFound", status.Error(codes.NotFound, "no such model"), false},
+		{"gRPC FailedPrecondition", status.Error(codes.FailedPrecondition, "precondition"), false},
+		{"gRPC Unimplemented", status.Error(codes.Unimplemented, "unimplemented"), false},
+		{"gRPC Canceled", status.Error(codes.Canceled, "canceled"), false},
+		{"gRPC Unknown", status.Error(codes.Unknown, "unknown"), false},
+		// REST (genai.APIError) のステータスコード
+		{"REST 429", genai.APIError{Code: 429, Status: "RESOURCE_EXHAUSTED"}, true},
+		{"REST 500", genai.APIError{Code: 500, Status: "INTERNAL"}, true},
+		{"REST 502", genai.APIError{Code: 502}, true},
+		{"REST 503", genai.APIError{Code: 503, Status: "UNAVAILABLE"}, true},
+		{"REST 504", genai.APIError{Code: 504, Status: "DEADLINE_EXCEEDED"}, true},
+		{"REST 400", genai.APIError{Code: 400, Status: "INVALID_ARGUMENT"}, false},
+		{"REST 401", genai.APIError{Code: 401, Status: "UNAUTHENTICATED"}, false},
+		{"REST 403", genai.APIError{Code: 403, Status: "PERMISSION_DENIED"}, false},
+		{"REST 404", genai.APIError{Code: 404, Status: "NOT_FOUND"}, false},
+		// ラップされたエラー
+		{"ラップされた gRPC Unavailable", fmt.Errorf("call: %w", status.Error(codes.Unavailable, "x")), true},
+		{"ラップされた REST 503", fmt.Errorf("call: %w", genai.APIError{Code: 503}), true},
+		{"ラップされた REST 400", fmt.Errorf("call: %w", genai.APIError{Code: 400}), false},
+		// コンテキスト
 		{"コンテキストキャンセル", context.Canceled, false},
 		{"タイムアウト", context.DeadlineExceeded, false},
-		// ------------------------------------------------------
-		{"APIResponseError (ブロック)", &APIResponseError{msg: "blocked"}, false},
+		{"ラップされたキャンセル", fmt.Errorf("doRequest: %w", context.Canceled), false},
+		// 論理的なエラー
+		{"APIResponseError (ブロック)", &APIResponseError{msg: "blocked", finishReason: genai.FinishReasonSafety}, false},
+		{"APIResponseError (空レスポンス)", &APIResponseError{msg: "empty"}, false},
+		{"ラップされた APIResponseError", fmt.Errorf("extract: %w", &APIResponseError{msg: "blocked"}), false},
+		{"分類できないエラー", errors.New("connection reset"), false},
+		{"nil", nil, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := shouldRetry(tt.err); got != tt.want {
-				t.Errorf("shouldRetry(%v) = %v, want %v", tt.err, got, tt.want)
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("FAIL: IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
 			}
 		})
 	}
 }
+
+// --- resumable アップロードに関するテスト ---
+
+// fakeUploadServer は File API の resumable アップロードを模したサーバーなのだ。
+// failAt を超えるチャンクを受け取ると、failAt までを受け取った扱いにして 503 を返すのだ (1 回だけ)。
+type fakeUploadServer struct {
+	t         *testing.T
+	mu        sync.Mutex
+	received  []byte
+	failAt    int
+	failed    bool
+	starts    int
+	queries   int
+	alwaysErr bool
+}
+
+func (s *fakeUploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("x-goog-api-key") != "dummy-key" {
+		s.t.Errorf("FAIL: API キーが送られていません: %q", r.Header.Get("x-goog-api-key"))
+	}
+
+	switch command := r.Header.Get(uploadCommandHeader); {
+	case command == "start":
+		s.starts++
+		if r.URL.Path != "/upload/v1beta/files" || r.Header.Get(uploadProtocolHeader) != "resumable" {
+			s.t.Errorf("FAIL: セッションの開始のリクエストが不正です: %s %s", r.URL.Path, r.Header.Get(uploadProtocolHeader))
+		}
+		w.Header().Set(uploadURLHeader, "http://"+r.Host+"/session")
+	case command == "query":
+		s.queries++
+		if s.alwaysErr {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(uploadStatusHeader, "active")
+		w.Header().Set(uploadSizeReceivedHeader, strconv.Itoa(len(s.received)))
+	case strings.HasPrefix(command, "upload"):
+		offset, _ := strconv.Atoi(r.Header.Get(uploadOffsetHeader))
+		if offset != len(s.received) {
+			http.Error(w, "offset mismatch", http.StatusBadRequest)
+			return
+		}
+		chunk, _ := io.ReadAll(r.Body)
+		if s.alwaysErr || (!s.failed && offset+len(chunk) > s.failAt) {
+			// 途中まで受け取ったところで接続が切れた扱いにするのだ
+			s.failed = true
+			if !s.alwaysErr {
+				s.received = append(s.received, chunk[:s.failAt-offset]...)
+			}
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s.received = append(s.received, chunk...)
+		if strings.Contains(command, "finalize") {
+			w.Header().Set(uploadStatusHeader, "final")
+			fmt.Fprint(w, `{"file":{"name":"files/abc","uri":"https://example.com/files/abc","state":"ACTIVE"}}`)
+			return
+		}
+		w.Header().Set(uploadStatusHeader, "active")
+	default:
+		s.t.Errorf("FAIL: 予期しないコマンド: %q", command)
+	}
+}
+
+func newFakeUploader(t *testing.T, server *fakeUploadServer, onProgress func(sent, total int64)) *resumableUploader {
+	t.Helper()
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	cc := genai.ClientConfig{APIKey: "dummy-key", HTTPClient: ts.Client()}
+	cc.HTTPOptions.BaseURL = ts.URL + "/"
+	u := newResumableUploader(cc, onProgress)
+	u.chunkSize = 256
+	u.resumeDelay = 0
+	return u
+}
+
+func TestResumableUploader_ResumesFromServerOffset(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	server := &fakeUploadServer{t: t, failAt: 300}
+
+	var progress []int64
+	u := newFakeUploader(t, server, func(sent, total int64) {
+		if total != int64(len(data)) {
+			t.Errorf("FAIL: 進捗の全体のバイト数が不正です: %d", total)
+		}
+		progress = append(progress, sent)
+	})
+
+	file, err := u.upload(context.Background(), bytes.NewReader(data), int64(len(data)), "text/plain", "test")
+	if err != nil {
+		t.Fatalf("FAIL: 再開後もアップロードに失敗しました: %v", err)
+	}
+	if file.Name != "files/abc" || file.URI != "https://example.com/files/abc" {
+		t.Errorf("FAIL: 作成されたファイルの情報が不正です: %+v", file)
+	}
+	if !bytes.Equal(server.received, data) {
+		t.Errorf("FAIL: サーバーが受け取ったデータが一致しません (got %d bytes, want %d bytes)", len(server.received), len(data))
+	}
+	if server.starts != 1 || server.queries != 1 {
+		t.Errorf("FAIL: セッションは 1 回だけ開始し、失敗後に 1 回だけ問い合わせるべきです (starts: %d, queries: %d)", server.starts, server.queries)
+	}
+	// 256 バイト目までは受け取りが確認され、失敗後はサーバーが受け取り済みの 300 バイト目から再開するのだ
+	want := []int64{256, 300, 556, 812, 1000}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("FAIL: 進捗はサーバーが受け取りを確認したバイト数で通知するべきです: got %v, want %v", progress, want)
+	}
+}
+
+func TestResumableUploader_GivesUpAfterMaxResumes(t *testing.T) {
+	server := &fakeUploadServer{t: t, alwaysErr: true}
+	u := newFakeUploader(t, server, nil)
+
+	data := bytes.Repeat([]byte("a"), 10)
+	_, err := u.upload(context.Background(), bytes.NewReader(data), int64(len(data)), "text/plain", "test")
+	if err == nil {
+		t.Fatal("FAIL: 再開回数を超えた場合、エラーが返されるべきです")
+	}
+	if !strings.Contains(err.Error(), "再開回数") {
+		t.Errorf("FAIL: 予期しないエラーメッセージ: %q", err.Error())
+	}
+	if server.queries != maxUploadResumes {
+		t.Errorf("FAIL: 再開の上限まで問い合わせるべきです (queries: %d)", server.queries)
+	}
+}
+
+// --- リトライ予算に関するテスト ---
+
+func TestExecuteWithRetry_MaxElapsedTime(t *testing.T) {
+	c := &Client{
+		retryConfig: retry.Config{
+			MaxRetries:      10,
+			InitialInterval: 500 * time.Millisecond,
+			MaxInterval:     time.Second,
+		},
+		maxElapsedTime: 50 * time.Millisecond,
+	}
+
+	attempts := 0
+	op := func() error {
+		attempts++
+		return status.Error(codes.Unavailable, "service unavailable")
+	}
+
+	start := time.Now()
+	err := c.executeWithRetry(context.Background(), "test", op, IsRetryable)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrRetryBudgetExceeded) {
+		t.Fatalf("FAIL: ErrRetryBudgetExceeded が返されるべきです。got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "service unavailable") {
+		t.Errorf("FAIL: 最後のエラーがラップされていません: %v", err)
+	}
+	if elapsed >= 500*time.Millisecond {
+		t.Errorf("FAIL: 予算時間で打ち切られるべきです。elapsed = %v", elapsed)
+	}
+	if attempts != 1 {
+		t.Errorf("FAIL: 試行回数が想定と異なります。got %d, want 1", attempts)
+	}
+}
+
+func TestExecuteWithRetry_MaxElapsedTime_NonRetryableError(t *testing.T) {
+	c := &Client{
+		retryConfig:    retry.Config{MaxRetries: 10, InitialInterval: 500 * time.Millisecond, MaxInterval: time.Second},
+		maxElapsedTime: 20 * time.Millisecond,
+	}
+
+	// 予算時間を過ぎてから、リトライ対象外のエラーで失敗する操作なのだ
+	op := func() error {
+		time.Sleep(50 * time.Millisecond)
+		return status.Error(codes.InvalidArgument, "invalid argument")
+	}
+
+	err := c.executeWithRetry(context.Background(), "test", op, IsRetryable)
+	if err == nil {
+		t.Fatal("FAIL: エラーが返されるべきです")
+	}
+	if errors.Is(err, ErrRetryBudgetExceeded) {
+		t.Errorf("FAIL: リトライ対象外のエラーは予算切れとして報告されるべきではありません。got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "invalid argument") {
+		t.Errorf("FAIL: 元のエラーが返されるべきです: %v", err)
+	}
+}
+
+// --- スタブを使った生成処理のテスト ---
+
+// stubModels は GenerateContent の呼び出しを記録し、用意した応答やエラーを順番に返すスタブなのだ。
+type stubModels struct {
+	mu        sync.Mutex
+	responses []*genai.GenerateContentResponse
+	errs      []error
+	calls     int
+	// modelErrs に登録したモデルへの呼び出しは、常にそのエラーを返すのだ
+	modelErrs map[string]error
+
+	lastModel    string
+	lastContents []*genai.Content
+	lastConfig   *genai.GenerateContentConfig
+
+	// streamChunks は GenerateContentStream が順番に返す断片なのだ。
+	// streamStall が true の場合は、すべての断片を返した後、コンテキストがキャンセルされるまで何も返さないのだ。
+	streamChunks []*genai.GenerateContentResponse
+	streamStall  bool
+}
+
+func (s *stubModels) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.calls
+	s.calls++
+	s.lastModel, s.lastContents, s.lastConfig = model, contents, config
+
+	if err, ok := s.modelErrs[model]; ok {
+		return nil, err
+	}
+	if i < len(s.errs) && s.errs[i] != nil {
+		return nil, s.errs[i]
+	}
+	if len(s.responses) == 0 {
+		return nil, errors.New("stub: no response configured")
+	}
+	if i < len(s.responses) {
+		return s.responses[i], nil
+	}
+	return s.responses[len(s.responses)-1], nil
+}
+
+func (s *stubModels) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	s.mu.Lock()
+	s.calls++
+	s.lastModel, s.lastContents, s.lastConfig = model, contents, config
+	s.mu.Unlock()
+
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		for _, chunk := range s.streamChunks {
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+		if s.streamStall {
+			<-ctx.Done()
+			yield(nil, ctx.Err())
+		}
+	}
+}
+
+func (s *stubModels) CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastModel, s.lastContents = model, contents
+	if err, ok := s.modelErrs[model]; ok {
+		return nil, err
+	}
+	return &genai.CountTokensResponse{TotalTokens: int32(promptLength(contents))}, nil
+}
+
+// textResponse はテキストのみを含む正常終了の応答を組み立てるのだ。
+func textResponse(texts ...string) *genai.GenerateContentResponse {
+	parts := make([]*genai.Part, 0, len(texts))
+	for _, text := range texts {
+		parts = append(parts, &genai.Part{Text: text})
+	}
+	return &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{
+			Content:      &genai.Content{Role: "model", Parts: parts},
+			FinishReason: genai.FinishReasonStop,
+		}},
+	}
+}
+
+// newTestClient はスタブを差し込み、リトライ間隔を短くしたテスト用クライアントを生成するのだ。
+func newTestClient(models modelsService) *Client {
+	return &Client{
+		models:      models,
+		temperature: DefaultTemperature,
+		retryConfig: retry.Config{
+			MaxRetries:      3,
+			InitialInterval: time.Millisecond,
+			MaxInterval:     5 * time.Millisecond,
+		},
+	}
+}
+
+func TestClient_GenerateContent_SetsRawResponse(t *testing.T) {
+	raw := textResponse("こんにちは")
+	c := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{raw}})
+
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: GenerateContent がエラーを返しました: %v", err)
+	}
+	if resp.RawResponse == nil {
+		t.Fatal("FAIL: RawResponse が設定されていません")
+	}
+	if resp.RawResponse != raw {
+		t.Error("FAIL: RawResponse が API の応答そのものではありません")
+	}
+	if resp.Text != "こんにちは" {
+		t.Errorf("FAIL: Text が想定と異なります。got %q", resp.Text)
+	}
+}
+
+func TestExtractCitations(t *testing.T) {
+	t.Run("引用メタデータがある場合に変換されること", func(t *testing.T) {
+		resp := textResponse("本文")
+		resp.Candidates[0].CitationMetadata = &genai.CitationMetadata{
+			Citations: []*genai.Citation{
+				{URI: "https://example.com/a", Title: "A", StartIndex: 0, EndIndex: 6},
+			},
+		}
+
+		got := extractCitations(resp)
+		want := []Citation{{URI: "https://example.com/a", Title: "A", StartIndex: 0, EndIndex: 6}}
+		if len(got) != 1 || got[0] != want[0] {
+			t.Errorf("FAIL: extractCitations() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("引用メタデータがない場合は nil を返すこと", func(t *testing.T) {
+		if got := extractCitations(textResponse("本文")); got != nil {
+			t.Errorf("FAIL: extractCitations() = %+v, want nil", got)
+		}
+	})
+}
+
+func TestExtractTextFromResponse(t *testing.T) {
+	t.Run("複数のテキストパートが連結されること", func(t *testing.T) {
+		resp := textResponse("一つ目、", "二つ目、", "三つ目")
+		// テキスト以外のパートは読み飛ばされるのだ
+		resp.Candidates[0].Content.Parts = append(resp.Candidates[0].Content.Parts,
+			&genai.Part{InlineData: &genai.Blob{MIMEType: "image/png", Data: []byte{0x89}}})
+
+		got, err := extractTextFromResponse(resp)
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if want := "一つ目、二つ目、三つ目"; got != want {
+			t.Errorf("FAIL: extractTextFromResponse() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("空のレスポンスは APIResponseError を返すこと", func(t *testing.T) {
+		_, err := extractTextFromResponse(&genai.GenerateContentResponse{})
+		var apiErr *APIResponseError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("FAIL: APIResponseError が返されるべきです。got: %v", err)
+		}
+	})
+
+	t.Run("ブロックされたレスポンスは APIResponseError を返すこと", func(t *testing.T) {
+		resp := textResponse("途中まで")
+		resp.Candidates[0].FinishReason = genai.FinishReasonSafety
+		_, err := extractTextFromResponse(resp)
+		var apiErr *APIResponseError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("FAIL: APIResponseError が返されるべきです。got: %v", err)
+		}
+	})
+}
+
+func TestClient_GenerateContent_SearchGrounding(t *testing.T) {
+	t.Run("検索ツールが付与され、グラウンディングの出典が Citations に入ること", func(t *testing.T) {
+		raw := textResponse("東京の天気は晴れです")
+		raw.Candidates[0].GroundingMetadata = &genai.GroundingMetadata{
+			GroundingChunks: []*genai.GroundingChunk{
+				{Web: &genai.GroundingChunkWeb{URI: "https://weather.example.com", Title: "天気予報"}},
+			},
+			GroundingSupports: []*genai.GroundingSupport{
+				{Segment: &genai.Segment{StartIndex: 0, EndIndex: 12}, GroundingChunkIndices: []int32{0}},
+			},
+		}
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{raw}}
+		c := newTestClient(stub)
+		c.enableSearchGrounding = true
+
+		resp, err := c.GenerateContent(context.Background(), "東京の天気は？", "test-model")
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if len(stub.lastConfig.Tools) != 1 || stub.lastConfig.Tools[0].GoogleSearch == nil {
+			t.Errorf("FAIL: GoogleSearch ツールが設定されていません: %+v", stub.lastConfig.Tools)
+		}
+		want := Citation{URI: "https://weather.example.com", Title: "天気予報", StartIndex: 0, EndIndex: 12}
+		if len(resp.Citations) != 1 || resp.Citations[0] != want {
+			t.Errorf("FAIL: Citations = %+v, want [%+v]", resp.Citations, want)
+		}
+	})
+
+	t.Run("InvalidArgument は ErrSearchGroundingUnsupported に変換されること", func(t *testing.T) {
+		stub := &stubModels{errs: []error{genai.APIError{Code: 400, Status: "INVALID_ARGUMENT", Message: "Search Grounding is not supported."}}}
+		c := newTestClient(stub)
+		c.enableSearchGrounding = true
+
+		_, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if !errors.Is(err, ErrSearchGroundingUnsupported) {
+			t.Errorf("FAIL: ErrSearchGroundingUnsupported が返されるべきです。got: %v", err)
+		}
+	})
+}
+
+func TestClient_GenerateContent_ThinkingBudget(t *testing.T) {
+	t.Run("思考の予算が生成設定に反映されること", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		c := newTestClient(stub)
+		c.thinkingBudget = genai.Ptr[int32](1024)
+
+		if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		tc := stub.lastConfig.ThinkingConfig
+		if tc == nil || tc.ThinkingBudget == nil || *tc.ThinkingBudget != 1024 {
+			t.Errorf("FAIL: ThinkingBudget が設定されていません: %+v", tc)
+		}
+	})
+
+	t.Run("InvalidArgument は ErrThinkingBudgetUnsupported に変換されること", func(t *testing.T) {
+		stub := &stubModels{errs: []error{genai.APIError{Code: 400, Status: "INVALID_ARGUMENT", Message: "Thinking is not supported by this model."}}}
+		c := newTestClient(stub)
+		c.thinkingBudget = genai.Ptr[int32](1024)
+		c.enableSearchGrounding = true
+
+		_, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if !errors.Is(err, ErrThinkingBudgetUnsupported) {
+			t.Errorf("FAIL: ErrThinkingBudgetUnsupported が返されるべきです。got: %v", err)
+		}
+	})
+
+	t.Run("思考に触れない InvalidArgument は変換されないこと", func(t *testing.T) {
+		stub := &stubModels{errs: []error{genai.APIError{Code: 400, Status: "INVALID_ARGUMENT", Message: "Request contains an invalid argument."}}}
+		c := newTestClient(stub)
+		c.thinkingBudget = genai.Ptr[int32](1024)
+
+		_, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if err == nil {
+			t.Fatal("FAIL: エラーが返されるべきです")
+		}
+		if errors.Is(err, ErrThinkingBudgetUnsupported) {
+			t.Errorf("FAIL: 思考に触れないエラーは ErrThinkingBudgetUnsupported に変換されるべきではありません。got: %v", err)
+		}
+	})
+
+	t.Run("-1 未満は NewClient がエラーを返すこと", func(t *testing.T) {
+		_, err := NewClient(context.Background(), Config{APIKey: "dummy-key", ThinkingBudget: genai.Ptr[int32](-2)})
+		if err == nil || !strings.Contains(err.Error(), "ThinkingBudget") {
+			t.Errorf("FAIL: 範囲外の ThinkingBudget はエラーになるべきです (got: %v)", err)
+		}
+	})
+}
+
+func TestClient_GenerateContent_ResponseModalities(t *testing.T) {
+	t.Run("応答の種類が生成設定に反映され、テキストと画像の両方が取り出されること", func(t *testing.T) {
+		resp := textResponse("ロゴの案なのだ")
+		resp.Candidates[0].Content.Parts = append(resp.Candidates[0].Content.Parts,
+			&genai.Part{InlineData: &genai.Blob{MIMEType: "image/png", Data: []byte{0x89, 0x50}}})
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{resp}}
+		c, err := NewClient(context.Background(), Config{APIKey: "dummy-key", ResponseModalities: []string{"text", " IMAGE", "Text"}})
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		c.models = stub
+
+		got, err := c.GenerateContent(context.Background(), "ロゴを描いて", "test-model")
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if want := []string{"TEXT", "IMAGE"}; !reflect.DeepEqual(stub.lastConfig.ResponseModalities, want) {
+			t.Errorf("FAIL: ResponseModalities = %v, want %v", stub.lastConfig.ResponseModalities, want)
+		}
+		if got.Text != "ロゴの案なのだ" || len(got.Images) != 1 || got.Images[0].MIMEType != "image/png" {
+			t.Errorf("FAIL: テキストと画像の両方が取り出されるべきです: text=%q images=%d", got.Text, len(got.Images))
+		}
+	})
+
+	t.Run("InvalidArgument は ErrResponseModalitiesUnsupported に変換されること", func(t *testing.T) {
+		stub := &stubModels{errs: []error{genai.APIError{Code: 400, Status: "INVALID_ARGUMENT", Message: "The requested combination of response modalities is not supported by the model."}}}
+		c := newTestClient(stub)
+		c.responseModalities = []string{"TEXT", "IMAGE"}
+		c.thinkingBudget = genai.Ptr[int32](1024)
+
+		_, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if !errors.Is(err, ErrResponseModalitiesUnsupported) {
+			t.Errorf("FAIL: ErrResponseModalitiesUnsupported が返されるべきです。got: %v", err)
+		}
+		if errors.Is(err, ErrThinkingBudgetUnsupported) {
+			t.Errorf("FAIL: 思考の予算のエラーと取り違えるべきではありません。got: %v", err)
+		}
+	})
+
+	t.Run("応答の種類に触れない InvalidArgument は変換されないこと", func(t *testing.T) {
+		stub := &stubModels{errs: []error{genai.APIError{Code: 400, Status: "INVALID_ARGUMENT", Message: "Request contains an invalid argument."}}}
+		c := newTestClient(stub)
+		c.responseModalities = []string{"TEXT", "IMAGE"}
+
+		_, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if err == nil {
+			t.Fatal("FAIL: エラーが返されるべきです")
+		}
+		if errors.Is(err, ErrResponseModalitiesUnsupported) {
+			t.Errorf("FAIL: 応答の種類に触れないエラーは ErrResponseModalitiesUnsupported に変換されるべきではありません。got: %v", err)
+		}
+	})
+
+	t.Run("画像だけの応答は空の応答として再試行されないこと", func(t *testing.T) {
+		resp := textResponse("")
+		resp.Candidates[0].Content.Parts = []*genai.Part{{InlineData: &genai.Blob{MIMEType: "image/png", Data: []byte{0x89, 0x50}}}}
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{resp, textResponse("二回目なのだ")}}
+		c := newTestClient(stub)
+		c.responseModalities = []string{"IMAGE"}
+		c.retryEmptyResponses = true
+
+		got, err := c.GenerateContent(context.Background(), "ロゴを描いて", "test-model")
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if stub.calls != 1 {
+			t.Errorf("FAIL: 呼び出し回数 = %d, want 1", stub.calls)
+		}
+		if len(got.Images) != 1 {
+			t.Errorf("FAIL: 画像が捨てられるべきではありません: images=%d", len(got.Images))
+		}
+	})
+
+	t.Run("未知の値は NewClient がエラーを返すこと", func(t *testing.T) {
+		_, err := NewClient(context.Background(), Config{APIKey: "dummy-key", ResponseModalities: []string{"TEXT", "VIDEO"}})
+		if err == nil || !strings.Contains(err.Error(), "VIDEO") {
+			t.Errorf("FAIL: 未知の ResponseModalities はエラーになるべきです (got: %v)", err)
+		}
+	})
+}
+
+func TestNewClient_BaseURL(t *testing.T) {
+	for _, baseURL := range []string{"http://localhost:8080", "https://europe-west1.example.com/"} {
+		c, err := NewClient(context.Background(), Config{APIKey: "dummy-key", BaseURL: baseURL})
+		if err != nil {
+			t.Fatalf("FAIL: BaseURL %q で予期しないエラー: %v", baseURL, err)
+		}
+		if got := c.client.ClientConfig().HTTPOptions.BaseURL; got != baseURL {
+			t.Errorf("FAIL: HTTPOptions.BaseURL = %q, want %q", got, baseURL)
+		}
+	}
+
+	for _, baseURL := range []string{"localhost:8080", "ftp://example.com", "http://", "://bad"} {
+		if _, err := NewClient(context.Background(), Config{APIKey: "dummy-key", BaseURL: baseURL}); err == nil {
+			t.Errorf("FAIL: 不正な BaseURL %q はエラーになるべきです", baseURL)
+		}
+	}
+}
+
+func TestNewClient_TooManyStopSequences(t *testing.T) {
+	cfg := Config{
+		APIKey:        "dummy-key",
+		StopSequences: []string{"1", "2", "3", "4", "5", "6"},
+	}
+
+	_, err := NewClient(context.Background(), cfg)
+	if err == nil {
+		t.Fatal("FAIL: 停止シーケンスが多すぎる場合、エラーが返されるべきです")
+	}
+	if !strings.Contains(err.Error(), "停止シーケンスは最大5個") {
+		t.Errorf("FAIL: 予期しないエラーメッセージ: %q", err.Error())
+	}
+}
+
+func TestClient_GenerateContent_StopSequences(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("本文")}}
+	c := newTestClient(stub)
+	c.stopSequences = []string{"---END---"}
+
+	if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if got := stub.lastConfig.StopSequences; len(got) != 1 || got[0] != "---END---" {
+		t.Errorf("FAIL: StopSequences がリクエストに設定されていません: %v", got)
+	}
+}
+
+func TestNewClient_InvalidPenalty(t *testing.T) {
+	cfg := Config{
+		APIKey:          "dummy-key",
+		PresencePenalty: genai.Ptr[float32](2.5),
+	}
+
+	_, err := NewClient(context.Background(), cfg)
+	if err == nil {
+		t.Fatal("FAIL: 範囲外のペナルティでエラーが返されるべきです")
+	}
+	if !strings.Contains(err.Error(), "PresencePenalty") {
+		t.Errorf("FAIL: 予期しないエラーメッセージ: %q", err.Error())
+	}
+}
+
+func TestClient_GenerateContent_Seed(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("本文")}}
+	c := newTestClient(stub)
+	c.seed = genai.Ptr[int32](42)
+	c.topP = genai.Ptr[float32](0.1)
+	c.presencePenalty = genai.Ptr[float32](0.5)
+	c.frequencyPenalty = genai.Ptr[float32](-0.5)
+
+	if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	cfg := stub.lastConfig
+	if cfg.Seed == nil || *cfg.Seed != 42 {
+		t.Errorf("FAIL: Seed がリクエストに設定されていません: %v", cfg.Seed)
+	}
+	if cfg.TopP == nil || *cfg.TopP != 0.1 {
+		t.Errorf("FAIL: TopP がリクエストに設定されていません: %v", cfg.TopP)
+	}
+	if cfg.PresencePenalty == nil || *cfg.PresencePenalty != 0.5 {
+		t.Errorf("FAIL: PresencePenalty がリクエストに設定されていません: %v", cfg.PresencePenalty)
+	}
+	if cfg.FrequencyPenalty == nil || *cfg.FrequencyPenalty != -0.5 {
+		t.Errorf("FAIL: FrequencyPenalty がリクエストに設定されていません: %v", cfg.FrequencyPenalty)
+	}
+}
+
+func TestClient_Stats(t *testing.T) {
+	blocked := textResponse("")
+	blocked.Candidates[0].FinishReason = genai.FinishReasonSafety
+
+	stub := &stubModels{
+		// 1回目の呼び出し: 一時的エラーの後に成功、2回目の呼び出し: ブロック
+		errs:      []error{status.Error(codes.Unavailable, "unavailable")},
+		responses: []*genai.GenerateContentResponse{nil, textResponse("ok"), blocked},
+	}
+	c := newTestClient(stub)
+
+	if _, err := c.GenerateContent(context.Background(), "first", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if _, err := c.GenerateContent(context.Background(), "second", "test-model"); err == nil {
+		t.Fatal("FAIL: ブロックされた応答でエラーが返されるべきです")
+	}
+
+	want := ClientStats{TotalRequests: 2, TotalRetries: 1, TotalFailures: 1, BlockedResponses: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("FAIL: Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestStartSpan_NoTracer(t *testing.T) {
+	ctx := context.Background()
+	gotCtx, span := startSpan(ctx, "test-model", promptToContents("hello"))
+	if span != nil {
+		t.Error("FAIL: トレースが設定されていない場合、スパンは作成されるべきではありません")
+	}
+	if gotCtx != ctx {
+		t.Error("FAIL: トレースが設定されていない場合、コンテキストはそのまま返されるべきです")
+	}
+	// nil スパンでも安全に終了できること
+	endSpan(nil, 1, nil, errors.New("ignored"))
+}
+
+func TestClient_PrometheusMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := newMetricsCollector(reg)
+	if err != nil {
+		t.Fatalf("FAIL: メトリクスの登録に失敗しました: %v", err)
+	}
+
+	stub := &stubModels{
+		errs:      []error{status.Error(codes.Unavailable, "unavailable")},
+		responses: []*genai.GenerateContentResponse{nil, textResponse("ok")},
+	}
+	c := newTestClient(stub)
+	c.metrics = metrics
+
+	if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.outcomes.WithLabelValues("test-model", outcomeSuccess)); got != 1 {
+		t.Errorf("FAIL: success の件数 = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.outcomes.WithLabelValues("test-model", outcomeRetry)); got != 1 {
+		t.Errorf("FAIL: retry の件数 = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(metrics.duration); got != 1 {
+		t.Errorf("FAIL: レイテンシの系列数 = %d, want 1", got)
+	}
+
+	// 同じレジストリへの再登録は既存のコレクタを再利用すること
+	again, err := newMetricsCollector(reg)
+	if err != nil {
+		t.Fatalf("FAIL: 再登録でエラーが返されました: %v", err)
+	}
+	if again.outcomes != metrics.outcomes {
+		t.Error("FAIL: 既存のコレクタが再利用されていません")
+	}
+}
+
+func TestClient_GenerateContent_FallbackModels(t *testing.T) {
+	t.Run("主モデルが過負荷の場合にフォールバックモデルが使われること", func(t *testing.T) {
+		stub := &stubModels{
+			modelErrs: map[string]error{"primary": status.Error(codes.ResourceExhausted, "overloaded")},
+			responses: []*genai.GenerateContentResponse{textResponse("fallback answer")},
+		}
+		c := newTestClient(stub)
+		c.fallbackModels = []string{"fallback"}
+
+		resp, err := c.GenerateContent(context.Background(), "hello", "primary")
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.ModelName != "fallback" || resp.Text != "fallback answer" {
+			t.Errorf("FAIL: フォールバックモデルの応答ではありません: model=%q text=%q", resp.ModelName, resp.Text)
+		}
+	})
+
+	t.Run("すべてのモデルが失敗した場合にエラーがまとめて返ること", func(t *testing.T) {
+		stub := &stubModels{modelErrs: map[string]error{
+			"primary":  status.Error(codes.ResourceExhausted, "primary overloaded"),
+			"fallback": status.Error(codes.Unavailable, "fallback unavailable"),
+		}}
+		c := newTestClient(stub)
+		c.fallbackModels = []string{"fallback"}
+
+		_, err := c.GenerateContent(context.Background(), "hello", "primary")
+		if err == nil {
+			t.Fatal("FAIL: すべてのモデルが失敗した場合、エラーが返されるべきです")
+		}
+		for _, want := range []string{"primary overloaded", "fallback unavailable"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("FAIL: エラーに %q が含まれていません: %v", want, err)
+			}
+		}
+	})
+
+	t.Run("永続的なエラーではフォールバックしないこと", func(t *testing.T) {
+		stub := &stubModels{modelErrs: map[string]error{"primary": status.Error(codes.InvalidArgument, "bad request")}}
+		c := newTestClient(stub)
+		c.fallbackModels = []string{"fallback"}
+
+		if _, err := c.GenerateContent(context.Background(), "hello", "primary"); err == nil {
+			t.Fatal("FAIL: エラーが返されるべきです")
+		}
+		if stub.lastModel != "primary" {
+			t.Errorf("FAIL: フォールバックモデルが呼び出されました: %q", stub.lastModel)
+		}
+	})
+}
+
+func TestClient_CountTokens(t *testing.T) {
+	var gen ai.Generator = newTestClient(&stubModels{})
+
+	got, err := gen.CountTokens(context.Background(), "hello", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if got != 5 {
+		t.Errorf("FAIL: CountTokens() = %d, want 5", got)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"成功", nil, nil},
+		{"401 は認証のエラー", genai.APIError{Code: http.StatusUnauthorized}, ErrUnauthorized},
+		{"無効な API キーの 400 は認証のエラー", genai.APIError{Code: http.StatusBadRequest, Message: "API key not valid. Please pass a valid API key.",
+			Details: []map[string]any{{"reason": "API_KEY_INVALID"}}}, ErrUnauthorized},
+		{"gRPC の PermissionDenied は認証のエラー", status.Error(codes.PermissionDenied, "denied"), ErrUnauthorized},
+		{"接続できない場合はネットワークのエラー", &url.Error{Op: "Post", URL: "https://example.invalid", Err: errors.New("connection refused")}, ErrUnreachable},
+		{"503 はネットワークのエラー", genai.APIError{Code: http.StatusServiceUnavailable}, ErrUnreachable},
+		{"存在しないモデルはどちらでもない", genai.APIError{Code: http.StatusNotFound, Message: "model not found"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubModels{}
+			if tt.err != nil {
+				stub.modelErrs = map[string]error{DefaultPingModel: tt.err}
+			}
+			err := newTestClient(stub).Ping(context.Background())
+
+			if tt.err == nil {
+				if err != nil {
+					t.Errorf("FAIL: 予期しないエラー: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err.Error()) {
+				t.Fatalf("FAIL: API のエラーを包んで返すべきです (got: %v)", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("FAIL: %v をラップするべきです (got: %v)", tt.want, err)
+			}
+			if tt.want == nil && (errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrUnreachable)) {
+				t.Errorf("FAIL: 認証やネットワークのエラーとみなさないこと (got: %v)", err)
+			}
+		})
+	}
+}
+
+// --- 並行利用に関するテスト ---
+
+func TestClient_GenerateContent_Concurrent(t *testing.T) {
+	const goroutines = 50
+
+	seed := int32(42)
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+	c := newTestClient(stub)
+	c.stopSequences = []string{"END"}
+	c.seed = &seed
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if resp.Text != "ok" {
+				errs <- errors.New("unexpected text: " + resp.Text)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("FAIL: 並行呼び出しでエラーが発生しました: %v", err)
+	}
+	if got := c.Stats().TotalRequests; got != goroutines {
+		t.Errorf("FAIL: TotalRequests = %d, want %d", got, goroutines)
+	}
+}
+
+func TestNewClient_CopiesMutableConfig(t *testing.T) {
+	seed := int32(1)
+	cfg := Config{APIKey: "dummy-key", StopSequences: []string{"END"}, Seed: &seed}
+	c, err := NewClient(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+
+	// 生成後に Config を書き換えてもクライアントに影響しないこと
+	cfg.StopSequences[0] = "CHANGED"
+	seed = 99
+
+	config := c.newGenerateContentConfig()
+	if config.StopSequences[0] != "END" || *config.Seed != 1 {
+		t.Errorf("FAIL: Config の変更がクライアントに影響しています: stop=%v seed=%d", config.StopSequences, *config.Seed)
+	}
+}
+
+// --- 空の応答の再試行に関するテスト ---
+
+func TestClient_GenerateContent_RetryEmptyResponses(t *testing.T) {
+	empty := &genai.GenerateContentResponse{}
+	blocked := &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonSafety}},
+	}
+
+	tests := []struct {
+		name      string
+		enabled   bool
+		responses []*genai.GenerateContentResponse
+		wantCalls int
+		wantErr   bool
+	}{
+		{"空の応答の後に有効な応答が返れば成功する", true, []*genai.GenerateContentResponse{empty, textResponse("ok")}, 2, false},
+		{"空白のみの応答も再試行する", true, []*genai.GenerateContentResponse{textResponse("  "), textResponse("ok")}, 2, false},
+		{"上限回数まで空なら空の応答エラーを返す", true, []*genai.GenerateContentResponse{empty, empty, empty, empty}, 1 + maxEmptyResponseRetries, true},
+		{"ブロックは再試行しない", true, []*genai.GenerateContentResponse{blocked, textResponse("ok")}, 1, true},
+		{"無効の場合は再試行しない", false, []*genai.GenerateContentResponse{empty, textResponse("ok")}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubModels{responses: tt.responses}
+			c := newTestClient(stub)
+			c.retryEmptyResponses = tt.enabled
+
+			resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+			if stub.calls != tt.wantCalls {
+				t.Errorf("FAIL: 呼び出し回数 = %d, want %d", stub.calls, tt.wantCalls)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("FAIL: エラーが返されるべきです")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FAIL: 予期しないエラー: %v", err)
+			}
+			if resp.Text != "ok" {
+				t.Errorf("FAIL: Text = %q, want %q", resp.Text, "ok")
+			}
+			if got := stub.lastContents[0].Parts[0].Text; !strings.HasSuffix(got, emptyResponseNudge) {
+				t.Errorf("FAIL: 再試行時のプロンプトに補足が付いていません: %q", got)
+			}
+		})
+	}
+}
+
+func TestClient_GenerateContent_SetsUsage(t *testing.T) {
+	raw := textResponse("ok")
+	raw.UsageMetadata = &genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:     3,
+		CandidatesTokenCount: 5,
+		TotalTokenCount:      8,
+	}
+	c := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{raw}})
+
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	want := ai.Usage{PromptTokens: 3, CompletionTokens: 5, TotalTokens: 8}
+	if resp.Usage == nil || *resp.Usage != want {
+		t.Errorf("FAIL: Usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	// 使用量を含まない応答では nil になること
+	if got := extractUsage(textResponse("ok")); got != nil {
+		t.Errorf("FAIL: 使用量がない場合は nil になるべきです: %+v", got)
+	}
+}
+
+func TestNewClient_InvalidRetryDelay(t *testing.T) {
+	cfg := Config{
+		APIKey:       "dummy-key",
+		InitialDelay: 10 * time.Second,
+		MaxDelay:     time.Second,
+	}
+
+	_, err := NewClient(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "リトライの初期待機時間") {
+		t.Errorf("FAIL: 初期待機時間が最大待機時間を超える場合はエラーになるべきです (got: %v)", err)
+	}
+}
+
+func TestNewClient_DisableRetries(t *testing.T) {
+	// 待機時間を長くしておき、リトライせずにすぐ返ることを確かめるのだ
+	c, err := NewClient(context.Background(), Config{
+		APIKey:         "dummy-key",
+		MaxRetries:     5,
+		InitialDelay:   time.Minute,
+		MaxDelay:       time.Minute,
+		DisableRetries: true,
+	})
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	unavailable := genai.APIError{Code: http.StatusServiceUnavailable, Status: "UNAVAILABLE"}
+	stub := &stubModels{errs: []error{unavailable, unavailable}}
+	c.models = stub
+
+	start := time.Now()
+	if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err == nil {
+		t.Fatal("FAIL: エラーが返されるべきです")
+	}
+	if stub.calls != 1 {
+		t.Errorf("FAIL: リトライせずに 1 回だけ呼び出すべきです (calls: %d)", stub.calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("FAIL: バックオフを待たずにすぐ返すべきです (elapsed: %v)", elapsed)
+	}
+}
+
+func TestClient_GenerateContent_CanceledContext(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+	c := newTestClient(stub)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.GenerateContent(ctx, "hello", "test-model")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("FAIL: context.Canceled が返されるべきです (got: %v)", err)
+	}
+	if stub.calls != 0 {
+		t.Errorf("FAIL: キャンセル済みの場合は API を呼び出すべきではありません (calls: %d)", stub.calls)
+	}
+	if got := c.Stats().TotalRetries; got != 0 {
+		t.Errorf("FAIL: キャンセル時にリトライするべきではありません (retries: %d)", got)
+	}
+}
+
+func TestShouldRetryWithContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"試行単位のタイムアウトはリトライする", context.Background(), context.DeadlineExceeded, true},
+		{"ラップされた試行単位のタイムアウトもリトライする", context.Background(), fmt.Errorf("doRequest: %w", context.DeadlineExceeded), true},
+		{"呼び出し元の期限切れはリトライしない", expired, context.DeadlineExceeded, false},
+		{"呼び出し元のキャンセルはリトライしない", canceled, context.Canceled, false},
+		{"呼び出し元がキャンセル済みなら一時的エラーでもリトライしない", canceled, status.Error(codes.Unavailable, "unavailable"), false},
+		{"キャンセルはリトライしない", context.Background(), context.Canceled, false},
+		{"有効なコンテキストの一時的エラーはリトライする", context.Background(), status.Error(codes.Unavailable, "unavailable"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRetryWithContext(tt.ctx)(tt.err); got != tt.want {
+				t.Errorf("FAIL: shouldRetryWithContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_GenerateContent_RetriesPerAttemptTimeout(t *testing.T) {
+	stub := &stubModels{
+		errs:      []error{context.DeadlineExceeded},
+		responses: []*genai.GenerateContentResponse{textResponse("ok")},
+	}
+	c := newTestClient(stub)
+
+	start := time.Now()
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 試行単位のタイムアウト後は再試行で成功するべきです: %v", err)
+	}
+	if resp.Text != "ok" || stub.calls != 2 || resp.Attempts != 2 {
+		t.Errorf("FAIL: text=%q calls=%d attempts=%d, want ok / 2 / 2", resp.Text, stub.calls, resp.Attempts)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("FAIL: 再試行に時間がかかりすぎています: %v", elapsed)
+	}
+}
+
+// --- GenerateTurns に関するテスト ---
+
+func TestClient_GenerateTurns(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+	c := newTestClient(stub)
+
+	turns := []Turn{
+		{Role: RoleSystem, Text: "あなたは簡潔に答えるアシスタントなのだ"},
+		{Role: RoleUser, Text: "1+1は？"},
+		{Role: RoleModel, Text: "2なのだ"},
+		{Role: RoleUser, Text: "それに3を足すと？"},
+	}
+	if _, err := c.GenerateTurns(context.Background(), turns, "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+
+	if len(stub.lastContents) != 3 {
+		t.Fatalf("FAIL: 会話のターン数 = %d, want 3", len(stub.lastContents))
+	}
+	wantRoles := []string{RoleUser, RoleModel, RoleUser}
+	for i, content := range stub.lastContents {
+		if content.Role != wantRoles[i] {
+			t.Errorf("FAIL: ターン %d のロール = %q, want %q", i, content.Role, wantRoles[i])
+		}
+	}
+	si := stub.lastConfig.SystemInstruction
+	if si == nil || len(si.Parts) != 1 || si.Parts[0].Text != turns[0].Text {
+		t.Errorf("FAIL: システム指示が設定されていません: %+v", si)
+	}
+}
+
+func TestClient_GenerateTurns_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		turns []Turn
+		want  string
+	}{
+		{"未知のロール", []Turn{{Role: "assistant", Text: "x"}, {Role: RoleUser, Text: "y"}}, "使用できません"},
+		{"空のテキスト", []Turn{{Role: RoleUser, Text: " "}}, "テキストが空"},
+		{"システムのみ", []Turn{{Role: RoleSystem, Text: "x"}}, "会話のターンがありません"},
+		{"最後が model", []Turn{{Role: RoleUser, Text: "x"}, {Role: RoleModel, Text: "y"}}, "最後のターン"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+			_, err := newTestClient(stub).GenerateTurns(context.Background(), tt.turns, "test-model")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("FAIL: エラーに %q が含まれるべきです (got: %v)", tt.want, err)
+			}
+			if stub.calls != 0 {
+				t.Errorf("FAIL: 検証エラー時は API を呼び出すべきではありません")
+			}
+		})
+	}
+}
+
+func TestClient_SystemInstruction(t *testing.T) {
+	const instruction = "あなたは簡潔に答えるアシスタントなのだ"
+
+	t.Run("GenerateContent に付ける", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		c := newTestClient(stub)
+		c.systemInstruction = instruction
+
+		if _, err := c.GenerateContent(context.Background(), "こんにちは", "test-model"); err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		si := stub.lastConfig.SystemInstruction
+		if si == nil || len(si.Parts) != 1 || si.Parts[0].Text != instruction {
+			t.Errorf("FAIL: システム指示が設定されていません: %+v", si)
+		}
+	})
+
+	t.Run("GenerateTurns の system ターンが優先される", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		c := newTestClient(stub)
+		c.systemInstruction = instruction
+
+		turns := []Turn{{Role: RoleSystem, Text: "丁寧に答えるのだ"}, {Role: RoleUser, Text: "こんにちは"}}
+		if _, err := c.GenerateTurns(context.Background(), turns, "test-model"); err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		si := stub.lastConfig.SystemInstruction
+		if si == nil || len(si.Parts) != 1 || si.Parts[0].Text != turns[0].Text {
+			t.Errorf("FAIL: system ターンのシステム指示が使われていません: %+v", si)
+		}
+	})
+}
+
+func TestChatSession_Send(t *testing.T) {
+	stub := &stubModels{
+		responses: []*genai.GenerateContentResponse{textResponse("こんにちはなのだ"), textResponse("3なのだ")},
+		errs:      []error{nil, nil, errors.New("boom")},
+	}
+	c := newTestClient(stub)
+	c.retryConfig.MaxRetries = 0
+
+	previous := []*genai.Content{
+		{Role: RoleUser, Parts: []*genai.Part{{Text: "前回の質問"}}},
+		{Role: RoleModel, Parts: []*genai.Part{{Text: "前回の回答"}}},
+	}
+	session := c.NewChatSession("test-model", previous)
+
+	if _, err := session.Send(context.Background(), "こんにちは"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	resp, err := session.Send(context.Background(), "1+2は？")
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if resp.Text != "3なのだ" {
+		t.Errorf("FAIL: Text = %q", resp.Text)
+	}
+	// 2 回目は、保存済みの履歴と 1 往復目の会話を含めて送るのだ
+	if len(stub.lastContents) != 5 || stub.lastContents[0].Parts[0].Text != "前回の質問" || stub.lastContents[4].Parts[0].Text != "1+2は？" {
+		t.Errorf("FAIL: 履歴が送られていません: %d 件", len(stub.lastContents))
+	}
+
+	history := session.History()
+	if len(history) != 6 || history[5].Role != RoleModel || history[5].Parts[0].Text != "3なのだ" {
+		t.Fatalf("FAIL: 履歴に応答が追加されていません: %d 件", len(history))
+	}
+
+	if _, err := session.Send(context.Background(), "失敗する質問"); err == nil {
+		t.Fatal("FAIL: エラーが返されるべきです")
+	}
+	if got := len(session.History()); got != 6 {
+		t.Errorf("FAIL: 失敗した場合は履歴を変更すべきではありません (got: %d 件)", got)
+	}
+}
+
+func TestChatSession_MaxHistoryTokens(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("0123456789")}}
+	c := newTestClient(stub)
+	c.systemInstruction = "システム指示なのだ"
+	session := c.NewChatSession("test-model", nil)
+	// 1 往復 (質問 10 文字 + 応答 10 文字) が見積もりで 20 トークンなので、直近の 2 往復と新しい質問だけが収まるのだ
+	session.MaxHistoryTokens = 55
+
+	for i := range 5 {
+		if _, err := session.Send(context.Background(), fmt.Sprintf("質問その%dなのだよね", i)); err != nil {
+			t.Fatalf("FAIL: %d 回目で予期しないエラー: %v", i+1, err)
+		}
+		if got := historyTokens(stub.lastContents); got > session.MaxHistoryTokens {
+			t.Errorf("FAIL: %d 回目の送信が上限を超えています (%d > %d)", i+1, got, session.MaxHistoryTokens)
+		}
+	}
+
+	// 5 回目の送信では、最も古い 2 往復が削除され、2 番目の質問から始まっているはずなのだ
+	if len(stub.lastContents) != 5 || stub.lastContents[0].Role != RoleUser || stub.lastContents[0].Parts[0].Text != "質問その2なのだよね" {
+		t.Errorf("FAIL: 古いターンが削除されていません: %d 件, 先頭 %q", len(stub.lastContents), stub.lastContents[0].Parts[0].Text)
+	}
+	if si := stub.lastConfig.SystemInstruction; si == nil || si.Parts[0].Text != "システム指示なのだ" {
+		t.Errorf("FAIL: システム指示は削除されるべきではありません: %+v", si)
+	}
+}
+
+// recordingModels は、GenerateContent に渡されたコンテンツをすべて記録するスタブなのだ。
+type recordingModels struct {
+	*stubModels
+	calls [][]*genai.Content
+}
+
+func (r *recordingModels) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	r.calls = append(r.calls, contents)
+	return r.stubModels.GenerateContent(ctx, model, contents, config)
+}
+
+func TestChatSession_Summarize(t *testing.T) {
+	models := &recordingModels{stubModels: &stubModels{responses: []*genai.GenerateContentResponse{
+		textResponse("回答その0なのだよね"), textResponse("回答その1なのだよね"), textResponse("回答その2なのだよね"),
+		textResponse("要約"), // 4 回目の送信の前に、要約を頼む呼び出しが入るのだ
+		textResponse("回答その3なのだよね"),
+	}}}
+	c := newTestClient(models)
+	session := c.NewChatSession("test-model", nil)
+	session.MaxHistoryTokens = 55
+	session.Compaction = Summarize
+	session.SummarizeTurns = 4
+	session.SummaryPrompt = "SUMMARIZE:"
+
+	for i := range 4 {
+		if _, err := session.Send(context.Background(), fmt.Sprintf("質問その%dなのだよね", i)); err != nil {
+			t.Fatalf("FAIL: %d 回目で予期しないエラー: %v", i+1, err)
+		}
+	}
+
+	if len(models.calls) != 5 {
+		t.Fatalf("FAIL: 要約の呼び出しが行われていません (calls: %d)", len(models.calls))
+	}
+	summaryCall := models.calls[3]
+	if len(summaryCall) != 1 || !strings.HasPrefix(summaryCall[0].Parts[0].Text, "SUMMARIZE:") || !strings.Contains(summaryCall[0].Parts[0].Text, "質問その0なのだよね") {
+		t.Errorf("FAIL: 設定した指示と古いターンで要約を頼むべきです: %+v", summaryCall)
+	}
+
+	// 最も古い 2 往復が要約の 1 往復に置き換わり、履歴が縮んでいるはずなのだ
+	history := session.History()
+	if len(history) != 6 {
+		t.Fatalf("FAIL: 履歴の件数 = %d, want 6", len(history))
+	}
+	if !strings.Contains(history[0].Parts[0].Text, "要約") || history[2].Parts[0].Text != "質問その2なのだよね" {
+		t.Errorf("FAIL: 先頭が要約のターンに置き換わるべきです: %q, %q", history[0].Parts[0].Text, history[2].Parts[0].Text)
+	}
+	// 要約を入れた後も、user と model のロールが交互に並ぶこと
+	for i, content := range history {
+		want := RoleUser
+		if i%2 == 1 {
+			want = RoleModel
+		}
+		if content.Role != want {
+			t.Errorf("FAIL: history[%d].Role = %q, want %q", i, content.Role, want)
+		}
+	}
+}
+
+// --- GenerateFewShot に関するテスト ---
+
+func TestClient_GenerateFewShot(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+	c := newTestClient(stub)
+
+	examples := []FewShotExample{
+		{Input: "りんご", Output: "apple"},
+		{Input: "みかん", Output: "orange"},
+	}
+	if _, err := c.GenerateFewShot(context.Background(), examples, "ぶどう", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+
+	want := []struct{ role, text string }{
+		{RoleUser, "りんご"}, {RoleModel, "apple"},
+		{RoleUser, "みかん"}, {RoleModel, "orange"},
+		{RoleUser, "ぶどう"},
+	}
+	if len(stub.lastContents) != len(want) {
+		t.Fatalf("FAIL: 会話のターン数 = %d, want %d", len(stub.lastContents), len(want))
+	}
+	for i, content := range stub.lastContents {
+		if content.Role != want[i].role || content.Parts[0].Text != want[i].text {
+			t.Errorf("FAIL: ターン %d = (%q, %q), want (%q, %q)", i, content.Role, content.Parts[0].Text, want[i].role, want[i].text)
+		}
+	}
+
+	t.Run("例がなければ入力だけを送る", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		if _, err := newTestClient(stub).GenerateFewShot(context.Background(), nil, "ぶどう", "test-model"); err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if len(stub.lastContents) != 1 || stub.lastContents[0].Role != RoleUser {
+			t.Errorf("FAIL: 入力の 1 ターンだけが送られるべきです: %+v", stub.lastContents)
+		}
+	})
+
+	t.Run("空の出力の例はエラー", func(t *testing.T) {
+		stub := &stubModels{}
+		_, err := newTestClient(stub).GenerateFewShot(context.Background(), []FewShotExample{{Input: "りんご"}}, "ぶどう", "test-model")
+		if err == nil || !strings.Contains(err.Error(), "few-shot") {
+			t.Errorf("FAIL: 不正な例でエラーが返されるべきです: %v", err)
+		}
+		if stub.lastContents != nil {
+			t.Error("FAIL: 不正な例で API が呼び出されました")
+		}
+	})
+}
+
+// --- GenerateJSON に関するテスト ---
+
+func TestClient_GenerateJSON(t *testing.T) {
+	schema := map[string]any{"type": "object"}
+
+	t.Run("JSON の MIME タイプとスキーマを指定すること", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse(`{"a":1}`)}}
+		resp, err := newTestClient(stub).GenerateJSON(context.Background(), "hello", "test-model", schema)
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.Text != `{"a":1}` {
+			t.Errorf("FAIL: Text = %q", resp.Text)
+		}
+		if stub.lastConfig.ResponseMIMEType != jsonMIMEType {
+			t.Errorf("FAIL: ResponseMIMEType = %q, want %q", stub.lastConfig.ResponseMIMEType, jsonMIMEType)
+		}
+		if got, ok := stub.lastConfig.ResponseJsonSchema.(map[string]any); !ok || got["type"] != "object" {
+			t.Errorf("FAIL: ResponseJsonSchema が設定されていません: %v", stub.lastConfig.ResponseJsonSchema)
+		}
+	})
+
+	t.Run("コードブロックで囲まれた応答は区切り記号を取り除くこと", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("```json\n{\"a\":1}\n```")}}
+		resp, err := newTestClient(stub).GenerateJSON(context.Background(), "hello", "test-model", schema)
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.Text != `{"a":1}` {
+			t.Errorf("FAIL: Text = %q, want %q", resp.Text, `{"a":1}`)
+		}
+	})
+
+	t.Run("JSON でない応答は ErrInvalidJSON を返すこと", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("not json")}}
+		_, err := newTestClient(stub).GenerateJSON(context.Background(), "hello", "test-model", nil)
+		if !errors.Is(err, ErrInvalidJSON) {
+			t.Errorf("FAIL: ErrInvalidJSON が返されるべきです (got: %v)", err)
+		}
+	})
+}
+
+// --- ReturnPartialOnBlock に関するテスト ---
+
+func TestClient_GenerateContent_ReturnPartialOnBlock(t *testing.T) {
+	partial := func(reason genai.FinishReason) *genai.GenerateContentResponse {
+		resp := textResponse("途中まで", "の応答")
+		resp.Candidates[0].FinishReason = reason
+		return resp
+	}
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		reason   genai.FinishReason
+		wantText string
+	}{
+		{"MaxTokens で部分的な応答を返す", true, genai.FinishReasonMaxTokens, "途中までの応答"},
+		{"Safety で部分的な応答を返す", true, genai.FinishReasonSafety, "途中までの応答"},
+		{"無効の場合は MaxTokens でもエラーのみ", false, genai.FinishReasonMaxTokens, ""},
+		{"無効の場合は Safety でもエラーのみ", false, genai.FinishReasonSafety, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubModels{responses: []*genai.GenerateContentResponse{partial(tt.reason)}}
+			c := newTestClient(stub)
+			c.returnPartialOnBlock = tt.enabled
+
+			resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+			if !IsBlocked(err) {
+				t.Fatalf("FAIL: ブロックを示すエラーが返されるべきです (got: %v)", err)
+			}
+			if stub.calls != 1 {
+				t.Errorf("FAIL: ブロックはリトライしないこと (calls: %d)", stub.calls)
+			}
+
+			if !tt.enabled {
+				if resp != nil || errors.Is(err, ErrTruncated) {
+					t.Errorf("FAIL: 無効の場合は応答なし・ErrTruncated なしであるべきです (resp: %v, err: %v)", resp, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrTruncated) {
+				t.Errorf("FAIL: ErrTruncated をラップしたエラーが返されるべきです (got: %v)", err)
+			}
+			if resp == nil || resp.Text != tt.wantText {
+				t.Errorf("FAIL: 部分的な応答が返されるべきです (got: %+v)", resp)
+			}
+			if got := c.Stats().TotalFailures; got != 0 {
+				t.Errorf("FAIL: 部分的な応答は失敗として数えないこと (failures: %d)", got)
+			}
+		})
+	}
+
+	t.Run("テキストがない場合は部分的な応答を返さない", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{{
+			Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonSafety}},
+		}}}
+		c := newTestClient(stub)
+		c.returnPartialOnBlock = true
+
+		resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if resp != nil || errors.Is(err, ErrTruncated) || !IsBlocked(err) {
+			t.Errorf("FAIL: 空のブロックはエラーのみを返すべきです (resp: %v, err: %v)", resp, err)
+		}
+	})
+}
+
+// --- AutoContinue に関するテスト ---
+
+func TestClient_GenerateContent_AutoContinue(t *testing.T) {
+	truncated := func(text string) *genai.GenerateContentResponse {
+		resp := textResponse(text)
+		resp.Candidates[0].FinishReason = genai.FinishReasonMaxTokens
+		resp.UsageMetadata = &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 5, TotalTokenCount: 15}
+		return resp
+	}
+	finished := textResponse("の続き。")
+	finished.Candidates[0].FinishReason = genai.FinishReasonStop
+	finished.UsageMetadata = &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 20, CandidatesTokenCount: 3, TotalTokenCount: 23}
+
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{truncated("前半"), finished}}
+	c := newTestClient(stub)
+	c.autoContinue = true
+	c.maxContinuations = DefaultMaxContinuations
+
+	resp, err := c.GenerateContent(context.Background(), "長い文章を書いて", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 自然に終わった場合はエラーにしないべきです: %v", err)
+	}
+	if resp.Text != "前半の続き。" {
+		t.Errorf("FAIL: 打ち切られた応答と続きを連結するべきです: %q", resp.Text)
+	}
+	if stub.calls != 2 {
+		t.Errorf("FAIL: 続きを 1 回だけ頼むべきです (calls: %d)", stub.calls)
+	}
+	if resp.Attempts != 2 || resp.Usage == nil || resp.Usage.TotalTokens != 38 {
+		t.Errorf("FAIL: 試行回数と使用量はすべての呼び出しの合計であるべきです (attempts: %d, usage: %+v)", resp.Attempts, resp.Usage)
+	}
+
+	// 続きの依頼は、元のプロンプト、それまでの応答、続きを頼むターンの順に送るのだ
+	wantRoles := []string{RoleUser, RoleModel, RoleUser}
+	var gotRoles []string
+	for _, content := range stub.lastContents {
+		gotRoles = append(gotRoles, content.Role)
+	}
+	if !reflect.DeepEqual(gotRoles, wantRoles) {
+		t.Fatalf("FAIL: 続きの依頼のターンの並びが違います: %v", gotRoles)
+	}
+	if got := stub.lastContents[1].Parts[0].Text; got != "前半" {
+		t.Errorf("FAIL: それまでの応答を履歴に含めるべきです: %q", got)
+	}
+	if got := stub.lastContents[2].Parts[0].Text; got != continuationPrompt {
+		t.Errorf("FAIL: 続きを頼むターンを送るべきです: %q", got)
+	}
+
+	t.Run("上限に達したら連結したテキストと ErrTruncated を返す", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{truncated("あ")}}
+		c := newTestClient(stub)
+		c.autoContinue = true
+		c.maxContinuations = 2
+
+		resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if !errors.Is(err, ErrTruncated) || !IsBlocked(err) {
+			t.Errorf("FAIL: ErrTruncated をラップしたエラーが返されるべきです (got: %v)", err)
+		}
+		if resp == nil || resp.Text != "あああ" {
+			t.Errorf("FAIL: 上限までの続きを連結した応答が返されるべきです (got: %+v)", resp)
+		}
+		if stub.calls != 3 {
+			t.Errorf("FAIL: MaxContinuations を超えて続きを頼まないこと (calls: %d)", stub.calls)
+		}
+	})
+
+	t.Run("続きが空なら打ち切る", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{truncated("あ"), truncated("")}}
+		c := newTestClient(stub)
+		c.autoContinue = true
+		c.maxContinuations = 5
+
+		resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if !errors.Is(err, ErrTruncated) || resp == nil || resp.Text != "あ" {
+			t.Errorf("FAIL: 進まない続きで堂々巡りしないべきです (resp: %+v, err: %v)", resp, err)
+		}
+		if stub.calls != 2 {
+			t.Errorf("FAIL: 空の続きの後は頼まないこと (calls: %d)", stub.calls)
+		}
+	})
+
+	t.Run("無効の場合は続きを頼まない", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{truncated("前半"), finished}}
+		resp, err := newTestClient(stub).GenerateContent(context.Background(), "hello", "test-model")
+		if resp != nil || !IsBlocked(err) || stub.calls != 1 {
+			t.Errorf("FAIL: 無効の場合はこれまでどおりエラーのみを返すべきです (resp: %v, err: %v, calls: %d)", resp, err, stub.calls)
+		}
+	})
+}
+
+// --- Middleware に関するテスト ---
+
+func TestClient_Use_MiddlewareOrder(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+	c := newTestClient(stub)
+
+	var order []string
+	record := func(name string) Middleware {
+		return func(next GenerateFunc) GenerateFunc {
+			return func(ctx context.Context, prompt string, modelName string) (*Response, error) {
+				order = append(order, name+":before")
+				resp, err := next(ctx, prompt+"+"+name, modelName)
+				order = append(order, name+":after")
+				return resp, err
+			}
+		}
+	}
+	c.Use(record("outer"), record("inner"))
+
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil || resp.Text != "ok" {
+		t.Fatalf("FAIL: 予期せぬ結果です (resp: %v, err: %v)", resp, err)
+	}
+
+	want := []string{"outer:before", "inner:before", "inner:after", "outer:after"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("FAIL: 先に追加したミドルウェアが外側で実行されるべきです (got: %v)", order)
+	}
+	if got := stub.lastContents[0].Parts[0].Text; got != "hello+outer+inner" {
+		t.Errorf("FAIL: ミドルウェアが書き換えたプロンプトが API に渡されるべきです (got: %q)", got)
+	}
+}
+
+func TestClient_Use_ShortCircuit(t *testing.T) {
+	stub := &stubModels{}
+	c := newTestClient(stub)
+	c.Use(func(next GenerateFunc) GenerateFunc {
+		return func(ctx context.Context, prompt string, modelName string) (*Response, error) {
+			return &Response{Text: "cached", ModelName: modelName}, nil
+		}
+	})
+
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil || resp.Text != "cached" {
+		t.Fatalf("FAIL: ミドルウェアの応答が返されるべきです (resp: %v, err: %v)", resp, err)
+	}
+	if stub.calls != 0 {
+		t.Errorf("FAIL: next を呼ばない場合は API を呼び出さないこと (calls: %d)", stub.calls)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Run("呼び出しの間隔を空ける", func(t *testing.T) {
+		const interval = 20 * time.Millisecond
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("1"), textResponse("2"), textResponse("3")}}
+		c := newTestClient(stub)
+		c.Use(RateLimitMiddleware(interval))
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+				t.Fatalf("FAIL: 予期せぬエラーです: %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 2*interval {
+			t.Errorf("FAIL: 3 回の呼び出しには少なくとも %v かかるべきです (got: %v)", 2*interval, elapsed)
+		}
+	})
+
+	t.Run("待機中のキャンセルでは API を呼ばない", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("1"), textResponse("2")}}
+		c := newTestClient(stub)
+		c.Use(RateLimitMiddleware(time.Hour))
+
+		if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+			t.Fatalf("FAIL: 最初の呼び出しは待たずに成功するべきです: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := c.GenerateContent(ctx, "hello", "test-model"); err == nil {
+			t.Error("FAIL: 期限までに枠が空かない場合はエラーが返されるべきです")
+		}
+		if stub.calls != 1 {
+			t.Errorf("FAIL: キャンセルされた呼び出しは API に届かないこと (calls: %d)", stub.calls)
+		}
+	})
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	stub := &stubModels{errs: []error{errors.New("boom")}}
+	c := newTestClient(stub)
+	c.Use(LoggingMiddleware(logger))
+
+	if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err == nil {
+		t.Fatal("FAIL: エラーが返されるべきです")
+	}
+	out := buf.String()
+	if !strings.Contains(out, "model=test-model") || !strings.Contains(out, "boom") {
+		t.Errorf("FAIL: モデル名とエラーがログに出力されるべきです (got: %q)", out)
+	}
+}
+
+func TestClient_DebugRequests(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	const apiKey = "secret-api-key"
+	newClient := func(debug bool) *Client {
+		c := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}})
+		c.apiKeys = []string{apiKey}
+		c.debugRequests = debug
+		// API キーが生成設定に紛れ込んだ場合も伏せ字になることを確かめるのだ
+		c.rawConfig, _ = parseRawConfig(`{"httpOptions":{"headers":{"x-goog-api-key":["` + apiKey + `"]}}}`)
+		return c
+	}
+
+	if _, err := newClient(false).GenerateContent(context.Background(), "debug-prompt", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if strings.Contains(buf.String(), "debug-prompt") {
+		t.Errorf("FAIL: DebugRequests が無効の場合はリクエストを出力すべきではありません (got: %q)", buf.String())
+	}
+
+	if _, err := newClient(true).GenerateContent(context.Background(), "debug-prompt", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "debug-prompt") || !strings.Contains(out, "temperature") {
+		t.Errorf("FAIL: コンテンツと生成設定が出力されるべきです (got: %q)", out)
+	}
+	if strings.Contains(out, apiKey) || !strings.Contains(out, redactedValue) {
+		t.Errorf("FAIL: API キーは伏せ字にすべきです (got: %q)", out)
+	}
+}
+
+// --- RequestsPerMinute に関するテスト ---
+
+func TestClient_GenerateContent_RequestsPerMinute(t *testing.T) {
+	t.Run("N 回の呼び出しは最低限の間隔を空ける", func(t *testing.T) {
+		const (
+			requestsPerMinute = 6000 // 10ms 間隔
+			n                 = 4
+		)
+		responses := make([]*genai.GenerateContentResponse, n)
+		for i := range responses {
+			responses[i] = textResponse("ok")
+		}
+		c := newTestClient(&stubModels{responses: responses})
+		c.limiter = newRateLimiter(requestsPerMinute)
+
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+				t.Fatalf("FAIL: 予期せぬエラーです: %v", err)
+			}
+		}
+		// 最初の 1 回は待たないので、残りの n-1 回分の間隔がかかるはずなのだ
+		minimum := time.Duration(n-1) * time.Minute / requestsPerMinute
+		if elapsed := time.Since(start); elapsed < minimum {
+			t.Errorf("FAIL: %d 回の呼び出しには少なくとも %v かかるべきです (got: %v)", n, minimum, elapsed)
+		}
+	})
+
+	t.Run("待機中にコンテキストが終了したら API を呼ばない", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("1"), textResponse("2")}}
+		c := newTestClient(stub)
+		c.limiter = newRateLimiter(1)
+
+		if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+			t.Fatalf("FAIL: 最初の呼び出しは待たずに成功するべきです: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := c.GenerateContent(ctx, "hello", "test-model"); err == nil {
+			t.Error("FAIL: エラーが返されるべきです")
+		}
+		if stub.calls != 1 {
+			t.Errorf("FAIL: 待機を中断した呼び出しは API に届かないこと (calls: %d)", stub.calls)
+		}
+	})
+
+	t.Run("0 なら制限しない", func(t *testing.T) {
+		if l := newRateLimiter(0); l != nil {
+			t.Errorf("FAIL: 0 の場合はリミッターを生成しないこと (got: %v)", l)
+		}
+	})
+}
+
+func TestNewClient_InvalidTopP(t *testing.T) {
+	_, err := NewClient(context.Background(), Config{APIKey: "dummy-key", TopP: genai.Ptr[float32](1.5)})
+	if err == nil || !strings.Contains(err.Error(), "TopP") {
+		t.Errorf("FAIL: 範囲外の TopP はエラーになるべきです (got: %v)", err)
+	}
+}
+
+func TestNewClient_InvalidRequestsPerMinute(t *testing.T) {
+	_, err := NewClient(context.Background(), Config{APIKey: "dummy-key", RequestsPerMinute: -1})
+	if err == nil || !strings.Contains(err.Error(), "RequestsPerMinute") {
+		t.Errorf("FAIL: 負の RequestsPerMinute はエラーになるべきです (got: %v)", err)
+	}
+}
+
+func TestClient_GenerateContent_MaxOutputTokens(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+	c := newTestClient(stub)
+	c.maxOutputTokens = 256
+
+	if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if stub.lastConfig.MaxOutputTokens != 256 {
+		t.Errorf("FAIL: MaxOutputTokens がリクエストに設定されていません: %d", stub.lastConfig.MaxOutputTokens)
+	}
+
+	if _, err := NewClient(context.Background(), Config{APIKey: "dummy", MaxOutputTokens: -1}); err == nil {
+		t.Error("FAIL: 負の MaxOutputTokens はエラーにするべきです")
+	}
+}
+
+func TestClient_GenerateContent_CandidateCount(t *testing.T) {
+	multi := textResponse("案1")
+	multi.Candidates = append(multi.Candidates, textResponse("案2").Candidates[0], textResponse("案3").Candidates[0])
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{multi}}
+	c := newTestClient(stub)
+	c.candidateCount = 3
+
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if stub.lastConfig.CandidateCount != 3 {
+		t.Errorf("FAIL: CandidateCount がリクエストに設定されていません: %d", stub.lastConfig.CandidateCount)
+	}
+	if resp.Text != "案1" || strings.Join(resp.Candidates, ",") != "案1,案2,案3" {
+		t.Errorf("FAIL: すべての候補が返されるべきです (text: %q, candidates: %q)", resp.Text, resp.Candidates)
+	}
+
+	t.Run("候補が 1 つなら Candidates は nil", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		resp, err := newTestClient(stub).GenerateContent(context.Background(), "hello", "test-model")
+		if err != nil || resp.Candidates != nil {
+			t.Errorf("FAIL: 候補が 1 つの場合は nil であるべきです (candidates: %q, err: %v)", resp.Candidates, err)
+		}
+		if stub.lastConfig.CandidateCount != 0 {
+			t.Errorf("FAIL: 未指定の場合は CandidateCount を送らないこと: %d", stub.lastConfig.CandidateCount)
+		}
+	})
+}
+
+func TestClient_GenerateContent_CandidateSelector(t *testing.T) {
+	multi := func() *genai.GenerateContentResponse {
+		resp := textResponse("短い")
+		resp.Candidates = append(resp.Candidates, textResponse("いちばん長い案なのだ").Candidates[0], textResponse("中くらいの案").Candidates[0])
+		return resp
+	}
+
+	longest := func(candidates []*genai.Candidate) int {
+		best := 0
+		for i, candidate := range candidates {
+			if utf8.RuneCountInString(candidateText(candidate)) > utf8.RuneCountInString(candidateText(candidates[best])) {
+				best = i
+			}
+		}
+		return best
+	}
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{multi()}}
+	c := newTestClient(stub)
+	c.candidateSelector = longest
+
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if resp.Text != "いちばん長い案なのだ" {
+		t.Errorf("FAIL: 選んだ候補が Text になるべきです: %q", resp.Text)
+	}
+	if strings.Join(resp.Candidates, ",") != "いちばん長い案なのだ,短い,中くらいの案" {
+		t.Errorf("FAIL: 選んだ候補が先頭になるよう並べ替えるべきです: %q", resp.Candidates)
+	}
+
+	t.Run("既定ではブロックされていない最初の候補", func(t *testing.T) {
+		resp := multi()
+		resp.Candidates[0].FinishReason = genai.FinishReasonSafety
+		got, err := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{resp}}).GenerateContent(context.Background(), "hello", "test-model")
+		if err != nil {
+			t.Fatalf("FAIL: ブロックされていない候補があればエラーにしないべきです: %v", err)
+		}
+		if got.Text != "いちばん長い案なのだ" {
+			t.Errorf("FAIL: 2 番目の候補が選ばれるべきです: %q", got.Text)
+		}
+	})
+
+	t.Run("範囲外の番号なら先頭の候補", func(t *testing.T) {
+		c := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{multi()}})
+		c.candidateSelector = func([]*genai.Candidate) int { return 5 }
+		resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if err != nil || resp.Text != "短い" {
+			t.Errorf("FAIL: 先頭の候補を使うべきです (text: %q, err: %v)", resp.Text, err)
+		}
+	})
+}
+
+// --- RetriesExhaustedError に関するテスト ---
+
+func TestClient_GenerateContent_OnRetry(t *testing.T) {
+	errs := []error{status.Error(codes.Unavailable, "unavailable 1"), status.Error(codes.Unavailable, "unavailable 2")}
+	stub := &stubModels{errs: errs, responses: []*genai.GenerateContentResponse{nil, nil, textResponse("ok")}}
+	c := newTestClient(stub)
+
+	var attempts []int
+	var retryErrs []error
+	ctx := ai.WithOnRetry(context.Background(), func(attempt int, err error) {
+		attempts = append(attempts, attempt)
+		retryErrs = append(retryErrs, err)
+	})
+	if _, err := c.GenerateContent(ctx, "hello", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if !reflect.DeepEqual(attempts, []int{2, 3}) {
+		t.Errorf("FAIL: リトライの試行番号 = %v, want [2 3]", attempts)
+	}
+	for i, err := range retryErrs {
+		if !errors.Is(err, errs[i]) {
+			t.Errorf("FAIL: %d 回目のリトライには直前の試行のエラーを渡すべきです: %v", i+1, err)
+		}
+	}
+}
+
+func TestClient_GenerateContent_RetriesExhausted(t *testing.T) {
+	errs := make([]error, 10)
+	for i := range errs {
+		errs[i] = status.Error(codes.Unavailable, fmt.Sprintf("unavailable %d", i+1))
+	}
+	stub := &stubModels{errs: errs}
+	c := newTestClient(stub)
+
+	_, err := c.GenerateContent(context.Background(), "hello", "test-model")
+
+	var exhausted *RetriesExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("FAIL: RetriesExhaustedError が返されるべきです (got: %v)", err)
+	}
+	if exhausted.Attempts != stub.calls || len(exhausted.Errors) != stub.calls {
+		t.Errorf("FAIL: 試行回数と履歴が呼び出し回数と一致するべきです (attempts: %d, errors: %d, calls: %d)", exhausted.Attempts, len(exhausted.Errors), stub.calls)
+	}
+	for i, attemptErr := range exhausted.Errors {
+		if !errors.Is(attemptErr, errs[i]) {
+			t.Errorf("FAIL: %d 回目のエラーが履歴と一致しません: %v", i+1, attemptErr)
+		}
+	}
+	if last := errs[stub.calls-1]; !errors.Is(err, last) {
+		t.Errorf("FAIL: errors.Is で最後の試行のエラーを判定できるべきです (got: %v)", err)
+	}
+	if !IsRetryable(err) {
+		t.Error("FAIL: 最後の試行のエラーに基づいてリトライ可能と判定されるべきです")
+	}
+
+	t.Run("リトライ対象外のエラーはそのまま返す", func(t *testing.T) {
+		stub := &stubModels{errs: []error{status.Error(codes.InvalidArgument, "bad request")}}
+		_, err := newTestClient(stub).GenerateContent(context.Background(), "hello", "test-model")
+		if err == nil || errors.As(err, &exhausted) {
+			t.Errorf("FAIL: RetriesExhaustedError で包まないこと (got: %v)", err)
+		}
+	})
+}
+
+// --- クォータの超過に関するテスト ---
+
+func TestClient_GenerateContent_QuotaExceeded(t *testing.T) {
+	restQuota := func(quotaID string) error {
+		return genai.APIError{Code: http.StatusTooManyRequests, Status: "RESOURCE_EXHAUSTED", Details: []map[string]any{{
+			"@type":      quotaFailureType,
+			"violations": []any{map[string]any{"quotaMetric": "generativelanguage.googleapis.com/generate_content_free_tier_requests", "quotaId": quotaID}},
+		}}}
+	}
+	grpcQuota := func(quotaID string) error {
+		st, err := status.New(codes.ResourceExhausted, "quota").WithDetails(&errdetails.QuotaFailure{
+			Violations: []*errdetails.QuotaFailure_Violation{{QuotaId: quotaID}},
+		})
+		if err != nil {
+			t.Fatalf("FAIL: エラーの詳細を付けられません: %v", err)
+		}
+		return st.Err()
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantQuota bool
+	}{
+		{"REST の 1 日あたりのクォータはリトライしない", restQuota("GenerateRequestsPerDayPerProjectPerModel-FreeTier"), true},
+		{"REST の 1 分あたりのレート制限はリトライする", restQuota("GenerateRequestsPerMinutePerProjectPerModel-FreeTier"), false},
+		{"gRPC の 1 日あたりのクォータはリトライしない", grpcQuota("GenerateRequestsPerDayPerProjectPerModel"), true},
+		{"gRPC の 1 分あたりのレート制限はリトライする", grpcQuota("GenerateRequestsPerMinutePerProjectPerModel"), false},
+		{"詳細のない 429 はリトライする", genai.APIError{Code: http.StatusTooManyRequests}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := make([]error, 10)
+			for i := range errs {
+				errs[i] = tt.err
+			}
+			stub := &stubModels{errs: errs}
+			c := newTestClient(stub)
+			c.fallbackModels = []string{"fallback-model"}
+			_, err := c.GenerateContent(context.Background(), "hello", "test-model")
+
+			if errors.Is(err, ErrQuotaExceeded) != tt.wantQuota {
+				t.Errorf("FAIL: ErrQuotaExceeded の判定が違います (want: %v, got: %v)", tt.wantQuota, err)
+			}
+			if tt.wantQuota && (IsRetryable(err) || stub.calls != 1) {
+				t.Errorf("FAIL: クォータの超過はリトライもフォールバックもしないこと (calls: %d, err: %v)", stub.calls, err)
+			}
+			if !tt.wantQuota && stub.lastModel == "test-model" {
+				t.Errorf("FAIL: レート制限はリトライの後にフォールバックするべきです (calls: %d)", stub.calls)
+			}
+		})
+	}
+}
+
+// --- APIKeys のローテーションに関するテスト ---
+
+func TestClient_GenerateContent_APIKeyRotation(t *testing.T) {
+	rateLimited := genai.APIError{Code: http.StatusTooManyRequests, Status: "RESOURCE_EXHAUSTED"}
+
+	t.Run("レート制限を受けたら次のキーで送り直す", func(t *testing.T) {
+		first := &stubModels{modelErrs: map[string]error{"test-model": rateLimited}}
+		second := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("2 つ目のキー")}}
+		c := newTestClient(newKeyPool([]modelsService{first, second}, RoundRobin))
+
+		resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if err != nil {
+			t.Fatalf("FAIL: 2 つ目のキーで成功するべきです: %v", err)
+		}
+		if resp.Text != "2 つ目のキー" || first.calls != 1 || second.calls != 1 {
+			t.Errorf("FAIL: 1 つ目のキーの後に 2 つ目のキーを使うべきです (text: %q, calls: %d, %d)", resp.Text, first.calls, second.calls)
+		}
+		if c.Stats().TotalRetries != 0 {
+			t.Errorf("FAIL: キーの切り替えはバックオフ付きのリトライとして数えないこと (retries: %d)", c.Stats().TotalRetries)
+		}
+	})
+
+	t.Run("RoundRobin はリクエストごとに順番にキーを使う", func(t *testing.T) {
+		stubs := []*stubModels{
+			{responses: []*genai.GenerateContentResponse{textResponse("ok")}},
+			{responses: []*genai.GenerateContentResponse{textResponse("ok")}},
+			{responses: []*genai.GenerateContentResponse{textResponse("ok")}},
+		}
+		c := newTestClient(newKeyPool([]modelsService{stubs[0], stubs[1], stubs[2]}, RoundRobin))
+		for range 6 {
+			if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+				t.Fatalf("FAIL: 予期しないエラー: %v", err)
+			}
+		}
+		for i, stub := range stubs {
+			if stub.calls != 2 {
+				t.Errorf("FAIL: %d つ目のキーの呼び出し回数が均等ではありません: %d", i+1, stub.calls)
+			}
+		}
+	})
+
+	t.Run("LeastRecentlyRateLimited はレート制限を受けたキーを後回しにする", func(t *testing.T) {
+		first := &stubModels{errs: []error{rateLimited}, responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		second := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		c := newTestClient(newKeyPool([]modelsService{first, second}, LeastRecentlyRateLimited))
+		for range 3 {
+			if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+				t.Fatalf("FAIL: 予期しないエラー: %v", err)
+			}
+		}
+		if first.calls != 1 || second.calls != 3 {
+			t.Errorf("FAIL: レート制限を受けていないキーを優先するべきです (calls: %d, %d)", first.calls, second.calls)
+		}
+	})
+
+	t.Run("すべてのキーがレート制限を受けたらリトライに任せる", func(t *testing.T) {
+		first := &stubModels{errs: []error{rateLimited}, responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		second := &stubModels{errs: []error{rateLimited}, responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		c := newTestClient(newKeyPool([]modelsService{first, second}, RoundRobin))
+
+		if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+			t.Fatalf("FAIL: バックオフの後のリトライで成功するべきです: %v", err)
+		}
+		if c.Stats().TotalRetries != 1 {
+			t.Errorf("FAIL: すべてのキーを試した後に 1 回リトライするべきです (retries: %d)", c.Stats().TotalRetries)
+		}
+	})
+
+	t.Run("アップロードしたファイルを参照するリクエストはアップロードしたキーで送る", func(t *testing.T) {
+		first := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok"), textResponse("ok")}}
+		second := &stubModels{modelErrs: map[string]error{"test-model": genai.APIError{Code: http.StatusForbidden, Status: "PERMISSION_DENIED"}}}
+		c := newTestClient(newKeyPool([]modelsService{first, second}, RoundRobin))
+		c.files = &stubFiles{}
+		c.filePollingInterval = time.Millisecond
+		c.filePollingTimeout = time.Second
+		c.resumableUploadThreshold = DefaultResumableUploadThreshold
+
+		large := bytes.Repeat([]byte("a"), fileAPITransferThreshold+1)
+		for range 2 {
+			parts := []*genai.Part{genai.NewPartFromBytes(large, "text/plain"), genai.NewPartFromText("要約して")}
+			if _, err := c.GenerateWithParts(context.Background(), "test-model", parts, ImageOptions{}); err != nil {
+				t.Fatalf("FAIL: ファイルを参照するリクエストはアップロードしたキーで成功するべきです: %v", err)
+			}
+		}
+		if first.calls != 2 || second.calls != 0 {
+			t.Errorf("FAIL: ファイルを参照するリクエストは常に 1 つ目のキーで送るべきです (calls: %d, %d)", first.calls, second.calls)
+		}
+
+		// ファイルを参照しないリクエストは、これまでどおり順番にキーを使うのだ
+		for range 2 {
+			_, _ = c.GenerateContent(context.Background(), "hello", "test-model")
+		}
+		if second.calls != 1 {
+			t.Errorf("FAIL: ファイルを参照しないリクエストはキーを順番に使うべきです (calls: %d, %d)", first.calls, second.calls)
+		}
+	})
+
+	t.Run("APIKey と APIKeys は重複を除いて並べる", func(t *testing.T) {
+		got := collectAPIKeys(Config{APIKey: "a", APIKeys: []string{"b", "a", "", "c"}})
+		if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("FAIL: キーの並びが違います: %v", got)
+		}
+		if _, err := NewClient(context.Background(), Config{APIKeys: []string{"a", "b"}, KeyRotation: "random"}); err == nil {
+			t.Error("FAIL: 不明な KeyRotation はエラーにするべきです")
+		}
+	})
+}
+
+// --- リクエスト ID に関するテスト ---
+
+func TestClient_GenerateContent_RequestID(t *testing.T) {
+	t.Run("応答の responseId を Response に設定する", func(t *testing.T) {
+		apiResp := textResponse("ok")
+		apiResp.ResponseID = "resp-123"
+		resp, err := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{apiResp}}).GenerateContent(context.Background(), "hello", "test-model")
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.RequestID != "resp-123" {
+			t.Errorf("FAIL: RequestID が responseId と一致しません: %q", resp.RequestID)
+		}
+	})
+
+	t.Run("responseId がなければレスポンスヘッダーを使う", func(t *testing.T) {
+		apiResp := textResponse("ok")
+		apiResp.SDKHTTPResponse = &genai.HTTPResponse{Headers: http.Header{"X-Request-Id": {"hdr-456"}}}
+		resp, err := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{apiResp}}).GenerateContent(context.Background(), "hello", "test-model")
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.RequestID != "hdr-456" {
+			t.Errorf("FAIL: RequestID がヘッダーの値と一致しません: %q", resp.RequestID)
+		}
+	})
+
+	t.Run("ブロックされた場合はエラーに含める", func(t *testing.T) {
+		apiResp := textResponse("")
+		apiResp.ResponseID = "blocked-789"
+		apiResp.Candidates[0].FinishReason = genai.FinishReasonSafety
+		_, err := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{apiResp}}).GenerateContent(context.Background(), "hello", "test-model")
+		if !IsBlocked(err) {
+			t.Fatalf("FAIL: ブロックのエラーが返されるべきです (got: %v)", err)
+		}
+		if !strings.Contains(err.Error(), "blocked-789") || RequestIDFromError(err) != "blocked-789" {
+			t.Errorf("FAIL: エラーからリクエスト ID がわかるべきです: %v", err)
+		}
+	})
+
+	t.Run("リトライを使い切った場合は最後の試行のリクエスト ID を含める", func(t *testing.T) {
+		errs := make([]error, 10)
+		for i := range errs {
+			errs[i] = genai.APIError{Code: http.StatusServiceUnavailable, Details: []map[string]any{
+				{"@type": requestInfoType, "requestId": fmt.Sprintf("req-%d", i+1)},
+			}}
+		}
+		stub := &stubModels{errs: errs}
+		_, err := newTestClient(stub).GenerateContent(context.Background(), "hello", "test-model")
+
+		var exhausted *RetriesExhaustedError
+		if !errors.As(err, &exhausted) {
+			t.Fatalf("FAIL: RetriesExhaustedError が返されるべきです (got: %v)", err)
+		}
+		want := fmt.Sprintf("req-%d", stub.calls)
+		if exhausted.RequestID != want || !strings.Contains(err.Error(), want) {
+			t.Errorf("FAIL: 最後の試行のリクエスト ID %q が含まれるべきです (got: %q, %v)", want, exhausted.RequestID, err)
+		}
+	})
+}
+
+// --- 呼び出し単位のリトライ設定に関するテスト ---
+
+func TestClient_GenerateContentWithRetryConfig(t *testing.T) {
+	unavailable := func(n int) []error {
+		errs := make([]error, n)
+		for i := range errs {
+			errs[i] = status.Error(codes.Unavailable, "unavailable")
+		}
+		return errs
+	}
+
+	tests := []struct {
+		name      string
+		override  *retry.Config
+		wantCalls int
+	}{
+		{"nil の場合はクライアントの設定を使う", nil, 4},
+		{"MaxRetries 0 ならリトライしない", &retry.Config{MaxRetries: 0}, 1},
+		{"MaxRetries を増やせば多くリトライする", &retry.Config{MaxRetries: 6}, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubModels{errs: unavailable(10)}
+			c := newTestClient(stub)
+
+			_, err := c.GenerateContentWithRetryConfig(context.Background(), "hello", "test-model", tt.override)
+			if err == nil {
+				t.Fatal("FAIL: エラーが返されるべきです")
+			}
+			if stub.calls != tt.wantCalls {
+				t.Errorf("FAIL: 呼び出し回数 = %d, want %d", stub.calls, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("以降の呼び出しはクライアントの設定に戻る", func(t *testing.T) {
+		stub := &stubModels{errs: unavailable(10)}
+		c := newTestClient(stub)
+
+		_, _ = c.GenerateContentWithRetryConfig(context.Background(), "hello", "test-model", &retry.Config{MaxRetries: 0})
+		_, _ = c.GenerateContent(context.Background(), "hello", "test-model")
+		if stub.calls != 1+4 {
+			t.Errorf("FAIL: 上書きはその呼び出しだけに適用されるべきです (calls: %d)", stub.calls)
+		}
+	})
+
+	t.Run("待機時間の矛盾はエラー", func(t *testing.T) {
+		c := newTestClient(&stubModels{})
+		_, err := c.GenerateContentWithRetryConfig(context.Background(), "hello", "test-model", &retry.Config{InitialInterval: time.Hour})
+		if err == nil || !strings.Contains(err.Error(), "リトライの初期待機時間") {
+			t.Errorf("FAIL: 初期待機時間が最大待機時間を超える場合はエラーになるべきです (got: %v)", err)
+		}
+	})
+}
+
+func TestClient_GenerateContent_NonIdempotent(t *testing.T) {
+	unavailable := []error{status.Error(codes.Unavailable, "unavailable"), status.Error(codes.Unavailable, "unavailable")}
+	ctx := ai.WithGenerateOptions(context.Background(), ai.GenerateOptions{NonIdempotent: true})
+
+	stub := &stubModels{errs: unavailable, responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+	c := newTestClient(stub)
+	c.fallbackModels = []string{"fallback"}
+
+	_, err := c.GenerateContent(ctx, "hello", "test-model")
+	if err == nil {
+		t.Fatal("FAIL: 最初のエラーが返されるべきです")
+	}
+	if stub.calls != 1 {
+		t.Errorf("FAIL: 冪等でない呼び出しはリトライもフォールバックもしないべきです (calls: %d)", stub.calls)
+	}
+	var exhausted *RetriesExhaustedError
+	if errors.As(err, &exhausted) || !IsRetryable(err) {
+		t.Errorf("FAIL: 最初の試行のエラーをそのまま返すべきです (got: %v)", err)
+	}
+
+	t.Run("指定しなければリトライする", func(t *testing.T) {
+		stub := &stubModels{errs: unavailable, responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		if _, err := newTestClient(stub).GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+			t.Fatalf("FAIL: リトライ後は成功するべきです: %v", err)
+		}
+		if stub.calls != 3 {
+			t.Errorf("FAIL: 呼び出し回数 = %d, want 3", stub.calls)
+		}
+	})
+
+	t.Run("ゼロ値の GenerateOptions ではリトライする", func(t *testing.T) {
+		stub := &stubModels{errs: unavailable, responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+		ctx := ai.WithGenerateOptions(context.Background(), ai.GenerateOptions{})
+		if _, err := newTestClient(stub).GenerateContent(ctx, "hello", "test-model"); err != nil {
+			t.Fatalf("FAIL: リトライ後は成功するべきです: %v", err)
+		}
+		if stub.calls != 3 {
+			t.Errorf("FAIL: 呼び出し回数 = %d, want 3", stub.calls)
+		}
+	})
+}
+
+// --- RawConfigJSON に関するテスト ---
+
+func TestClient_RawConfigJSON(t *testing.T) {
+	t.Run("構造化フィールドと併合し、重なった場合は構造化フィールドを優先する", func(t *testing.T) {
+		c := newTestClient(&stubModels{})
+		c.rawConfig, _ = parseRawConfig(`{"topP":0.5,"topK":20,"maxOutputTokens":128,"thinkingConfig":{"thinkingBudget":0}}`)
+		c.topP = genai.Ptr[float32](0.9)
+
+		cfg := c.newGenerateContentConfig()
+		if cfg.TopP == nil || *cfg.TopP != 0.9 {
+			t.Errorf("FAIL: 構造化フィールドの TopP が優先されるべきです: %v", cfg.TopP)
+		}
+		if cfg.TopK == nil || *cfg.TopK != 20 || cfg.MaxOutputTokens != 128 {
+			t.Errorf("FAIL: RawConfigJSON の値が反映されるべきです (topK: %v, maxOutputTokens: %d)", cfg.TopK, cfg.MaxOutputTokens)
+		}
+		if cfg.ThinkingConfig == nil || cfg.ThinkingConfig.ThinkingBudget == nil || *cfg.ThinkingConfig.ThinkingBudget != 0 {
+			t.Errorf("FAIL: ラップされていないパラメータも反映されるべきです: %+v", cfg.ThinkingConfig)
+		}
+
+		// 呼び出し側で書き換えても、次の呼び出しに影響しないこと
+		*cfg.TopK = 99
+		*cfg.ThinkingConfig.ThinkingBudget = 512
+		if next := c.newGenerateContentConfig(); *next.TopK != 20 || *next.ThinkingConfig.ThinkingBudget != 0 {
+			t.Errorf("FAIL: 呼び出しごとに独立した設定が返されるべきです: topK=%v thinkingBudget=%v", *next.TopK, *next.ThinkingConfig.ThinkingBudget)
+		}
+	})
+
+	t.Run("Temperature 未指定なら RawConfigJSON の温度を使う", func(t *testing.T) {
+		c, err := NewClient(context.Background(), Config{APIKey: "dummy-key", RawConfigJSON: `{"temperature":0.2}`})
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if got := *c.newGenerateContentConfig().Temperature; got != 0.2 {
+			t.Errorf("FAIL: Temperature = %v, want 0.2", got)
+		}
+
+		c, err = NewClient(context.Background(), Config{APIKey: "dummy-key", RawConfigJSON: `{"temperature":0.2}`, Temperature: genai.Ptr[float32](0.9)})
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if got := *c.newGenerateContentConfig().Temperature; got != 0.9 {
+			t.Errorf("FAIL: 構造化フィールドの Temperature が優先されるべきです: %v", got)
+		}
+	})
+
+	t.Run("不正な JSON は生成時にエラー", func(t *testing.T) {
+		for _, raw := range []string{`{"topP":`, `{"topPP":0.5}`, `{"topP":0.5} {}`} {
+			_, err := NewClient(context.Background(), Config{APIKey: "dummy-key", RawConfigJSON: raw})
+			if err == nil || !strings.Contains(err.Error(), "RawConfigJSON") {
+				t.Errorf("FAIL: %q はエラーになるべきです (got: %v)", raw, err)
+			}
+		}
+	})
+}
+
+// --- GenerateValidated に関するテスト ---
+
+func TestClient_GenerateValidated(t *testing.T) {
+	validateJSON := func(text string) error {
+		if !json.Valid([]byte(text)) {
+			return errors.New("JSON ではありません")
+		}
+		return nil
+	}
+
+	t.Run("検証に失敗したら指摘を付けて再生成すること", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("not json"), textResponse(`{"a":1}`)}}
+		resp, err := newTestClient(stub).GenerateValidated(context.Background(), "hello", "test-model", validateJSON, 3)
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.Text != `{"a":1}` {
+			t.Errorf("FAIL: Text = %q", resp.Text)
+		}
+		if stub.calls != 2 {
+			t.Errorf("FAIL: 呼び出し回数 = %d, want 2", stub.calls)
+		}
+		prompt := stub.lastContents[0].Parts[0].Text
+		if !strings.HasPrefix(prompt, "hello") || !strings.Contains(prompt, "JSON ではありません") {
+			t.Errorf("FAIL: 再生成のプロンプトに検証エラーが含まれていません: %q", prompt)
+		}
+	})
+
+	t.Run("上限まで検証を通らなければ最後の応答と ErrValidationFailed を返すこと", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("bad1"), textResponse("bad2")}}
+		resp, err := newTestClient(stub).GenerateValidated(context.Background(), "hello", "test-model", validateJSON, 2)
+		if !errors.Is(err, ErrValidationFailed) {
+			t.Fatalf("FAIL: ErrValidationFailed が返されるべきです (got: %v)", err)
+		}
+		if resp == nil || resp.Text != "bad2" {
+			t.Errorf("FAIL: 最後の応答が返されるべきです: %+v", resp)
+		}
+		if stub.calls != 2 {
+			t.Errorf("FAIL: 呼び出し回数 = %d, want 2", stub.calls)
+		}
+	})
+
+	t.Run("maxAttempts が 0 以下ならエラーを返すこと", func(t *testing.T) {
+		stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse(`{}`)}}
+		if _, err := newTestClient(stub).GenerateValidated(context.Background(), "hello", "test-model", validateJSON, 0); err == nil {
+			t.Error("FAIL: エラーが返されるべきです")
+		}
+		if stub.calls != 0 {
+			t.Errorf("FAIL: API が呼び出されるべきではありません (calls: %d)", stub.calls)
+		}
+	})
+}
+
+func TestClient_GenerateContent_TemperatureOverride(t *testing.T) {
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}}
+	c := newTestClient(stub)
+
+	if _, err := c.GenerateContent(ai.WithTemperature(context.Background(), 0.9), "hello", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if got := stub.lastConfig.Temperature; got == nil || *got != 0.9 {
+		t.Errorf("FAIL: 温度が上書きされていません: %v", got)
+	}
+
+	if _, err := c.GenerateContent(context.Background(), "hello", "test-model"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if got := stub.lastConfig.Temperature; got == nil || *got != DefaultTemperature {
+		t.Errorf("FAIL: 指定がない場合はクライアントの温度を使うべきです: %v", got)
+	}
+
+	calls := stub.calls
+	if _, err := c.GenerateContent(ai.WithTemperature(context.Background(), 1.5), "hello", "test-model"); err == nil {
+		t.Error("FAIL: 範囲外の温度はエラーになるべきです")
+	}
+	if stub.calls != calls {
+		t.Error("FAIL: 範囲外の温度で API が呼び出されるべきではありません")
+	}
+}
+
+// --- GenerateWithParts のアップロードに関するテスト ---
+
+// stubFiles は File API の呼び出し回数を記録するスタブなのだ。アップロードしたファイルはすぐに Active になるのだ。
+type stubFiles struct {
+	mu      sync.Mutex
+	uploads int
+	deleted []string
+}
+
+func (s *stubFiles) Upload(ctx context.Context, r io.Reader, config *genai.UploadFileConfig) (*genai.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+	s.uploads++
+	return &genai.File{Name: fmt.Sprintf("files/%d", s.uploads), State: genai.FileStateProcessing}, nil
+}
+
+func (s *stubFiles) Get(ctx context.Context, name string, config *genai.GetFileConfig) (*genai.File, error) {
+	return &genai.File{Name: name, URI: "https://example.com/" + name, State: genai.FileStateActive}, nil
+}
+
+func (s *stubFiles) Delete(ctx context.Context, name string, config *genai.DeleteFileConfig) (*genai.DeleteFileResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, name)
+	return &genai.DeleteFileResponse{}, nil
+}
+
+func TestClient_GenerateWithParts_UploadsOnceAcrossRetries(t *testing.T) {
+	unavailable := genai.APIError{Code: 503, Status: "UNAVAILABLE"}
+	models := &stubModels{
+		errs:      []error{unavailable, unavailable},
+		responses: []*genai.GenerateContentResponse{textResponse("ok")},
+	}
+	files := &stubFiles{}
+	c := newTestClient(models)
+	c.files = files
+	c.filePollingInterval = time.Millisecond
+	c.filePollingTimeout = time.Second
+	c.resumableUploadThreshold = DefaultResumableUploadThreshold
+
+	large := bytes.Repeat([]byte("a"), fileAPITransferThreshold+1)
+	parts := []*genai.Part{genai.NewPartFromBytes(large, "text/plain"), genai.NewPartFromText("要約して")}
+	resp, err := c.GenerateWithParts(context.Background(), "test-model", parts, ImageOptions{})
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if resp.Text != "ok" || models.calls != 3 {
+		t.Fatalf("FAIL: 生成が 2 回リトライされた後に成功するべきです (calls: %d, text: %q)", models.calls, resp.Text)
+	}
+	if files.uploads != 1 {
+		t.Errorf("FAIL: アップロードはリトライにかかわらず 1 回だけ行うべきです (uploads: %d)", files.uploads)
+	}
+	if len(files.deleted) != 1 || files.deleted[0] != "files/1" {
+		t.Errorf("FAIL: アップロードしたファイルを 1 回だけ削除するべきです: %v", files.deleted)
+	}
+	if got := models.lastContents[0].Parts[0].FileData; got == nil || got.FileURI != "https://example.com/files/1" {
+		t.Errorf("FAIL: 巨大なデータはアップロードしたファイルの参照に置き換えるべきです: %+v", got)
+	}
+}
+
+func TestClient_GenerateContent_InlineImages(t *testing.T) {
+	png, jpeg := []byte{0x89, 'P', 'N', 'G'}, []byte{0xff, 0xd8, 0xff}
+	mixed := &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{
+			Content: &genai.Content{Role: RoleModel, Parts: []*genai.Part{
+				{Text: "1 枚目なのだ。"},
+				genai.NewPartFromBytes(png, "image/png"),
+				{Text: "2 枚目なのだ。"},
+				genai.NewPartFromBytes(jpeg, "image/jpeg"),
+				genai.NewPartFromBytes([]byte("%PDF"), "application/pdf"), // 画像以外のインラインデータは含めないのだ
+			}},
+			FinishReason: genai.FinishReasonStop,
+		}},
+	}
+	c := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{mixed}})
+
+	resp, err := c.GenerateContent(context.Background(), "猫を2枚", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if resp.Text != "1 枚目なのだ。2 枚目なのだ。" {
+		t.Errorf("FAIL: 画像があってもテキストは連結して返すべきです: %q", resp.Text)
+	}
+	want := []Image{{Data: png, MIMEType: "image/png"}, {Data: jpeg, MIMEType: "image/jpeg"}}
+	if !reflect.DeepEqual(resp.Images, want) {
+		t.Errorf("FAIL: Images = %+v, want %+v", resp.Images, want)
+	}
+
+	t.Run("テキストだけの応答では nil", func(t *testing.T) {
+		c := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{textResponse("ok")}})
+		resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.Images != nil {
+			t.Errorf("FAIL: 画像がなければ Images は nil であるべきです: %+v", resp.Images)
+		}
+	})
+}
+
+func TestExtractImage(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G'}
+	imageResponse := &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{
+			Content: &genai.Content{Role: RoleModel, Parts: []*genai.Part{
+				{Text: "どうぞなのだ"},
+				genai.NewPartFromBytes(png, "image/png"),
+			}},
+			FinishReason: genai.FinishReasonStop,
+		}},
+	}
+	stub := &stubModels{responses: []*genai.GenerateContentResponse{imageResponse}}
+	opts := ImageOptions{AspectRatio: "16:9", Seed: genai.Ptr[int32](42)}
+	resp, err := newTestClient(stub).GenerateWithParts(context.Background(), "test-model", []*genai.Part{genai.NewPartFromText("猫")}, opts)
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if cfg := stub.lastConfig; cfg.ImageConfig == nil || cfg.ImageConfig.AspectRatio != "16:9" || cfg.Seed == nil || *cfg.Seed != 42 {
+		t.Errorf("FAIL: 縦横比とシードがリクエストに設定されるべきです: %+v", cfg)
+	}
+
+	data, mimeType, err := ExtractImage(resp)
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if !bytes.Equal(data, png) || mimeType != "image/png" {
+		t.Errorf("FAIL: 画像のパートを取り出すべきです (mime: %q, data: %v)", mimeType, data)
+	}
+
+	t.Run("画像がなければ ErrNoImage とモデルのテキスト", func(t *testing.T) {
+		c := newTestClient(&stubModels{responses: []*genai.GenerateContentResponse{textResponse("画像は作れないのだ")}})
+		resp, err := c.GenerateWithParts(context.Background(), "test-model", []*genai.Part{genai.NewPartFromText("猫")}, ImageOptions{})
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		_, _, err = ExtractImage(resp)
+		if !errors.Is(err, ErrNoImage) || !strings.Contains(err.Error(), "画像は作れないのだ") {
+			t.Errorf("FAIL: ErrNoImage にモデルの応答を添えるべきです (got: %v)", err)
+		}
+	})
+}
+
+// --- GenerateContentStream に関するテスト ---
+
+func TestClient_GenerateContentStream(t *testing.T) {
+	t.Run("断片を順番に通知し、連結した応答を返すこと", func(t *testing.T) {
+		stub := &stubModels{streamChunks: []*genai.GenerateContentResponse{textResponse("こん"), textResponse("にちは")}}
+		c := newTestClient(stub)
+		c.streamStallTimeout = time.Second
+
+		var got []string
+		resp, err := c.GenerateContentStream(context.Background(), "hello", "test-model", func(text string) error {
+			got = append(got, text)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.Text != "こんにちは" || strings.Join(got, "|") != "こん|にちは" {
+			t.Errorf("FAIL: 応答 %q, 断片 %v", resp.Text, got)
+		}
+	})
+
+	t.Run("断片が届かなくなったら ErrStreamStalled で打ち切ること", func(t *testing.T) {
+		stub := &stubModels{streamChunks: []*genai.GenerateContentResponse{textResponse("途中まで")}, streamStall: true}
+		c := newTestClient(stub)
+		c.streamStallTimeout = 20 * time.Millisecond
+
+		start := time.Now()
+		resp, err := c.GenerateContentStream(context.Background(), "hello", "test-model", nil)
+		if !errors.Is(err, ErrStreamStalled) {
+			t.Fatalf("FAIL: ErrStreamStalled が返されるべきです (got: %v)", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("FAIL: 打ち切りまでに時間がかかりすぎています: %v", elapsed)
+		}
+		if resp == nil || resp.Text != "途中まで" {
+			t.Errorf("FAIL: 受信済みのテキストを含む応答を返すべきです: %+v", resp)
+		}
+	})
+
+	t.Run("断片を受け取るたびに待ち時間の計測をやり直すこと", func(t *testing.T) {
+		// 断片の間隔 (15ms) は打ち切りの時間 (40ms) より短いが、合計時間はそれを超えるのだ
+		slow := &slowStreamModels{stubModels: &stubModels{}, chunks: []string{"a", "b", "c", "d"}, interval: 15 * time.Millisecond}
+		c := newTestClient(slow)
+		c.streamStallTimeout = 40 * time.Millisecond
+
+		resp, err := c.GenerateContentStream(context.Background(), "hello", "test-model", nil)
+		if err != nil {
+			t.Fatalf("FAIL: 予期しないエラー: %v", err)
+		}
+		if resp.Text != "abcd" {
+			t.Errorf("FAIL: Text = %q", resp.Text)
+		}
+	})
+}
+
+// slowStreamModels は、断片を一定の間隔で返すストリームのスタブなのだ。
+type slowStreamModels struct {
+	*stubModels
+	chunks   []string
+	interval time.Duration
+}
+
+func (s *slowStreamModels) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		for _, chunk := range s.chunks {
+			select {
+			case <-time.After(s.interval):
+			case <-ctx.Done():
+				yield(nil, ctx.Err())
+				return
+			}
+			if !yield(textResponse(chunk), nil) {
+				return
+			}
+		}
+	}
+}
+
+// --- モックサーバーを使った結合テスト ---
+
+// mockReply は、モックサーバーが 1 回のリクエストに返すステータスコードとレスポンスボディなのだ。
+type mockReply struct {
+	status int
+	body   string
+}
+
+// mockServer は、genai の REST API の代わりに、用意した応答を順番に返す httptest サーバーなのだ。
+// 応答を使い切った後は、最後の応答を返し続けるのだ。
+type mockServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	replies  []mockReply
+	requests []string // 受け取ったリクエストのパスなのだ
+}
+
+// newMockServer はモックサーバーを起動し、テストの終了時に停止するのだ。
+func newMockServer(t *testing.T, replies ...mockReply) *mockServer {
+	t.Helper()
+	m := &mockServer{replies: replies}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.handle))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockServer) handle(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	reply := m.replies[min(len(m.requests), len(m.replies)-1)]
+	m.requests = append(m.requests, r.URL.Path)
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reply.status)
+	_, _ = io.WriteString(w, reply.body)
+}
+
+// requestCount は受け取ったリクエストの数を返すのだ。
+func (m *mockServer) requestCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.requests)
+}
+
+// newMockServerClient は、BaseURL でモックサーバーに向けた、リトライ待ち時間の短いクライアントを生成するのだ。
+func newMockServerClient(t *testing.T, m *mockServer) *Client {
+	t.Helper()
+	c, err := NewClient(context.Background(), Config{
+		APIKey:       "dummy-key",
+		BaseURL:      m.URL,
+		MaxRetries:   3,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("FAIL: クライアントの生成に失敗しました: %v", err)
+	}
+	return c
+}
+
+const (
+	mockTextReply    = `{"candidates":[{"content":{"role":"model","parts":[{"text":"こんにちは"},{"text":"なのだ"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":5,"totalTokenCount":8},"modelVersion":"test-model-001"}`
+	mockBlockedReply = `{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"SAFETY"}]}`
+	mockUnavailable  = `{"error":{"code":503,"message":"The model is overloaded.","status":"UNAVAILABLE"}}`
+)
+
+func TestMockServer_GenerateContent(t *testing.T) {
+	m := newMockServer(t, mockReply{http.StatusOK, mockTextReply})
+	c := newMockServerClient(t, m)
+
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if resp.Text != "こんにちはなのだ" {
+		t.Errorf("FAIL: Text = %q, want %q", resp.Text, "こんにちはなのだ")
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 3 || resp.Usage.CompletionTokens != 5 || resp.Usage.TotalTokens != 8 {
+		t.Errorf("FAIL: Usage が不正です: %+v", resp.Usage)
+	}
+	if resp.Attempts != 1 {
+		t.Errorf("FAIL: Attempts = %d, want 1", resp.Attempts)
+	}
+	if len(m.requests) != 1 || !strings.HasSuffix(m.requests[0], "/models/test-model:generateContent") {
+		t.Errorf("FAIL: 予期しないリクエストです: %v", m.requests)
+	}
+}
+
+func TestMockServer_GenerateContent_Blocked(t *testing.T) {
+	m := newMockServer(t, mockReply{http.StatusOK, mockBlockedReply})
+	c := newMockServerClient(t, m)
+
+	_, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if !IsBlocked(err) {
+		t.Fatalf("FAIL: ブロックを示すエラーが返されるべきです (got: %v)", err)
+	}
+	if n := m.requestCount(); n != 1 {
+		t.Errorf("FAIL: ブロックはリトライすべきではありません (requests: %d)", n)
+	}
+}
+
+func TestMockServer_GenerateContent_Retries503(t *testing.T) {
+	m := newMockServer(t,
+		mockReply{http.StatusServiceUnavailable, mockUnavailable},
+		mockReply{http.StatusServiceUnavailable, mockUnavailable},
+		mockReply{http.StatusOK, mockTextReply},
+	)
+	c := newMockServerClient(t, m)
+
+	resp, err := c.GenerateContent(context.Background(), "hello", "test-model")
+	if err != nil {
+		t.Fatalf("FAIL: 503 はリトライで回復すべきです: %v", err)
+	}
+	if resp.Attempts != 3 || m.requestCount() != 3 {
+		t.Errorf("FAIL: 3 回目で成功すべきです (attempts: %d, requests: %d)", resp.Attempts, m.requestCount())
+	}
+	if stats := c.Stats(); stats.TotalRetries != 2 {
+		t.Errorf("FAIL: Stats.TotalRetries = %d, want 2", stats.TotalRetries)
+	}
+}
@@ -0,0 +1,51 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// redactedValue は、デバッグ出力で API キーの代わりに表示する文字列なのだ。
+const redactedValue = "[REDACTED]"
+
+// debugRequest は、Config.DebugRequests でログに出力するリクエストの内容なのだ。
+type debugRequest struct {
+	Model    string                       `json:"model"`
+	Contents []*genai.Content             `json:"contents"`
+	Config   *genai.GenerateContentConfig `json:"config"`
+}
+
+// logRequest は Config.DebugRequests が有効な場合に限り、送信するコンテンツと生成設定を JSON にしてデバッグログに出力するのだ。
+// API キーはリクエストボディには含まれないけれど、RawConfigJSON のヘッダーなどに紛れ込んだ場合に備えて伏せ字にするのだ。
+func (c *Client) logRequest(ctx context.Context, modelName string, contents []*genai.Content, config *genai.GenerateContentConfig) {
+	if !c.debugRequests || !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	body, err := json.Marshal(debugRequest{Model: modelName, Contents: contents, Config: config})
+	if err != nil {
+		slog.DebugContext(ctx, "リクエストの内容を JSON に変換できなかったのだ", "model", modelName, "error", err)
+		return
+	}
+	request := string(body)
+	for _, apiKey := range c.apiKeys {
+		request = strings.ReplaceAll(request, apiKey, redactedValue)
+	}
+	slog.DebugContext(ctx, "Gemini API にリクエストを送信するのだ", "model", modelName, "request", request)
+}
+
+// logRequestID は、API 呼び出しの結果 (応答またはエラー) にリクエスト ID があれば、デバッグログに出力するのだ。
+func logRequestID(ctx context.Context, modelName string, attempt int, resp *genai.GenerateContentResponse, err error) {
+	id := extractRequestID(resp)
+	if err != nil {
+		id = RequestIDFromError(err)
+	}
+	if id == "" {
+		return
+	}
+	slog.DebugContext(ctx, "Gemini API がリクエスト ID を返したのだ", "model", modelName, "attempt", attempt, "request_id", id)
+}
@@ -4,33 +4,65 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"time"
 
 	"google.golang.org/genai"
 )
 
-// uploadToFileAPI はデータをアップロードし、Active状態になるまでポーリングするのだ。
-// 戻り値として、File APIでのURI、削除時に使用する名前、およびエラーを返すのだ。
-func (c *Client) uploadToFileAPI(ctx context.Context, data []byte, mimeType string) (string, string, error) {
-	reader := bytes.NewReader(data)
+// uploadToFileAPI は r の先頭から size バイトをアップロードし、Active状態になるまでポーリングするのだ。
+func (c *Client) uploadToFileAPI(ctx context.Context, r io.ReaderAt, size int64, mimeType string) (string, string, error) {
+	total := size
+	var file *genai.File
+	var err error
+	if total > c.resumableUploadThreshold && c.uploader != nil {
+		// 巨大なデータは、送信が途中で失敗してもサーバーが受け取り済みの位置から再開できるセッションで送るのだ
+		file, err = c.uploader.upload(ctx, r, total, mimeType, uploadDisplayName())
+		if err != nil {
+			return "", "", fmt.Errorf("file upload failed: %w", err)
+		}
+	} else {
+		file, err = c.uploadReader(ctx, io.NewSectionReader(r, 0, total), mimeType)
+		if err != nil {
+			return "", "", err
+		}
+		if c.onUploadProgress != nil {
+			c.onUploadProgress(total, total)
+		}
+	}
+
+	return c.waitForFileActive(ctx, file)
+}
+
+// uploadReader はリーダーの内容をそのまま File API へ送信するのだ。
+// SDK はチャンク単位で読み出して送信するため、リーダー全体をメモリに載せる必要はないのだ。
+func (c *Client) uploadReader(ctx context.Context, reader io.Reader, mimeType string) (*genai.File, error) {
 	uploadCfg := &genai.UploadFileConfig{
 		MIMEType:    mimeType,
-		DisplayName: fmt.Sprintf("gemini-auto-%d", time.Now().UnixNano()),
+		DisplayName: uploadDisplayName(),
 	}
 
-	// 1. ファイルをアップロードするのだ
-	file, err := c.client.Files.Upload(ctx, reader, uploadCfg)
+	file, err := c.files.Upload(ctx, reader, uploadCfg)
 	if err != nil {
-		return "", "", fmt.Errorf("file upload failed: %w", err)
+		return nil, fmt.Errorf("file upload failed: %w", err)
 	}
+	return file, nil
+}
 
-	// 2. Active状態になるまでポーリング待機するのだ
-	ticker := time.NewTicker(filePollingInterval)
+// uploadDisplayName は、自動でアップロードするファイルの表示名を返すのだ。
+func uploadDisplayName() string {
+	return fmt.Sprintf("gemini-auto-%d", time.Now().UnixNano())
+}
+
+// waitForFileActive はアップロード済みファイルが Active 状態になるまでポーリングするのだ。
+// 戻り値として、File APIでのURI、削除時に使用する名前、およびエラーを返すのだ。
+func (c *Client) waitForFileActive(ctx context.Context, file *genai.File) (string, string, error) {
+	ticker := time.NewTicker(c.filePollingInterval)
 	defer ticker.Stop()
 
 	// 無限ループを防ぐためのタイムアウト設定なのだ
-	timeout := time.After(filePollingTimeout)
+	timeout := time.After(c.filePollingTimeout)
 
 	for {
 		select {
@@ -39,7 +71,7 @@ func (c *Client) uploadToFileAPI(ctx context.Context, data []byte, mimeType stri
 			go func(fileName string) {
 				cleanupCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 				defer cancel()
-				if _, err := c.client.Files.Delete(cleanupCtx, fileName, &genai.DeleteFileConfig{}); err != nil {
+				if _, err := c.files.Delete(cleanupCtx, fileName, &genai.DeleteFileConfig{}); err != nil {
 					slog.WarnContext(context.Background(), "Async cleanup of File API failed", "name", fileName, "error", err)
 				}
 			}(file.Name)
@@ -48,13 +80,13 @@ func (c *Client) uploadToFileAPI(ctx context.Context, data []byte, mimeType stri
 		case <-timeout:
 			// タイムアウト発生時、ファイル名を含めた詳細なエラーを返しつつ、非同期で削除する
 			go func(fileName string) {
-				_, _ = c.client.Files.Delete(context.Background(), fileName, &genai.DeleteFileConfig{})
+				_, _ = c.files.Delete(context.Background(), fileName, &genai.DeleteFileConfig{})
 			}(file.Name)
-			return "", "", fmt.Errorf("file processing for %q timed out after %v", file.Name, filePollingTimeout)
+			return "", "", fmt.Errorf("file processing for %q timed out after %v", file.Name, c.filePollingTimeout)
 
 		case <-ticker.C:
 			// 現在の状態を取得するのだ
-			currentFile, err := c.client.Files.Get(ctx, file.Name, &genai.GetFileConfig{})
+			currentFile, err := c.files.Get(ctx, file.Name, &genai.GetFileConfig{})
 			if err != nil {
 				return "", "", fmt.Errorf("failed to get status for %q: %w", file.Name, err)
 			}
@@ -77,3 +109,39 @@ func (c *Client) uploadToFileAPI(ctx context.Context, data []byte, mimeType stri
 		}
 	}
 }
+
+// UploadFile はデータを File API にアップロードし、利用可能になるまで待機するのだ。
+// 一度アップロードしたファイルを複数のリクエストで使い回したい場合に利用するのだ。
+// 不要になったら呼び出し側で Delete を呼んで削除する必要があるのだ。
+func (c *Client) UploadFile(ctx context.Context, data []byte, mimeType string) (*UploadedFile, error) {
+	return c.UploadFileFrom(ctx, bytes.NewReader(data), int64(len(data)), mimeType)
+}
+
+// UploadFileFrom は r の先頭から size バイトを File API にアップロードし、利用可能になるまで待機するのだ。
+// UploadFile と違ってデータ全体をメモリに載せずに済むので、*os.File をそのまま渡せば巨大なファイルも扱えるのだ。
+// 送信が途中で失敗した場合に受け取り済みの位置から読み直すため、io.Reader ではなく io.ReaderAt を受け取るのだ。
+func (c *Client) UploadFileFrom(ctx context.Context, r io.ReaderAt, size int64, mimeType string) (*UploadedFile, error) {
+	uri, name, err := c.uploadToFileAPI(ctx, r, size, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadedFile{
+		URI:      uri,
+		Name:     name,
+		MIMEType: mimeType,
+		client:   c,
+	}, nil
+}
+
+// Part はアップロード済みファイルを参照する genai.Part を返すのだ。
+func (f *UploadedFile) Part() *genai.Part {
+	return &genai.Part{FileData: &genai.FileData{FileURI: f.URI, MIMEType: f.MIMEType}}
+}
+
+// Delete は File API 上のファイルを削除するのだ。
+func (f *UploadedFile) Delete(ctx context.Context) error {
+	if _, err := f.client.files.Delete(ctx, f.Name, &genai.DeleteFileConfig{}); err != nil {
+		return fmt.Errorf("failed to delete file %q: %w", f.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// KeyRotation は、Config.APIKeys で複数の API キーを指定した場合に、リクエストに使うキーを選ぶ方法なのだ。
+type KeyRotation string
+
+const (
+	// RoundRobin は、リクエストごとに順番にキーを使うのだ。
+	RoundRobin KeyRotation = "round-robin"
+	// LeastRecentlyRateLimited は、レート制限を受けていないキーを優先し、どのキーも受けている場合は
+	// 最後に受けてから最も時間がたったキーを使うのだ。受けていないキー同士では順番に使うのだ。
+	LeastRecentlyRateLimited KeyRotation = "least-recently-rate-limited"
+)
+
+// fileOwnerKey は、File API へのアップロードに使うキーの番号なのだ。Client.files と Client.uploader は最初のキーで作るのだ。
+// ファイルはアップロードしたキーのプロジェクトにしか見えないので、ファイルを参照するリクエストはこのキーで送るのだ。
+const fileOwnerKey = 0
+
+// keyPool は API キーごとの modelsService をまとめて、1 つの modelsService として振る舞うのだ。
+// あるキーでレート制限 (429 / ResourceExhausted) を受けた場合は、同じ呼び出しの中で次のキーに切り替えて送り直すのだ。
+// すべてのキーがレート制限を受けた場合は最後のエラーを返し、Client のリトライ (バックオフ) に任せるのだ。
+// File API のファイル (FileData) を参照するリクエストは、キーを切り替えずに fileOwnerKey で送るのだ。
+type keyPool struct {
+	models   []modelsService
+	rotation KeyRotation
+
+	mu sync.Mutex
+	// next は RoundRobin で次の呼び出しが最初に使うキーの番号なのだ。
+	next int
+	// rateLimitedAt はキーごとに最後にレート制限を受けた時刻なのだ（ゼロ値なら受けていないのだ）。
+	rateLimitedAt []time.Time
+}
+
+// newKeyPool は、キーごとの modelsService から keyPool を生成するのだ。rotation が空の場合は RoundRobin なのだ。
+func newKeyPool(models []modelsService, rotation KeyRotation) *keyPool {
+	if rotation == "" {
+		rotation = RoundRobin
+	}
+	return &keyPool{
+		models:        models,
+		rotation:      rotation,
+		rateLimitedAt: make([]time.Time, len(models)),
+	}
+}
+
+// order は、この呼び出しでキーを試す順番を返すのだ。
+func (p *keyPool) order() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.models)
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = (p.next + i) % n
+	}
+	p.next = (p.next + 1) % n
+
+	if p.rotation == LeastRecentlyRateLimited {
+		slices.SortStableFunc(indexes, func(a, b int) int {
+			return p.rateLimitedAt[a].Compare(p.rateLimitedAt[b])
+		})
+	}
+	return indexes
+}
+
+// markRateLimited は、キーがレート制限を受けた時刻を記録するのだ。
+func (p *keyPool) markRateLimited(index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rateLimitedAt[index] = time.Now()
+}
+
+// keysFor は、contents を送るときに試すキーの番号を順番に返すのだ。
+// File API のファイルを参照する場合は、アップロードしたキー (fileOwnerKey) だけを返すのだ。
+func (p *keyPool) keysFor(contents []*genai.Content) []int {
+	if hasFileData(contents) {
+		return []int{fileOwnerKey}
+	}
+	return p.order()
+}
+
+// callWithKeys は keysFor の順番にキーを使って call を呼び出し、レート制限を受けたら次のキーで送り直すのだ。
+func callWithKeys[T any](ctx context.Context, p *keyPool, contents []*genai.Content, call func(modelsService) (T, error)) (T, error) {
+	var result T
+	var err error
+	indexes := p.keysFor(contents)
+	for n, i := range indexes {
+		result, err = call(p.models[i])
+		if err == nil || !isRateLimited(err) {
+			return result, err
+		}
+		p.markRateLimited(i)
+		if n == len(indexes)-1 || ctx.Err() != nil {
+			break
+		}
+		slog.WarnContext(ctx, "API キーがレート制限を受けたため、次のキーに切り替えるのだ", "key", i+1, "keys", len(indexes), "error", err)
+	}
+	return result, err
+}
+
+func (p *keyPool) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	return callWithKeys(ctx, p, contents, func(m modelsService) (*genai.GenerateContentResponse, error) {
+		return m.GenerateContent(ctx, model, contents, config)
+	})
+}
+
+func (p *keyPool) CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
+	return callWithKeys(ctx, p, contents, func(m modelsService) (*genai.CountTokensResponse, error) {
+		return m.CountTokens(ctx, model, contents, config)
+	})
+}
+
+// GenerateContentStream は、最初に選んだキーだけを使うのだ。断片を受け取り始めた後に送り直すと応答が重複するので、
+// レート制限を受けてもキーは切り替えず、次の呼び出しのために記録だけするのだ。
+func (p *keyPool) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	i := p.keysFor(contents)[0]
+	stream := p.models[i].GenerateContentStream(ctx, model, contents, config)
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		for resp, err := range stream {
+			if err != nil && isRateLimited(err) {
+				p.markRateLimited(i)
+			}
+			if !yield(resp, err) {
+				return
+			}
+		}
+	}
+}
+
+// hasFileData は、contents に File API のファイルを参照するパートが含まれているかどうかを判定するのだ。
+func hasFileData(contents []*genai.Content) bool {
+	for _, content := range contents {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part != nil && part.FileData != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectAPIKeys は、Config.APIKey と Config.APIKeys を、空のキーと重複を除いてこの順に並べるのだ。
+func collectAPIKeys(cfg Config) []string {
+	var keys []string
+	for _, key := range append([]string{cfg.APIKey}, cfg.APIKeys...) {
+		if key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// splitAPIKeys は、カンマ区切りの API キー (環境変数 GEMINI_API_KEYS の値) を分割するのだ。
+func splitAPIKeys(value string) []string {
+	var keys []string
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// isRateLimited は、エラーがレート制限またはクォータの超過 (429 / ResourceExhausted) を示すかどうかを判定するのだ。
+// クォータはキー (プロジェクト) ごとなので、1 日あたりのクォータの超過でも別のキーなら通る見込みがあるのだ。
+func isRateLimited(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests
+	}
+	return status.Code(err) == codes.ResourceExhausted
+}
@@ -0,0 +1,91 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus メトリクスの outcome ラベルの値なのだ。
+const (
+	outcomeSuccess = "success"
+	outcomeRetry   = "retry"
+	outcomeFailure = "failure"
+	outcomeBlocked = "blocked"
+)
+
+// metricsCollector はリクエストのレイテンシと結果を Prometheus に記録するのだ。
+// nil の場合は何も記録しないので、呼び出し側で nil チェックは不要なのだ。
+type metricsCollector struct {
+	duration *prometheus.HistogramVec
+	outcomes *prometheus.CounterVec
+}
+
+// newMetricsCollector はコレクタを生成して reg に登録するのだ。
+// 同じレジストリに登録済みの場合は、既存のコレクタを再利用するのだ。
+func newMetricsCollector(reg prometheus.Registerer) (*metricsCollector, error) {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gemini",
+		Subsystem: "client",
+		Name:      "request_duration_seconds",
+		Help:      "リトライを含めた生成リクエスト全体の所要時間なのだ。",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 10),
+	}, []string{"model", "outcome"})
+	outcomes := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gemini",
+		Subsystem: "client",
+		Name:      "requests_total",
+		Help:      "生成リクエストの結果ごとの件数なのだ (success/retry/failure/blocked)。",
+	}, []string{"model", "outcome"})
+
+	var err error
+	if duration, err = registerOrReuse(reg, duration); err != nil {
+		return nil, err
+	}
+	if outcomes, err = registerOrReuse(reg, outcomes); err != nil {
+		return nil, err
+	}
+	return &metricsCollector{duration: duration, outcomes: outcomes}, nil
+}
+
+// registerOrReuse はコレクタを登録し、登録済みなら既存のものを返すのだ。
+func registerOrReuse[T prometheus.Collector](reg prometheus.Registerer, c T) (T, error) {
+	if err := reg.Register(c); err != nil {
+		var already prometheus.AlreadyRegisteredError
+		if errors.As(err, &already) {
+			if existing, ok := already.ExistingCollector.(T); ok {
+				return existing, nil
+			}
+		}
+		return c, fmt.Errorf("Prometheus メトリクスの登録に失敗しました: %w", err)
+	}
+	return c, nil
+}
+
+// observeRetry はリトライの発生を記録するのだ。
+func (m *metricsCollector) observeRetry(modelName string) {
+	if m == nil {
+		return
+	}
+	m.outcomes.WithLabelValues(modelName, outcomeRetry).Inc()
+}
+
+// observeResult は呼び出し全体の所要時間と最終的な結果を記録するのだ。
+func (m *metricsCollector) observeResult(modelName string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	outcome := outcomeSuccess
+	switch {
+	case err == nil:
+	case IsBlocked(err):
+		outcome = outcomeBlocked
+	default:
+		outcome = outcomeFailure
+	}
+	m.duration.WithLabelValues(modelName, outcome).Observe(time.Since(start).Seconds())
+	m.outcomes.WithLabelValues(modelName, outcome).Inc()
+}
@@ -0,0 +1,78 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// GenerateFunc は GenerateContent と同じシグネチャの生成関数なのだ。
+type GenerateFunc func(ctx context.Context, prompt string, modelName string) (*Response, error)
+
+// Middleware は GenerateFunc を包んで、ログやキャッシュ、レート制限などの横断的な処理を差し込むのだ。
+// next を呼ばずに返せば、API 呼び出しを省略することもできるのだ。
+type Middleware func(next GenerateFunc) GenerateFunc
+
+// Use は GenerateContent の呼び出しが通るミドルウェアを追加するのだ。
+// 先に追加したものほど外側で実行されるのだ。Client を使い始める前に呼ぶことを想定しているけれど、
+// 途中で追加しても安全で、以降の呼び出しから反映されるのだ。
+func (c *Client) Use(mw ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middlewares = append(c.middlewares, mw...)
+}
+
+// generateChain は登録済みのミドルウェアで final を包んだ生成関数を返すのだ。
+func (c *Client) generateChain(final GenerateFunc) GenerateFunc {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	next := final
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		next = c.middlewares[i](next)
+	}
+	return next
+}
+
+// LoggingMiddleware は呼び出しごとにモデル名、プロンプト長、所要時間、エラーを logger に出力するのだ。
+// logger が nil の場合は slog.Default() を使うのだ。
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next GenerateFunc) GenerateFunc {
+		return func(ctx context.Context, prompt string, modelName string) (*Response, error) {
+			start := time.Now()
+			resp, err := next(ctx, prompt, modelName)
+			attrs := []any{"model", modelName, "prompt_length", len(prompt), "elapsed", time.Since(start)}
+			if err != nil {
+				logger.WarnContext(ctx, "Gemini API の呼び出しに失敗したのだ", append(attrs, "error", err)...)
+			} else {
+				logger.InfoContext(ctx, "Gemini API の呼び出しが完了したのだ", attrs...)
+			}
+			return resp, err
+		}
+	}
+}
+
+// RateLimitMiddleware は呼び出しの開始間隔が interval 以上空くように待機させるのだ。
+// Config.RequestsPerMinute と同じく x/time/rate のリミッターで待つけれど、こちらはミドルウェアを通る GenerateContent の呼び出しだけに効くのだ。
+// 待機中に ctx が終了した場合や、期限までに枠が空かない場合は、API を呼ばずにエラーを返すのだ。interval が 0 以下なら何もしないのだ。
+func RateLimitMiddleware(interval time.Duration) Middleware {
+	// generateChain は呼び出しのたびにミドルウェアで包み直すので、リミッターはその外側で共有するのだ
+	limiter := rate.NewLimiter(rate.Every(interval), 1)
+	return func(next GenerateFunc) GenerateFunc {
+		if interval <= 0 {
+			return next
+		}
+		return func(ctx context.Context, prompt string, modelName string) (*Response, error) {
+			if err := limiter.Wait(ctx); err != nil {
+				return nil, fmt.Errorf("レート制限の待機中に中断しました: %w", err)
+			}
+			return next(ctx, prompt, modelName)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// File API の resumable アップロードのプロトコルで使うヘッダーなのだ。
+const (
+	uploadProtocolHeader     = "X-Goog-Upload-Protocol"
+	uploadCommandHeader      = "X-Goog-Upload-Command"
+	uploadOffsetHeader       = "X-Goog-Upload-Offset"
+	uploadStatusHeader       = "X-Goog-Upload-Status"
+	uploadURLHeader          = "X-Goog-Upload-URL"
+	uploadSizeReceivedHeader = "X-Goog-Upload-Size-Received"
+)
+
+const (
+	// uploadChunkSize は 1 回のリクエストで送るチャンクの大きさなのだ。プロトコルの都合で 256KiB の倍数にするのだ。
+	uploadChunkSize int64 = 8 * 1024 * 1024
+	// uploadResumeDelay は、送信に失敗してから受け取り済みのオフセットを問い合わせるまでの待ち時間なのだ。再開するたびに長くするのだ。
+	uploadResumeDelay = time.Second
+	// defaultUploadAPIVersion は、ClientConfig で API のバージョンが指定されていない場合に使うバージョンなのだ。
+	defaultUploadAPIVersion = "v1beta"
+)
+
+// resumableUploader は File API の resumable アップロードのセッションを直接扱うのだ。
+// SDK の Files.Upload は送信に失敗すると最初からやり直しになるので、巨大なデータではこちらを使うのだ。
+// チャンクの送信に失敗した場合は、サーバーが受け取り済みのオフセットを問い合わせて、そこから続きを送るのだ。
+// 進捗は、サーバーが受け取りを確認したバイト数で通知するのだ。
+type resumableUploader struct {
+	httpClient  *http.Client
+	baseURL     string
+	apiVersion  string
+	apiKey      string
+	chunkSize   int64
+	maxResumes  int
+	resumeDelay time.Duration
+	onProgress  func(bytesSent, total int64)
+}
+
+// newResumableUploader は、genai のクライアントと同じ接続先・API キー・HTTP クライアントを使う resumableUploader を生成するのだ。
+func newResumableUploader(cc genai.ClientConfig, onProgress func(bytesSent, total int64)) *resumableUploader {
+	httpClient := cc.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	apiVersion := cc.HTTPOptions.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultUploadAPIVersion
+	}
+	return &resumableUploader{
+		httpClient:  httpClient,
+		baseURL:     strings.TrimSuffix(cc.HTTPOptions.BaseURL, "/"),
+		apiVersion:  apiVersion,
+		apiKey:      cc.APIKey,
+		chunkSize:   uploadChunkSize,
+		maxResumes:  maxUploadResumes,
+		resumeDelay: uploadResumeDelay,
+		onProgress:  onProgress,
+	}
+}
+
+// upload はセッションを開始し、r の先頭から total バイトをチャンクに分けて送信するのだ。
+// 一度にメモリに載せるのは 1 チャンク分だけなのだ。
+// 失敗した場合は maxResumes 回まで、サーバーが受け取り済みのオフセットから再開するのだ。
+func (u *resumableUploader) upload(ctx context.Context, r io.ReaderAt, total int64, mimeType, displayName string) (*genai.File, error) {
+	uploadURL, err := u.start(ctx, total, mimeType, displayName)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, min(u.chunkSize, total))
+	var offset int64
+	resumes := 0
+	for {
+		end := min(offset+u.chunkSize, total)
+		command := "upload"
+		if end == total {
+			command = "upload, finalize"
+		}
+		chunk := buf[:end-offset]
+		if n, err := r.ReadAt(chunk, offset); n < len(chunk) {
+			return nil, fmt.Errorf("アップロードするデータの読み込みに失敗しました (オフセット %d): %w", offset, err)
+		}
+		status, file, err := u.send(ctx, uploadURL, command, offset, chunk)
+		if err == nil {
+			switch status {
+			case "final":
+				u.progress(total, total)
+				return file, nil
+			case "active":
+				offset = end
+				u.progress(offset, total)
+				continue
+			default:
+				return nil, fmt.Errorf("アップロードのセッションが予期しない状態になりました: %s", status)
+			}
+		}
+
+		// 送信に失敗したので、サーバーが受け取り済みのオフセットを問い合わせて、そこから再開するのだ
+		var received int64
+		for {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("アップロードを中断しました (オフセット %d): %w", offset, ctx.Err())
+			}
+			if resumes >= u.maxResumes {
+				return nil, fmt.Errorf("アップロードの再開回数 (%d回) を超えました: %w", u.maxResumes, err)
+			}
+			resumes++
+			slog.WarnContext(ctx, "アップロードの送信に失敗。サーバーが受け取り済みの位置から再開するのだ", "offset", offset, "attempt", resumes, "error", err)
+			if err := sleepContext(ctx, u.resumeDelay*time.Duration(resumes)); err != nil {
+				return nil, fmt.Errorf("アップロードを中断しました (オフセット %d): %w", offset, err)
+			}
+			status, received, file, err = u.query(ctx, uploadURL)
+			if err == nil {
+				break
+			}
+		}
+		switch {
+		case status == "final":
+			u.progress(total, total)
+			return file, nil
+		case status != "active":
+			return nil, fmt.Errorf("アップロードのセッションが予期しない状態になりました: %s", status)
+		case received < 0 || received > total:
+			return nil, fmt.Errorf("サーバーが受け取り済みのバイト数が不正です: %d (全体 %d)", received, total)
+		}
+		offset = received
+		u.progress(offset, total)
+	}
+}
+
+// start は resumable アップロードのセッションを開始し、チャンクの送信先の URL を返すのだ。
+func (u *resumableUploader) start(ctx context.Context, total int64, mimeType, displayName string) (string, error) {
+	body, err := json.Marshal(map[string]any{"file": map[string]string{"displayName": displayName, "mimeType": mimeType}})
+	if err != nil {
+		return "", fmt.Errorf("アップロードのセッションの開始に失敗しました: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/upload/%s/files", u.baseURL, u.apiVersion), bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("アップロードのセッションの開始に失敗しました: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(uploadProtocolHeader, "resumable")
+	req.Header.Set(uploadCommandHeader, "start")
+	req.Header.Set("X-Goog-Upload-Header-Content-Length", strconv.FormatInt(total, 10))
+	req.Header.Set("X-Goog-Upload-Header-Content-Type", mimeType)
+
+	resp, err := u.do(req)
+	if err != nil {
+		return "", fmt.Errorf("アップロードのセッションの開始に失敗しました: %w", err)
+	}
+	resp.Body.Close()
+	uploadURL := resp.Header.Get(uploadURLHeader)
+	if uploadURL == "" {
+		return "", fmt.Errorf("アップロードのセッションの開始に失敗しました: 送信先の URL が返されませんでした")
+	}
+	return uploadURL, nil
+}
+
+// send はオフセット offset からのチャンクを送信し、セッションの状態を返すのだ。最後のチャンクでは作成されたファイルも返すのだ。
+func (u *resumableUploader) send(ctx context.Context, uploadURL, command string, offset int64, chunk []byte) (string, *genai.File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, bytes.NewReader(chunk))
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set(uploadCommandHeader, command)
+	req.Header.Set(uploadOffsetHeader, strconv.FormatInt(offset, 10))
+
+	resp, err := u.do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("オフセット %d のチャンクの送信に失敗しました: %w", offset, err)
+	}
+	defer resp.Body.Close()
+	status := resp.Header.Get(uploadStatusHeader)
+	if status == "" {
+		return "", nil, fmt.Errorf("オフセット %d のチャンクの送信に失敗しました: セッションの状態が返されませんでした", offset)
+	}
+	file, err := decodeUploadedFile(resp, status)
+	return status, file, err
+}
+
+// query は、セッションの状態と、サーバーが受け取り済みのバイト数を問い合わせるのだ。
+// アップロードが完了していた場合は、作成されたファイルも返すのだ。
+func (u *resumableUploader) query(ctx context.Context, uploadURL string) (string, int64, *genai.File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, http.NoBody)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	req.Header.Set(uploadCommandHeader, "query")
+
+	resp, err := u.do(req)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("アップロードの状態の問い合わせに失敗しました: %w", err)
+	}
+	defer resp.Body.Close()
+	status := resp.Header.Get(uploadStatusHeader)
+	received, err := strconv.ParseInt(resp.Header.Get(uploadSizeReceivedHeader), 10, 64)
+	if status == "active" && err != nil {
+		return "", 0, nil, fmt.Errorf("アップロードの状態の問い合わせに失敗しました: 受け取り済みのバイト数が返されませんでした")
+	}
+	file, err := decodeUploadedFile(resp, status)
+	return status, received, file, err
+}
+
+// do は API キーを付けてリクエストを送り、2xx 以外の応答をエラーにするのだ。
+func (u *resumableUploader) do(req *http.Request) (*http.Response, error) {
+	if u.apiKey != "" {
+		req.Header.Set("x-goog-api-key", u.apiKey)
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// progress は、onProgress が指定されていれば進捗を通知するのだ。
+func (u *resumableUploader) progress(sent, total int64) {
+	if u.onProgress != nil {
+		u.onProgress(sent, total)
+	}
+}
+
+// decodeUploadedFile は、アップロードが完了した (status が final の) 応答の本文から、作成されたファイルを取り出すのだ。
+func decodeUploadedFile(resp *http.Response, status string) (*genai.File, error) {
+	if status != "final" {
+		return nil, nil
+	}
+	var body struct {
+		File *genai.File `json:"file"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("アップロードしたファイルの情報の解析に失敗しました: %w", err)
+	}
+	if body.File == nil {
+		return nil, fmt.Errorf("アップロードしたファイルの情報が返されませんでした")
+	}
+	return body.File, nil
+}
+
+// sleepContext は d だけ待つのだ。待っている間に ctx が終了した場合はエラーを返すのだ。
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+package gemini
+
+import (
+	"expvar"
+	"log/slog"
+	"sync/atomic"
+)
+
+// expvarName は PublishMetrics で expvar に公開する際の変数名なのだ。
+const expvarName = "gemini_client"
+
+// ClientStats は Client が処理したリクエストの累計なのだ。
+type ClientStats struct {
+	// TotalRequests は生成リクエストの呼び出し回数なのだ（リトライは含まないのだ）。
+	TotalRequests uint64
+	// TotalRetries はリトライとして API を再呼び出しした回数なのだ。
+	TotalRetries uint64
+	// TotalFailures はリトライを含めて最終的に失敗した呼び出し回数なのだ。
+	TotalFailures uint64
+	// BlockedResponses は安全フィルター等でブロックされた応答の数なのだ。
+	BlockedResponses uint64
+}
+
+// clientCounters は ClientStats の元になるアトミックなカウンタなのだ。
+type clientCounters struct {
+	requests atomic.Uint64
+	retries  atomic.Uint64
+	failures atomic.Uint64
+	blocked  atomic.Uint64
+}
+
+// Stats は現時点での累計を返すのだ。複数の goroutine から呼び出しても安全なのだ。
+func (c *Client) Stats() ClientStats {
+	return ClientStats{
+		TotalRequests:    c.counters.requests.Load(),
+		TotalRetries:     c.counters.retries.Load(),
+		TotalFailures:    c.counters.failures.Load(),
+		BlockedResponses: c.counters.blocked.Load(),
+	}
+}
+
+// publishMetrics は Stats を expvar に公開するのだ。
+// expvar の変数名はプロセス内で一意なので、既に公開済みの場合は警告を出して何もしないのだ。
+func (c *Client) publishMetrics() {
+	if expvar.Get(expvarName) != nil {
+		slog.Warn("expvar に同名の変数が既に公開されているため、メトリクスの公開をスキップするのだ", "name", expvarName)
+		return
+	}
+	expvar.Publish(expvarName, expvar.Func(func() any { return c.Stats() }))
+}
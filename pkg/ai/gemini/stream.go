@@ -0,0 +1,123 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// streamChunk はストリームから受け取った 1 つの断片、またはエラーなのだ。
+type streamChunk struct {
+	resp *genai.GenerateContentResponse
+	err  error
+}
+
+// GenerateContentStream は応答をストリーミングで受け取り、テキストの断片が届くたびに onChunk を呼び出すのだ。
+// すべての断片を連結した応答を返すのだ。onChunk が nil の場合は、連結した結果だけを返すのだ。
+// onChunk がエラーを返した場合は、ストリームを打ち切ってそのエラーを返すのだ。
+// 断片を受け取り始めた後はやり直せないので、GenerateContent と違ってリトライやフォールバックはしないのだ。
+// Config.StreamStallTimeout の間に次の断片が届かない場合は、ストリームを打ち切り、
+// それまでに受け取ったテキストを含む応答と ErrStreamStalled をラップしたエラーを返すのだ。
+func (c *Client) GenerateContentStream(ctx context.Context, prompt string, modelName string, onChunk func(text string) error) (*Response, error) {
+	if prompt == "" {
+		return nil, errors.New("プロンプトが空です。入力を確認してください")
+	}
+	config := c.newGenerateContentConfig()
+	if err := applyTemperatureOverride(ctx, config); err != nil {
+		return nil, err
+	}
+	if err := c.waitForRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	c.counters.requests.Add(1)
+	contents := promptToContents(prompt)
+	c.logRequest(ctx, modelName, contents, config)
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// ストリームの読み出しは別の goroutine で行い、断片の待ち時間を select で監視できるようにするのだ
+	chunks := make(chan streamChunk)
+	go func() {
+		defer close(chunks)
+		for resp, err := range c.models.GenerateContentStream(streamCtx, modelName, contents, config) {
+			select {
+			case chunks <- streamChunk{resp: resp, err: err}:
+			case <-streamCtx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// 断片が届かない時間を計測するタイマーなのだ。StreamStallTimeout が 0 なら stalled は nil のままで、打ち切らないのだ
+	var (
+		timer   *time.Timer
+		stalled <-chan time.Time
+	)
+	if c.streamStallTimeout > 0 {
+		timer = time.NewTimer(c.streamStallTimeout)
+		defer timer.Stop()
+		stalled = timer.C
+	}
+
+	var sb strings.Builder
+	result := &Response{ModelName: modelName, Attempts: 1}
+	for {
+		select {
+		case <-stalled:
+			c.counters.failures.Add(1)
+			result.Text = sb.String()
+			return result, fmt.Errorf("%w (%v の間、応答の断片が届きませんでした)", ErrStreamStalled, c.streamStallTimeout)
+
+		case <-ctx.Done():
+			c.counters.failures.Add(1)
+			return nil, ctx.Err()
+
+		case chunk, ok := <-chunks:
+			if !ok {
+				result.Text = sb.String()
+				return result, nil
+			}
+			if chunk.err != nil {
+				c.counters.failures.Add(1)
+				return nil, fmt.Errorf("ストリームの受信中にエラーが発生しました: %w", chunk.err)
+			}
+			// 断片を受け取ったので、待ち時間の計測をやり直すのだ
+			if timer != nil {
+				timer.Reset(c.streamStallTimeout)
+			}
+
+			text, extractErr := extractTextFromResponse(chunk.resp)
+			if text != "" {
+				sb.WriteString(text)
+				if onChunk != nil {
+					if err := onChunk(text); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if extractErr != nil {
+				if IsBlocked(extractErr) {
+					c.counters.blocked.Add(1)
+				}
+				c.counters.failures.Add(1)
+				return nil, extractErr
+			}
+			result.RawResponse = chunk.resp
+			if id := extractRequestID(chunk.resp); id != "" {
+				result.RequestID = id
+			}
+			result.Images = append(result.Images, extractImages(chunk.resp)...)
+			if usage := extractUsage(chunk.resp); usage != nil {
+				result.Usage = usage
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package gemini
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genai"
+)
+
+const (
+	tracerName = "github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	spanName   = "gemini.GenerateContent"
+)
+
+// startSpan は ctx にトレース中のスパンがある場合に限り、その TracerProvider で子スパンを開始するのだ。
+// トレースが設定されていない場合は何もせず nil を返すので、オーバーヘッドはないのだ。
+// プロンプトの内容はスパンに記録せず、長さだけを記録するのだ。
+func startSpan(ctx context.Context, modelName string, contents []*genai.Content) (context.Context, trace.Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.SpanContext().IsValid() {
+		return ctx, nil
+	}
+
+	tracer := parent.TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, spanName, trace.WithAttributes(
+		attribute.String("gemini.model", modelName),
+		attribute.Int("gemini.prompt_length", promptLength(contents)),
+	))
+}
+
+// endSpan は試行回数やトークン使用量をスパンに記録して終了するのだ。span が nil の場合は何もしないのだ。
+func endSpan(span trace.Span, attempts int, resp *Response, err error) {
+	if span == nil {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("gemini.attempts", attempts))
+	if resp != nil && resp.RawResponse != nil && resp.RawResponse.UsageMetadata != nil {
+		usage := resp.RawResponse.UsageMetadata
+		span.SetAttributes(
+			attribute.Int("gemini.usage.prompt_tokens", int(usage.PromptTokenCount)),
+			attribute.Int("gemini.usage.candidates_tokens", int(usage.CandidatesTokenCount)),
+			attribute.Int("gemini.usage.total_tokens", int(usage.TotalTokenCount)),
+		)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+}
+
+// promptLength はリクエストに含まれるテキストの合計文字数（バイト数）を返すのだ。
+func promptLength(contents []*genai.Content) int {
+	n := 0
+	for _, content := range contents {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part != nil {
+				n += len(part.Text)
+			}
+		}
+	}
+	return n
+}
@@ -2,23 +2,58 @@ package gemini
 
 import (
 	"context"
+	"io"
+	"iter"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
 	"github.com/shouni/go-utils/retry"
+	"golang.org/x/time/rate"
 	"google.golang.org/genai"
 )
 
 const (
 	DefaultTemperature  float32 = 0.7
 	DefaultMaxRetries           = 3
-	DefaultInitialDelay         = 30 * time.Second
-	DefaultMaxDelay             = 120 * time.Second
+	DefaultInitialDelay         = 2 * time.Second
+	DefaultMaxDelay             = 60 * time.Second
 
 	DefaultTopP              float32 = 0.95
 	DefaultCandidateCount    int32   = 1
 	fileAPITransferThreshold         = 512 * 1024
-	filePollingInterval              = 2 * time.Second
-	filePollingTimeout               = 60 * time.Second
+
+	DefaultFilePollingInterval = 2 * time.Second
+	DefaultFilePollingTimeout  = 60 * time.Second
+
+	DefaultResumableUploadThreshold int64 = 8 * 1024 * 1024
+	maxUploadResumes                      = 3
+
+	// DefaultPingModel は Ping で疎通を確認するモデルなのだ。
+	DefaultPingModel = "gemini-2.5-flash"
+	// pingText は Ping でトークン数を数えさせる短いテキストなのだ。
+	pingText = "ping"
+
+	// maxStopSequences は Gemini API が受け付ける停止シーケンスの上限数なのだ。
+	maxStopSequences = 5
+
+	// readerInputMIMEType は GenerateContentFromReader でアップロードする入力の MIME タイプなのだ。
+	readerInputMIMEType = "text/plain"
+	// jsonMIMEType は GenerateJSON で応答形式として指定する MIME タイプなのだ。
+	jsonMIMEType = "application/json"
+
+	// maxEmptyResponseRetries は RetryEmptyResponses が有効なときに、空の応答を再試行する上限回数なのだ。
+	maxEmptyResponseRetries = 2
+	// emptyResponseNudge は空の応答を再試行するときにプロンプトの末尾へ付け加える指示なのだ。
+	emptyResponseNudge = "\n\n（必ずテキストで回答してください。）"
+	// DefaultMaxContinuations は AutoContinue が有効で MaxContinuations が 0 の場合に、続きを頼む上限回数なのだ。
+	DefaultMaxContinuations = 3
+	// continuationPrompt は AutoContinue で、打ち切られた応答の続きを頼むターンの指示なのだ。
+	continuationPrompt = "出力が途中で途切れました。途切れたところから、前置きや繰り返しをせずにそのまま続きを書いてください。"
+	// validationNudgeFormat は GenerateValidated で再生成するときにプロンプトの末尾へ付け加える指示なのだ。
+	// 検証エラーの内容を埋め込んで、モデルに何を直せばよいかを伝えるのだ。
+	validationNudgeFormat = "\n\n（前回の出力は次の理由で不適切でした: %v\n指摘を修正したうえで、出力全体をもう一度生成してください。）"
 )
 
 type GenerativeModel interface {
@@ -26,18 +61,250 @@ type GenerativeModel interface {
 	GenerateWithParts(ctx context.Context, modelName string, parts []*genai.Part, opts ImageOptions) (*Response, error)
 }
 
+// modelsService は Client が利用する genai.Models のメソッドを抽象化したものなのだ。
+// テストで API 呼び出しをスタブに差し替えるために使うのだ。
+type modelsService interface {
+	GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error)
+	CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error)
+	GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error]
+}
+
+// filesService は Client が利用する genai.Files のメソッドを抽象化したものなのだ。
+// modelsService と同じく、テストで File API の呼び出しをスタブに差し替えるために使うのだ。
+type filesService interface {
+	Upload(ctx context.Context, r io.Reader, config *genai.UploadFileConfig) (*genai.File, error)
+	Get(ctx context.Context, name string, config *genai.GetFileConfig) (*genai.File, error)
+	Delete(ctx context.Context, name string, config *genai.DeleteFileConfig) (*genai.DeleteFileResponse, error)
+}
+
+// Client は Gemini API のクライアントなのだ。
+// 設定は NewClient で確定し、以降は読み取り専用なので、1 つの Client を複数の goroutine から同時に使っても安全なのだ。
+// 統計カウンタはアトミックに更新し、リクエスト設定は呼び出しごとに新しく生成するのだ。
+// Use で追加するミドルウェアだけは後から変更できるので、ロックで保護しているのだ。
 type Client struct {
-	client      *genai.Client
+	client *genai.Client
+	models modelsService
+	files  filesService
+	// uploader は巨大なデータを resumable アップロードのセッションで送るのだ（files と同じ API キーを使うのだ）。
+	uploader    *resumableUploader
 	temperature float32
 	retryConfig retry.Config
+	// maxElapsedTime はバックオフを含めたリトライ全体の予算時間なのだ（0 なら無制限）。
+	maxElapsedTime time.Duration
+
+	filePollingInterval time.Duration
+	filePollingTimeout  time.Duration
+
+	resumableUploadThreshold int64
+	onUploadProgress         func(bytesSent, total int64)
+
+	enableSearchGrounding bool
+	stopSequences         []string
+
+	topP           *float32
+	seed           *int32
+	candidateCount int32
+	// maxOutputTokens は応答の出力トークン数の上限なのだ（0 なら API の既定値なのだ）。
+	maxOutputTokens int32
+	// candidateSelector は複数の候補から Response.Text にする候補を選ぶ関数なのだ（nil なら FirstNonBlocked なのだ）。
+	candidateSelector CandidateSelector
+	// rawConfig は NewClient で解析した RawConfigJSON なのだ（nil なら指定なしなのだ）。
+	// リクエストごとに cloneRawConfig で複製して使い、これ自体は書き換えないのだ。
+	rawConfig *genai.GenerateContentConfig
+	// systemInstruction はすべてのテキスト生成に付けるシステム指示なのだ（空なら付けないのだ）。
+	systemInstruction string
+	presencePenalty   *float32
+	frequencyPenalty  *float32
+	thinkingBudget    *int32
+	// responseModalities は応答に含める種類を大文字に揃えたものなのだ（空ならモデルの既定値なのだ）。
+	responseModalities []string
+
+	fallbackModels       []string
+	retryEmptyResponses  bool
+	returnPartialOnBlock bool
+	// autoContinue が true なら、MaxTokens で打ち切られた応答の続きを最大 maxContinuations 回まで頼むのだ。
+	autoContinue     bool
+	maxContinuations int
+
+	// limiter は RequestsPerMinute による呼び出し間隔の制御なのだ（nil なら制限しないのだ）。
+	limiter *rate.Limiter
+	// debugRequests が true なら、送信するリクエストの内容をデバッグログに出力するのだ。
+	debugRequests bool
+	// apiKeys はデバッグ出力から API キーを伏せ字にするためだけに保持するのだ。
+	apiKeys []string
+	// streamStallTimeout は GenerateContentStream で次の断片を待つ最大時間なのだ（0 なら打ち切らないのだ）。
+	streamStallTimeout time.Duration
+
+	counters clientCounters
+	metrics  *metricsCollector
+
+	// mu は Use で追加される middlewares を保護するのだ。
+	mu          sync.RWMutex
+	middlewares []Middleware
 }
 
 type Config struct {
-	APIKey       string
+	APIKey string
+	// APIKeys に複数の API キーを指定すると、キーごとに genai のクライアントを作り、KeyRotation に従ってリクエストごとにキーを使い分けるのだ。
+	// あるキーがレート制限 (429 / ResourceExhausted) を受けた場合は、同じ呼び出しの中で次のキーに切り替えて送り直すのだ。
+	// APIKey と両方指定した場合は、APIKey を先頭のキーとして扱うのだ。File API (アップロードとその削除) は先頭のキーだけを使うのだ。
+	APIKeys []string
+	// KeyRotation は APIKeys を使い分ける方法なのだ。空の場合は RoundRobin なのだ。
+	KeyRotation KeyRotation
+	// BaseURL を指定すると、API の接続先を差し替えるのだ（例: http://localhost:8080）。
+	// モックサーバーを使った結合テストや、リージョンごとのエンドポイントに使うのだ。空の場合は既定の接続先なのだ。
+	BaseURL      string
 	Temperature  *float32
 	MaxRetries   uint64
 	InitialDelay time.Duration
 	MaxDelay     time.Duration
+	// DisableRetries を true にすると、MaxRetries に関わらずリトライせず、一時的なエラーでも待たずにすぐ返すのだ。
+	// MaxRetries の 0 は DefaultMaxRetries を意味するので、リトライしたくない場合はこちらを使うのだ。
+	DisableRetries bool
+	// MaxElapsedTime はバックオフ待機を含めたリトライ全体の上限時間なのだ。
+	// 超えた場合は最後のエラーを ErrRetryBudgetExceeded でラップして返すのだ。0 なら MaxRetries のみで制御するのだ。
+	MaxElapsedTime time.Duration
+
+	// FilePollingInterval は File API のアップロード後、状態を確認する間隔なのだ。
+	FilePollingInterval time.Duration
+	// FilePollingTimeout は File API の処理完了を待つ最大時間なのだ。巨大な動画などは長めに設定するのだ。
+	FilePollingTimeout time.Duration
+
+	// ResumableUploadThreshold を超えるサイズのデータは、File API の resumable アップロードのセッションで送るのだ。
+	// 送信が途中で失敗した場合は、サーバーが受け取り済みのオフセットを問い合わせて、そこから続きを送るのだ。
+	ResumableUploadThreshold int64
+	// OnUploadProgress は File API へのアップロード進捗を通知するコールバックなのだ（任意）。
+	// resumable アップロードでは、サーバーが受け取りを確認したバイト数を通知するのだ。
+	OnUploadProgress func(bytesSent, total int64)
+
+	// EnableSearchGrounding を true にすると、Google 検索によるグラウンディングを有効にするのだ。
+	// 検索結果の出典は Response.Citations に格納されるのだ。対応していないモデルでは ErrSearchGroundingUnsupported を返すのだ。
+	EnableSearchGrounding bool
+
+	// StopSequences のいずれかが出力されると、そこで生成を打ち切るのだ（最大5個）。
+	StopSequences []string
+
+	// TopP は 0.0 から 1.0 の間で指定するのだ。nil の場合、テキスト生成では API の既定値、
+	// GenerateWithParts では DefaultTopP を使うのだ。
+	TopP *float32
+
+	// CandidateCount に 2 以上を指定すると、1 回のリクエストで複数の候補を生成し、Response.Candidates に格納するのだ。
+	// 0 の場合は API の既定値（1 つ）なのだ。GenerateWithParts では常に DefaultCandidateCount を使うのだ。
+	CandidateCount int32
+
+	// MaxOutputTokens を指定すると、応答の出力トークン数をこれ以下に制限するのだ。上限に達した応答は FinishReason が MAX_TOKENS になるのだ。
+	// 0 の場合は API (モデル) の既定値なのだ。
+	MaxOutputTokens int32
+
+	// CandidateSelector は、応答に複数の候補が含まれる場合に、Response.Text などに使う候補を選ぶ関数なのだ。
+	// 選んだ候補が先頭になるよう、Response.Candidates と RawResponse.Candidates を並べ替えるのだ。
+	// nil の場合は FirstNonBlocked（ブロックされていない最初の候補）なのだ。範囲外の番号を返した場合は先頭の候補を使うのだ。
+	CandidateSelector CandidateSelector
+
+	// Seed を固定すると、Temperature 0 と組み合わせて再現性のある出力を得やすくなるのだ。
+	// ImageOptions.Seed が指定された場合はそちらが優先されるのだ。
+	Seed *int32
+	// PresencePenalty と FrequencyPenalty は -2.0 以上 2.0 未満で指定するのだ。
+	PresencePenalty  *float32
+	FrequencyPenalty *float32
+
+	// PublishMetrics を true にすると、Stats の内容を expvar の "gemini_client" として公開するのだ。
+	PublishMetrics bool
+	// MetricsRegisterer を指定すると、モデル別のレイテンシと結果を Prometheus のメトリクスとして登録するのだ。
+	// nil の場合はメトリクスを収集しないのだ。
+	MetricsRegisterer prometheus.Registerer
+
+	// FallbackModels は、指定モデルでリトライしても一時的なエラー（過負荷など）が解消しない場合に、
+	// 順番に試す代替モデルなのだ。すべて失敗した場合は各モデルのエラーをまとめて返すのだ。
+	FallbackModels []string
+
+	// RetryEmptyResponses を true にすると、GenerateContent が空の応答を受け取った場合に、
+	// 回答を促す一文をプロンプトに付け加えて最大 2 回まで再試行するのだ。
+	// 安全フィルターなどによるブロックは再試行しないのだ。
+	RetryEmptyResponses bool
+
+	// RawConfigJSON は genai.GenerateContentConfig の JSON 表現（例: {"thinkingConfig":{"thinkingBudget":0}}）で、
+	// このライブラリがまだフィールドとして用意していないパラメータを指定するためのものなのだ。
+	// 構造化フィールドと重なった場合は構造化フィールドが優先されるのだ。不正な JSON や未知のフィールドは NewClient がエラーを返すのだ。
+	RawConfigJSON string
+
+	// ReturnPartialOnBlock を true にすると、MaxTokens や安全フィルターで生成が途中で打ち切られた場合に、
+	// それまでに生成されたテキストを含む Response と、ErrTruncated をラップしたエラーを両方返すのだ。
+	// false（既定）の場合は、これまでどおりエラーのみを返すのだ。
+	ReturnPartialOnBlock bool
+
+	// AutoContinue を true にすると、応答が出力トークンの上限 (FinishReason が MAX_TOKENS) で打ち切られた場合に、
+	// それまでの応答を会話の履歴にして続きを書くよう頼むターンを送り、自然に終わる (STOP) まで応答を連結するのだ。
+	// 続きを頼むのは MaxContinuations 回までで、使い切っても終わらなかった場合や、途中で失敗した場合は、
+	// 連結したテキストを含む Response と ErrTruncated をラップしたエラーを両方返すのだ。
+	// Response.Usage と Attempts はすべての呼び出しの合計になるのだ。GenerateContentStream には効かないのだ。
+	AutoContinue bool
+	// MaxContinuations は AutoContinue で続きを頼む上限回数なのだ。0 の場合は DefaultMaxContinuations なのだ。
+	MaxContinuations int
+
+	// RequestsPerMinute を指定すると、API を呼び出す前に待機して、1 分あたりのリクエスト数がこれを超えないように間隔を空けるのだ。
+	// リトライの指数バックオフとは別に、クォータに引っかかる前に先回りしてペースを落とすためのものなのだ。0 なら制限しないのだ。
+	RequestsPerMinute int
+
+	// StreamStallTimeout を指定すると、GenerateContentStream で応答の断片がこの時間内に届かない場合に、
+	// ストリームを打ち切って ErrStreamStalled を返すのだ。断片を受け取るたびに計測をやり直すのだ。
+	// 接続は開いたままなのに何も届かない状態で、対話的な処理が止まり続けるのを防ぐためのものなのだ。0 なら打ち切らないのだ。
+	StreamStallTimeout time.Duration
+
+	// SystemInstruction を指定すると、テキスト生成のリクエストにシステム指示として付けるのだ。
+	// GenerateTurns の system ロールのターンや ImageOptions.SystemPrompt が指定された場合は、そちらが優先されるのだ。
+	SystemInstruction string
+
+	// ThinkingBudget は思考に対応したモデル（gemini-2.5 系など）が応答の前に使う思考トークンの上限なのだ。
+	// 大きいほど品質が上がりやすい代わりに、応答までの時間が長くなるのだ。0 で思考を無効に、-1 でモデルに任せるのだ。
+	// nil の場合はモデルの既定値なのだ。対応していないモデルでは ErrThinkingBudgetUnsupported を返すのだ。
+	ThinkingBudget *int32
+
+	// ResponseModalities は、応答に含めてほしい種類 ("TEXT"、"IMAGE"、"AUDIO") なのだ。大文字と小文字は区別しないのだ。
+	// ["TEXT", "IMAGE"] を指定すると、対応したモデル (gemini-2.5-flash-image など) がテキストと画像を 1 つの応答で返し、
+	// Response.Text と Response.Images の両方に入るのだ。空の場合はモデルの既定値なのだ。
+	// 未知の値は NewClient がエラーを返し、対応していないモデルでは ErrResponseModalitiesUnsupported を返すのだ。
+	ResponseModalities []string
+
+	// DebugRequests を true にすると、API を呼び出す前に、送信するコンテンツと生成設定を JSON にして slog のデバッグレベルで出力するのだ。
+	// プロンプトがそのままログに残るので、調査のときだけ有効にするのだ。API キーは伏せ字にするのだ。
+	DebugRequests bool
+}
+
+// CandidateSelector は、応答の候補の一覧から使う候補の番号を返す関数なのだ。
+// 長さで選んだり、安全性の評価を見て避けたり、独自の採点で選んだりできるのだ。
+type CandidateSelector func(candidates []*genai.Candidate) int
+
+// FirstNonBlocked は、安全フィルターなどでブロックされていない最初の候補を選ぶ CandidateSelector なのだ。
+// すべての候補がブロックされている場合は先頭を選ぶので、そのブロックがエラーとして返るのだ。
+func FirstNonBlocked(candidates []*genai.Candidate) int {
+	for i, candidate := range candidates {
+		if candidate != nil && (candidate.FinishReason == genai.FinishReasonUnspecified || candidate.FinishReason == genai.FinishReasonStop) {
+			return i
+		}
+	}
+	return 0
+}
+
+// GenerateTurns で使用できるロールなのだ。
+const (
+	RoleUser   = "user"
+	RoleModel  = "model"
+	RoleSystem = "system"
+)
+
+// Turn は GenerateTurns に渡す会話の 1 ターンなのだ。
+// Role には RoleUser、RoleModel、RoleSystem のいずれかを指定するのだ。
+type Turn struct {
+	Role string
+	Text string
+}
+
+// FewShotExample は GenerateFewShot に渡す入力と出力の例なのだ。
+// Input を user のターン、Output を model のターンとして送るので、モデルは例と同じ形式で答えやすくなるのだ。
+type FewShotExample struct {
+	Input  string
+	Output string
 }
 
 type ImageOptions struct {
@@ -47,7 +314,20 @@ type ImageOptions struct {
 	SafetySettings []*genai.SafetySetting
 }
 
-type Response struct {
-	Text        string
-	RawResponse *genai.GenerateContentResponse
+// Response は ai.Response の別名なのだ。
+type Response = ai.Response
+
+// Citation は ai.Citation の別名なのだ。
+type Citation = ai.Citation
+
+// Image は ai.Image の別名なのだ。
+type Image = ai.Image
+
+// UploadedFile は File API にアップロード済みのファイルを表すのだ。
+type UploadedFile struct {
+	URI      string
+	Name     string
+	MIMEType string
+
+	client *Client
 }
@@ -2,39 +2,258 @@ package gemini
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
 	"google.golang.org/genai"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// ErrRetryBudgetExceeded は Config.MaxElapsedTime で指定したリトライの予算時間を超えたことを示すのだ。
+var ErrRetryBudgetExceeded = errors.New("リトライの予算時間を超えました")
+
+// ErrSearchGroundingUnsupported は、指定したモデルが Google 検索によるグラウンディングに対応していないことを示すのだ。
+var ErrSearchGroundingUnsupported = errors.New("このモデルは Google 検索によるグラウンディングに対応していない可能性があります")
+
+// ErrThinkingBudgetUnsupported は、指定したモデルが思考の予算（Config.ThinkingBudget）に対応していないことを示すのだ。
+var ErrThinkingBudgetUnsupported = errors.New("このモデルは思考の予算 (thinking budget) に対応していない可能性があります")
+
+// ErrResponseModalitiesUnsupported は、指定したモデルが Config.ResponseModalities の組み合わせに対応していないことを示すのだ。
+var ErrResponseModalitiesUnsupported = errors.New("このモデルは指定した応答の種類 (response modalities) の組み合わせに対応していない可能性があります")
+
+// ErrTruncated は ReturnPartialOnBlock が有効なときに、生成が途中で打ち切られ、部分的なテキストを返したことを示すのだ。
+var ErrTruncated = errors.New("生成が途中で打ち切られたため、部分的な応答を返しました")
+
+// ErrInvalidRawConfig は Config.RawConfigJSON が解析できなかったことを示すのだ。
+var ErrInvalidRawConfig = errors.New("RawConfigJSON の解析に失敗しました")
+
+// ErrInvalidJSON は GenerateJSON の応答が JSON として解釈できなかったことを示すのだ。
+var ErrInvalidJSON = errors.New("モデルの応答が有効な JSON ではありません")
+
+// ErrStreamStalled は GenerateContentStream で、Config.StreamStallTimeout の間に応答の断片が届かずストリームを打ち切ったことを示すのだ。
+var ErrStreamStalled = errors.New("ストリームが応答を返さなくなったため打ち切りました")
+
+// ErrValidationFailed は GenerateValidated で、試行回数の上限まで再生成しても応答が検証を通らなかったことを示すのだ。
+var ErrValidationFailed = errors.New("応答が検証を通りませんでした")
+
+// ErrNoImage は ExtractImage で、応答に画像のパートが含まれていなかったことを示すのだ。
+// 画像を生成できないモデルを指定した場合や、モデルがテキストだけで答えた場合に返るのだ。
+var ErrNoImage = errors.New("応答に画像が含まれていません")
+
+// ErrUnauthorized は Ping で、API キーが無効か、モデルを使う権限がないことを示すのだ。
+var ErrUnauthorized = errors.New("API キーが無効か、権限がありません")
+
+// ErrUnreachable は Ping で、ネットワークの障害やサービスの停止により Gemini API に接続できなかったことを示すのだ。
+var ErrUnreachable = errors.New("Gemini API に接続できません")
+
+// ErrQuotaExceeded は、1 日あたりなどの長い期間の利用上限 (クォータ) を使い切ったことを示すのだ。
+// 1 分あたりのレート制限とは違い、時間をおいてもすぐには解消しないので、リトライもフォールバックもしないのだ。
+var ErrQuotaExceeded = errors.New("API の利用上限 (クォータ) に達しました。Google AI Studio または Google Cloud コンソールで割り当てと請求の設定を確認してください")
+
+// RetriesExhaustedError は、リトライの回数または予算時間を使い切っても一時的なエラーが解消しなかったことを示すのだ。
+// 各試行のエラーを順番に保持するので、不安定な API の調査に使えるのだ。
+type RetriesExhaustedError struct {
+	// Attempts は API を呼び出した回数なのだ。
+	Attempts int
+	// Errors は各試行で発生したエラーなのだ（古い順）。
+	Errors []error
+	// Err は最終的なエラーなのだ。最後の試行のエラーをラップしているのだ。
+	Err error
+	// RequestID は最後の試行で API が返したリクエスト ID なのだ。返されなかった場合は空なのだ。
+	RequestID string
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%d 回試行しましたが失敗しました (リクエスト ID: %s): %v", e.Attempts, e.RequestID, e.Err)
+	}
+	return fmt.Sprintf("%d 回試行しましたが失敗しました: %v", e.Attempts, e.Err)
+}
+
+// Unwrap は最終的なエラーを返すので、errors.Is / errors.As で最後の試行のエラーを判定できるのだ。
+func (e *RetriesExhaustedError) Unwrap() error { return e.Err }
+
 // APIResponseError は生成ブロックや空レスポンスなど、通信成功後の論理的なエラーを示すのだ。
 type APIResponseError struct {
 	msg string
+	// finishReason はブロックされた場合の終了理由なのだ。空レスポンスの場合は空文字なのだ。
+	finishReason genai.FinishReason
+	// requestID は応答のリクエスト ID なのだ。返されなかった場合は空なのだ。
+	requestID string
 }
 
-func (e *APIResponseError) Error() string { return e.msg }
+func (e *APIResponseError) Error() string {
+	if e.requestID != "" {
+		return fmt.Sprintf("%s (リクエスト ID: %s)", e.msg, e.requestID)
+	}
+	return e.msg
+}
+
+// requestIDHeaders は、リクエスト ID として扱うレスポンスヘッダーなのだ。先に見つかったものを使うのだ。
+var requestIDHeaders = []string{"X-Request-Id", "X-Goog-Request-Id", "X-Cloud-Trace-Context"}
+
+// requestInfoType は、エラーの詳細 (google.rpc.RequestInfo) のうちリクエスト ID を含むものの型名なのだ。
+const requestInfoType = "type.googleapis.com/google.rpc.RequestInfo"
+
+// RequestIDFromError はエラーに含まれるリクエスト ID を返すのだ。見つからない場合は空文字を返すのだ。
+// RetriesExhaustedError、APIResponseError、エラーの詳細に RequestInfo を含む genai.APIError から取り出すのだ。
+func RequestIDFromError(err error) string {
+	var exhausted *RetriesExhaustedError
+	if errors.As(err, &exhausted) && exhausted.RequestID != "" {
+		return exhausted.RequestID
+	}
+	var respErr *APIResponseError
+	if errors.As(err, &respErr) && respErr.requestID != "" {
+		return respErr.requestID
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		for _, detail := range apiErr.Details {
+			if detail["@type"] != requestInfoType {
+				continue
+			}
+			if id, ok := detail["requestId"].(string); ok && id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// extractRequestID は応答からリクエスト ID を取り出すのだ。
+// 応答の responseId を優先し、なければレスポンスヘッダーを見るのだ。どちらもなければ空文字を返すのだ。
+func extractRequestID(resp *genai.GenerateContentResponse) string {
+	if resp == nil {
+		return ""
+	}
+	if resp.ResponseID != "" {
+		return resp.ResponseID
+	}
+	if resp.SDKHTTPResponse != nil {
+		for _, name := range requestIDHeaders {
+			if id := resp.SDKHTTPResponse.Headers.Get(name); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// IsBlocked はエラーが安全フィルターなどの FinishReason によるブロックを示すかどうかを判定するのだ。
+func IsBlocked(err error) bool {
+	var apiErr *APIResponseError
+	return errors.As(err, &apiErr) && apiErr.finishReason != ""
+}
+
+// isEmptyResponse は応答が空だったかどうかを判定するのだ。
+// 候補が返らなかった場合と、画像がなくテキストが空白のみだった場合を空とみなし、ブロックは含めないのだ。
+func isEmptyResponse(resp *Response, err error) bool {
+	if err != nil {
+		var apiErr *APIResponseError
+		return errors.As(err, &apiErr) && apiErr.finishReason == ""
+	}
+	return resp != nil && len(resp.Images) == 0 && strings.TrimSpace(resp.Text) == ""
+}
 
 // promptToContents は文字列を SDK が受け取れる Content 構造に変換します。
 func promptToContents(text string) []*genai.Content {
 	return []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: text}}}}
 }
 
-// shouldRetry は発生したエラーがリトライで解決可能かどうかを判定するのだ。
-func shouldRetry(err error) bool {
+// turnsToContents は Turn の一覧を会話の Content とシステム指示に変換するのだ。
+// 未知のロール、空のテキスト、会話のターンがない場合、最後のターンが user でない場合はエラーを返すのだ。
+func turnsToContents(turns []Turn) ([]*genai.Content, *genai.Content, error) {
+	var contents []*genai.Content
+	var systemInstruction *genai.Content
+
+	for i, turn := range turns {
+		if strings.TrimSpace(turn.Text) == "" {
+			return nil, nil, fmt.Errorf("ターン %d のテキストが空です", i+1)
+		}
+		part := &genai.Part{Text: turn.Text}
+
+		switch turn.Role {
+		case RoleSystem:
+			if systemInstruction == nil {
+				systemInstruction = &genai.Content{}
+			}
+			systemInstruction.Parts = append(systemInstruction.Parts, part)
+		case RoleUser, RoleModel:
+			contents = append(contents, &genai.Content{Role: turn.Role, Parts: []*genai.Part{part}})
+		default:
+			return nil, nil, fmt.Errorf("ターン %d のロール '%s' は使用できません (使用可能なロール: %s, %s, %s)", i+1, turn.Role, RoleUser, RoleModel, RoleSystem)
+		}
+	}
+
+	if len(contents) == 0 {
+		return nil, nil, errors.New("会話のターンがありません。user ロールのターンを1つ以上指定してください")
+	}
+	if last := contents[len(contents)-1]; last.Role != RoleUser {
+		return nil, nil, fmt.Errorf("最後のターンは %s ロールである必要があります (実際: %s)", RoleUser, last.Role)
+	}
+	return contents, systemInstruction, nil
+}
+
+// shouldRetryWithContext は、呼び出し元のコンテキストを考慮した判定関数を返すのだ。
+// 呼び出し元がキャンセル・期限切れなら何もリトライしないのだ。
+// 呼び出し元がまだ有効なのに context.DeadlineExceeded が返った場合は、HTTP クライアントなどの
+// 1 回分の試行のタイムアウトとみなしてリトライするのだ。
+func shouldRetryWithContext(ctx context.Context) func(error) bool {
+	return func(err error) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return true
+		}
+		return IsRetryable(err)
+	}
+}
+
+// IsRetryable は発生したエラーがリトライで解決可能かどうかを判定するのだ。
+// Client のリトライとフォールバックはすべてこの判定に従うのだ。
+// REST (genai.APIError) と gRPC のどちらのエラーでも、一時的な障害 (429 / 5xx 相当) のみ true を返すのだ。
+func IsRetryable(err error) bool {
 	// 規約違反（ブロック）などはリトライしても無駄なので即座に諦めるのだ
 	var apiErr *APIResponseError
 	if errors.As(err, &apiErr) {
 		return false
 	}
 
+	// 同じ 429 / ResourceExhausted でも、1 日分のクォータを使い切った場合は待っても解消しないのだ
+	if errors.Is(err, ErrQuotaExceeded) || isQuotaExceeded(err) {
+		return false
+	}
+
 	// キャンセルやタイムアウト（上位管理）もリトライ対象外なのだ
 	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 		return false
 	}
 
+	// REST の場合は HTTP ステータスコードで判定するのだ
+	var restErr genai.APIError
+	if errors.As(err, &restErr) {
+		switch restErr.Code {
+		case http.StatusTooManyRequests, // レート制限
+			http.StatusInternalServerError, // サーバー内部エラー
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable, // サーバーが一時的にダウンしている場合
+			http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
 	// gRPC のステータスコードを元に、一時的な障害のみリトライを許可するのだ
 	st, ok := status.FromError(err)
 	if !ok {
@@ -53,31 +272,348 @@ func shouldRetry(err error) bool {
 	}
 }
 
+// quotaFailureType は、エラーの詳細 (google.rpc.QuotaFailure) のうち、超過したクォータを示すものの型名なのだ。
+const quotaFailureType = "type.googleapis.com/google.rpc.QuotaFailure"
+
+// isQuotaExceeded は、レート制限のエラー (429 / ResourceExhausted) が、1 分あたりの制限ではなく
+// 1 日あたりのクォータの超過によるものかどうかを、エラーの詳細 (QuotaFailure) の違反から判定するのだ。
+// 詳細がない場合は、リトライで解消しうるレート制限とみなすのだ。
+func isQuotaExceeded(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Code != http.StatusTooManyRequests {
+			return false
+		}
+		for _, detail := range apiErr.Details {
+			if detail["@type"] != quotaFailureType {
+				continue
+			}
+			violations, _ := detail["violations"].([]any)
+			for _, v := range violations {
+				violation, _ := v.(map[string]any)
+				quotaID, _ := violation["quotaId"].(string)
+				quotaMetric, _ := violation["quotaMetric"].(string)
+				if isDailyQuota(quotaID) || isDailyQuota(quotaMetric) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return false
+	}
+	for _, detail := range st.Details() {
+		failure, ok := detail.(*errdetails.QuotaFailure)
+		if !ok {
+			continue
+		}
+		for _, violation := range failure.GetViolations() {
+			if isDailyQuota(violation.GetQuotaId()) || isDailyQuota(violation.GetQuotaMetric()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isDailyQuota は、クォータの ID や指標名 (例: GenerateRequestsPerDayPerProjectPerModel) が 1 日あたりの上限を示すかどうかを判定するのだ。
+func isDailyQuota(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "perday") || strings.Contains(name, "per_day") || strings.Contains(name, "daily")
+}
+
+// isInvalidArgument はエラーがリクエスト内容の不正（HTTP 400 / INVALID_ARGUMENT）を示すかどうかを判定するのだ。
+func isInvalidArgument(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusBadRequest || apiErr.Status == "INVALID_ARGUMENT"
+	}
+	return status.Code(err) == codes.InvalidArgument
+}
+
+// isAuthError はエラーが API キーの誤りや権限の不足を示すかどうかを判定するのだ。
+// Gemini API は無効な API キーを 401 / 403 ではなく 400 (理由 API_KEY_INVALID) で返すので、それも認証のエラーとみなすのだ。
+func isAuthError(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden {
+			return true
+		}
+		for _, detail := range apiErr.Details {
+			if detail["reason"] == "API_KEY_INVALID" {
+				return true
+			}
+		}
+		return apiErr.Code == http.StatusBadRequest && strings.Contains(strings.ToLower(apiErr.Message), "api key")
+	}
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return true
+	}
+	return false
+}
+
+// isNetworkError はエラーが接続の失敗 (名前解決、接続拒否、タイムアウトなど) やサービスの停止を示すかどうかを判定するのだ。
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return true
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusServiceUnavailable || apiErr.Code == http.StatusBadGateway || apiErr.Code == http.StatusGatewayTimeout
+	}
+	return status.Code(err) == codes.Unavailable
+}
+
+// validateBaseURL は Config.BaseURL が http または https のスキームとホストを持つ URL かどうかを検証するのだ。
+func validateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("BaseURL の形式が不正です: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("BaseURL は http:// または https:// で始まり、ホストを含む必要があります。入力値: %s", baseURL)
+	}
+	return nil
+}
+
+// mentionsThinking はエラーメッセージが思考の設定に触れているかどうかを判定するのだ。
+// 思考の予算と無関係な InvalidArgument を ErrThinkingBudgetUnsupported と取り違えないために使うのだ。
+func mentionsThinking(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "thinking")
+}
+
+// mentionsModalities はエラーメッセージが応答の種類 (modality) の設定に触れているかどうかを判定するのだ。
+// 思考の予算や検索グラウンディングと同時に指定された場合に、どの設定が原因の InvalidArgument かを見分けるために使うのだ。
+func mentionsModalities(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "modalit")
+}
+
+// normalizeResponseModalities は、応答の種類を大文字に揃え、API が受け付ける値かどうかを検証するのだ。
+func normalizeResponseModalities(modalities []string) ([]string, error) {
+	var normalized []string
+	for _, m := range modalities {
+		switch upper := genai.Modality(strings.ToUpper(strings.TrimSpace(m))); upper {
+		case genai.ModalityText, genai.ModalityImage, genai.ModalityAudio:
+			if !slices.Contains(normalized, string(upper)) {
+				normalized = append(normalized, string(upper))
+			}
+		default:
+			return nil, fmt.Errorf("ResponseModalities に未知の値が含まれています (利用可能な値: %s, %s, %s)。入力値: %s", genai.ModalityText, genai.ModalityImage, genai.ModalityAudio, m)
+		}
+	}
+	return normalized, nil
+}
+
 // extractTextFromResponse はレスポンスからテキストを安全に抽出し、異常な終了理由がないか確認するのだ。
+// ブロックされた場合も、それまでに生成されたテキストをエラーと一緒に返すのだ（使うかどうかは呼び出し側が決めるのだ）。
 func extractTextFromResponse(resp *genai.GenerateContentResponse) (string, error) {
 	if resp == nil || len(resp.Candidates) == 0 {
-		return "", &APIResponseError{msg: "Gemini APIから空のレスポンスが返されました"}
+		return "", &APIResponseError{msg: "Gemini APIから空のレスポンスが返されました", requestID: extractRequestID(resp)}
 	}
 
 	candidate := resp.Candidates[0]
+	text := candidateText(candidate)
 
 	// FinishReason が正常（指定なし or 停止）以外なら、安全フィルター等によるブロックとみなすのだ
 	if candidate.FinishReason != genai.FinishReasonUnspecified && candidate.FinishReason != genai.FinishReasonStop {
-		return "", &APIResponseError{msg: fmt.Sprintf("生成がブロックされました。理由: %v", candidate.FinishReason)}
+		return text, &APIResponseError{
+			msg:          fmt.Sprintf("生成がブロックされました。理由: %v", candidate.FinishReason),
+			finishReason: candidate.FinishReason,
+			requestID:    extractRequestID(resp),
+		}
+	}
+
+	// テキスト部分が含まれていない場合も正常として扱う（画像のみの応答などのケース）
+	return text, nil
+}
+
+// ExtractImage は GenerateWithParts などの応答から、最初の画像 (Response.Images の先頭) のデータと MIME タイプを取り出すのだ。
+// 画像がない場合は ErrNoImage を返すのだ。モデルが画像の代わりにテキストを返した場合は、そのテキストをエラーに添えるのだ。
+func ExtractImage(resp *Response) ([]byte, string, error) {
+	if resp == nil {
+		return nil, "", ErrNoImage
+	}
+	if len(resp.Images) > 0 {
+		return resp.Images[0].Data, resp.Images[0].MIMEType, nil
+	}
+	if text := strings.TrimSpace(resp.Text); text != "" {
+		return nil, "", fmt.Errorf("%w (モデルの応答: %s)", ErrNoImage, text)
 	}
+	return nil, "", ErrNoImage
+}
 
+// candidateText は候補のテキストパートをすべて連結して返すのだ。
+func candidateText(candidate *genai.Candidate) string {
 	// 画像生成の場合、Content自体が空でもエラーにせず続行させるのだ（画像データは別途取得可能なため）
 	if candidate.Content == nil || len(candidate.Content.Parts) == 0 {
-		return "", nil
+		return ""
 	}
 
-	// Partsの中から最初に見つかったテキストを返すのだ
+	// 応答が複数のテキストパートに分割されている場合があるので、すべて連結するのだ
+	// 関数呼び出しやインラインデータなど、テキスト以外のパートは読み飛ばすのだ
+	var sb strings.Builder
 	for _, part := range candidate.Content.Parts {
-		if part.Text != "" {
-			return part.Text, nil
+		if part == nil || part.Text == "" {
+			continue
 		}
+		sb.WriteString(part.Text)
 	}
+	return sb.String()
+}
 
-	// テキスト部分が含まれていない場合も正常として扱う（画像のみの応答などのケース）
-	return "", nil
+// parseRawConfig は Config.RawConfigJSON を genai.GenerateContentConfig に変換するのだ。
+// 空文字の場合は nil を返すのだ。綴りの誤りに気づけるよう、未知のフィールドはエラーにするのだ。
+func parseRawConfig(raw string) (*genai.GenerateContentConfig, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var config genai.GenerateContentConfig
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRawConfig, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: JSON オブジェクトの後に余分なデータがあります", ErrInvalidRawConfig)
+	}
+	return &config, nil
+}
+
+// cloneRawConfig は parseRawConfig で解析した設定を、入れ子のポインタも含めて複製するのだ。
+// JSON から解析した値なので、JSON を経由すればそのまま複製できるのだ。nil の場合は空の設定を返すのだ。
+func cloneRawConfig(config *genai.GenerateContentConfig) *genai.GenerateContentConfig {
+	clone := &genai.GenerateContentConfig{}
+	if config == nil {
+		return clone
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		// 解析できた値は必ず JSON に戻せるので、ここには来ないのだ
+		return clone
+	}
+	if err := json.Unmarshal(data, clone); err != nil {
+		return &genai.GenerateContentConfig{}
+	}
+	return clone
+}
+
+// extractCandidateTexts は複数の候補が返された場合に、各候補のテキストを順番に返すのだ。
+// 候補が 1 つ以下の場合は nil を返すのだ。
+func extractCandidateTexts(resp *genai.GenerateContentResponse) []string {
+	if resp == nil || len(resp.Candidates) < 2 {
+		return nil
+	}
+	texts := make([]string, 0, len(resp.Candidates))
+	for _, candidate := range resp.Candidates {
+		if candidate == nil {
+			texts = append(texts, "")
+			continue
+		}
+		texts = append(texts, candidateText(candidate))
+	}
+	return texts
+}
+
+// extractImages は最初の候補に含まれる画像のインラインデータのパートを、順番どおりに取り出すのだ。
+// テキストや関数呼び出しなど、画像以外のパートは読み飛ばすのだ。
+func extractImages(resp *genai.GenerateContentResponse) []Image {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0] == nil || resp.Candidates[0].Content == nil {
+		return nil
+	}
+	var images []Image
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if part == nil || part.InlineData == nil || len(part.InlineData.Data) == 0 || !strings.HasPrefix(part.InlineData.MIMEType, "image/") {
+			continue
+		}
+		images = append(images, Image{Data: part.InlineData.Data, MIMEType: part.InlineData.MIMEType})
+	}
+	return images
+}
+
+// extractUsage はレスポンスのトークン使用量を ai.Usage に変換するのだ。使用量が含まれていない場合は nil を返すのだ。
+func extractUsage(resp *genai.GenerateContentResponse) *ai.Usage {
+	if resp == nil || resp.UsageMetadata == nil {
+		return nil
+	}
+	return &ai.Usage{
+		PromptTokens:     resp.UsageMetadata.PromptTokenCount,
+		CompletionTokens: resp.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      resp.UsageMetadata.TotalTokenCount,
+	}
+}
+
+// extractCitations はレスポンスの引用メタデータとグラウンディングメタデータを Citation の一覧に変換するのだ。
+// 出典情報が含まれていない場合は nil を返すのだ。
+func extractCitations(resp *genai.GenerateContentResponse) []Citation {
+	if resp == nil || len(resp.Candidates) == 0 {
+		return nil
+	}
+
+	candidate := resp.Candidates[0]
+	var citations []Citation
+
+	if candidate.CitationMetadata != nil {
+		for _, c := range candidate.CitationMetadata.Citations {
+			if c == nil {
+				continue
+			}
+			citations = append(citations, Citation{
+				URI:        c.URI,
+				Title:      c.Title,
+				StartIndex: c.StartIndex,
+				EndIndex:   c.EndIndex,
+			})
+		}
+	}
+
+	// Google 検索グラウンディングの出典は、応答テキストの範囲 (GroundingSupports) と紐づけて変換するのだ
+	if gm := candidate.GroundingMetadata; gm != nil {
+		referenced := make(map[int32]bool)
+		for _, support := range gm.GroundingSupports {
+			if support == nil || support.Segment == nil {
+				continue
+			}
+			for _, idx := range support.GroundingChunkIndices {
+				web := groundingChunkWeb(gm.GroundingChunks, idx)
+				if web == nil {
+					continue
+				}
+				referenced[idx] = true
+				citations = append(citations, Citation{
+					URI:        web.URI,
+					Title:      web.Title,
+					StartIndex: support.Segment.StartIndex,
+					EndIndex:   support.Segment.EndIndex,
+				})
+			}
+		}
+		// 応答テキストと紐づかない出典も一覧には含めるのだ
+		for i := range gm.GroundingChunks {
+			if referenced[int32(i)] {
+				continue
+			}
+			if web := groundingChunkWeb(gm.GroundingChunks, int32(i)); web != nil {
+				citations = append(citations, Citation{URI: web.URI, Title: web.Title})
+			}
+		}
+	}
+
+	return citations
+}
+
+// groundingChunkWeb はインデックスが指す Web 出典を安全に取り出すのだ。
+func groundingChunkWeb(chunks []*genai.GroundingChunk, idx int32) *genai.GroundingChunkWeb {
+	if idx < 0 || int(idx) >= len(chunks) || chunks[idx] == nil {
+		return nil
+	}
+	return chunks[idx].Web
 }
@@ -0,0 +1,134 @@
+// Package ai は、特定のプロバイダに依存しない生成AIクライアントの共通インターフェースと型を定義するのだ。
+// 各プロバイダの実装 (pkg/ai/gemini など) はこのインターフェースを満たすのだ。
+package ai
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// Generator は、テキストプロンプトからコンテンツを生成するクライアントの共通インターフェースなのだ。
+type Generator interface {
+	GenerateContent(ctx context.Context, prompt string, modelName string) (*Response, error)
+	CountTokens(ctx context.Context, text string, modelName string) (int32, error)
+}
+
+// temperatureKey は呼び出し単位の温度をコンテキストに格納するためのキーなのだ。
+type temperatureKey struct{}
+
+// WithTemperature は、このコンテキストを使った生成の呼び出しだけ、クライアントに設定した温度を t に差し替えるのだ。
+// 対応するプロバイダ (pkg/ai/gemini, pkg/ai/openai) は TemperatureFromContext で読み取り、範囲外の値はエラーにするのだ。
+func WithTemperature(ctx context.Context, t float32) context.Context {
+	return context.WithValue(ctx, temperatureKey{}, t)
+}
+
+// TemperatureFromContext は WithTemperature で設定した温度を返すのだ。設定されていない場合は ok が false なのだ。
+func TemperatureFromContext(ctx context.Context) (t float32, ok bool) {
+	t, ok = ctx.Value(temperatureKey{}).(float32)
+	return t, ok
+}
+
+// GenerateOptions は、1 回の生成の呼び出しだけに適用する設定なのだ。WithGenerateOptions でコンテキストに付けて渡すのだ。
+// 指定しない場合は DefaultGenerateOptions の値が使われるのだ。ゼロ値がそのまま既定の設定になるようにしてあるのだ。
+type GenerateOptions struct {
+	// NonIdempotent が true の場合、その呼び出しはクライアントのリトライ設定に関係なくリトライせず、最初のエラーを返すのだ。
+	// フォールバックモデルへの切り替えや空の応答の再試行も行わないのだ。
+	// ツール呼び出しやファイルを書き換える操作など、2 回送られると副作用が重複する呼び出しで true にするのだ。
+	NonIdempotent bool
+}
+
+// DefaultGenerateOptions は、WithGenerateOptions で指定しなかった場合の設定を返すのだ (ゼロ値なので、リトライするのだ)。
+func DefaultGenerateOptions() GenerateOptions {
+	return GenerateOptions{}
+}
+
+// generateOptionsKey は呼び出し単位の GenerateOptions をコンテキストに格納するためのキーなのだ。
+type generateOptionsKey struct{}
+
+// WithGenerateOptions は、このコンテキストを使った生成の呼び出しだけに opts を適用するのだ。
+// 対応するプロバイダ (pkg/ai/gemini, pkg/ai/openai) は GenerateOptionsFromContext で読み取るのだ。
+func WithGenerateOptions(ctx context.Context, opts GenerateOptions) context.Context {
+	return context.WithValue(ctx, generateOptionsKey{}, opts)
+}
+
+// GenerateOptionsFromContext は WithGenerateOptions で設定した GenerateOptions を返すのだ。
+// 設定されていない場合は DefaultGenerateOptions を返すのだ。
+func GenerateOptionsFromContext(ctx context.Context) GenerateOptions {
+	if opts, ok := ctx.Value(generateOptionsKey{}).(GenerateOptions); ok {
+		return opts
+	}
+	return DefaultGenerateOptions()
+}
+
+// RetryFunc は、一時的なエラーのためにリトライするときに、その試行を始める直前に呼ばれる関数なのだ。
+// attempt はこれから行う試行の番号 (2 以上)、err は直前の試行のエラーなのだ。
+type RetryFunc func(attempt int, err error)
+
+// onRetryKey は呼び出し単位の RetryFunc をコンテキストに格納するためのキーなのだ。
+type onRetryKey struct{}
+
+// WithOnRetry は、このコンテキストを使った生成の呼び出しでリトライするたびに fn を呼ぶようにするのだ。
+// 進行状況の表示など、リトライを利用者に知らせるのに使うのだ。fn は API を呼び出す goroutine から呼ばれるのだ。
+// 対応するプロバイダ (pkg/ai/gemini, pkg/ai/openai) は OnRetryFromContext で読み取るのだ。
+func WithOnRetry(ctx context.Context, fn RetryFunc) context.Context {
+	return context.WithValue(ctx, onRetryKey{}, fn)
+}
+
+// OnRetryFromContext は WithOnRetry で設定した RetryFunc を返すのだ。設定されていない場合は nil なのだ。
+func OnRetryFromContext(ctx context.Context) RetryFunc {
+	fn, _ := ctx.Value(onRetryKey{}).(RetryFunc)
+	return fn
+}
+
+// Response は生成結果なのだ。
+type Response struct {
+	Text string
+	// Candidates は複数の候補を要求した場合の、すべての候補のテキストなのだ。先頭は Text と同じなのだ。
+	// 候補が 1 つだけの場合は nil なのだ。
+	Candidates []string
+	// RawResponse は Gemini API の生の応答なのだ。Gemini 以外のプロバイダでは nil なのだ。
+	RawResponse *genai.GenerateContentResponse
+	// Citations はモデルが引用した出典の一覧なのだ。出典情報がない場合は nil なのだ。
+	Citations []Citation
+	// Images はモデルが応答に含めた画像 (インラインデータのパート) を、応答に現れた順に並べたものなのだ。
+	// テキストは Text に入り、画像だけがここに入るのだ。画像がない場合は nil なのだ。
+	Images []Image
+	// ModelName は実際に応答したモデル名なのだ。フォールバックした場合は代替モデル名になるのだ。
+	ModelName string
+	// Usage はトークン使用量なのだ。プロバイダが使用量を返さない場合は nil なのだ。
+	Usage *Usage
+	// Elapsed はプロンプトの構築から応答の受信までにかかった時間なのだ。
+	// プロバイダの実装は設定せず、Runner などの呼び出し側が記録するのだ。
+	Elapsed time.Duration
+	// Attempts はこの応答を得るまでに API を呼び出した回数 (リトライを含む) なのだ。
+	// フォールバックした場合は、応答したモデルへの呼び出し回数なのだ。0 は記録されていないことを示すのだ。
+	Attempts int
+	// RequestID は API が返したリクエスト ID (Gemini では応答の responseId、またはレスポンスヘッダーのリクエスト ID) なのだ。
+	// サポートへの問い合わせで API 側の記録を特定するのに使うのだ。返されなかった場合や Gemini 以外のプロバイダでは空なのだ。
+	RequestID string
+}
+
+// Usage はリクエストのトークン使用量なのだ。
+type Usage struct {
+	PromptTokens     int32
+	CompletionTokens int32
+	TotalTokens      int32
+}
+
+// Image は応答に含まれていた 1 枚の画像なのだ。
+type Image struct {
+	Data []byte
+	// MIMEType は image/png などの画像の形式なのだ。
+	MIMEType string
+}
+
+// Citation は応答の一部がどの出典に基づくかを示すのだ。
+// StartIndex と EndIndex は応答テキスト内の範囲を表すのだ。
+type Citation struct {
+	URI        string
+	Title      string
+	StartIndex int32
+	EndIndex   int32
+}
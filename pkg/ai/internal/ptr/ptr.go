@@ -0,0 +1,11 @@
+// Package ptr は、プロバイダの実装 (pkg/ai/gemini、pkg/ai/openai) が共有するポインタの補助関数なのだ。
+package ptr
+
+// Clone はポインタの指す値を複製した新しいポインタを返すのだ。nil の場合は nil を返すのだ。
+func Clone[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,261 @@
+// Package openai は、OpenAI 互換の chat completions API を使う ai.Generator の実装なのだ。
+// OpenAI 本家のほか、Ollama などのローカル LLM サーバーも BaseURL を変えるだけで利用できるのだ。
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/ai/internal/ptr"
+	"github.com/shouni/go-utils/retry"
+)
+
+var _ ai.Generator = (*Client)(nil)
+
+// ErrCountTokensUnsupported は、chat completions API にトークン数を数える手段がないことを示すのだ。
+var ErrCountTokensUnsupported = errors.New("OpenAI 互換 API ではトークン数の取得に対応していません")
+
+// HTTPError は API が 2xx 以外のステータスを返したことを示すのだ。
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("OpenAI API がエラーを返しました (status %d): %s", e.StatusCode, e.Body)
+}
+
+// APIResponseError は生成の打ち切りや空レスポンスなど、通信成功後の論理的なエラーを示すのだ。
+type APIResponseError struct {
+	msg string
+	// finishReason は生成が打ち切られた場合の終了理由なのだ。空レスポンスの場合は空文字なのだ。
+	finishReason string
+}
+
+func (e *APIResponseError) Error() string { return e.msg }
+
+// IsBlocked はエラーがコンテンツフィルターなどの finish_reason による打ち切りを示すかどうかを判定するのだ。
+func IsBlocked(err error) bool {
+	var apiErr *APIResponseError
+	return errors.As(err, &apiErr) && apiErr.finishReason != ""
+}
+
+// NewClient は設定を基に新しい OpenAI 互換クライアントを生成するのだ。
+func NewClient(cfg Config) (*Client, error) {
+	baseURL := DefaultBaseURL
+	if cfg.BaseURL != "" {
+		baseURL = strings.TrimRight(cfg.BaseURL, "/")
+	}
+	if cfg.APIKey == "" && baseURL == DefaultBaseURL {
+		return nil, fmt.Errorf("APIキーは必須です。設定を確認してください")
+	}
+
+	temp := DefaultTemperature
+	if cfg.Temperature != nil {
+		if *cfg.Temperature < 0.0 || *cfg.Temperature > 2.0 {
+			return nil, fmt.Errorf("温度設定は0.0から2.0の間である必要があります。入力値: %f", *cfg.Temperature)
+		}
+		temp = *cfg.Temperature
+	}
+
+	if cfg.TopP != nil && (*cfg.TopP < 0.0 || *cfg.TopP > 1.0) {
+		return nil, fmt.Errorf("TopP は0.0から1.0の間である必要があります。入力値: %f", *cfg.TopP)
+	}
+
+	retryCfg := retry.DefaultConfig()
+	retryCfg.MaxRetries = DefaultMaxRetries
+	if cfg.DisableRetries {
+		retryCfg.MaxRetries = 0
+	} else if cfg.MaxRetries > 0 {
+		retryCfg.MaxRetries = cfg.MaxRetries
+	}
+	retryCfg.InitialInterval = DefaultInitialDelay
+	if cfg.InitialDelay > 0 {
+		retryCfg.InitialInterval = cfg.InitialDelay
+	}
+	retryCfg.MaxInterval = DefaultMaxDelay
+	if cfg.MaxDelay > 0 {
+		retryCfg.MaxInterval = cfg.MaxDelay
+	}
+	if retryCfg.InitialInterval > retryCfg.MaxInterval {
+		return nil, fmt.Errorf("リトライの初期待機時間 (%v) は最大待機時間 (%v) 以下である必要があります", retryCfg.InitialInterval, retryCfg.MaxInterval)
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		httpClient:  httpClient,
+		apiKey:      cfg.APIKey,
+		baseURL:     baseURL,
+		temperature: temp,
+		topP:        ptr.Clone(cfg.TopP),
+		retryConfig: retryCfg,
+
+		systemInstruction: cfg.SystemInstruction,
+	}, nil
+}
+
+// NewClientFromEnv は環境変数 OPENAI_API_KEY と OPENAI_BASE_URL から設定を読み取って初期化するのだ。
+func NewClientFromEnv() (*Client, error) {
+	return NewClientFromEnvWithConfig(Config{})
+}
+
+// NewClientFromEnvWithConfig は APIキーとベース URL だけを環境変数から読み取り、残りの設定は cfg を使って初期化するのだ。
+func NewClientFromEnvWithConfig(cfg Config) (*Client, error) {
+	cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
+	if cfg.APIKey == "" && cfg.BaseURL == "" {
+		return nil, fmt.Errorf("環境変数 OPENAI_API_KEY または OPENAI_BASE_URL が設定されていません")
+	}
+	return NewClient(cfg)
+}
+
+// GenerateContent は純粋なテキストプロンプトからコンテンツを生成するのだ。
+func (c *Client) GenerateContent(ctx context.Context, prompt string, modelName string) (*ai.Response, error) {
+	if prompt == "" {
+		return nil, errors.New("プロンプトが空です。入力を確認してください")
+	}
+
+	// ai.WithTemperature で温度が指定されていれば、この呼び出しだけ差し替えるのだ
+	temp := c.temperature
+	if t, ok := ai.TemperatureFromContext(ctx); ok {
+		if t < 0.0 || t > 2.0 {
+			return nil, fmt.Errorf("温度設定は0.0から2.0の間である必要があります。入力値: %f", t)
+		}
+		temp = t
+	}
+
+	var messages []chatMessage
+	if c.systemInstruction != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: c.systemInstruction})
+	}
+	messages = append(messages, chatMessage{Role: "user", Content: prompt})
+
+	body, err := json.Marshal(chatRequest{
+		Model:       modelName,
+		Messages:    messages,
+		Temperature: temp,
+		TopP:        c.topP,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの組み立てに失敗しました: %w", err)
+	}
+
+	var finalResp *ai.Response
+	var attempts int
+	var lastErr error
+	onRetry := ai.OnRetryFromContext(ctx)
+	op := func() error {
+		attempts++
+		if attempts > 1 && onRetry != nil {
+			onRetry(attempts, lastErr)
+		}
+		resp, err := c.doChatRequest(ctx, body)
+		if err == nil {
+			finalResp, err = toResponse(resp, modelName)
+		}
+		lastErr = err
+		return err
+	}
+
+	// ai.GenerateOptions で冪等でないと指定された呼び出しは、リトライせずに最初のエラーを返すのだ
+	shouldRetry := IsRetryable
+	if ai.GenerateOptionsFromContext(ctx).NonIdempotent {
+		shouldRetry = func(error) bool { return false }
+	}
+	err = retry.Do(ctx, c.retryConfig, fmt.Sprintf("OpenAI API call to %s", modelName), op, shouldRetry)
+	if err != nil {
+		return nil, err
+	}
+	finalResp.Attempts = attempts
+	return finalResp, nil
+}
+
+// CountTokens は chat completions API ではトークン数を数えられないため、常に ErrCountTokensUnsupported を返すのだ。
+func (c *Client) CountTokens(ctx context.Context, text string, modelName string) (int32, error) {
+	return 0, ErrCountTokensUnsupported
+}
+
+// doChatRequest は chat completions API を1回呼び出すのだ。
+func (c *Client) doChatRequest(ctx context.Context, body []byte) (*chatResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+chatCompletionsPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("レスポンスの読み込みに失敗しました: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var chatResp chatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析に失敗しました: %w", err)
+	}
+	return &chatResp, nil
+}
+
+// toResponse は chat completions のレスポンスを ai.Response に変換するのだ。
+func toResponse(resp *chatResponse, requestedModel string) (*ai.Response, error) {
+	if len(resp.Choices) == 0 {
+		return nil, &APIResponseError{msg: "OpenAI APIから空のレスポンスが返されました"}
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "" && choice.FinishReason != "stop" {
+		return nil, &APIResponseError{
+			msg:          fmt.Sprintf("生成が中断されました。理由: %s", choice.FinishReason),
+			finishReason: choice.FinishReason,
+		}
+	}
+
+	modelName := resp.Model
+	if modelName == "" {
+		modelName = requestedModel
+	}
+	result := &ai.Response{Text: choice.Message.Content, ModelName: modelName}
+	if resp.Usage != nil {
+		result.Usage = &ai.Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		}
+	}
+	return result, nil
+}
+
+// IsRetryable は発生したエラーがリトライで解決可能かどうかを判定するのだ。
+// レート制限 (429) とサーバーエラー (5xx) のみリトライするのだ。
+func IsRetryable(err error) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,249 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+)
+
+// newTestClient は httptest サーバーに向けた、リトライ待ち時間の短いテスト用クライアントを生成します。
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(Config{
+		APIKey:       "test-key",
+		BaseURL:      srv.URL,
+		MaxRetries:   3,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("FAIL: クライアントの生成に失敗しました: %v", err)
+	}
+	return c
+}
+
+func TestNewClient_InvalidAPIKey(t *testing.T) {
+	_, err := NewClient(Config{})
+	if err == nil || !strings.Contains(err.Error(), "APIキーは必須です") {
+		t.Errorf("FAIL: 既定の BaseURL で APIキーが空の場合はエラーになるべきです (got: %v)", err)
+	}
+
+	if _, err := NewClient(Config{BaseURL: "http://localhost:11434/v1"}); err != nil {
+		t.Errorf("FAIL: BaseURL を指定した場合は APIキーが空でも生成できるべきです (got: %v)", err)
+	}
+}
+
+func TestClient_GenerateContent_TopP(t *testing.T) {
+	var body map[string]any
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	t.Cleanup(srv.Close)
+
+	topP := float32(0.5)
+	c, err := NewClient(Config{BaseURL: srv.URL, TopP: &topP})
+	if err != nil {
+		t.Fatalf("FAIL: クライアントの生成に失敗しました: %v", err)
+	}
+	if _, err := c.GenerateContent(context.Background(), "hi", "m"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if body["top_p"] != 0.5 {
+		t.Errorf("FAIL: top_p がリクエストに設定されていません: %v", body["top_p"])
+	}
+
+	// 未指定の場合は top_p を送らず、サーバーの既定値に任せます
+	if _, err := newTestClient(t, handler).GenerateContent(context.Background(), "hi", "m"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if _, ok := body["top_p"]; ok {
+		t.Errorf("FAIL: TopP 未指定時は top_p を送らないこと: %v", body["top_p"])
+	}
+
+	invalid := float32(1.5)
+	if _, err := NewClient(Config{BaseURL: srv.URL, TopP: &invalid}); err == nil {
+		t.Error("FAIL: 範囲外の TopP はエラーになるべきです")
+	}
+}
+
+func TestClient_GenerateContent(t *testing.T) {
+	var got chatRequest
+	var auth string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != chatCompletionsPath {
+			t.Errorf("FAIL: 予期しないパスです: %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"model":"gpt-4o-mini-2024-07-18","choices":[{"message":{"role":"assistant","content":"こんにちは"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`))
+	})
+
+	resp, err := c.GenerateContent(context.Background(), "hi", "gpt-4o-mini")
+	if err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+	if resp.Text != "こんにちは" {
+		t.Errorf("FAIL: Text = %q, want %q", resp.Text, "こんにちは")
+	}
+	if resp.ModelName != "gpt-4o-mini-2024-07-18" {
+		t.Errorf("FAIL: ModelName = %q", resp.ModelName)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 8 {
+		t.Errorf("FAIL: Usage が不正です: %+v", resp.Usage)
+	}
+	if auth != "Bearer test-key" {
+		t.Errorf("FAIL: Authorization ヘッダーが不正です: %q", auth)
+	}
+	if got.Model != "gpt-4o-mini" || len(got.Messages) != 1 || got.Messages[0].Content != "hi" {
+		t.Errorf("FAIL: リクエストボディが不正です: %+v", got)
+	}
+}
+
+func TestClient_GenerateContent_DisableRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	// 待機時間を長くしておき、リトライせずにすぐ返ることを確かめます
+	c, err := NewClient(Config{BaseURL: srv.URL, MaxRetries: 5, InitialDelay: time.Minute, MaxDelay: time.Minute, DisableRetries: true})
+	if err != nil {
+		t.Fatalf("FAIL: クライアントの生成に失敗しました: %v", err)
+	}
+	start := time.Now()
+	if _, err := c.GenerateContent(context.Background(), "hi", "m"); err == nil {
+		t.Fatal("FAIL: エラーが返されるべきです")
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("FAIL: リトライせずに 1 回だけ送信すべきです (hits: %d)", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("FAIL: バックオフを待たずにすぐ返すべきです (elapsed: %v)", elapsed)
+	}
+}
+
+func TestClient_GenerateContent_SystemInstruction(t *testing.T) {
+	var got chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(Config{BaseURL: srv.URL, SystemInstruction: "簡潔に答えてください"})
+	if err != nil {
+		t.Fatalf("FAIL: クライアントの生成に失敗しました: %v", err)
+	}
+	if _, err := c.GenerateContent(context.Background(), "hi", "m"); err != nil {
+		t.Fatalf("FAIL: 予期しないエラー: %v", err)
+	}
+
+	// system メッセージはユーザーのメッセージより前に送ります
+	want := []chatMessage{{Role: "system", Content: "簡潔に答えてください"}, {Role: "user", Content: "hi"}}
+	if !slices.Equal(got.Messages, want) {
+		t.Errorf("FAIL: Messages = %+v, want %+v", got.Messages, want)
+	}
+}
+
+func TestClient_GenerateContent_Retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int32
+	}{
+		{"レート制限 (429) はリトライする", http.StatusTooManyRequests, 3},
+		{"サーバーエラー (503) はリトライする", http.StatusServiceUnavailable, 3},
+		{"認証エラー (401) はリトライしない", http.StatusUnauthorized, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				// 最後の呼び出しだけ成功させ、リトライ後に結果が返ることを確認します
+				if calls.Add(1) < 3 {
+					http.Error(w, "error", tt.status)
+					return
+				}
+				_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+			})
+
+			resp, err := c.GenerateContent(context.Background(), "hi", "gpt-4o-mini")
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("FAIL: 呼び出し回数 = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+
+			var httpErr *HTTPError
+			if tt.wantCalls == 1 && !errors.As(err, &httpErr) {
+				t.Errorf("FAIL: HTTPError が返されるべきです (got: %v)", err)
+			}
+			if tt.wantCalls > 1 && err != nil {
+				t.Errorf("FAIL: リトライ後は成功するべきです (got: %v)", err)
+			}
+			if tt.wantCalls > 1 && err == nil && resp.Attempts != int(tt.wantCalls) {
+				t.Errorf("FAIL: Attempts = %d, want %d", resp.Attempts, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClient_GenerateContent_NonIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "error", http.StatusServiceUnavailable)
+	})
+
+	// 冪等でないと指定した呼び出しは、リトライ可能なエラーでも 1 回で諦めます
+	ctx := ai.WithGenerateOptions(context.Background(), ai.GenerateOptions{NonIdempotent: true})
+	_, err := c.GenerateContent(ctx, "hi", "gpt-4o-mini")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("FAIL: 最初の HTTPError が返されるべきです (got: %v)", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("FAIL: 呼び出し回数 = %d, want 1", calls.Load())
+	}
+}
+
+func TestClient_GenerateContent_FinishReason(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":""},"finish_reason":"content_filter"}]}`))
+	})
+
+	_, err := c.GenerateContent(context.Background(), "hi", "gpt-4o-mini")
+	var apiErr *APIResponseError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("FAIL: APIResponseError が返されるべきです (got: %v)", err)
+	}
+	if !IsBlocked(err) {
+		t.Errorf("FAIL: IsBlocked が true になるべきです")
+	}
+	if !strings.Contains(err.Error(), "content_filter") {
+		t.Errorf("FAIL: エラーに終了理由が含まれるべきです: %v", err)
+	}
+}
+
+func TestClient_CountTokens_Unsupported(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {})
+	if _, err := c.CountTokens(context.Background(), "hi", "gpt-4o-mini"); !errors.Is(err, ErrCountTokensUnsupported) {
+		t.Errorf("FAIL: ErrCountTokensUnsupported が返されるべきです (got: %v)", err)
+	}
+}
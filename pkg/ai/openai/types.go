@@ -0,0 +1,79 @@
+package openai
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/shouni/go-utils/retry"
+)
+
+const (
+	DefaultBaseURL              = "https://api.openai.com/v1"
+	DefaultTemperature  float32 = 0.7
+	DefaultMaxRetries           = 3
+	DefaultInitialDelay         = 2 * time.Second
+	DefaultMaxDelay             = 60 * time.Second
+
+	chatCompletionsPath = "/chat/completions"
+)
+
+// Client は OpenAI 互換 API のクライアントなのだ。
+// 設定は NewClient で確定して以降変更しないため、複数の goroutine から同時に使っても安全なのだ。
+type Client struct {
+	httpClient  *http.Client
+	apiKey      string
+	baseURL     string
+	temperature float32
+	topP        *float32
+	retryConfig retry.Config
+	// systemInstruction は各リクエストの先頭に付ける system メッセージなのだ（空なら付けないのだ）。
+	systemInstruction string
+}
+
+type Config struct {
+	// APIKey はローカルの LLM サーバー (Ollama など) を使う場合は空でもよいのだ。
+	APIKey string
+	// BaseURL は OpenAI 互換 API のベース URL なのだ (例: http://localhost:11434/v1)。
+	BaseURL     string
+	Temperature *float32
+	// TopP は 0.0 から 1.0 の間で指定するのだ。nil の場合はサーバーの既定値に任せるのだ。
+	TopP         *float32
+	MaxRetries   uint64
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// DisableRetries を true にすると、MaxRetries に関わらずリトライせず、一時的なエラーでも待たずにすぐ返すのだ。
+	// MaxRetries の 0 は DefaultMaxRetries を意味するので、リトライしたくない場合はこちらを使うのだ。
+	DisableRetries bool
+	// HTTPClient を指定しない場合は http.DefaultClient を使うのだ。
+	HTTPClient *http.Client
+	// SystemInstruction を指定すると、各リクエストの先頭に system メッセージとして付けるのだ。
+	SystemInstruction string
+}
+
+// chatMessage は chat completions API のメッセージなのだ。
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest は chat completions API のリクエストボディなのだ。
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float32       `json:"temperature"`
+	TopP        *float32      `json:"top_p,omitempty"`
+}
+
+// chatResponse は chat completions API のレスポンスボディのうち、利用するフィールドなのだ。
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int32 `json:"prompt_tokens"`
+		CompletionTokens int32 `json:"completion_tokens"`
+		TotalTokens      int32 `json:"total_tokens"`
+	} `json:"usage"`
+}
@@ -0,0 +1,51 @@
+package ai
+
+import "unicode"
+
+// EstimateTokens は、API を呼ばずにテキストのトークン数をおおまかに見積もるのだ。
+// CountTokens を呼べないプロバイダやオフラインでの試行、呼び出しを省きたい場面で、API による数の代わりに使うのだ。
+// あくまで目安で、実際のトークン数とは 2〜3 割程度ずれることがあるのだ。
+//
+// 見積もりはトークナイザーのおおよその傾向に合わせた次の規則なのだ。
+//   - ASCII の英字の並び (単語) は 6 文字でおよそ 1 トークン (最低 1 トークン) として数えるのだ。よく使う単語は 1 トークンになりやすいので、
+//     空白や記号を含めたテキスト全体ではおおむね 4 文字で 1 トークンになるのだ。
+//   - 数字と記号は 1 文字ごとに 1 トークンとして数えるのだ。
+//   - 日本語などの ASCII 以外の文字は 1 文字ごとに 1 トークンとして数えるのだ (実際はこれより少ないことが多いので、多めの見積もりになるのだ)。
+//   - 単語の間の 1 つの空白は前後のトークンに含まれるものとして数えず、改行と、インデントなどの 2 つ以上続く空白は 1 トークンとして数えるのだ。
+func EstimateTokens(text string) int {
+	tokens, word, spaces := 0, 0, 0
+	flushWord := func() {
+		if word > 0 {
+			tokens += max(1, (word+3)/6)
+			word = 0
+		}
+	}
+	flushSpaces := func() {
+		if spaces > 1 {
+			tokens++
+		}
+		spaces = 0
+	}
+
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			flushSpaces()
+			word++
+		case r == '\n':
+			flushWord()
+			flushSpaces()
+			tokens++
+		case unicode.IsSpace(r):
+			flushWord()
+			spaces++
+		default:
+			flushWord()
+			flushSpaces()
+			tokens++
+		}
+	}
+	flushWord()
+	flushSpaces()
+	return tokens
+}
@@ -0,0 +1,49 @@
+package ai
+
+import "testing"
+
+func TestEstimateTokens(t *testing.T) {
+	// known は、Gemini のトークナイザー (SentencePiece) で数えたおよそのトークン数なのだ。
+	// 英語は known の ±tolerance に収まること、日本語は少なく見積もらず (多めの見積もり)、known の 2 倍以内であることを確認するのだ。
+	tests := []struct {
+		name      string
+		text      string
+		known     int
+		tolerance float64
+		overOnly  bool
+	}{
+		{name: "空", text: "", known: 0},
+		{name: "挨拶", text: "Hello, world!", known: 4, tolerance: 0.25},
+		{name: "英文", text: "The quick brown fox jumps over the lazy dog.", known: 10, tolerance: 0.25},
+		{
+			name:      "英語の段落",
+			text:      "Large language models process text as tokens. A token is often a word or part of a word,\nso longer words may be split into several tokens.",
+			known:     30,
+			tolerance: 0.25,
+		},
+		{name: "日本語", text: "吾輩は猫である。名前はまだ無い。", known: 10, overOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateTokens(tt.text)
+			if tt.overOnly {
+				if got < tt.known || got > tt.known*2 {
+					t.Errorf("FAIL: EstimateTokens(%q) = %d, want %d 以上 %d 以下", tt.text, got, tt.known, tt.known*2)
+				}
+				return
+			}
+			diff := float64(got - tt.known)
+			if diff < -float64(tt.known)*tt.tolerance || diff > float64(tt.known)*tt.tolerance {
+				t.Errorf("FAIL: EstimateTokens(%q) = %d, want %d ±%.0f%%", tt.text, got, tt.known, tt.tolerance*100)
+			}
+		})
+	}
+
+	t.Run("インデントと改行を数える", func(t *testing.T) {
+		// 改行 2 つと、2 つ以上続く空白 2 か所がそれぞれ 1 トークンになるのだ
+		if got, want := EstimateTokens("a\n    b\n    c"), 7; got != want {
+			t.Errorf("FAIL: EstimateTokens() = %d, want %d", got, want)
+		}
+	})
+}
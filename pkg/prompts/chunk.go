@@ -0,0 +1,56 @@
+package prompts
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SplitIntoChunks は、テキストを maxRunes 文字 (rune 数) 以下のチャンクに分割します。
+// 段落 (空行区切り) の境界で分割し、1 つの段落が maxRunes を超える場合のみ段落の途中で分割します。
+// maxRunes が 0 以下の場合や、テキスト全体が maxRunes 以下の場合は、テキスト全体を 1 つのチャンクとして返します。
+func SplitIntoChunks(text string, maxRunes int) []string {
+	if maxRunes <= 0 || utf8.RuneCountInString(text) <= maxRunes {
+		return []string{text}
+	}
+
+	var chunks []string
+	var current strings.Builder
+	currentLen := 0
+
+	flush := func() {
+		if currentLen > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentLen = 0
+		}
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraphLen := utf8.RuneCountInString(paragraph)
+
+		// 段落単体が上限を超える場合は、上限ごとに切り出します
+		if paragraphLen > maxRunes {
+			flush()
+			runes := []rune(paragraph)
+			for start := 0; start < len(runes); start += maxRunes {
+				end := min(start+maxRunes, len(runes))
+				chunks = append(chunks, string(runes[start:end]))
+			}
+			continue
+		}
+
+		// 区切りの空行 (2 文字) を含めて上限を超える場合は、現在のチャンクを確定します
+		if currentLen > 0 && currentLen+2+paragraphLen > maxRunes {
+			flush()
+		}
+		if currentLen > 0 {
+			current.WriteString("\n\n")
+			currentLen += 2
+		}
+		current.WriteString(paragraph)
+		currentLen += paragraphLen
+	}
+	flush()
+
+	return chunks
+}
@@ -2,9 +2,14 @@ package prompts
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"text/template"
+	"time"
 )
 
 // testTemplates は、テストで使用するためのテンプレートのモックデータです。
@@ -151,3 +156,490 @@ func TestPromptBuilder_Build(t *testing.T) {
 		}
 	})
 }
+
+// TestValidateTemplates は ValidateTemplates の検出ロジックをテストします。
+func TestValidateTemplates(t *testing.T) {
+	templates := map[string]string{
+		"ok":      "入力: {{.Content}}",
+		"broken":  "一行目\n二行目 {{.Content",
+		"unknown": "一行目\n{{.Content}}\n{{.Author}}",
+	}
+
+	issues := ValidateTemplates(templates)
+	if len(issues) != 2 {
+		t.Fatalf("期待される問題数: 2, 実際: %d (%+v)", len(issues), issues)
+	}
+
+	// 結果はモード名順に並ぶ
+	broken, unknown := issues[0], issues[1]
+	if broken.Mode != "broken" || broken.IsWarning || broken.Line != 2 {
+		t.Errorf("構文エラーの検出結果が期待値と異なります: %+v", broken)
+	}
+	if unknown.Mode != "unknown" || !unknown.IsWarning || unknown.Line != 3 {
+		t.Errorf("未知フィールドの検出結果が期待値と異なります: %+v", unknown)
+	}
+	if !strings.Contains(unknown.Message, ".Author") {
+		t.Errorf("警告メッセージにフィールド名が含まれていません: %s", unknown.Message)
+	}
+
+	// 組み込みテンプレートには問題がないこと
+	if issues := ValidateTemplates(EmbeddedTemplates()); len(issues) != 0 {
+		t.Errorf("組み込みテンプレートで問題が検出されました: %+v", issues)
+	}
+}
+
+// TestPromptBuilder_RegisterTemplateStrict は、同一モードの同時登録で成功が1件だけになることをテストします。
+// go test -race で実行することで、登録と Build の競合も検出します。
+func TestPromptBuilder_RegisterTemplateStrict(t *testing.T) {
+	builder, err := NewPromptBuilderFromTemplates(map[string]string{"release": testTemplates["release"]})
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+
+	const workers = 50
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		successes int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := builder.RegisterTemplateStrict("custom", fmt.Sprintf("カスタム%d: {{.Content}}", i))
+			if err == nil {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			}
+			// 登録と並行して Build も実行する
+			_, _ = builder.Build(TemplateData{Content: "x"}, "release")
+		}(i)
+	}
+	wg.Wait()
+
+	if successes != 1 {
+		t.Errorf("成功した登録数: 期待値 1, 実際 %d", successes)
+	}
+
+	// 既存モードへの Strict 登録はエラー、通常の登録は上書き
+	if err := builder.RegisterTemplateStrict("release", "上書き {{.Content}}"); err == nil {
+		t.Error("既存モードへの RegisterTemplateStrict でエラーが期待されましたが、nilでした")
+	}
+	if err := builder.RegisterTemplate("release", "上書き {{.Content}}"); err != nil {
+		t.Fatalf("RegisterTemplate がエラーを返しました: %v", err)
+	}
+	if got, _ := builder.Build(TemplateData{Content: "x"}, "release"); got != "上書き x" {
+		t.Errorf("上書き後の結果が期待値と異なります: %q", got)
+	}
+}
+
+// TestPromptBuilder_ListModes は ListModes と HasMode をテストします。
+func TestPromptBuilder_ListModes(t *testing.T) {
+	builder, err := NewPromptBuilderFromTemplates(map[string]string{"solo": "S", "dialogue": "D", "review": "R"})
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+
+	got := strings.Join(builder.ListModes(), ",")
+	if want := "dialogue,review,solo"; got != want {
+		t.Errorf("ListModes() = %q, want %q", got, want)
+	}
+	if !builder.HasMode("solo") {
+		t.Error("HasMode(\"solo\") = false, want true")
+	}
+	if builder.HasMode("unknown") {
+		t.Error("HasMode(\"unknown\") = true, want false")
+	}
+}
+
+// TestPromptBuilder_UnregisterTemplate は UnregisterTemplate と ClearTemplates をテストします。
+func TestPromptBuilder_UnregisterTemplate(t *testing.T) {
+	builder, err := NewPromptBuilderFromTemplates(map[string]string{"solo": "S"})
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+	if err := builder.RegisterTemplate("temp", "一時 {{.Content}}"); err != nil {
+		t.Fatalf("RegisterTemplate がエラーを返しました: %v", err)
+	}
+
+	builder.UnregisterTemplate("temp")
+	if builder.HasMode("temp") {
+		t.Error("UnregisterTemplate 後もモード 'temp' が残っています")
+	}
+	if _, err := builder.Build(TemplateData{Content: "x"}, "temp"); err == nil {
+		t.Error("登録解除したモードの Build でエラーが期待されましたが、nilでした")
+	}
+
+	builder.ClearTemplates()
+	if modes := builder.ListModes(); len(modes) != 0 {
+		t.Errorf("ClearTemplates 後もモードが残っています: %v", modes)
+	}
+}
+
+// TestPromptBuilder_GetTemplate は、モードに対して使われるテンプレート名の解決をテストします。
+func TestPromptBuilder_GetTemplate(t *testing.T) {
+	builtin, err := NewPromptBuilder()
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+	if name, ok := builtin.GetTemplate("solo"); !ok || name != "builtin:solo" {
+		t.Errorf("組み込みテンプレートの名前が期待値と異なります: %q, %v", name, ok)
+	}
+
+	// ファイルで上書きしたモードは、設定した名前を返す
+	if err := builtin.RegisterTemplate("solo", "上書き {{.Content}}"); err != nil {
+		t.Fatalf("RegisterTemplate がエラーを返しました: %v", err)
+	}
+	if name, _ := builtin.GetTemplate("solo"); name != "solo" {
+		t.Errorf("上書き後は組み込みの名前を返すべきではありません: %q", name)
+	}
+	builtin.SetTemplateName("solo", "templates/solo.md")
+	if name, _ := builtin.GetTemplate("solo"); name != "templates/solo.md" {
+		t.Errorf("SetTemplateName で設定した名前が返されるべきです: %q", name)
+	}
+
+	if _, ok := builtin.GetTemplate("unknown"); ok {
+		t.Error("未登録のモードで true が返されました")
+	}
+	builtin.SetTemplateName("unknown", "x.md")
+	if _, ok := builtin.GetTemplate("unknown"); ok {
+		t.Error("未登録のモードに名前を設定しても登録されるべきではありません")
+	}
+}
+
+// TestPromptBuilder_ResolveVars は、テンプレートが参照する変数と渡された変数の突き合わせをテストします。
+func TestPromptBuilder_ResolveVars(t *testing.T) {
+	builder, err := NewPromptBuilderFromTemplates(map[string]string{
+		BaseTemplateName: "{{.Vars.header}}\n{{block \"body\" .}}{{end}}",
+		"greet":          "{{if .Vars.formal}}拝啓{{end}} {{.Vars.name}} {{.Vars.name}} {{range .Vars}}{{.}}{{end}}",
+	})
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+
+	got, err := builder.ResolveVars("greet", map[string]string{"name": "太郎", "extra": "x"})
+	if err != nil {
+		t.Fatalf("ResolveVars がエラーを返しました: %v", err)
+	}
+	want := []VarUsage{
+		{Name: "formal", Referenced: true},
+		{Name: "header", Referenced: true},
+		{Name: "name", Value: "太郎", Set: true, Referenced: true},
+		{Name: "extra", Value: "x", Set: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveVars の結果が期待値と異なります。\n期待値: %+v\n実際: %+v", want, got)
+	}
+
+	if _, err := builder.ResolveVars("unknown", nil); err == nil {
+		t.Error("未登録のモードでエラーが期待されましたが、nilでした")
+	}
+}
+
+// TestReloadingBuilder は、テンプレートファイルの変更が Build に反映されることをテストします。
+func TestReloadingBuilder(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "solo.md")
+	if err := os.WriteFile(path, []byte("旧: {{.Content}}"), 0o644); err != nil {
+		t.Fatalf("テンプレートの書き込みに失敗しました: %v", err)
+	}
+
+	builder, err := NewReloadingBuilder(dir)
+	if err != nil {
+		t.Fatalf("NewReloadingBuilder がエラーを返しました: %v", err)
+	}
+	defer builder.Close()
+
+	data := TemplateData{Content: "x"}
+	if got, _ := builder.Build(data, "solo"); got != "旧: x" {
+		t.Fatalf("初期の結果が期待値と異なります: %q", got)
+	}
+	if name, ok := builder.GetTemplate("solo"); !ok || name != path {
+		t.Errorf("テンプレート名はファイルのパスであるべきです: %q, %v", name, ok)
+	}
+
+	// waitFor は、Build の結果が期待値になるまで待機します。
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) {
+			if got, _ := builder.Build(data, "solo"); got == want {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		got, _ := builder.Build(data, "solo")
+		t.Fatalf("再読み込み後の結果が期待値と異なります。期待値: %q, 実際: %q", want, got)
+	}
+
+	if err := os.WriteFile(path, []byte("新: {{.Content}}"), 0o644); err != nil {
+		t.Fatalf("テンプレートの書き込みに失敗しました: %v", err)
+	}
+	waitFor("新: x")
+
+	// 解析エラーになる変更は無視され、直前の版が使われ続ける
+	if err := os.WriteFile(path, []byte("壊れた {{.Content"), 0o644); err != nil {
+		t.Fatalf("テンプレートの書き込みに失敗しました: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	waitFor("新: x")
+}
+
+// TestNewTemplateData は、メタデータ付きの TemplateData がテンプレートから参照できることをテストします。
+func TestNewTemplateData(t *testing.T) {
+	builder, err := NewPromptBuilderFromTemplates(map[string]string{
+		"meta":   "{{.SourceName}} ({{.ContentLength}}文字): {{.Content}}",
+		"legacy": testTemplates["release"],
+	})
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+
+	data := NewTemplateData("こんにちは", "input.txt")
+	if data.Timestamp.IsZero() {
+		t.Error("Timestamp が設定されていません")
+	}
+
+	got, err := builder.Build(data, "meta")
+	if err != nil {
+		t.Fatalf("Build がエラーを返しました: %v", err)
+	}
+	if want := "input.txt (5文字): こんにちは"; got != want {
+		t.Errorf("Build() = %q, want %q", got, want)
+	}
+
+	// Content のみを参照する既存テンプレートは影響を受けない
+	got, _ = builder.Build(data, "legacy")
+	if want := "リリースレビューのプロンプト: こんにちは"; got != want {
+		t.Errorf("Build() = %q, want %q", got, want)
+	}
+}
+
+// TestBuild_Translate は組み込みの translate テンプレートが Vars の言語を反映することをテストします。
+func TestBuild_Translate(t *testing.T) {
+	builder, err := NewPromptBuilder()
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		want    []string
+		notWant []string
+	}{
+		{"翻訳元を指定した場合", map[string]string{"to": "英語", "from": "日本語"}, []string{"日本語から英語に翻訳"}, []string{"入力から判断", "<no value>"}},
+		{"翻訳元を省略した場合", map[string]string{"to": "英語"}, []string{"テキストを英語に翻訳", "入力から判断"}, []string{"<no value>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := NewTemplateData("こんにちは", "args")
+			data.Vars = tt.vars
+			got, err := builder.Build(data, "translate")
+			if err != nil {
+				t.Fatalf("Build() でエラーが発生しました: %v", err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("結果に %q が含まれていません:\n%s", w, got)
+				}
+			}
+			for _, nw := range tt.notWant {
+				if strings.Contains(got, nw) {
+					t.Errorf("結果に %q が含まれるべきではありません:\n%s", nw, got)
+				}
+			}
+		})
+	}
+}
+
+// TestBuild_Summarize は組み込みの summarize テンプレートが長さの指定を反映することをテストします。
+func TestBuild_Summarize(t *testing.T) {
+	builder, err := NewPromptBuilder()
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"short", map[string]string{"length": "short"}, "3文程度"},
+		{"medium", map[string]string{"length": "medium"}, "1段落"},
+		{"long", map[string]string{"length": "long"}, "見出しや箇条書き"},
+		{"文数の指定を優先", map[string]string{"length": "short", "sentences": "4"}, "4文で"},
+		{"変数なしは medium 相当", nil, "1段落"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := NewTemplateData("本文", "args")
+			data.Vars = tt.vars
+			got, err := builder.Build(data, "summarize")
+			if err != nil {
+				t.Fatalf("Build() でエラーが発生しました: %v", err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("結果に %q が含まれていません:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestBuild_Review は組み込みの review テンプレートが差分と重点的に確認する観点を反映することをテストします。
+func TestBuild_Review(t *testing.T) {
+	builder, err := NewPromptBuilder()
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+
+	const diff = "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-x := 1\n+x := 2"
+	data := NewTemplateData(diff, "git diff")
+	data.Vars = map[string]string{"focus": "エラー処理"}
+	got, err := builder.Build(data, "review")
+	if err != nil {
+		t.Fatalf("Build() でエラーが発生しました: %v", err)
+	}
+	for _, want := range []string{"## 重大な問題", "## 総評", "観点を重点的に確認してください: エラー処理", "[差分 (git diff)]\n" + diff} {
+		if !strings.Contains(got, want) {
+			t.Errorf("結果に %q が含まれていません:\n%s", want, got)
+		}
+	}
+
+	t.Run("観点の指定なし", func(t *testing.T) {
+		got, err := builder.Build(NewTemplateData(diff, ""), "review")
+		if err != nil {
+			t.Fatalf("Build() でエラーが発生しました: %v", err)
+		}
+		if strings.Contains(got, "重点的に") || !strings.Contains(got, "[差分]\n") {
+			t.Errorf("観点と入力元の名前を含めるべきではありません:\n%s", got)
+		}
+	})
+}
+
+// TestSplitIntoChunks は段落単位のチャンク分割をテストします。
+func TestSplitIntoChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxRunes int
+		want     []string
+	}{
+		{"上限以下はそのまま", "あいう\n\nえお", 10, []string{"あいう\n\nえお"}},
+		{"上限 0 は分割しない", "あいう\n\nえお", 0, []string{"あいう\n\nえお"}},
+		{"段落の境界で分割", "あいう\n\nえお\n\nかきくけ", 7, []string{"あいう\n\nえお", "かきくけ"}},
+		{"長すぎる段落は途中で分割", "あいうえおかき\n\nく", 3, []string{"あいう", "えおか", "き", "く"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitIntoChunks(tt.text, tt.maxRunes)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("SplitIntoChunks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPromptBuilder_BaseTemplate は、ベーステンプレートの共通ヘッダーが各モードに適用されることをテストします。
+func TestPromptBuilder_BaseTemplate(t *testing.T) {
+	const header = "## 社内スタイルガイド: 敬語で簡潔に書くこと"
+	templates := EmbeddedTemplates()
+	templates[BaseTemplateName] = header + "\n\n{{block \"body\" .}}{{end}}\n\n(出典: {{.SourceName}})"
+	templates["review"] = "{{define \"body\"}}次のコードをレビューしてください。\n{{.Content}}{{end}}"
+
+	builder, err := NewPromptBuilderFromTemplates(templates)
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+	if builder.HasMode(BaseTemplateName) {
+		t.Error("ベーステンプレートはモードとして登録されるべきではありません")
+	}
+
+	// 組み込みの solo / dialogue はヘッダーを持たないが、ベーステンプレート経由で付与される
+	for _, mode := range []string{"solo", "dialogue", "review"} {
+		t.Run(mode, func(t *testing.T) {
+			got, err := builder.Build(NewTemplateData("入力本文", "stdin"), mode)
+			if err != nil {
+				t.Fatalf("Build がエラーを返しました: %v", err)
+			}
+			if !strings.HasPrefix(got, header) {
+				t.Errorf("ベーステンプレートのヘッダーが先頭にありません:\n%s", got)
+			}
+			if !strings.Contains(got, "入力本文") || !strings.HasSuffix(got, "(出典: stdin)") {
+				t.Errorf("モードの本文とベーステンプレートのフッターが含まれていません:\n%s", got)
+			}
+			if strings.Count(got, header) != 1 {
+				t.Errorf("ヘッダーは1回だけ出力されるべきです:\n%s", got)
+			}
+		})
+	}
+
+	t.Run("RegisterTemplate もベーステンプレートを適用する", func(t *testing.T) {
+		if err := builder.RegisterTemplate("added", "追加: {{.Content}}"); err != nil {
+			t.Fatalf("RegisterTemplate がエラーを返しました: %v", err)
+		}
+		got, err := builder.Build(NewTemplateData("x", "stdin"), "added")
+		if err != nil || !strings.HasPrefix(got, header) || !strings.Contains(got, "追加: x") {
+			t.Errorf("登録したモードにもベーステンプレートが適用されるべきです (err: %v):\n%s", err, got)
+		}
+	})
+
+	t.Run("body ブロックのないベーステンプレートはエラー", func(t *testing.T) {
+		_, err := NewPromptBuilderFromTemplates(map[string]string{BaseTemplateName: header, "solo": "{{.Content}}"})
+		if err == nil || !strings.Contains(err.Error(), "body") {
+			t.Errorf("body ブロックがない場合はエラーになるべきです: %v", err)
+		}
+		issues := ValidateTemplates(map[string]string{BaseTemplateName: header, "solo": "{{.Content}}"})
+		if len(issues) != 1 || issues[0].Mode != BaseTemplateName {
+			t.Errorf("ベーステンプレートの問題として報告されるべきです: %+v", issues)
+		}
+	})
+
+	t.Run("body 内の未知フィールドも検証する", func(t *testing.T) {
+		issues := ValidateTemplates(map[string]string{
+			BaseTemplateName: "{{block \"body\" .}}{{end}}",
+			"review":         "{{define \"body\"}}\n{{.Author}}{{end}}",
+		})
+		if len(issues) != 1 || issues[0].Mode != "review" || issues[0].Line != 2 || !issues[0].IsWarning {
+			t.Errorf("body 内の未知フィールドが検出されるべきです: %+v", issues)
+		}
+	})
+}
+
+// TestPromptBuilder_EnvFunc は、テンプレートの env 関数が許可された環境変数のみを参照することをテストします。
+func TestPromptBuilder_EnvFunc(t *testing.T) {
+	t.Setenv("AICLIENT_BRAND", "ACME")
+	t.Setenv("GEMINI_API_KEY", "secret-key")
+
+	builder, err := NewPromptBuilderFromTemplates(map[string]string{
+		"brand":  "{{env \"AICLIENT_BRAND\"}} として回答: {{.Content}}",
+		"unset":  "[{{env \"AICLIENT_UNSET\"}}]{{.Content}}",
+		"secret": "{{env \"GEMINI_API_KEY\"}} {{.Content}}",
+	})
+	if err != nil {
+		t.Fatalf("テストセットアップが失敗しました: %v", err)
+	}
+	data := NewTemplateData("質問", "stdin")
+
+	got, err := builder.Build(data, "brand")
+	if err != nil || got != "ACME として回答: 質問" {
+		t.Errorf("許可された環境変数が展開されるべきです: %q (err: %v)", got, err)
+	}
+
+	got, err = builder.Build(data, "unset")
+	if err != nil || got != "[]質問" {
+		t.Errorf("未設定の環境変数は空文字列になるべきです: %q (err: %v)", got, err)
+	}
+
+	got, err = builder.Build(data, "secret")
+	if err == nil {
+		t.Fatalf("接頭辞のない環境変数の参照はエラーになるべきです: %q", got)
+	}
+	if strings.Contains(got, "secret-key") || strings.Contains(err.Error(), "secret-key") {
+		t.Errorf("秘密情報が出力に含まれてはいけません: %q (err: %v)", got, err)
+	}
+}
@@ -0,0 +1,110 @@
+package prompts
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReloadingBuilder は、テンプレートディレクトリを監視し、ファイルの変更時にテンプレートを読み直す Builder です。
+// 読み直しは新しい PromptBuilder を丸ごと構築してから差し替えるため、Build は常に整合した最新の版を使います。
+// 読み直し時に解析エラーが発生した場合は、エラーをログに出力して直前の正常な版を使い続けます。
+type ReloadingBuilder struct {
+	dir     string
+	current atomic.Pointer[PromptBuilder]
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// NewReloadingBuilder は、ディレクトリ内のテンプレートを読み込み、変更の監視を開始します。
+// 不要になったら Close を呼び出して監視を停止してください。
+func NewReloadingBuilder(dir string) (*ReloadingBuilder, error) {
+	b := &ReloadingBuilder{
+		dir:  dir,
+		done: make(chan struct{}),
+	}
+	if err := b.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("テンプレート監視の開始に失敗しました: %w", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("テンプレートディレクトリ '%s' の監視に失敗しました: %w", dir, err)
+	}
+	b.watcher = watcher
+
+	go b.watch()
+	return b, nil
+}
+
+// Build は、最新のテンプレートを使ってプロンプトを構築します。
+func (b *ReloadingBuilder) Build(data TemplateData, mode string) (string, error) {
+	return b.current.Load().Build(data, mode)
+}
+
+// GetTemplate は、最新のテンプレートのうち、モードに対して Build が使うファイルのパスを返します。
+func (b *ReloadingBuilder) GetTemplate(mode string) (string, bool) {
+	return b.current.Load().GetTemplate(mode)
+}
+
+// Close は、ディレクトリの監視を停止します。
+func (b *ReloadingBuilder) Close() error {
+	err := b.watcher.Close()
+	<-b.done
+	return err
+}
+
+// reload は、ディレクトリからテンプレートを読み直し、すべて解析できた場合のみ差し替えます。
+func (b *ReloadingBuilder) reload() error {
+	templates, err := LoadTemplatesFromDir(b.dir)
+	if err != nil {
+		return err
+	}
+	builder, err := NewPromptBuilderFromTemplates(templates)
+	if err != nil {
+		return err
+	}
+	for mode := range templates {
+		builder.SetTemplateName(mode, filepath.Join(b.dir, mode+templateFileExt))
+	}
+	b.current.Store(builder)
+	return nil
+}
+
+// watch は、テンプレートファイルの変更を検知して reload を呼び出します。
+func (b *ReloadingBuilder) watch() {
+	defer close(b.done)
+
+	for {
+		select {
+		case event, ok := <-b.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Ext(event.Name) != templateFileExt {
+				continue
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			if err := b.reload(); err != nil {
+				slog.Error("テンプレートの再読み込みに失敗しました。直前の版を使い続けます", "dir", b.dir, "error", err)
+				continue
+			}
+			slog.Info("テンプレートを再読み込みしました", "dir", b.dir, "file", event.Name)
+
+		case err, ok := <-b.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("テンプレート監視でエラーが発生しました", "dir", b.dir, "error", err)
+		}
+	}
+}
@@ -2,44 +2,295 @@ package prompts
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
 )
 
+// BaseTemplateName は、すべてのモードに共通するベーステンプレートの名前です (ディレクトリでは _base.md)。
+// ベーステンプレートは {{block "body" .}} で各モードの内容を差し込む位置を定義します。
+// ベーステンプレートがある場合、各モードのテンプレートは {{define "body"}} で本文だけを定義します。
+// body を定義していないモードは、テンプレート全体を本文として扱います。
+const BaseTemplateName = "_base"
+
+// bodyTemplateName は、ベーステンプレートが各モードの内容を差し込むブロックの名前です。
+const bodyTemplateName = "body"
+
 // Builder は、最終的なAIプロンプトを構築するためのインターフェースです。
 type Builder interface {
 	Build(data TemplateData, mode string) (string, error) // 慣習に合わせ引数順序を調整
 }
 
+// TemplateResolver は、モードに対して Build が実際に使うテンプレートの名前を返せる Builder です。
+// ディレクトリのテンプレートが組み込みのテンプレートを上書きしている場合などに、どちらが使われたかをログに残すために使います。
+type TemplateResolver interface {
+	// GetTemplate は、モードのテンプレート名を返します。モードが登録されていない場合は false を返します。
+	GetTemplate(mode string) (string, bool)
+}
+
+// builtinTemplatePrefix は、組み込みテンプレートの名前に付ける接頭辞です (例: builtin:solo)。
+const builtinTemplatePrefix = "builtin:"
+
 // PromptBuilder は Builder インターフェースを実装します。
+// テンプレートの登録と Build は複数の goroutine から同時に呼び出せます。
 type PromptBuilder struct {
+	mu        sync.RWMutex
 	templates map[string]*template.Template
+	// names はモードごとのテンプレート名 (ファイルのパスなど) です。登録がないモードはモード名をテンプレート名とします。
+	names map[string]string
+	// base はベーステンプレートの内容です。空の場合、各モードのテンプレートをそのまま使います。
+	base string
 }
 
 // NewPromptBuilder は PromptBuilder を初期化し、すべてのテンプレートを一度パースしてキャッシュします。
 func NewPromptBuilder() (*PromptBuilder, error) {
-	parsedTemplates := make(map[string]*template.Template)
-	for mode, content := range allTemplates {
-		if content == "" {
-			return nil, fmt.Errorf("プロンプトテンプレート '%s' (go:embed) の読み込みに失敗: 内容が空です", mode)
+	b, err := NewPromptBuilderFromTemplates(allTemplates)
+	if err != nil {
+		return nil, err
+	}
+	for mode := range allTemplates {
+		b.names[mode] = builtinTemplatePrefix + mode
+	}
+	return b, nil
+}
+
+// NewPromptBuilderFromTemplates は、モード名とテンプレート文字列のマップから PromptBuilder を初期化します。
+// LoadTemplatesFromDir と組み合わせることで、組み込み以外のテンプレートも利用できます。
+// BaseTemplateName のエントリはモードとしては登録せず、ほかのすべてのモードのベーステンプレートとして使います。
+func NewPromptBuilderFromTemplates(templates map[string]string) (*PromptBuilder, error) {
+	base, hasBase := templates[BaseTemplateName]
+	if hasBase {
+		if err := validateBaseTemplate(base); err != nil {
+			return nil, err
 		}
+	}
 
-		tmpl, err := template.New(mode).Parse(content)
+	parsedTemplates := make(map[string]*template.Template)
+	for mode, content := range templates {
+		if mode == BaseTemplateName {
+			continue
+		}
+		tmpl, err := parseModeTemplate(mode, content, base)
 		if err != nil {
-			// エラーメッセージをより詳細に
-			return nil, fmt.Errorf("テンプレート '%s' の解析に失敗しました: %w", mode, err)
+			return nil, err
 		}
 		parsedTemplates[mode] = tmpl
 	}
 
 	return &PromptBuilder{
 		templates: parsedTemplates,
+		names:     make(map[string]string),
+		base:      base,
 	}, nil
 }
 
+// validateBaseTemplate は、ベーステンプレートを解析し、body ブロックを含むことを確認します。
+func validateBaseTemplate(base string) error {
+	tmpl, err := parseTemplate(BaseTemplateName, base)
+	if err != nil {
+		return err
+	}
+	if tmpl.Lookup(bodyTemplateName) == nil {
+		return fmt.Errorf("ベーステンプレート '%s' に {{block \"%s\" .}} がありません", BaseTemplateName, bodyTemplateName)
+	}
+	return nil
+}
+
+// parseModeTemplate は、モードのテンプレートを解析します。base が空でなければ、base の body ブロックに
+// モードの内容を差し込んだテンプレートを返します。
+func parseModeTemplate(mode, content, base string) (*template.Template, error) {
+	modeTmpl, err := parseTemplate(mode, content)
+	if err != nil || base == "" {
+		return modeTmpl, err
+	}
+
+	tmpl, err := template.New(mode).Funcs(templateFuncs).Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("ベーステンプレート '%s' の解析に失敗しました: %w", BaseTemplateName, err)
+	}
+
+	// body を定義していないモードは、テンプレート全体を body として扱う
+	if modeTmpl.Lookup(bodyTemplateName) == nil {
+		if _, err := tmpl.AddParseTree(bodyTemplateName, modeTmpl.Tree); err != nil {
+			return nil, fmt.Errorf("テンプレート '%s' をベーステンプレートに適用できませんでした: %w", mode, err)
+		}
+		return tmpl, nil
+	}
+	for _, t := range modeTmpl.Templates() {
+		if t.Name() == mode || t.Tree == nil {
+			continue
+		}
+		if _, err := tmpl.AddParseTree(t.Name(), t.Tree); err != nil {
+			return nil, fmt.Errorf("テンプレート '%s' をベーステンプレートに適用できませんでした: %w", mode, err)
+		}
+	}
+	return tmpl, nil
+}
+
+// parseTemplate は、テンプレート文字列を検証してパースします。
+func parseTemplate(mode, content string) (*template.Template, error) {
+	if content == "" {
+		return nil, fmt.Errorf("プロンプトテンプレート '%s' の読み込みに失敗: 内容が空です", mode)
+	}
+
+	tmpl, err := template.New(mode).Funcs(templateFuncs).Parse(content)
+	if err != nil {
+		// エラーメッセージをより詳細に
+		return nil, fmt.Errorf("テンプレート '%s' の解析に失敗しました: %w", mode, err)
+	}
+	return tmpl, nil
+}
+
+// RegisterTemplate は、テンプレートを解析してモードとして登録します。
+// 同じモードが既に登録されている場合は上書きします。ベーステンプレートがある場合は、それに差し込んで登録します。
+func (b *PromptBuilder) RegisterTemplate(mode, templateString string) error {
+	tmpl, err := parseModeTemplate(mode, templateString, b.base)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.templates[mode] = tmpl
+	delete(b.names, mode)
+	return nil
+}
+
+// RegisterTemplateStrict は RegisterTemplate と同様にテンプレートを登録しますが、
+// 同じモードが既に登録されている場合はエラーを返します。存在確認と登録はロック内で一括して行われます。
+func (b *PromptBuilder) RegisterTemplateStrict(mode, templateString string) error {
+	// 解析はロックの外で行い、ロックの保持時間を短くする (base は生成後に変わらないため、ロックなしで参照できる)
+	tmpl, err := parseModeTemplate(mode, templateString, b.base)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, exists := b.templates[mode]; exists {
+		return fmt.Errorf("モード '%s' は既に登録されています", mode)
+	}
+	b.templates[mode] = tmpl
+	return nil
+}
+
+// UnregisterTemplate は、指定したモードの登録を解除します。未登録のモードを指定しても何もしません。
+// 主にテストでの状態のリセットや、テンプレートのホットリロードを想定しています。
+func (b *PromptBuilder) UnregisterTemplate(mode string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.templates, mode)
+	delete(b.names, mode)
+}
+
+// ClearTemplates は、登録済みのすべてのテンプレートを削除します。
+// 主にテストでの状態のリセットや、テンプレートのホットリロードを想定しています。
+func (b *PromptBuilder) ClearTemplates() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.templates = make(map[string]*template.Template)
+	b.names = make(map[string]string)
+}
+
+// SetTemplateName は、登録済みのモードのテンプレート名 (読み込んだファイルのパスなど) を設定します。
+// GetTemplate が返す名前になり、ログや出力のメタ情報でどのテンプレートが使われたかを確認できます。
+func (b *PromptBuilder) SetTemplateName(mode, name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.templates[mode]; !ok {
+		return
+	}
+	if b.names == nil {
+		b.names = make(map[string]string)
+	}
+	b.names[mode] = name
+}
+
+// GetTemplate は、モードに対して Build が使うテンプレートの名前を返します。
+// 組み込みテンプレートは builtin:<モード>、SetTemplateName で名前を設定したモードはその名前、それ以外はモード名を返します。
+func (b *PromptBuilder) GetTemplate(mode string) (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if _, ok := b.templates[mode]; !ok {
+		return "", false
+	}
+	if name, ok := b.names[mode]; ok {
+		return name, true
+	}
+	return mode, true
+}
+
+// ListModes は、登録済みのモード名を昇順で返します。
+func (b *PromptBuilder) ListModes() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	modes := make([]string, 0, len(b.templates))
+	for mode := range b.templates {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// HasMode は、指定したモードが登録済みかどうかを返します。
+func (b *PromptBuilder) HasMode(mode string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	_, ok := b.templates[mode]
+	return ok
+}
+
+// VarUsage は、テンプレートの変数 1 つについて、参照されているかと渡された値を表します (ResolveVars を参照)。
+type VarUsage struct {
+	Name string
+	// Value は渡された値です。Set が false の場合は空文字列です。
+	Value string
+	// Set は値が渡されたかどうかです。参照されているのに false の場合、テンプレートには空文字列として展開されます。
+	Set bool
+	// Referenced はテンプレートが {{.Vars.名前}} で参照しているかどうかです。false の場合、渡された値は使われません。
+	Referenced bool
+}
+
+// ResolveVars は、モードのテンプレートが参照する変数と vars を突き合わせ、変数ごとの値と過不足を返します。
+// テンプレートのデバッグ (ドライラン) で、どの変数が埋め込まれ、どの変数が未設定かを示すために使います。
+// 参照されている変数を名前順に並べ、その後ろに参照されていない変数を名前順に並べます。
+func (b *PromptBuilder) ResolveVars(mode string, vars map[string]string) ([]VarUsage, error) {
+	b.mu.RLock()
+	tmpl, ok := b.templates[mode]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不明なモードです: '%s'", mode)
+	}
+
+	var usages []VarUsage
+	referenced := make(map[string]bool)
+	for _, name := range referencedVars(tmpl) {
+		value, set := vars[name]
+		usages = append(usages, VarUsage{Name: name, Value: value, Set: set, Referenced: true})
+		referenced[name] = true
+	}
+
+	var unused []string
+	for name := range vars {
+		if !referenced[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		usages = append(usages, VarUsage{Name: name, Value: vars[name], Set: true})
+	}
+	return usages, nil
+}
+
 // Build は、TemplateDataを埋め込み、要求されたモードに応じて適切なテンプレートを実行します。
 func (b *PromptBuilder) Build(data TemplateData, mode string) (string, error) {
+	b.mu.RLock()
 	tmpl, ok := b.templates[mode]
+	b.mu.RUnlock()
 	if !ok {
 		return "", fmt.Errorf("不明なモードです: '%s'", mode)
 	}
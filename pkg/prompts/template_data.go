@@ -2,11 +2,34 @@ package prompts
 
 import (
 	_ "embed"
+	"time"
+	"unicode/utf8"
 )
 
 // TemplateData はレビュープロンプトのテンプレートに渡すデータ構造です。
+// Content 以外のフィールドは任意で、未設定の場合はゼロ値のままテンプレートに渡されます。
 type TemplateData struct {
 	Content string
+
+	// SourceName は入力元の名前です (ファイル名、"stdin" など)。
+	SourceName string
+	// ContentLength は Content の文字数 (rune 数) です。
+	ContentLength int
+	// Timestamp は入力を受け取った時刻です。
+	Timestamp time.Time
+
+	// Vars はテンプレート固有の追加の変数です (例: translate の {{.Vars.to}})。
+	Vars map[string]string
+}
+
+// NewTemplateData は、Content から ContentLength と Timestamp を補完した TemplateData を生成します。
+func NewTemplateData(content, sourceName string) TemplateData {
+	return TemplateData{
+		Content:       content,
+		SourceName:    sourceName,
+		ContentLength: utf8.RuneCountInString(content),
+		Timestamp:     time.Now(),
+	}
 }
 
 var (
@@ -14,12 +37,30 @@ var (
 	soloPromptTemplate string
 	//go:embed prompt_dialogue.md
 	dialoguePromptTemplate string
+	//go:embed prompt_translate.md
+	translatePromptTemplate string
+	//go:embed prompt_summarize.md
+	summarizePromptTemplate string
+	//go:embed prompt_review.md
+	reviewPromptTemplate string
 )
 
 var (
 	// allTemplates は、テンプレートのMAP
 	allTemplates = map[string]string{
-		"solo":     soloPromptTemplate,
-		"dialogue": dialoguePromptTemplate,
+		"solo":      soloPromptTemplate,
+		"dialogue":  dialoguePromptTemplate,
+		"translate": translatePromptTemplate,
+		"summarize": summarizePromptTemplate,
+		"review":    reviewPromptTemplate,
 	}
 )
+
+// EmbeddedTemplates は、組み込みテンプレートのコピーを返します。
+func EmbeddedTemplates() map[string]string {
+	templates := make(map[string]string, len(allTemplates))
+	for mode, content := range allTemplates {
+		templates[mode] = content
+	}
+	return templates
+}
@@ -0,0 +1,26 @@
+package prompts
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// EnvVarPrefix は、テンプレートの env 関数で参照できる環境変数名の接頭辞です。
+// APIキーなどの秘密情報がプロンプトに漏れないよう、この接頭辞を持つ変数のみ参照を許可します。
+const EnvVarPrefix = "AICLIENT_"
+
+// templateFuncs は、すべてのテンプレートで利用できる関数です。
+var templateFuncs = template.FuncMap{
+	"env": envFunc,
+}
+
+// envFunc は、{{env "AICLIENT_BRAND"}} のように環境変数の値を返します。未設定の場合は空文字列を返します。
+// EnvVarPrefix で始まらない名前 (GEMINI_API_KEY など) はエラーとなり、テンプレートの実行は失敗します。
+func envFunc(name string) (string, error) {
+	if !strings.HasPrefix(name, EnvVarPrefix) {
+		return "", fmt.Errorf("環境変数 '%s' はテンプレートから参照できません (%s で始まる名前のみ許可されています)", name, EnvVarPrefix)
+	}
+	return os.Getenv(name), nil
+}
@@ -0,0 +1,36 @@
+package prompts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// templateFileExt は、ディレクトリから読み込むテンプレートファイルの拡張子です。
+const templateFileExt = ".md"
+
+// LoadTemplatesFromDir は、ディレクトリ内の *.md ファイルをテンプレートとして読み込みます。
+// モード名はファイル名から拡張子を除いたものです (例: review.md → "review")。
+func LoadTemplatesFromDir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("テンプレートディレクトリ '%s' の読み込みに失敗しました: %w", dir, err)
+	}
+
+	templates := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != templateFileExt {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("テンプレートファイル '%s' の読み込みに失敗しました: %w", entry.Name(), err)
+		}
+		mode := strings.TrimSuffix(entry.Name(), templateFileExt)
+		templates[mode] = string(content)
+	}
+
+	return templates, nil
+}
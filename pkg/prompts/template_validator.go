@@ -0,0 +1,170 @@
+package prompts
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateIssue は、テンプレート検証で見つかった問題を表します。
+type TemplateIssue struct {
+	Mode    string
+	Line    int // 行番号が特定できない場合は 0
+	Message string
+	// IsWarning が true の場合、実行時に問題になり得るが、解析自体は成功していることを示します。
+	IsWarning bool
+}
+
+// parseErrorLinePattern は、text/template の解析エラー "template: mode:3: ..." から行番号を取り出します。
+var parseErrorLinePattern = regexp.MustCompile(`template: [^:]+:(\d+):`)
+
+// ValidateTemplates は、すべてのテンプレートを解析し、構文エラーと TemplateData に存在しないフィールド参照を報告します。
+// BaseTemplateName のエントリがある場合は、ベーステンプレート自体と、各モードをそれに差し込めるかどうかも検証します。
+// 戻り値はモード名、行番号の順に並べられます。
+func ValidateTemplates(templates map[string]string) []TemplateIssue {
+	base, hasBase := templates[BaseTemplateName]
+	if hasBase && validateBaseTemplate(base) != nil {
+		// ベーステンプレート自体のエラーは下で報告し、各モードはベーステンプレートなしで検証する
+		base = ""
+	}
+
+	var issues []TemplateIssue
+	for mode, content := range templates {
+		tmpl, err := parseTemplate(mode, content)
+		if err == nil && mode == BaseTemplateName {
+			err = validateBaseTemplate(content)
+		}
+		if err == nil && mode != BaseTemplateName {
+			_, err = parseModeTemplate(mode, content, base)
+		}
+		if err != nil {
+			issue := TemplateIssue{Mode: mode, Message: err.Error()}
+			if m := parseErrorLinePattern.FindStringSubmatch(err.Error()); m != nil {
+				issue.Line, _ = strconv.Atoi(m[1])
+			}
+			issues = append(issues, issue)
+			continue
+		}
+		issues = append(issues, checkTemplateFields(mode, tmpl)...)
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Mode != issues[j].Mode {
+			return issues[i].Mode < issues[j].Mode
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+// checkTemplateFields は、テンプレートが参照する .Field が TemplateData に存在するかを確認します。
+// {{define}} で定義したテンプレート (body など) も対象にします。
+// range や with の内側ではドットの型が変わるため、検査の対象外とします。
+func checkTemplateFields(mode string, tmpl *template.Template) []TemplateIssue {
+	var issues []TemplateIssue
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		issues = append(issues, checkTreeFields(mode, t.Tree)...)
+	}
+	return issues
+}
+
+// checkTreeFields は、1 つの解析木について checkTemplateFields の検査を行います。
+func checkTreeFields(mode string, tree *parse.Tree) []TemplateIssue {
+	dataType := reflect.TypeOf(TemplateData{})
+	var issues []TemplateIssue
+	walkFields(tree, func(n *parse.FieldNode) {
+		if _, ok := dataType.FieldByName(n.Ident[0]); !ok {
+			issues = append(issues, TemplateIssue{
+				Mode:      mode,
+				Line:      nodeLine(tree, n),
+				Message:   "TemplateData に存在しないフィールド '." + strings.Join(n.Ident, ".") + "' を参照しています",
+				IsWarning: true,
+			})
+		}
+	})
+	return issues
+}
+
+// referencedVars は、テンプレートが {{.Vars.名前}} で参照する変数名を、重複を除いて昇順で返します。
+// {{define}} で定義したテンプレートも対象にします。checkTreeFields と同じく、range や with の内側は対象外とします。
+func referencedVars(tmpl *template.Template) []string {
+	seen := make(map[string]bool)
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		walkFields(t.Tree, func(n *parse.FieldNode) {
+			if len(n.Ident) >= 2 && n.Ident[0] == "Vars" {
+				seen[n.Ident[1]] = true
+			}
+		})
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// walkFields は、解析木のうちドットが TemplateData を指す部分をたどり、見つけた .Field の参照ごとに visit を呼びます。
+// range や with の内側ではドットの型が変わるため、その本体はたどらず、パイプラインと else 節だけをたどります。
+func walkFields(tree *parse.Tree, visit func(*parse.FieldNode)) {
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				for _, arg := range cmd.Args {
+					walk(arg)
+				}
+			}
+		case *parse.FieldNode:
+			visit(n)
+		}
+	}
+	walk(tree.Root)
+}
+
+// nodeLine は、ノードのテンプレート内での行番号を返します。
+func nodeLine(tree *parse.Tree, node parse.Node) int {
+	location, _ := tree.ErrorContext(node)
+	parts := strings.Split(location, ":")
+	if len(parts) < 2 {
+		return 0
+	}
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+	return line
+}
@@ -0,0 +1,40 @@
+package runner
+
+import "strings"
+
+// DefaultContextWarningRatio は、プロンプトのトークン数がコンテキストウィンドウのこの割合を超えたときに警告する既定値です。
+const DefaultContextWarningRatio = 0.9
+
+// modelContextWindows は、主要なモデルのコンテキストウィンドウ (入力トークン数の上限) です。
+// 未登録のモデルでは上限付近の警告を行いません。
+var modelContextWindows = map[string]int{
+	"gemini-2.5-pro":        1048576,
+	"gemini-2.5-flash":      1048576,
+	"gemini-2.5-flash-lite": 1048576,
+	"gemini-2.0-flash":      1048576,
+	"gemini-2.0-flash-lite": 1048576,
+	"gemini-1.5-pro":        2097152,
+	"gemini-1.5-flash":      1048576,
+	"gpt-4o":                128000,
+	"gpt-4o-mini":           128000,
+	"gpt-4.1":               1047576,
+	"gpt-4.1-mini":          1047576,
+}
+
+// ContextWindowFor は、モデルのコンテキストウィンドウ (入力トークン数の上限) を返します。"models/" 接頭辞は無視します。
+// 未登録のモデルでは false を返します。
+func ContextWindowFor(modelName string) (int, bool) {
+	limit, ok := modelContextWindows[strings.TrimPrefix(modelName, "models/")]
+	return limit, ok
+}
+
+// isNearContextLimit は、プロンプトのトークン数 (CountTokens で数えた数、または ai.EstimateTokens による見積もり) が
+// モデルのコンテキストウィンドウの ratio 倍を超えているかを判定します。
+// 未登録のモデルでは常に false を返します。
+func isNearContextLimit(modelName string, promptTokens int, ratio float64) (limit int, near bool) {
+	limit, ok := ContextWindowFor(modelName)
+	if !ok {
+		return 0, false
+	}
+	return limit, float64(promptTokens) > float64(limit)*ratio
+}
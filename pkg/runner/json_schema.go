@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+)
+
+// ErrSchemaMismatch は、応答が JSON Schema に適合しなかったことを示します。
+var ErrSchemaMismatch = errors.New("応答が JSON Schema に適合しません")
+
+// ErrJSONUnsupported は、クライアントが JSON 形式での生成 (GenerateJSON) に対応していないことを示します。
+var ErrJSONUnsupported = errors.New("このクライアントは JSON Schema を指定した生成に対応していません")
+
+// JSONGenerator は、応答を JSON に限定して生成できるクライアントです (gemini.Client など)。
+type JSONGenerator interface {
+	GenerateJSON(ctx context.Context, prompt string, modelName string, schema any) (*ai.Response, error)
+}
+
+// JSONSchema は、モデルに渡すスキーマ文書と、応答の検証に使うコンパイル済みスキーマの組です。
+type JSONSchema struct {
+	// Document はモデルの ResponseJsonSchema として渡すスキーマ文書です。
+	Document any
+	compiled *jsonschema.Schema
+}
+
+// LoadJSONSchema は、ファイルから JSON Schema を読み込んでコンパイルします。
+func LoadJSONSchema(path string) (*JSONSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("JSON Schema ファイル '%s' の読み込みに失敗しました: %w", path, err)
+	}
+	return ParseJSONSchema(data)
+}
+
+// ParseJSONSchema は、JSON Schema のバイト列を解析してコンパイルします。
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("JSON Schema の解析に失敗しました: %w", err)
+	}
+
+	const schemaURL = "schema.json"
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(schemaURL, doc); err != nil {
+		return nil, fmt.Errorf("JSON Schema の登録に失敗しました: %w", err)
+	}
+	compiled, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("JSON Schema のコンパイルに失敗しました: %w", err)
+	}
+	return &JSONSchema{Document: doc, compiled: compiled}, nil
+}
+
+// Validate は、テキストを JSON として解析し、スキーマに適合するかを検証します。
+func (s *JSONSchema) Validate(text string) error {
+	v, err := jsonschema.UnmarshalJSON(bytes.NewReader([]byte(text)))
+	if err != nil {
+		return fmt.Errorf("%w: 応答が有効な JSON ではありません: %w", ErrSchemaMismatch, err)
+	}
+	if err := s.compiled.Validate(v); err != nil {
+		return fmt.Errorf("%w: %w", ErrSchemaMismatch, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageSampleRunes は、言語の推定に使う入力の先頭の文字数です。巨大な入力でも推定の負荷を一定に保ちます。
+const languageSampleRunes = 4096
+
+// cjkWeight は、かなと漢字の文字数をラテン文字の文字数と比べるときの重みです。
+// 1 文字あたりの情報量が多く、英単語が混ざった日本語や中国語でも判定できるよう、ラテン文字より重く数えます。
+const cjkWeight = 3
+
+// scriptLanguages は、その文字体系 (スクリプト) だけで言語をほぼ特定できる場合の、文字体系と言語コードの対応です。
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// latinStopwords は、ラテン文字の言語を見分けるための、各言語で頻出する短い単語です。
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "is", "of", "to", "in", "that", "it", "for", "with", "this", "are", "was", "you"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "en", "es", "por", "para", "con", "una", "del"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "que", "une", "dans", "pour", "pas", "du", "avec"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "von", "ich", "auch"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "não"},
+	"it": {"il", "la", "di", "che", "e", "è", "un", "una", "per", "non", "con", "del", "della", "sono"},
+}
+
+// DetectLanguage は、テキストの言語を推定し、ISO 639-1 の言語コード (ja, en など) を返します。
+// 推定できない場合は空文字列を返します。
+// 文字体系 (かな、ハングル、キリル文字など) で判定できる言語はそれで判定し、
+// ラテン文字の言語 (en, es, fr, de, pt, it) は頻出する単語の出現数で判定する簡易的なものです。
+func DetectLanguage(text string) string {
+	var (
+		kana, han, latin int
+		scripts          = make(map[string]int)
+		sample           strings.Builder
+		n                int
+	)
+	for _, r := range text {
+		if n >= languageSampleRunes {
+			break
+		}
+		n++
+		sample.WriteRune(r)
+
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.table, r) {
+					scripts[s.lang]++
+					break
+				}
+			}
+		}
+	}
+
+	// かなが含まれていれば、漢字の多寡にかかわらず日本語とみなす
+	if kana > 0 && (kana+han)*cjkWeight >= latin {
+		return "ja"
+	}
+
+	best, bestCount := "", 0
+	for lang, count := range scripts {
+		if count > bestCount || count == bestCount && lang < best {
+			best, bestCount = lang, count
+		}
+	}
+	switch {
+	case han > bestCount && han*cjkWeight >= latin:
+		return "zh"
+	case bestCount > 0 && bestCount >= latin:
+		return best
+	case latin > 0:
+		return detectLatinLanguage(sample.String())
+	}
+	return ""
+}
+
+// detectLatinLanguage は、頻出する単語の出現数が最も多い言語を返します。どの単語も出現しない場合は空文字列を返します。
+func detectLatinLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	counts := make(map[string]int, len(latinStopwords))
+	for _, word := range words {
+		for lang, stopwords := range latinStopwords {
+			for _, sw := range stopwords {
+				if word == sw {
+					counts[lang]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestCount := "", 0
+	for lang, count := range counts {
+		if count > bestCount || count == bestCount && lang < best {
+			best, bestCount = lang, count
+		}
+	}
+	return best
+}
@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrModerationRejected は、Moderator が入力を送信前に拒否したことを示します。
+var ErrModerationRejected = errors.New("入力が事前チェックで拒否されました")
+
+// Moderator は、入力をモデルへ送る前に、明らかに許可されない内容を検出する事前チェックです。
+// 拒否する場合は allowed に false を、reason にその理由を返します。
+type Moderator interface {
+	Check(text string) (allowed bool, reason string)
+}
+
+// NoopModerator は、すべての入力を許可する Moderator です。
+type NoopModerator struct{}
+
+// Check は常に入力を許可します。
+func (NoopModerator) Check(text string) (bool, string) {
+	return true, ""
+}
+
+// KeywordModerator は、禁止キーワードのいずれかを含む入力を拒否する Moderator です。
+// キーワードの照合では大文字と小文字を区別しません。
+type KeywordModerator struct {
+	keywords []string
+}
+
+// NewKeywordModerator は、禁止キーワードの一覧から KeywordModerator を生成します。空白のみのキーワードは無視します。
+func NewKeywordModerator(keywords ...string) *KeywordModerator {
+	m := &KeywordModerator{}
+	for _, keyword := range keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			m.keywords = append(m.keywords, strings.ToLower(keyword))
+		}
+	}
+	return m
+}
+
+// Check は、入力が禁止キーワードを含む場合に拒否し、最初に見つかったキーワードを理由として返します。
+func (m *KeywordModerator) Check(text string) (bool, string) {
+	lower := strings.ToLower(text)
+	for _, keyword := range m.keywords {
+		if strings.Contains(lower, keyword) {
+			return false, fmt.Sprintf("禁止キーワード '%s' が含まれています", keyword)
+		}
+	}
+	return true, ""
+}
+
+// moderate は、Moderator が設定されていれば入力を確認し、拒否された場合は ErrModerationRejected をラップして返します。
+func (r *Runner) moderate(input string) error {
+	if r.Moderator == nil {
+		return nil
+	}
+	if allowed, reason := r.Moderator.Check(input); !allowed {
+		return fmt.Errorf("%w: %s", ErrModerationRejected, reason)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+)
+
+// StripCodeFences は、テキスト全体が 1 つのコードブロック (```json ... ``` など) で囲まれている場合に、
+// 区切り記号と言語タグを取り除いた中身を返します。ai.StripCodeFences と同じです。
+func StripCodeFences(s string) string {
+	return ai.StripCodeFences(s)
+}
+
+// DefaultFillerPhrases は、応答の冒頭によく現れる前置きの言葉です。TrimFiller に渡して使います。
+var DefaultFillerPhrases = []string{
+	"Sure", "Certainly", "Of course", "Absolutely", "Okay", "Here is", "Here's", "Here are",
+	"承知しました", "かしこまりました", "もちろんです", "以下は", "以下が",
+}
+
+// fillerPunctuation は、前置きの言葉の直後に続く区切りの記号です。
+const fillerPunctuation = ",.!:、。！，："
+
+// TrimFiller は、応答の前後の空白を取り除き、冒頭の前置き (phrases のいずれかで始まるもの) を取り除きます。
+// 前置きの言葉は大文字と小文字を区別せずに比較し、次のいずれかの場合に取り除きます。
+//   - 前置きで始まる最初の行がコロンで終わり、後ろに本文が続く場合 (例: "Sure, here is the summary:") は、その行全体
+//   - 前置きの直後が句読点の場合 (例: "Certainly! The answer is...") は、前置きと句読点
+//
+// "Here is why..." のように前置きの言葉が本文の一部である場合や、取り除くと何も残らない場合は、そのまま残します。
+// 前置きが続く場合 ("承知しました。以下が翻訳です：") は、繰り返し取り除きます。phrases が空の場合は空白のみを取り除きます。
+func TrimFiller(s string, phrases []string) string {
+	s = strings.TrimSpace(s)
+	for {
+		stripped := stripLeadingFiller(s, phrases)
+		if stripped == s {
+			return s
+		}
+		s = stripped
+	}
+}
+
+// stripLeadingFiller は、冒頭の前置きを 1 つだけ取り除きます。取り除けない場合は s をそのまま返します。
+func stripLeadingFiller(s string, phrases []string) string {
+	line, body, _ := strings.Cut(s, "\n")
+	for _, phrase := range phrases {
+		if phrase == "" || len(s) < len(phrase) || !strings.EqualFold(s[:len(phrase)], phrase) {
+			continue
+		}
+		after := s[len(phrase):]
+		if continuesWord(phrase, after) {
+			continue
+		}
+
+		var stripped string
+		switch {
+		case strings.HasSuffix(line, ":") || strings.HasSuffix(line, "："):
+			stripped = strings.TrimSpace(body)
+		case strings.ContainsRune(fillerPunctuation, firstRune(after)):
+			stripped = strings.TrimSpace(strings.TrimLeft(after, fillerPunctuation+" \t"))
+		}
+		if stripped != "" {
+			return stripped
+		}
+	}
+	return s
+}
+
+// continuesWord は、前置きの言葉の直後に英数字が続き、"Surely" の "Sure" のように単語の途中で一致しただけかを判定します。
+func continuesWord(phrase, after string) bool {
+	last, _ := utf8.DecodeLastRuneInString(phrase)
+	return isWordRune(last) && isWordRune(firstRune(after))
+}
+
+// isWordRune は、r がラテン文字または数字かを判定します。
+func isWordRune(r rune) bool {
+	return unicode.Is(unicode.Latin, r) || unicode.IsDigit(r)
+}
+
+// firstRune は、s の先頭の文字を返します。s が空の場合は utf8.RuneError を返します。
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+// zeroWidthJoiner は、絵文字などを組み合わせて 1 文字として表示するためのゼロ幅接合子です。
+const zeroWidthJoiner = '\u200d'
+
+// TruncateText は、s を先頭から maxLines 行以内、maxChars 文字 (rune 数) 以内に切り詰めます。0 以下の上限は無制限として扱います。
+// 文字数は rune 単位で数えるため、マルチバイト文字の途中で切ることはありません。
+// 結合文字 (濁点やアクセント記号など)、異体字セレクタ、ゼロ幅接合子でつながった文字も切り離さないよう、そのまとまりの手前で切ります。
+// 切り詰めた場合は true を返します。切り詰めた行の末尾の改行は残しません。
+func TruncateText(s string, maxChars, maxLines int) (string, bool) {
+	truncated := false
+	if maxLines > 0 {
+		end := 0
+		for range maxLines {
+			i := strings.IndexByte(s[end:], '\n')
+			if i < 0 {
+				end = len(s)
+				break
+			}
+			end += i + 1
+		}
+		if end < len(s) {
+			s, truncated = strings.TrimSuffix(s[:end], "\n"), true
+		}
+	}
+	if maxChars > 0 {
+		n := 0
+		for i := range s {
+			if n < maxChars {
+				n++
+				continue
+			}
+			for i > 0 && joinsPrevious(s[:i], s[i:]) {
+				_, size := utf8.DecodeLastRuneInString(s[:i])
+				i -= size
+			}
+			s, truncated = s[:i], true
+			break
+		}
+	}
+	return s, truncated
+}
+
+// joinsPrevious は、after の先頭の文字が before の末尾の文字と組み合わせて 1 文字として表示されるか
+// (after が結合文字・異体字セレクタ・ゼロ幅接合子で始まるか、before がゼロ幅接合子で終わるか) を判定します。
+func joinsPrevious(before, after string) bool {
+	last, _ := utf8.DecodeLastRuneInString(before)
+	next := firstRune(after)
+	return last == zeroWidthJoiner || next == zeroWidthJoiner || unicode.In(next, unicode.Mn, unicode.Me, unicode.Variation_Selector)
+}
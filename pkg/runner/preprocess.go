@@ -0,0 +1,216 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// InputFormat は、プロンプトを構築する前に入力をプレーンテキストへ変換するための、入力の形式です。
+type InputFormat string
+
+const (
+	// InputFormatRaw は、入力を変換せずにそのまま使います。
+	InputFormatRaw InputFormat = "raw"
+	// InputFormatHTML は、HTML のタグを取り除き、テキストだけを残します。
+	InputFormatHTML InputFormat = "html"
+	// InputFormatMarkdown は、Markdown の記法 (見出し記号、強調、リンクなど) を取り除いて平文にします。
+	InputFormatMarkdown InputFormat = "markdown"
+)
+
+// inputFormats は、指定できる入力形式の一覧です。
+var inputFormats = []InputFormat{InputFormatRaw, InputFormatHTML, InputFormatMarkdown}
+
+// ParseInputFormat は、文字列を InputFormat に変換します。空文字列は InputFormatRaw として扱います。
+func ParseInputFormat(s string) (InputFormat, error) {
+	if s == "" {
+		return InputFormatRaw, nil
+	}
+	for _, f := range inputFormats {
+		if InputFormat(s) == f {
+			return f, nil
+		}
+	}
+	names := make([]string, len(inputFormats))
+	for i, f := range inputFormats {
+		names[i] = string(f)
+	}
+	return "", fmt.Errorf("不明な入力形式です: '%s' (利用可能な形式: %s)", s, strings.Join(names, ", "))
+}
+
+// ConvertInput は、入力を format に応じてプレーンテキストへ変換します。
+func ConvertInput(text string, format InputFormat) (string, error) {
+	switch format {
+	case InputFormatRaw, "":
+		return text, nil
+	case InputFormatHTML:
+		return StripHTML(text), nil
+	case InputFormatMarkdown:
+		return FlattenMarkdown(text), nil
+	default:
+		_, err := ParseInputFormat(string(format))
+		return "", err
+	}
+}
+
+// htmlSkippedElements は、中身がテキストとして意味を持たないため、内容ごと取り除く要素です。
+var htmlSkippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "head": true, "svg": true,
+}
+
+// htmlBlockElements は、前後で改行して区切りを残す要素と、必要な改行の数です。
+// 段落に相当する要素は 2 (空行で区切る)、行に相当する要素は 1 です。
+var htmlBlockElements = map[string]int{
+	"article": 2, "blockquote": 2, "dl": 2, "figure": 2, "footer": 2, "h1": 2, "h2": 2, "h3": 2, "h4": 2,
+	"h5": 2, "h6": 2, "header": 2, "hr": 2, "ol": 2, "p": 2, "pre": 2, "section": 2, "table": 2, "ul": 2,
+	"address": 1, "aside": 1, "dd": 1, "div": 1, "dt": 1, "fieldset": 1, "figcaption": 1, "form": 1,
+	"li": 1, "main": 1, "nav": 1, "tr": 1,
+}
+
+// htmlSpaces は、HTML のテキスト中で 1 つの空白として扱われる空白文字の並びです。
+var htmlSpaces = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// StripHTML は、HTML のタグを取り除いてテキストだけを返します。
+// 文字参照 (&amp; など) は元の文字に戻し、script や style などの中身は取り除きます。
+// ソース中の改行はブラウザと同様に空白として扱い (pre の中を除く)、ブロック要素と br の位置で改行します。
+// 閉じていないタグなどの不正な HTML も、読める範囲で処理します。
+func StripHTML(s string) string {
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	skipDepth, preDepth := 0, 0
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			// 文字列からの読み込みでは、入力の終わり (io.EOF) 以外のエラーは発生しない
+			return normalizeWhitespace(sb.String())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if tt == html.StartTagToken {
+				if htmlSkippedElements[tag] {
+					skipDepth++
+				}
+				if tag == "pre" {
+					preDepth++
+				}
+			}
+			if tag == "br" {
+				sb.WriteString("\n")
+			}
+			ensureLineBreaks(&sb, htmlBlockElements[tag])
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if htmlSkippedElements[tag] && skipDepth > 0 {
+				skipDepth--
+			}
+			if tag == "pre" && preDepth > 0 {
+				preDepth--
+			}
+			if tag == "td" || tag == "th" {
+				sb.WriteString(" ")
+			}
+			ensureLineBreaks(&sb, htmlBlockElements[tag])
+		case html.TextToken:
+			if skipDepth > 0 {
+				continue
+			}
+			text := string(z.Text()) // Text は文字参照を元の文字に戻した内容を返す
+			if preDepth == 0 {
+				text = htmlSpaces.ReplaceAllString(text, " ")
+			}
+			sb.WriteString(text)
+		}
+	}
+}
+
+// ensureLineBreaks は、出力の末尾が n 個以上の改行 (末尾の空白は無視) で終わるように改行を書き足します。
+// 出力がまだ空の場合は何もしません。
+func ensureLineBreaks(sb *strings.Builder, n int) {
+	trimmed := strings.TrimRight(sb.String(), " ")
+	if n == 0 || trimmed == "" {
+		return
+	}
+	have := len(trimmed) - len(strings.TrimRight(trimmed, "\n"))
+	for range n - have {
+		sb.WriteString("\n")
+	}
+}
+
+var (
+	mdFenceLine     = regexp.MustCompile("^\\s*(```|~~~)")
+	mdHorizontal    = regexp.MustCompile(`^\s*(-\s*){3,}$|^\s*(\*\s*){3,}$|^\s*(_\s*){3,}$`)
+	mdHeading       = regexp.MustCompile(`^\s{0,3}#{1,6}\s+`)
+	mdBlockquote    = regexp.MustCompile(`^\s*(>\s?)+`)
+	mdTableDivider  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	mdImage         = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink          = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdStrong        = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	mdEmphasis      = regexp.MustCompile(`\*([^*\s][^*]*?)\*`)
+	mdStrikethrough = regexp.MustCompile(`~~(.+?)~~`)
+	mdInlineCode    = regexp.MustCompile("`([^`]+)`")
+)
+
+// FlattenMarkdown は、Markdown の記法を取り除いて平文にします。
+// 見出し記号、引用記号、強調、取り消し線、インラインコードの記号、水平線、コードブロックの区切り行を取り除き、
+// リンクと画像はテキスト (代替テキスト) だけを残します。リストの記号と本文の改行、行頭の字下げはそのまま残します。
+// 単語の区切りと紛らわしいため、_ 1 つによる強調 (_text_) は取り除きません。
+func FlattenMarkdown(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for _, line := range lines {
+		if mdFenceLine.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		// コードブロックの中身は記法として解釈せず、そのまま残す
+		if inFence {
+			out = append(out, line)
+			continue
+		}
+		if mdHorizontal.MatchString(line) || mdTableDivider.MatchString(line) && strings.Contains(line, "|") {
+			continue
+		}
+
+		line = mdHeading.ReplaceAllString(line, "")
+		line = mdBlockquote.ReplaceAllString(line, "")
+		line = mdImage.ReplaceAllString(line, "$1")
+		line = mdLink.ReplaceAllString(line, "$1")
+		line = mdInlineCode.ReplaceAllString(line, "$1")
+		line = mdStrong.ReplaceAllString(line, "$1$2")
+		line = mdEmphasis.ReplaceAllString(line, "$1")
+		line = mdStrikethrough.ReplaceAllString(line, "$1")
+		out = append(out, line)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(out, "\n"), "\n\n"))
+}
+
+// blankLines は、2 行以上続く空行 (空白のみの行を含む) です。
+var blankLines = regexp.MustCompile(`\n([ \t]*\n){2,}`)
+
+// multiSpace は、連続する空白 (改行を除く) です。
+var multiSpace = regexp.MustCompile(`[ \t\f\v\x{00a0}]+`)
+
+// normalizeWhitespace は、各行の連続する空白を 1 つにまとめて前後の空白を取り除き、連続する空行を 1 行にまとめます。
+func normalizeWhitespace(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := true // 先頭の空行を取り除くため、直前を空行とみなして始める
+	for _, line := range lines {
+		line = strings.TrimSpace(multiSpace.ReplaceAllString(line, " "))
+		if line == "" {
+			if !blank {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		out = append(out, line)
+		blank = false
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
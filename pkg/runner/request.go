@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+)
+
+// RunRequest は RunRequest メソッドに渡す、1 回の実行の入力と設定の上書きです。
+// 他の Go プログラムから Runner を組み込む際に、位置引数を並べずに呼び出せるようにするためのものです。
+type RunRequest struct {
+	// Input はモデルに渡す入力テキストです。
+	Input string
+	// SourceName はテンプレートに {{.SourceName}} として渡す入力元の名前です。
+	SourceName string
+	// Mode は適用するテンプレートのモードです。空の場合は入力をそのままプロンプトとして使います。
+	Mode string
+	// Vars はテンプレートに {{.Vars.名前}} として渡す変数です。Runner.Vars に追加され、同じ名前の変数は上書きします。
+	Vars map[string]string
+	// Model は使用するモデル名です。
+	Model string
+	// Temperature を指定すると、この実行だけクライアントの温度を上書きします (ai.WithTemperature を参照)。
+	Temperature *float32
+}
+
+// RunResponse は RunRequest メソッドの実行結果です。
+type RunResponse struct {
+	// Text はモデルの応答テキストです (TrimResponse や StripFences などの後処理済み)。
+	Text string
+	// ModelName は実際に応答したモデル名です。
+	ModelName string
+	// Usage はトークン使用量です。プロバイダが使用量を返さない場合は nil です。
+	Usage *ai.Usage
+	// Elapsed は入力の検証から後処理の完了までにかかった時間です。
+	Elapsed time.Duration
+	// PromptBuildTime はプロンプトの構築にかかった時間です。
+	PromptBuildTime time.Duration
+	// APITime はモデルの呼び出し (リトライの待機を含む) にかかった時間です。
+	APITime time.Duration
+	// Retries はモデルの呼び出しでリトライした回数です。
+	Retries int
+	// DetectedLanguage は入力から推定した言語コードです。推定できなかった場合は空文字列です。
+	DetectedLanguage string
+	// TemplateName はプロンプトの構築に使ったテンプレートの名前です。テンプレートを使わなかった場合は空文字列です。
+	TemplateName string
+}
+
+// RunRequest は、構造体で指定した入力と設定で Run と同じ処理を実行します。
+func (r *Runner) RunRequest(ctx context.Context, req RunRequest) (RunResponse, error) {
+	vars := r.Vars
+	if len(req.Vars) > 0 {
+		vars = maps.Clone(r.Vars)
+		if vars == nil {
+			vars = make(map[string]string, len(req.Vars))
+		}
+		maps.Copy(vars, req.Vars)
+	}
+	if req.Temperature != nil {
+		ctx = ai.WithTemperature(ctx, *req.Temperature)
+	}
+
+	result, err := r.run(ctx, req.Input, req.SourceName, req.Mode, req.Model, vars)
+	if err != nil {
+		return RunResponse{}, err
+	}
+	return RunResponse{
+		Text:             result.Text,
+		ModelName:        result.Response.ModelName,
+		Usage:            result.Response.Usage,
+		Elapsed:          result.Elapsed,
+		PromptBuildTime:  result.PromptBuildTime,
+		APITime:          result.APITime,
+		Retries:          result.Retries,
+		DetectedLanguage: result.DetectedLanguage,
+		TemplateName:     result.TemplateName,
+	}, nil
+}
@@ -0,0 +1,266 @@
+// Package runner は、入力からプロンプトを構築して AI モデルに渡すまでの一連の処理をまとめます。
+// CLI と HTTP サーバーの両方から同じ処理を利用するための共通層です。
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+)
+
+// ErrEmptyInput は、入力が空または空白のみであることを示します。
+var ErrEmptyInput = errors.New("入力が空です。処理するテキストを指定してください")
+
+// ErrInputTooLarge は、入力が MaxInputBytes を超えていることを示します。
+var ErrInputTooLarge = errors.New("入力が大きすぎます")
+
+// Runner は、プロンプトの構築とコンテンツ生成を実行します。
+// フィールドは生成後に変更せず、Run は複数の goroutine から同時に呼び出せます。
+type Runner struct {
+	generator ai.Generator
+	builder   prompts.Builder
+
+	// Timeout は 1 回の Run に適用するタイムアウトです。ゼロの場合は呼び出し元のコンテキストのみに従います。
+	Timeout time.Duration
+	// ContextWarningRatio は、プロンプトのトークン数がモデルのコンテキストウィンドウのこの割合を超えたときに警告する閾値です。
+	// ゼロの場合は DefaultContextWarningRatio を使用します。
+	ContextWarningRatio float64
+	// MaxInputBytes は受け付ける入力の最大バイト数です。ゼロの場合は無制限です。
+	MaxInputBytes int
+	// Vars はテンプレートに {{.Vars.名前}} として渡す追加の変数です。
+	Vars map[string]string
+	// JSONSchema を指定すると、応答を JSON に限定して生成し (JSONGenerator が必要)、スキーマへの適合を検証します。
+	JSONSchema *JSONSchema
+	// Moderator を指定すると、入力をモデルへ送る前に確認し、拒否された場合は ErrModerationRejected を返します。
+	// nil の場合は確認しません。
+	Moderator Moderator
+	// StripFences が true の場合、応答全体を囲むコードブロックの区切り記号を取り除きます (StripCodeFences を参照)。
+	StripFences bool
+	// TrimResponse が true の場合、応答の前後の空白と、冒頭の FillerPhrases による前置きを取り除きます (TrimFiller を参照)。
+	// 応答の内容を書き換えるため、既定では無効です。
+	TrimResponse bool
+	// FillerPhrases は TrimResponse で取り除く前置きの言葉です。空の場合は空白のみを取り除きます (DefaultFillerPhrases を参照)。
+	FillerPhrases []string
+	// TemplateName を指定すると、ログと RunResult に記録するテンプレート名を、ビルダーから解決した名前の代わりにこの名前にします。
+	// 空の場合は ResolveTemplateName で解決した名前を使います。
+	TemplateName string
+}
+
+// NewRunner は Runner を初期化します。
+// builder が nil の場合、テンプレートを使わずに入力をそのままモデルへ渡します。
+func NewRunner(generator ai.Generator, builder prompts.Builder) *Runner {
+	return &Runner{
+		generator: generator,
+		builder:   builder,
+	}
+}
+
+// BuildFullPrompt は、入力とモードから最終的なプロンプトを構築します。
+// mode が空の場合は、入力をそのままプロンプトとして返します。
+func (r *Runner) BuildFullPrompt(input, sourceName, mode string) (string, error) {
+	return r.buildPrompt(input, sourceName, mode, r.Vars)
+}
+
+// ResolveTemplateName は、mode のプロンプトの構築に使うテンプレートの名前を返します。
+// TemplateName が指定されていればその名前を、ビルダーが prompts.TemplateResolver を実装していれば実際に使うテンプレートの名前を、
+// それ以外はモード名を返します。mode が空の場合 (テンプレートを使わない場合) は空文字列を返します。
+func (r *Runner) ResolveTemplateName(mode string) string {
+	if mode == "" {
+		return ""
+	}
+	if r.TemplateName != "" {
+		return r.TemplateName
+	}
+	if resolver, ok := r.builder.(prompts.TemplateResolver); ok {
+		if name, ok := resolver.GetTemplate(mode); ok {
+			return name
+		}
+	}
+	return mode
+}
+
+// buildPrompt は、vars をテンプレートの変数として BuildFullPrompt と同じ処理を行います。
+func (r *Runner) buildPrompt(input, sourceName, mode string, vars map[string]string) (string, error) {
+	if mode == "" {
+		return input, nil
+	}
+	if r.builder == nil {
+		return "", fmt.Errorf("モード '%s' が指定されましたが、プロンプトビルダーが設定されていません", mode)
+	}
+
+	data := prompts.NewTemplateData(input, sourceName)
+	data.Vars = vars
+	finalPrompt, err := r.builder.Build(data, mode)
+	if err != nil {
+		return "", fmt.Errorf("プロンプトの構築に失敗しました: %w", err)
+	}
+	return finalPrompt, nil
+}
+
+// RunResult は RunWithResult の実行結果と、処理時間の内訳です。
+type RunResult struct {
+	// Response はモデルの応答です。Text は後処理 (TrimResponse と StripFences) 済みです。
+	Response *ai.Response
+	// Text は Response.Text と同じ、出力するテキストです。
+	Text string
+	// Elapsed は入力の検証から後処理の完了までにかかった時間です。
+	Elapsed time.Duration
+	// PromptBuildTime はプロンプトの構築にかかった時間です。
+	PromptBuildTime time.Duration
+	// APITime はモデルの呼び出し (リトライの待機を含む) にかかった時間です。
+	APITime time.Duration
+	// Retries はモデルの呼び出しでリトライした回数です。ジェネレーターが呼び出し回数を記録しない場合はゼロです。
+	Retries int
+	// Remaining は処理完了時点で残っていたタイムアウトの時間です。Timeout も呼び出し元の期限もない場合はゼロです。
+	Remaining time.Duration
+	// DetectedLanguage は入力から推定した言語コード (ja, en など) です。推定できなかった場合は空文字列です (DetectLanguage を参照)。
+	DetectedLanguage string
+	// TemplateName はプロンプトの構築に使ったテンプレートの名前です。テンプレートを使わなかった場合は空文字列です (ResolveTemplateName を参照)。
+	TemplateName string
+}
+
+// Run は、入力からプロンプトを構築し、指定モデルでコンテンツを生成します。
+// 処理時間の内訳が必要な場合は RunWithResult を使用してください。
+func (r *Runner) Run(ctx context.Context, input, sourceName, mode, modelName string) (*ai.Response, error) {
+	result, err := r.RunWithResult(ctx, input, sourceName, mode, modelName)
+	if err != nil {
+		return nil, err
+	}
+	return result.Response, nil
+}
+
+// RunWithResult は Run と同じ処理を行い、応答とともにプロンプト構築と API 呼び出しそれぞれの所要時間、
+// リトライ回数、残りのタイムアウト時間を返します。
+func (r *Runner) RunWithResult(ctx context.Context, input, sourceName, mode, modelName string) (*RunResult, error) {
+	return r.run(ctx, input, sourceName, mode, modelName, r.Vars)
+}
+
+// run は、vars をテンプレートの変数として RunWithResult の処理を実行します。
+func (r *Runner) run(ctx context.Context, input, sourceName, mode, modelName string, vars map[string]string) (*RunResult, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, ErrEmptyInput
+	}
+	if err := r.checkInputSize(len(input)); err != nil {
+		return nil, err
+	}
+	if err := r.moderate(input); err != nil {
+		return nil, err
+	}
+
+	detectedLanguage := DetectLanguage(input)
+	slog.DebugContext(ctx, "入力の言語を推定しました", "language", detectedLanguage)
+
+	start := time.Now()
+	finalPrompt, err := r.buildPrompt(input, sourceName, mode, vars)
+	if err != nil {
+		return nil, err
+	}
+	promptBuildTime := time.Since(start)
+
+	templateName := r.ResolveTemplateName(mode)
+	r.logPromptLength(ctx, finalPrompt, modelName, templateName)
+
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	apiStart := time.Now()
+	resp, err := r.generate(ctx, finalPrompt, modelName)
+	if err != nil {
+		return nil, fmt.Errorf("AIコンテンツ生成中にエラーが発生しました: %w", err)
+	}
+	apiTime := time.Since(apiStart)
+
+	// 前置きの後ろにコードブロックが続く応答もあるため、前置きを先に取り除きます
+	if r.TrimResponse {
+		resp.Text = TrimFiller(resp.Text, r.FillerPhrases)
+		for i, candidate := range resp.Candidates {
+			resp.Candidates[i] = TrimFiller(candidate, r.FillerPhrases)
+		}
+	}
+	if r.StripFences {
+		resp.Text = StripCodeFences(resp.Text)
+		for i, candidate := range resp.Candidates {
+			resp.Candidates[i] = StripCodeFences(candidate)
+		}
+	}
+	if r.JSONSchema != nil {
+		if err := r.JSONSchema.Validate(StripCodeFences(resp.Text)); err != nil {
+			return nil, err
+		}
+	}
+	resp.Elapsed = time.Since(start)
+
+	result := &RunResult{
+		Response:         resp,
+		Text:             resp.Text,
+		Elapsed:          resp.Elapsed,
+		PromptBuildTime:  promptBuildTime,
+		APITime:          apiTime,
+		Retries:          max(resp.Attempts-1, 0),
+		DetectedLanguage: detectedLanguage,
+		TemplateName:     templateName,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		result.Remaining = max(time.Until(deadline), 0)
+	}
+	return result, nil
+}
+
+// generate は、JSONSchema の指定に応じて GenerateContent または GenerateJSON を呼び出します。
+func (r *Runner) generate(ctx context.Context, prompt, modelName string) (*ai.Response, error) {
+	if r.JSONSchema == nil {
+		return r.generator.GenerateContent(ctx, prompt, modelName)
+	}
+	jg, ok := r.generator.(JSONGenerator)
+	if !ok {
+		return nil, ErrJSONUnsupported
+	}
+	return jg.GenerateJSON(ctx, prompt, modelName, r.JSONSchema.Document)
+}
+
+// logPromptLength は、最終的なプロンプトの長さと使ったテンプレートを記録し、モデルのコンテキストウィンドウに近い場合は警告します。
+// トークン数はまず ai.EstimateTokens で見積もり、上限に近い場合だけ CountTokens で数えて確かめます。
+// 数えられない場合 (CountTokens に対応していないプロバイダやオフラインの場合) は、見積もりのまま判定します。
+func (r *Runner) logPromptLength(ctx context.Context, prompt, modelName, templateName string) {
+	runes := utf8.RuneCountInString(prompt)
+	tokens := ai.EstimateTokens(prompt)
+	slog.InfoContext(ctx, "プロンプトを構築しました", "model", modelName, "template", templateName, "runes", runes, "estimated_tokens", tokens)
+
+	ratio := r.ContextWarningRatio
+	if ratio <= 0 {
+		ratio = DefaultContextWarningRatio
+	}
+	limit, near := isNearContextLimit(modelName, tokens, ratio)
+	if !near {
+		return
+	}
+	estimated := true
+	if counted, err := r.generator.CountTokens(ctx, prompt, modelName); err != nil {
+		slog.DebugContext(ctx, "トークン数を数えられないため、見積もりで判定します", "model", modelName, "error", err)
+	} else {
+		tokens, estimated = int(counted), false
+		if limit, near = isNearContextLimit(modelName, tokens, ratio); !near {
+			return
+		}
+	}
+	slog.WarnContext(ctx, "プロンプトがモデルのコンテキストウィンドウの上限に近づいています。応答が途中で切れたりブロックされたりする可能性があります",
+		"model", modelName, "tokens", tokens, "estimated", estimated, "context_window", limit, "ratio", ratio)
+}
+
+// checkInputSize は、入力のバイト数が MaxInputBytes 以下であることを確認します。
+func (r *Runner) checkInputSize(size int) error {
+	if r.MaxInputBytes > 0 && size > r.MaxInputBytes {
+		return fmt.Errorf("%w (%d バイト、上限 %d バイト)。summarize の --chunk-size で分割して処理することを検討してください", ErrInputTooLarge, size, r.MaxInputBytes)
+	}
+	return nil
+}
@@ -0,0 +1,646 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shouni/go-ai-client/v2/pkg/ai"
+	"github.com/shouni/go-ai-client/v2/pkg/ai/gemini"
+	"github.com/shouni/go-ai-client/v2/pkg/prompts"
+)
+
+// stubGenerator は、受け取ったプロンプトを記録して固定の応答を返す ai.Generator です。
+type stubGenerator struct {
+	text        string
+	err         error
+	lastPrompt  string
+	lastModel   string
+	hasDeadline bool
+	// lastTemperature は ai.WithTemperature で指定された温度です。指定がなければ nil です。
+	lastTemperature *float32
+	// attempts と delay は、応答に記録する呼び出し回数と応答までの待ち時間です。
+	attempts int
+	delay    time.Duration
+}
+
+func (s *stubGenerator) GenerateContent(ctx context.Context, prompt, modelName string) (*ai.Response, error) {
+	s.lastPrompt = prompt
+	s.lastModel = modelName
+	_, s.hasDeadline = ctx.Deadline()
+	s.lastTemperature = nil
+	if t, ok := ai.TemperatureFromContext(ctx); ok {
+		s.lastTemperature = &t
+	}
+	time.Sleep(s.delay)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &ai.Response{Text: s.text, ModelName: modelName, Attempts: s.attempts}, nil
+}
+
+func (s *stubGenerator) CountTokens(ctx context.Context, text, modelName string) (int32, error) {
+	return int32(len(text)), nil
+}
+
+func newTestBuilder(t *testing.T) prompts.Builder {
+	t.Helper()
+	builder, err := prompts.NewPromptBuilderFromTemplates(map[string]string{
+		"echo": "source={{.SourceName}} content={{.Content}}",
+	})
+	if err != nil {
+		t.Fatalf("ビルダーの初期化に失敗しました: %v", err)
+	}
+	return builder
+}
+
+func TestRunner_Run(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		wantPrompt string
+	}{
+		{"モード未指定の場合は入力をそのまま渡す", "", "hello"},
+		{"モード指定時はテンプレートを適用する", "echo", "source=stdin content=hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := &stubGenerator{text: "ok"}
+			r := NewRunner(gen, newTestBuilder(t))
+
+			resp, err := r.Run(context.Background(), "hello", "stdin", tt.mode, "test-model")
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if resp.Text != "ok" {
+				t.Errorf("応答が不正です: %q", resp.Text)
+			}
+			if gen.lastPrompt != tt.wantPrompt {
+				t.Errorf("プロンプトが不正です\n  got: %q\n  want: %q", gen.lastPrompt, tt.wantPrompt)
+			}
+			if gen.lastModel != "test-model" {
+				t.Errorf("モデル名が不正です: %q", gen.lastModel)
+			}
+			if resp.Elapsed <= 0 {
+				t.Errorf("処理時間が記録されるべきです: %v", resp.Elapsed)
+			}
+		})
+	}
+}
+
+func TestRunner_Run_Errors(t *testing.T) {
+	t.Run("空の入力はモデルを呼ばずにエラーを返す", func(t *testing.T) {
+		gen := &stubGenerator{}
+		_, err := NewRunner(gen, nil).Run(context.Background(), "  \n", "stdin", "", "m")
+		if !errors.Is(err, ErrEmptyInput) || gen.lastPrompt != "" {
+			t.Errorf("空の入力はエラーになるべきです (err: %v)", err)
+		}
+	})
+
+	t.Run("未知のモードはエラーを返す", func(t *testing.T) {
+		_, err := NewRunner(&stubGenerator{}, newTestBuilder(t)).Run(context.Background(), "hello", "stdin", "unknown", "m")
+		if err == nil || !strings.Contains(err.Error(), "プロンプトの構築に失敗しました") {
+			t.Errorf("未知のモードはエラーになるべきです (err: %v)", err)
+		}
+	})
+
+	t.Run("生成エラーはラップして返す", func(t *testing.T) {
+		sentinel := errors.New("boom")
+		_, err := NewRunner(&stubGenerator{err: sentinel}, nil).Run(context.Background(), "hello", "stdin", "", "m")
+		if !errors.Is(err, sentinel) {
+			t.Errorf("元のエラーを保持するべきです (err: %v)", err)
+		}
+	})
+}
+
+func TestRunner_Run_Timeout(t *testing.T) {
+	gen := &stubGenerator{text: "ok"}
+	r := NewRunner(gen, nil)
+	r.Timeout = time.Minute
+
+	if _, err := r.Run(context.Background(), "hello", "stdin", "", "m"); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if !gen.hasDeadline {
+		t.Error("Timeout 指定時はコンテキストに期限が設定されるべきです")
+	}
+}
+
+func TestRunner_RunWithResult(t *testing.T) {
+	gen := &stubGenerator{text: "```\nok\n```", attempts: 3, delay: 5 * time.Millisecond}
+	r := NewRunner(gen, newTestBuilder(t))
+	r.Timeout = time.Minute
+	r.StripFences = true
+
+	result, err := r.RunWithResult(context.Background(), "hello", "stdin", "echo", "m")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if result.Text != "ok" || result.Response.Text != "ok" {
+		t.Errorf("後処理済みのテキストが返されるべきです: %q", result.Text)
+	}
+	if result.Retries != 2 {
+		t.Errorf("リトライ回数は呼び出し回数 - 1 であるべきです: %d", result.Retries)
+	}
+	if result.APITime < gen.delay {
+		t.Errorf("API の所要時間が記録されるべきです: %v", result.APITime)
+	}
+	if result.Elapsed < result.PromptBuildTime+result.APITime {
+		t.Errorf("全体の所要時間は内訳の合計以上であるべきです (elapsed: %v, build: %v, api: %v)", result.Elapsed, result.PromptBuildTime, result.APITime)
+	}
+	if result.Remaining <= 0 || result.Remaining > r.Timeout {
+		t.Errorf("残りのタイムアウト時間が不正です: %v", result.Remaining)
+	}
+	if result.TemplateName != "echo" {
+		t.Errorf("使ったテンプレートの名前が記録されるべきです: %q", result.TemplateName)
+	}
+
+	t.Run("TemplateName で表示名を上書きできる", func(t *testing.T) {
+		r := NewRunner(&stubGenerator{text: "ok"}, newTestBuilder(t))
+		r.TemplateName = "custom"
+		result, err := r.RunWithResult(context.Background(), "hello", "stdin", "echo", "m")
+		if err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+		if result.TemplateName != "custom" {
+			t.Errorf("TemplateName が優先されるべきです: %q", result.TemplateName)
+		}
+	})
+
+	t.Run("期限がない場合は残り時間がゼロ", func(t *testing.T) {
+		result, err := NewRunner(&stubGenerator{text: "ok"}, nil).RunWithResult(context.Background(), "hello", "stdin", "", "m")
+		if err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+		if result.Remaining != 0 || result.Retries != 0 {
+			t.Errorf("残り時間とリトライ回数はゼロであるべきです (remaining: %v, retries: %d)", result.Remaining, result.Retries)
+		}
+		if result.TemplateName != "" {
+			t.Errorf("テンプレートを使わない場合は名前が空であるべきです: %q", result.TemplateName)
+		}
+	})
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		maxChars      int
+		maxLines      int
+		want          string
+		wantTruncated bool
+	}{
+		{"上限なし", "abc\ndef", 0, 0, "abc\ndef", false},
+		{"文字数の上限以下", "こんにちは", 5, 0, "こんにちは", false},
+		{"マルチバイト文字を文字単位で切る", "こんにちは世界", 5, 0, "こんにちは", true},
+		{"行数で切る", "1行目\n2行目\n3行目", 0, 2, "1行目\n2行目", true},
+		{"末尾の改行だけなら切らない", "1行目\n2行目\n", 0, 2, "1行目\n2行目\n", false},
+		{"行数と文字数の両方", "abcdef\nghi\njkl", 4, 2, "abcd", true},
+		{"結合文字を切り離さない", "か\u3099き", 1, 0, "", true},
+		{"結合文字の後で切る", "か\u3099き", 2, 0, "か\u3099", true},
+		{"ゼロ幅接合子でつながった絵文字を切り離さない", "a👨\u200d👩", 3, 0, "a", true},
+		{"異体字セレクタを切り離さない", "a❤\ufe0fb", 2, 0, "a", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := TruncateText(tt.input, tt.maxChars, tt.maxLines)
+			if got != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("TruncateText(%q, %d, %d) = (%q, %v), want (%q, %v)", tt.input, tt.maxChars, tt.maxLines, got, truncated, tt.want, tt.wantTruncated)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("切り詰めた結果が不正な UTF-8 です: %q", got)
+			}
+		})
+	}
+}
+
+func TestRunner_Run_StripFences(t *testing.T) {
+	gen := &stubGenerator{text: "```json\n{}\n```"}
+	r := NewRunner(gen, nil)
+	r.StripFences = true
+
+	resp, err := r.Run(context.Background(), "hello", "stdin", "", "m")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if resp.Text != "{}" {
+		t.Errorf("コードブロックが除去されるべきです: %q", resp.Text)
+	}
+}
+
+func TestTrimFiller(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"前後の空白", "  \n答えは 42 です。\n\n", "答えは 42 です。"},
+		{"コロンで終わる前置きの行", "Sure, here is the summary:\n\nThe report covers Q3.", "The report covers Q3."},
+		{"句読点が続く前置き", "Certainly! The answer is 42.", "The answer is 42."},
+		{"大文字と小文字を区別しない", "OF COURSE. Done.", "Done."},
+		{"Here is で始まる前置きの行", "Here's the translation:\nBonjour", "Bonjour"},
+		{"日本語の前置きの連続", "承知しました。以下が翻訳です：\nHello", "Hello"},
+		{"コードブロックの前置き", "Sure! Here is the JSON:\n```json\n{}\n```", "```json\n{}\n```"},
+		{"単語の途中で一致", "Surely this works.", "Surely this works."},
+		{"本文の一部", "Here is why it fails.", "Here is why it fails."},
+		{"前置きで始まらない", "以下は重要な点です。", "以下は重要な点です。"},
+		{"取り除くと何も残らない", "Sure!", "Sure!"},
+		{"本文のないコロンの行", "Here are the results:", "Here are the results:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimFiller(tt.input, DefaultFillerPhrases); got != tt.want {
+				t.Errorf("TrimFiller(%q)\n  got: %q\n  want: %q", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	if got := TrimFiller("  Sure! ok  ", nil); got != "Sure! ok" {
+		t.Errorf("前置きの言葉を指定しない場合は空白のみを取り除くべきです: %q", got)
+	}
+}
+
+func TestRunner_Run_TrimResponse(t *testing.T) {
+	gen := &stubGenerator{text: "  Sure, here is the JSON:\n```json\n{}\n```\n"}
+	r := NewRunner(gen, nil)
+
+	resp, err := r.Run(context.Background(), "hello", "stdin", "", "m")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if resp.Text != gen.text {
+		t.Errorf("既定では応答を変更すべきではありません: %q", resp.Text)
+	}
+
+	r.TrimResponse = true
+	r.FillerPhrases = DefaultFillerPhrases
+	r.StripFences = true
+	resp, err = r.Run(context.Background(), "hello", "stdin", "", "m")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if resp.Text != "{}" {
+		t.Errorf("前置きとコードブロックが除去されるべきです: %q", resp.Text)
+	}
+}
+
+func TestRunner_Run_MaxInputBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     int
+		input   string
+		wantErr bool
+	}{
+		{"上限以下は通す", 5, "hello", false},
+		{"上限を超えるとエラー", 4, "hello", true},
+		{"ゼロは無制限", 0, strings.Repeat("a", 1<<16), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := &stubGenerator{text: "ok"}
+			r := NewRunner(gen, nil)
+			r.MaxInputBytes = tt.max
+
+			_, err := r.Run(context.Background(), tt.input, "stdin", "", "m")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInputTooLarge) {
+					t.Errorf("ErrInputTooLarge が返されるべきです (err: %v)", err)
+				}
+				if gen.lastPrompt != "" {
+					t.Error("上限を超えた場合はモデルを呼び出すべきではありません")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsNearContextLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		tokens    int
+		ratio     float64
+		wantNear  bool
+		wantLimit int
+	}{
+		{"上限の割合以下", "gpt-4o", 115200, 0.9, false, 128000},
+		{"上限の割合を超える", "gpt-4o", 115201, 0.9, true, 128000},
+		{"models/ 接頭辞を無視する", "models/gpt-4o", 128000, 0.5, true, 128000},
+		{"未知のモデルは判定しない", "unknown-model", 1 << 30, 0.9, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, near := isNearContextLimit(tt.model, tt.tokens, tt.ratio)
+			if near != tt.wantNear || limit != tt.wantLimit {
+				t.Errorf("isNearContextLimit() = (%d, %v), want (%d, %v)", limit, near, tt.wantLimit, tt.wantNear)
+			}
+		})
+	}
+}
+
+// stubJSONGenerator は GenerateJSON に対応した stubGenerator です。
+type stubJSONGenerator struct {
+	stubGenerator
+	lastSchema any
+}
+
+func (s *stubJSONGenerator) GenerateJSON(ctx context.Context, prompt, modelName string, schema any) (*ai.Response, error) {
+	s.lastSchema = schema
+	return s.GenerateContent(ctx, prompt, modelName)
+}
+
+func TestRunner_Run_JSONSchema(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{
+		"type": "object",
+		"properties": {"name": {"type": "string"}},
+		"required": ["name"]
+	}`))
+	if err != nil {
+		t.Fatalf("スキーマの解析に失敗しました: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{"スキーマに適合する応答", `{"name": "zunda"}`, false},
+		{"コードブロックで囲まれていても検証する", "```json\n{\"name\": \"zunda\"}\n```", false},
+		{"必須プロパティが欠けた応答", `{"age": 3}`, true},
+		{"JSON ではない応答", `not json`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := &stubJSONGenerator{stubGenerator: stubGenerator{text: tt.text}}
+			r := NewRunner(gen, nil)
+			r.JSONSchema = schema
+
+			_, err := r.Run(context.Background(), "extract", "stdin", "", "m")
+			if tt.wantErr != errors.Is(err, ErrSchemaMismatch) {
+				t.Errorf("ErrSchemaMismatch の有無が期待と異なります (err: %v)", err)
+			}
+			if gen.lastSchema == nil {
+				t.Error("スキーマ文書が GenerateJSON に渡されるべきです")
+			}
+		})
+	}
+
+	t.Run("GenerateJSON 非対応のクライアントはエラー", func(t *testing.T) {
+		r := NewRunner(&stubGenerator{text: "{}"}, nil)
+		r.JSONSchema = schema
+		if _, err := r.Run(context.Background(), "extract", "stdin", "", "m"); !errors.Is(err, ErrJSONUnsupported) {
+			t.Errorf("ErrJSONUnsupported が返されるべきです (err: %v)", err)
+		}
+	})
+}
+
+// TestRunner_Run_JSONSchema_GeminiFencedReply は、Gemini のクライアントがコードブロックで囲んだ JSON を返しても、
+// GenerateJSON がそれを取り除き、スキーマの検証まで通ることを確かめます。
+func TestRunner_Run_JSONSchema_GeminiFencedReply(t *testing.T) {
+	reply := "```json\n{\"name\": \"zunda\"}\n```"
+	body, err := json.Marshal(map[string]any{"candidates": []any{map[string]any{
+		"content":      map[string]any{"role": "model", "parts": []any{map[string]string{"text": reply}}},
+		"finishReason": "STOP",
+	}}})
+	if err != nil {
+		t.Fatalf("応答の組み立てに失敗しました: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client, err := gemini.NewClient(context.Background(), gemini.Config{APIKey: "dummy-key", BaseURL: server.URL, DisableRetries: true})
+	if err != nil {
+		t.Fatalf("クライアントの初期化に失敗しました: %v", err)
+	}
+	schema, err := ParseJSONSchema([]byte(`{"type": "object", "required": ["name"]}`))
+	if err != nil {
+		t.Fatalf("スキーマの解析に失敗しました: %v", err)
+	}
+	r := NewRunner(client, nil)
+	r.JSONSchema = schema
+
+	result, err := r.Run(context.Background(), "extract", "stdin", "", "m")
+	if err != nil {
+		t.Fatalf("コードブロックで囲まれた JSON も検証を通るべきです: %v", err)
+	}
+	if result.Text != `{"name": "zunda"}` {
+		t.Errorf("区切り記号を取り除いた JSON が返されるべきです: %q", result.Text)
+	}
+}
+
+func TestParseJSONSchema_Invalid(t *testing.T) {
+	if _, err := ParseJSONSchema([]byte(`{"type": 1}`)); err == nil {
+		t.Error("不正なスキーマはエラーになるべきです")
+	}
+	if _, err := ParseJSONSchema([]byte(`{`)); err == nil {
+		t.Error("JSON として不正なスキーマはエラーになるべきです")
+	}
+}
+
+func TestRunner_Run_Moderator(t *testing.T) {
+	tests := []struct {
+		name      string
+		moderator Moderator
+		input     string
+		wantErr   bool
+	}{
+		{"未設定の場合は確認しない", nil, "secret", false},
+		{"NoopModerator はすべて許可する", NoopModerator{}, "secret", false},
+		{"禁止キーワードを含まない入力は許可する", NewKeywordModerator("secret"), "hello", false},
+		{"禁止キーワードは大文字小文字を区別せず拒否する", NewKeywordModerator("secret", " "), "This is SECRET", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := &stubGenerator{text: "ok"}
+			r := NewRunner(gen, nil)
+			r.Moderator = tt.moderator
+
+			_, err := r.Run(context.Background(), tt.input, "stdin", "", "m")
+			if tt.wantErr {
+				if !errors.Is(err, ErrModerationRejected) || !strings.Contains(err.Error(), "secret") {
+					t.Errorf("ErrModerationRejected と理由が返されるべきです (err: %v)", err)
+				}
+				if gen.lastPrompt != "" {
+					t.Error("拒否された入力はモデルに送られるべきではありません")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunner_RunRequest(t *testing.T) {
+	builder, err := prompts.NewPromptBuilderFromTemplates(map[string]string{
+		"greet": "{{.Vars.greeting}} {{.Vars.name}}: {{.Content}}",
+	})
+	if err != nil {
+		t.Fatalf("ビルダーの初期化に失敗しました: %v", err)
+	}
+	gen := &stubGenerator{text: "応答", attempts: 2}
+	r := NewRunner(gen, builder)
+	r.Vars = map[string]string{"greeting": "こんにちは", "name": "既定"}
+
+	temp := float32(0.2)
+	resp, err := r.RunRequest(context.Background(), RunRequest{
+		Input:       "hello",
+		Mode:        "greet",
+		Vars:        map[string]string{"name": "太郎"},
+		Model:       "test-model",
+		Temperature: &temp,
+	})
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if gen.lastPrompt != "こんにちは 太郎: hello" {
+		t.Errorf("リクエストの変数が Runner.Vars を上書きして適用されるべきです: %q", gen.lastPrompt)
+	}
+	if gen.lastModel != "test-model" || resp.ModelName != "test-model" {
+		t.Errorf("指定したモデルが使われるべきです: %q / %q", gen.lastModel, resp.ModelName)
+	}
+	if gen.lastTemperature == nil || *gen.lastTemperature != temp {
+		t.Errorf("温度の上書きがジェネレーターに渡されるべきです: %v", gen.lastTemperature)
+	}
+	if resp.Text != "応答" || resp.Retries != 1 {
+		t.Errorf("期待される応答ではありません: %+v", resp)
+	}
+	if r.Vars["name"] != "既定" {
+		t.Errorf("Runner.Vars が変更されてはいけません: %v", r.Vars)
+	}
+
+	// 温度を指定しない場合はクライアントの設定に任せる
+	if _, err := r.RunRequest(context.Background(), RunRequest{Input: "hello", Model: "test-model"}); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if gen.lastTemperature != nil {
+		t.Errorf("温度を指定しない場合は上書きされるべきではありません: %v", *gen.lastTemperature)
+	}
+
+	if _, err := r.RunRequest(context.Background(), RunRequest{Input: " ", Model: "test-model"}); !errors.Is(err, ErrEmptyInput) {
+		t.Errorf("空の入力は ErrEmptyInput を返すべきです: %v", err)
+	}
+}
+
+func TestStripHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "入れ子のタグを取り除いてテキストを残す",
+			input: `<div class="post"><p>Go は<b>シンプルで<i>高速</i></b>な言語です。</p><p>詳しくは<a href="https://go.dev">公式サイト</a>へ。</p></div>`,
+			want:  "Go はシンプルで高速な言語です。\n\n詳しくは公式サイトへ。",
+		},
+		{
+			name:  "リストの項目は1行ずつ、ソース中の改行とインデントは空白として扱う",
+			input: "<ul>\n  <li>one</li>\n  <li><span>two <em>and\n   more</em></span></li>\n</ul>",
+			want:  "one\ntwo and more",
+		},
+		{
+			name:  "script と style の中身を取り除く",
+			input: "<html><head><style>p{color:red}</style></head><body><script>alert('x')</script><h1>見出し</h1>本文<br>次の行</body></html>",
+			want:  "見出し\n\n本文\n次の行",
+		},
+		{
+			name:  "文字参照を元の文字に戻す",
+			input: "<p>a &lt; b &amp;&amp; c &gt; d</p>",
+			want:  "a < b && c > d",
+		},
+		{
+			name:  "閉じていないタグも読める範囲で処理する",
+			input: "<div><p>閉じていない<b>段落",
+			want:  "閉じていない段落",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripHTML(tt.input); got != tt.want {
+				t.Errorf("StripHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlattenMarkdown(t *testing.T) {
+	input := "# タイトル\n\n**太字**と*斜体*と`code`、[リンク](https://example.com)と![画像](a.png)。\n\n---\n\n> 引用\n\n- snake_case_name\n\n```go\n**x** := 1\n```\n"
+	want := "タイトル\n\n太字と斜体とcode、リンクと画像。\n\n引用\n\n- snake_case_name\n\n**x** := 1"
+	if got := FlattenMarkdown(input); got != want {
+		t.Errorf("FlattenMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestConvertInput(t *testing.T) {
+	if got, err := ConvertInput("<b>x</b>", InputFormatRaw); err != nil || got != "<b>x</b>" {
+		t.Errorf("raw は入力をそのまま返すべきです: %q (err: %v)", got, err)
+	}
+	if got, err := ConvertInput("<b>x</b>", InputFormatHTML); err != nil || got != "x" {
+		t.Errorf("html はタグを取り除くべきです: %q (err: %v)", got, err)
+	}
+	if _, err := ParseInputFormat("pdf"); err == nil {
+		t.Error("不明な形式はエラーを返すべきです")
+	}
+	if f, err := ParseInputFormat(""); err != nil || f != InputFormatRaw {
+		t.Errorf("空文字列は raw として扱うべきです: %q (err: %v)", f, err)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Go言語の並行処理について説明してください。", "ja"},
+		{"カタカナだけのテキスト", "ja"},
+		{"我们今天去公园散步。", "zh"},
+		{"오늘은 날씨가 좋습니다.", "ko"},
+		{"Привет, как дела?", "ru"},
+		{"The quick brown fox jumps over the lazy dog and it is fast.", "en"},
+		{"El perro de la casa es muy grande y los niños lo quieren.", "es"},
+		{"Le chat est dans la maison et il ne veut pas sortir.", "fr"},
+		{"Der Hund ist nicht in dem Haus und die Katze auch nicht.", "de"},
+		{"GoのAPIをcallする", "ja"},
+		{"12345 !?", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := DetectLanguage(tt.text); got != tt.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRunner_RunWithResult_DetectedLanguage(t *testing.T) {
+	r := NewRunner(&stubGenerator{text: "ok"}, nil)
+	result, err := r.RunWithResult(context.Background(), "これは日本語の入力です。", "stdin", "", "test-model")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if result.DetectedLanguage != "ja" {
+		t.Errorf("DetectedLanguage = %q, want %q", result.DetectedLanguage, "ja")
+	}
+}